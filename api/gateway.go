@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/ratelimit"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	"github.com/0x726f6f6b6965/task/internal/services"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// errorHandler - reply 412 Precondition Failed for the etag mismatches
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if isEtagMismatch(err) {
+		err = &runtime.HTTPStatusError{HTTPStatus: http.StatusPreconditionFailed, Err: err}
+	}
+	if delay, ok := retryDelay(err); ok {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((delay+time.Second-1)/time.Second), 10))
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
+
+// retryDelay - get the delay of the RetryInfo of a rate limited call, e.g. for its Retry-After header
+func retryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if retry, ok := detail.(*errdetails.RetryInfo); ok {
+			return retry.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+func isEtagMismatch(err error) bool {
+	var customStatus *runtime.HTTPStatusError
+	if errors.As(err, &customStatus) {
+		return false
+	}
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.FailedPrecondition {
+		return false
+	}
+	for _, detail := range st.Details() {
+		failure, ok := detail.(*errdetails.PreconditionFailure)
+		if !ok {
+			continue
+		}
+		for _, v := range failure.GetViolations() {
+			if v.GetType() == helper.EtagViolation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headerMatcher - forward the X-Actor, X-Tenant, X-Api-Key and Idempotency-Key headers as the x-actor, x-tenant,
+// x-api-key and idempotency-key metadata besides the default headers, which have the Authorization header
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, auth.APIKeyHeader) {
+		return auth.APIKeyHeader, true
+	}
+	if strings.EqualFold(key, services.Actor) {
+		return services.Actor, true
+	}
+	if strings.EqualFold(key, services.Tenant) {
+		return services.Tenant, true
+	}
+	if strings.EqualFold(key, services.IdempotencyKey) {
+		return services.IdempotencyKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher - reply the rate limit metadata as the X-RateLimit-Limit, X-RateLimit-Remaining
+// and X-RateLimit-Reset headers, the other metadata has the Grpc-Metadata- prefix
+func outgoingHeaderMatcher(key string) (string, bool) {
+	switch key {
+	case ratelimit.LimitHeader, ratelimit.RemainingHeader, ratelimit.ResetHeader:
+		return key, true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// authenticate - reply UNAUTHENTICATED (HTTP 401) to the requests without valid credentials before they reach
+// the gRPC server, which authenticates the forwarded headers again
+func authenticate(interceptor *auth.Interceptor, mux *runtime.ServeMux, next http.Handler) http.Handler {
+	if !interceptor.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := metadata.MD{}
+		for _, key := range []string{auth.Authorization, auth.APIKeyHeader} {
+			if values := r.Header.Values(key); len(values) > 0 {
+				md.Set(key, values...)
+			}
+		}
+		ctx, err := interceptor.Authenticate(metadata.NewIncomingContext(r.Context(), md), r.Method+" "+r.URL.Path)
+		if err != nil {
+			_, marshaler := runtime.MarshalerForRequest(mux, r)
+			errorHandler(r.Context(), mux, marshaler, w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tenantPath - serve the paths under the resource name tenants/{tenant} as the paths without it
+// with the tenant in the X-Tenant header, e.g. /tenants/acme/tasks/1 is /tasks/1 of acme
+func tenantPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.EscapedPath(), "/tenants/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tenant, rest, _ := strings.Cut(rest, "/")
+		path, err := url.PathUnescape("/" + rest)
+		if err != nil || !repository.ValidTenant(tenant) {
+			http.Error(w, "tenant path invalid", http.StatusBadRequest)
+			return
+		}
+		if header := r.Header.Get(services.Tenant); header != "" && header != tenant {
+			http.Error(w, "tenant path and X-Tenant header differ", http.StatusBadRequest)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = path, "/"+rest
+		r.Header.Set(services.Tenant, tenant)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardEtag - set the ETag header when the response is a task
+func forwardEtag(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
+	if task, ok := resp.(*pbTask.Task); ok && task.GetEtag() != "" {
+		w.Header().Set("ETag", strconv.Quote(task.GetEtag()))
+	}
+	return nil
+}
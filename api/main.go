@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 
@@ -28,14 +29,26 @@ func main() {
 		return
 	}
 
-	mux, cleanup, err := initApplication(context.Background(), &cfg)
+	app, cleanup, err := initApplication(context.Background(), &cfg)
 	if err != nil {
 		log.Fatal("initialize application error", err)
 	}
 	defer cleanup()
 
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Grpc.Port))
+	if err != nil {
+		log.Fatalf("failed to listen; err: %v", err)
+		return
+	}
+	go func() {
+		log.Printf("grpc server listening; port: %d", cfg.Grpc.Port)
+		if err := app.grpcServer.Serve(lis); err != nil {
+			log.Fatalf("failed to serve grpc; err: %v", err)
+		}
+	}()
+
 	log.Printf("server listening; port: %d", cfg.Rest.Port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Rest.Port), mux); err != nil {
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Rest.Port), tenantPath(authenticate(app.auth, app.mux, app.mux))); err != nil {
 		log.Fatalf("failed to serve; err: %v", err)
 		return
 	}
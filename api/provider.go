@@ -2,30 +2,84 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
 
+	"github.com/0x726f6f6b6965/task/internal/archive"
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/authz"
 	"github.com/0x726f6f6b6965/task/internal/config"
+	"github.com/0x726f6f6b6965/task/internal/events"
 	zaplog "github.com/0x726f6f6b6965/task/internal/log"
+	"github.com/0x726f6f6b6965/task/internal/ratelimit"
+	"github.com/0x726f6f6b6965/task/internal/repository"
 	"github.com/0x726f6f6b6965/task/internal/services"
 	"github.com/0x726f6f6b6965/task/internal/utils"
+	"github.com/0x726f6f6b6965/task/internal/webhook"
+	"github.com/0x726f6f6b6965/task/internal/workflow"
 	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
 	"github.com/google/wire"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
-var applicationSet = wire.NewSet(componentSet, services.NewTaskService, newServer)
+type application struct {
+	grpcServer *grpc.Server
+	mux        *runtime.ServeMux
+	auth       *auth.Interceptor
+	purger     *services.Purger
+	archiver   *services.Archiver
+	dispatcher *webhook.Dispatcher
+}
+
+func newApplication(grpcServer *grpc.Server, mux *runtime.ServeMux, authn *auth.Interceptor, purger *services.Purger,
+	archiver *services.Archiver, dispatcher *webhook.Dispatcher) *application {
+	return &application{
+		grpcServer: grpcServer,
+		mux:        mux,
+		auth:       authn,
+		purger:     purger,
+		archiver:   archiver,
+		dispatcher: dispatcher,
+	}
+}
+
+var applicationSet = wire.NewSet(componentSet, services.NewTaskService, newGrpcServer, newServer, newApplication)
 
-var componentSet = wire.NewSet(generatorSet, loggerSet, dbSet)
+var componentSet = wire.NewSet(generatorSet, loggerSet, dbSet, pageTokenSet, workflowSet, trashSet, archiveSet, webhookSet, tenancySet, authSet, rateLimitSet)
 
 var loggerSet = wire.NewSet(logCfg, zaplog.NewLogger)
 
-var dbSet = wire.NewSet(redisCfg, redisClient)
+var dbSet = wire.NewSet(redisCfg, redisClient, taskRepository, eventReader)
 
 var generatorSet = wire.NewSet(generatorCfg, utils.NewGenerator)
 
+var pageTokenSet = wire.NewSet(pageTokenSigner)
+
+var workflowSet = wire.NewSet(taskWorkflow)
+
+var trashSet = wire.NewSet(trashOptions, startPurger)
+
+var archiveSet = wire.NewSet(archiveSink, archiveOptions, startArchiver)
+
+var webhookSet = wire.NewSet(webhookStore, startDispatcher)
+
+var tenancySet = wire.NewSet(tenantOptions, services.NewTenancy)
+
+var authSet = wire.NewSet(authInterceptor, authzPolicy)
+
+var rateLimitSet = wire.NewSet(rateLimiter)
+
 func logCfg(cfg *config.Config) *config.Log {
 	return &cfg.Log
 }
@@ -49,15 +103,325 @@ func redisClient(opt *redis.Options) (*redis.Client, func(), error) {
 	return client, func() { client.Close() }, nil
 }
 
-func newServer(ctx context.Context, server pbTask.TaskServiceServer, logger *zap.Logger) (*runtime.ServeMux, error) {
-	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
-		MarshalOptions: protojson.MarshalOptions{
-			EmitUnpopulated: true,
-			UseEnumNumbers:  true,
-		},
-	}))
+func taskRepository(ctx context.Context, cfg *config.Config, client *redis.Client, logger *zap.Logger) (repository.TaskRepository, func(), error) {
+	switch cfg.Storage.Driver {
+	case "", config.StorageRedis:
+		return repository.NewRedisRepository(client, logger), func() {}, nil
+	case config.StorageMemory:
+		return repository.NewMemoryRepository(), func() {}, nil
+	case config.StorageSQL:
+		db, err := sql.Open(cfg.SQL.Driver, cfg.SQL.DSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.SQL.MaxOpenConns > 0 {
+			db.SetMaxOpenConns(cfg.SQL.MaxOpenConns)
+		}
+		repo, err := repository.NewSQLRepository(ctx, db, cfg.SQL.Driver, logger)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return repo, func() { db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported storage driver: %s", cfg.Storage.Driver)
+	}
+}
+
+// eventReader - the task events are only published by the redis storage, it is nil with the others
+func eventReader(cfg *config.Config, client *redis.Client) services.EventReader {
+	if cfg.Storage.Driver != "" && cfg.Storage.Driver != config.StorageRedis {
+		return nil
+	}
+	return events.NewReader(client, events.Options{})
+}
+
+func pageTokenSigner(cfg *config.Config, logger *zap.Logger) (utils.PageTokenSigner, error) {
+	keys := make([]utils.SigningKey, 0, len(cfg.PageToken.Keys))
+	for _, key := range cfg.PageToken.Keys {
+		secret := key.Secret
+		if key.SecretEnv != "" {
+			if secret = os.Getenv(key.SecretEnv); secret == "" {
+				return nil, fmt.Errorf("page token key %s: environment variable %s is empty", key.ID, key.SecretEnv)
+			}
+		}
+		keys = append(keys, utils.SigningKey{ID: key.ID, Secret: []byte(secret)})
+	}
+	if len(keys) == 0 {
+		// the tokens of a random key only work on this instance until it restarts
+		logger.Warn("no page token signing key configured, use a random key")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		keys = append(keys, utils.SigningKey{ID: "random", Secret: secret})
+	}
+	return utils.NewPageTokenSigner(keys, cfg.PageToken.TTL)
+}
+
+func taskWorkflow(cfg *config.Config) (workflow.Workflow, error) {
+	return workflow.New(cfg.Workflow.Initial, cfg.Workflow.Transitions)
+}
+
+func trashOptions(cfg *config.Config) services.TrashOptions {
+	return services.TrashOptions{
+		Retention:     cfg.Trash.Retention,
+		PurgeInterval: cfg.Trash.PurgeInterval,
+		PurgeBatch:    cfg.Trash.PurgeBatch,
+	}
+}
+
+// startPurger - run the purger in the background until the application is cleaned up
+func startPurger(ctx context.Context, repo repository.TaskRepository, opts services.TrashOptions, logger *zap.Logger) (*services.Purger, func()) {
+	purger := services.NewPurger(repo, opts, logger)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		purger.Run(ctx)
+	}()
+	return purger, func() {
+		cancel()
+		<-done
+	}
+}
+
+// archiveSink - the archived tasks are indexed in redis with the redis storage, the others list the objects
+func archiveSink(cfg *config.Config, client *redis.Client) (archive.Sink, error) {
+	var index archive.Index
+	if cfg.Storage.Driver == "" || cfg.Storage.Driver == config.StorageRedis {
+		index = archive.NewRedisIndex(client)
+	}
+	switch cfg.Archive.Driver {
+	case "":
+		return nil, nil
+	case config.ArchiveFile:
+		store, err := archive.NewFileStore(cfg.Archive.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return archive.NewSink(store, index), nil
+	case config.ArchiveS3:
+		store, err := archive.NewS3Store(archive.S3Options{
+			Endpoint:  cfg.Archive.S3.Endpoint,
+			Region:    cfg.Archive.S3.Region,
+			Bucket:    cfg.Archive.S3.Bucket,
+			Prefix:    cfg.Archive.S3.Prefix,
+			AccessKey: cfg.Archive.S3.AccessKey,
+			SecretKey: cfg.Archive.S3.SecretKey,
+			PathStyle: cfg.Archive.S3.PathStyle,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return archive.NewSink(store, index), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive driver: %s", cfg.Archive.Driver)
+	}
+}
+
+func archiveOptions(cfg *config.Config) (services.ArchiveOptions, error) {
+	statuses := make([]pbTask.Status, 0, len(cfg.Archive.Statuses))
+	for _, name := range cfg.Archive.Statuses {
+		status, err := workflow.ParseStatus(name)
+		if err != nil {
+			return services.ArchiveOptions{}, err
+		}
+		statuses = append(statuses, status)
+	}
+	return services.ArchiveOptions{
+		After:    cfg.Archive.After,
+		Statuses: statuses,
+		Interval: cfg.Archive.Interval,
+		Batch:    cfg.Archive.Batch,
+	}, nil
+}
+
+// startArchiver - run the archiver in the background until the application is cleaned up,
+// it is nil without an archive sink
+func startArchiver(ctx context.Context, repo repository.TaskRepository, sink archive.Sink,
+	opts services.ArchiveOptions, logger *zap.Logger) (*services.Archiver, func()) {
+	if sink == nil {
+		return nil, func() {}
+	}
+	archiver := services.NewArchiver(repo, sink, opts, logger)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		archiver.Run(ctx)
+	}()
+	return archiver, func() {
+		cancel()
+		<-done
+	}
+}
+
+// webhookStore - the webhooks are kept in redis and get the events of the redis storage, it is nil with the others
+func webhookStore(cfg *config.Config, client *redis.Client) *webhook.Store {
+	if cfg.Storage.Driver != "" && cfg.Storage.Driver != config.StorageRedis {
+		return nil
+	}
+	return webhook.NewStore(client)
+}
+
+// startDispatcher - run the webhook dispatcher in the background until the application is cleaned up,
+// it is nil without a webhook store
+func startDispatcher(ctx context.Context, cfg *config.Config, store *webhook.Store, logger *zap.Logger) (*webhook.Dispatcher, func(), error) {
+	if store == nil {
+		return nil, func() {}, nil
+	}
+	// the name of the instance is unique among the instances sharing the redis
+	consumer := cfg.Name
+	if consumer == "" {
+		consumer, _ = os.Hostname()
+	}
+	dispatcher, err := webhook.NewDispatcher(store, nil, webhook.Options{
+		Consumer:    consumer,
+		MaxAttempts: cfg.Webhook.MaxAttempts,
+		Backoff:     cfg.Webhook.Backoff,
+		MaxBackoff:  cfg.Webhook.MaxBackoff,
+		Timeout:     cfg.Webhook.Timeout,
+		Interval:    cfg.Webhook.Interval,
+	}, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.Run(ctx)
+	}()
+	return dispatcher, func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+func tenantOptions(cfg *config.Config) services.TenantOptions {
+	return services.TenantOptions{
+		Required: cfg.Tenancy.Required,
+		MaxTasks: cfg.Tenancy.MaxTasks,
+		Quotas:   cfg.Tenancy.Quotas,
+	}
+}
+
+// authInterceptor - authenticate the calls with the api keys and the jwt bearer tokens of the config,
+// the calls are not authenticated without both
+func authInterceptor(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*auth.Interceptor, error) {
+	authenticators := []auth.Authenticator{}
+	if len(cfg.Auth.APIKeys) > 0 {
+		keys := make([]auth.APIKey, len(cfg.Auth.APIKeys))
+		for i, key := range cfg.Auth.APIKeys {
+			keys[i] = auth.APIKey{Subject: key.Subject, Key: key.Key, Tenant: key.Tenant, Roles: key.Roles}
+		}
+		authenticator, err := auth.NewAPIKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if jwt := cfg.Auth.JWT; jwt.JWKSFile != "" || jwt.JWKSURL != "" {
+		authenticator, err := auth.NewJWT(ctx, auth.JWTOptions{
+			JWKSFile:    jwt.JWKSFile,
+			JWKSURL:     jwt.JWKSURL,
+			Issuer:      jwt.Issuer,
+			Audience:    jwt.Audience,
+			TenantClaim: jwt.TenantClaim,
+			RolesClaim:  jwt.RolesClaim,
+			Refresh:     jwt.Refresh,
+			Leeway:      jwt.Leeway,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if len(authenticators) == 0 {
+		logger.Warn("authentication is disabled without auth.api-keys or auth.jwt")
+		return auth.NewInterceptor(nil, logger), nil
+	}
+	return auth.NewInterceptor(auth.Chain(authenticators...), logger), nil
+}
+
+// authzPolicy - authorize the calls with the roles of the config, the calls are not authorized without roles.
+// The roles are the ones of the identities, so the authorization needs the authentication
+func authzPolicy(cfg *config.Config, authn *auth.Interceptor, logger *zap.Logger) (*authz.Policy, error) {
+	roles := make(map[string]authz.Role, len(cfg.Authz.Roles))
+	for name, role := range cfg.Authz.Roles {
+		roles[name] = authz.Role{Methods: role.Methods, AllTasks: role.AllTasks}
+	}
+	policy, err := authz.NewPolicy(roles, cfg.Authz.DefaultRoles, logger)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Enabled() && !authn.Enabled() {
+		return nil, errors.New("authz.roles need the authentication of auth.api-keys or auth.jwt")
+	}
+	return policy, nil
+}
+
+// rateLimiter - limit the calls of every client with the token buckets in redis,
+// the calls are not limited without a rate
+func rateLimiter(cfg *config.Config, client *redis.Client, logger *zap.Logger) *ratelimit.Limiter {
+	limit := func(limit config.Limit) ratelimit.Limit {
+		return ratelimit.Limit{Rate: limit.Rate, Per: limit.Per, Burst: limit.Burst}
+	}
+	limits := func(def config.Limit, methods map[string]config.Limit) ratelimit.Limits {
+		result := ratelimit.Limits{Default: limit(def), Methods: make(map[string]ratelimit.Limit, len(methods))}
+		for method, value := range methods {
+			result.Methods[method] = limit(value)
+		}
+		return result
+	}
+	opts := ratelimit.Options{
+		Limits:         limits(cfg.RateLimit.Default, cfg.RateLimit.Methods),
+		Clients:        make(map[string]ratelimit.Limits, len(cfg.RateLimit.Clients)),
+		TrustedProxies: cfg.RateLimit.TrustedProxies,
+	}
+	for client, value := range cfg.RateLimit.Clients {
+		opts.Clients[client] = limits(value.Default, value.Methods)
+	}
+	return ratelimit.NewLimiter(client, opts, logger)
+}
+
+func grpcEndpoint(cfg *config.Config) string {
+	host := cfg.Grpc.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s:%d", host, cfg.Grpc.Port)
+}
+
+func newGrpcServer(server pbTask.TaskServiceServer, authn *auth.Interceptor, limiter *ratelimit.Limiter,
+	tenancy *services.Tenancy, policy *authz.Policy) (*grpc.Server, func()) {
+	// the client of the rate limits, the tenant and the roles of a call come from its identity
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authn.UnaryInterceptor, limiter.UnaryInterceptor, tenancy.UnaryInterceptor, policy.UnaryInterceptor),
+		grpc.ChainStreamInterceptor(authn.StreamInterceptor, limiter.StreamInterceptor, tenancy.StreamInterceptor, policy.StreamInterceptor),
+	)
+	pbTask.RegisterTaskServiceServer(grpcServer, server)
+	reflection.Register(grpcServer)
+	return grpcServer, func() { grpcServer.GracefulStop() }
+}
+
+func newServer(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*runtime.ServeMux, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				EmitUnpopulated: true,
+				UseEnumNumbers:  true,
+			},
+		}),
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithForwardResponseOption(forwardEtag),
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+	)
 
-	err := pbTask.RegisterTaskServiceHandlerServer(ctx, mux, server)
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	err := pbTask.RegisterTaskServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint(cfg), opts)
 	if err != nil {
 		logger.Error("failed to register", zap.Error(err))
 		return mux, err
@@ -8,9 +8,8 @@ import (
 
 	"github.com/0x726f6f6b6965/task/internal/config"
 	"github.com/google/wire"
-	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 )
 
-func initApplication(ctx context.Context, cfg *config.Config) (*runtime.ServeMux, func(), error) {
+func initApplication(ctx context.Context, cfg *config.Config) (*application, func(), error) {
 	panic(wire.Build(applicationSet))
 }
@@ -12,12 +12,16 @@ import (
 	"github.com/0x726f6f6b6965/task/internal/log"
 	"github.com/0x726f6f6b6965/task/internal/services"
 	"github.com/0x726f6f6b6965/task/internal/utils"
-	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+import (
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // Injectors from wire.go:
 
-func initApplication(ctx context.Context, cfg *config.Config) (*runtime.ServeMux, func(), error) {
+func initApplication(ctx context.Context, cfg *config.Config) (*application, func(), error) {
 	uint64_2 := generatorCfg(cfg)
 	generator, err := utils.NewGenerator(uint64_2)
 	if err != nil {
@@ -34,14 +38,91 @@ func initApplication(ctx context.Context, cfg *config.Config) (*runtime.ServeMux
 		cleanup()
 		return nil, nil, err
 	}
-	taskServiceServer := services.NewTaskService(generator, client, logger)
-	serveMux, err := newServer(ctx, taskServiceServer, logger)
+	repositoryTaskRepository, cleanup3, err := taskRepository(ctx, cfg, client, logger)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	utilsPageTokenSigner, err := pageTokenSigner(cfg, logger)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	workflow, err := taskWorkflow(cfg)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	servicesTrashOptions := trashOptions(cfg)
+	sink, err := archiveSink(cfg, client)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	servicesEventReader := eventReader(cfg, client)
+	store := webhookStore(cfg, client)
+	taskServiceServer := services.NewTaskService(generator, repositoryTaskRepository, utilsPageTokenSigner, workflow, servicesTrashOptions, sink, servicesEventReader, store, logger)
+	interceptor, err := authInterceptor(ctx, cfg, logger)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	limiter := rateLimiter(cfg, client, logger)
+	servicesTenantOptions := tenantOptions(cfg)
+	tenancy := services.NewTenancy(servicesTenantOptions)
+	policy, err := authzPolicy(cfg, interceptor, logger)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	server, cleanup4 := newGrpcServer(taskServiceServer, interceptor, limiter, tenancy, policy)
+	serveMux, err := newServer(ctx, cfg, logger)
+	if err != nil {
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	purger, cleanup5 := startPurger(ctx, repositoryTaskRepository, servicesTrashOptions, logger)
+	servicesArchiveOptions, err := archiveOptions(cfg)
+	if err != nil {
+		cleanup5()
+		cleanup4()
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	archiver, cleanup6 := startArchiver(ctx, repositoryTaskRepository, sink, servicesArchiveOptions, logger)
+	dispatcher, cleanup7, err := startDispatcher(ctx, cfg, store, logger)
 	if err != nil {
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 		return nil, nil, err
 	}
-	return serveMux, func() {
+	mainApplication := newApplication(server, serveMux, interceptor, purger, archiver, dispatcher)
+	return mainApplication, func() {
+		cleanup7()
+		cleanup6()
+		cleanup5()
+		cleanup4()
+		cleanup3()
 		cleanup2()
 		cleanup()
 	}, nil
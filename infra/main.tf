@@ -18,23 +18,25 @@ module "nginx" {
 }
 
 module "task_1" {
-  source          = "./modules/task"
-  task_image      = var.task_image
-  task_cfg        = "${path.cwd}/application-1.yaml"
-  env_config      = var.env_config
-  label_app       = "task-app-1"
-  service_name    = "taks-svc1"
-  deployment_name = "task-deployment-1"
-  depends_on      = [module.redis]
+  source            = "./modules/task"
+  task_image        = var.task_image
+  task_cfg          = "${path.cwd}/application-1.yaml"
+  env_config        = var.env_config
+  page_token_secret = var.page_token_secret
+  label_app         = "task-app-1"
+  service_name      = "taks-svc1"
+  deployment_name   = "task-deployment-1"
+  depends_on        = [module.redis]
 }
 
 module "task_2" {
-  source          = "./modules/task"
-  task_image      = var.task_image
-  task_cfg        = "${path.cwd}/application-2.yaml"
-  env_config      = var.env_config
-  label_app       = "task-app-2"
-  service_name    = "taks-svc2"
-  deployment_name = "task-deployment-2"
-  depends_on      = [module.redis]
+  source            = "./modules/task"
+  task_image        = var.task_image
+  task_cfg          = "${path.cwd}/application-2.yaml"
+  env_config        = var.env_config
+  page_token_secret = var.page_token_secret
+  label_app         = "task-app-2"
+  service_name      = "taks-svc2"
+  deployment_name   = "task-deployment-2"
+  depends_on        = [module.redis]
 }
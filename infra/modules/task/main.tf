@@ -30,6 +30,10 @@ resource "kubernetes_deployment" "task_deployment" {
             name  = "CONFIG"
             value = var.env_config
           }
+          env {
+            name  = "PAGE_TOKEN_SECRET"
+            value = var.page_token_secret
+          }
         }
         volume {
           name = "task-cfg"
@@ -52,9 +56,15 @@ resource "kubernetes_service" "task_service" {
       app = kubernetes_deployment.task_deployment.metadata.0.labels.app
     }
     port {
+      name        = "rest"
       port        = 64530
       target_port = 64530
     }
+    port {
+      name        = "grpc"
+      port        = 64531
+      target_port = 64531
+    }
     type = "ClusterIP"
   }
   depends_on = [kubernetes_deployment.task_deployment]
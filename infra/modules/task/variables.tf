@@ -15,6 +15,12 @@ variable "env_config" {
   type        = string
 }
 
+variable "page_token_secret" {
+  description = "The secret of the page token signing key"
+  type        = string
+  sensitive   = true
+}
+
 variable "label_app" {
   description = "The deployment label"
   type        = string
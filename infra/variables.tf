@@ -27,3 +27,9 @@ variable "env_config" {
   type        = string
   default     = "/app/application.yaml"
 }
+
+variable "page_token_secret" {
+  description = "The secret of the page token signing key, shared by the task services"
+  type        = string
+  sensitive   = true
+}
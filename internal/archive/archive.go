@@ -0,0 +1,356 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// objectPrefix - the prefix of the archive object names
+	objectPrefix string = "tasks_"
+	// objectSuffix - the suffix of the archive object names
+	objectSuffix string = ".ndjson"
+	// maxLine - the maximum size of an archived task
+	maxLine int = 16 << 20
+	// listingTTL - how long the names of the objects of a tenant are kept without an index
+	listingTTL time.Duration = time.Minute
+)
+
+var (
+	// ErrNotFound - the task or the object is not archived
+	ErrNotFound = errors.New("not archived")
+)
+
+// Sink - the cold storage of the archived tasks
+type Sink interface {
+	// Put - write the tasks of a tenant as one archive object and get its name, "" if there are no tasks
+	Put(ctx context.Context, tenant string, tasks []*pbTask.Task) (string, error)
+	// Delete - delete an archive object written by Put, e.g. when its tasks were not removed
+	Delete(ctx context.Context, name string) error
+	// Get - get an archived task of a tenant by id, the latest copy if it was archived more than once.
+	// It returns ErrNotFound if the task is not archived
+	Get(ctx context.Context, tenant string, id string) (*pbTask.Task, error)
+	// Reindex - index the objects written before the index, it does nothing without an index or once they are indexed
+	Reindex(ctx context.Context) error
+}
+
+// Store - a flat object storage, e.g. a directory or an S3 bucket
+type Store interface {
+	// Put - write an object, an existing one is replaced
+	Put(ctx context.Context, name string, data []byte) error
+	// Get - read an object, it returns ErrNotFound if it does not exist
+	Get(ctx context.Context, name string) ([]byte, error)
+	// List - get the names of the objects which start with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete - delete an object, a missing one is not an error
+	Delete(ctx context.Context, name string) error
+}
+
+// ndjsonSink - the tasks of a batch are stored as one NDJSON object of protojson lines,
+// the object name has the tenant and the first and the last id of the batch. With an index Get only
+// reads the object of the id, without one it keeps the names of the objects of a tenant for listingTTL
+// and only reads the objects whose range has the id
+type ndjsonSink struct {
+	store    Store
+	index    Index
+	now      func() time.Time
+	mu       sync.Mutex
+	listings map[string]listing
+}
+
+// listing - the names of the objects of a tenant and when they were listed
+type listing struct {
+	names []string
+	at    time.Time
+}
+
+// Put - write the tasks as one NDJSON object and index their ids to it
+func (sink *ndjsonSink) Put(ctx context.Context, tenant string, tasks []*pbTask.Task) (string, error) {
+	if len(tasks) == 0 {
+		return "", nil
+	}
+	var (
+		buf   bytes.Buffer
+		ids   = make([]string, 0, len(tasks))
+		first = tasks[0].Id
+		last  = tasks[0].Id
+	)
+	for _, task := range tasks {
+		data, err := protojson.Marshal(task)
+		if err != nil {
+			return "", fmt.Errorf("marshal error: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+		ids = append(ids, task.Id)
+		first, last = min(first, task.Id), max(last, task.Id)
+	}
+	name := objectName(tenant, first, last, sink.now())
+	if err := sink.store.Put(ctx, name, buf.Bytes()); err != nil {
+		return "", err
+	}
+	if sink.index == nil {
+		sink.listed(tenant, func(names []string) []string { return append(names, name) })
+		return name, nil
+	}
+	if err := sink.index.Put(ctx, tenant, name, ids, true); err != nil {
+		sink.store.Delete(ctx, name)
+		return "", err
+	}
+	return name, nil
+}
+
+// Delete - delete the object
+func (sink *ndjsonSink) Delete(ctx context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+	if err := sink.store.Delete(ctx, name); err != nil {
+		return err
+	}
+	if tenant, _, ok := objectTenant(name); ok {
+		sink.listed(tenant, func(names []string) []string {
+			return slices.DeleteFunc(names, func(listed string) bool { return listed == name })
+		})
+	}
+	return nil
+}
+
+// Get - read the object of the task from the index, or scan the objects which may have it
+func (sink *ndjsonSink) Get(ctx context.Context, tenant string, id string) (*pbTask.Task, error) {
+	if sink.index != nil {
+		name, err := sink.index.Get(ctx, tenant, id)
+		if err != nil {
+			return nil, err
+		}
+		data, err := sink.store.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		task, err := find(data, id)
+		if err != nil {
+			return nil, fmt.Errorf("object %s: %w", name, err)
+		}
+		if task == nil {
+			return nil, ErrNotFound
+		}
+		return task, nil
+	}
+	names, err := sink.list(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	var found *pbTask.Task
+	for _, name := range names {
+		first, last, ok := objectRange(tenant, name)
+		if !ok || id < first || id > last {
+			continue
+		}
+		data, err := sink.store.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		task, err := find(data, id)
+		if err != nil {
+			return nil, fmt.Errorf("object %s: %w", name, err)
+		}
+		if task != nil && (found == nil || !task.UpdateTime.AsTime().Before(found.UpdateTime.AsTime())) {
+			found = task
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// Reindex - index the tasks of the objects from the latest to the oldest without replacing
+// the indexed ids, so the latest copy of a task wins even if an object is written meanwhile
+func (sink *ndjsonSink) Reindex(ctx context.Context) error {
+	if sink.index == nil {
+		return nil
+	}
+	built, err := sink.index.Built(ctx)
+	if err != nil || built {
+		return err
+	}
+	names, err := sink.store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	type object struct {
+		name   string
+		tenant string
+		nanos  int64
+	}
+	objects := make([]object, 0, len(names))
+	for _, name := range names {
+		if tenant, nanos, ok := objectTenant(name); ok {
+			objects = append(objects, object{name: name, tenant: tenant, nanos: nanos})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].nanos > objects[j].nanos })
+	for _, object := range objects {
+		data, err := sink.store.Get(ctx, object.name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var ids []string
+		err = scan(data, func(task *pbTask.Task) bool {
+			ids = append(ids, task.Id)
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("object %s: %w", object.name, err)
+		}
+		if err = sink.index.Put(ctx, object.tenant, object.name, ids, false); err != nil {
+			return err
+		}
+	}
+	return sink.index.MarkBuilt(ctx)
+}
+
+// list - get the names of the objects of a tenant, they are listed again after listingTTL
+func (sink *ndjsonSink) list(ctx context.Context, tenant string) ([]string, error) {
+	sink.mu.Lock()
+	cached, ok := sink.listings[tenant]
+	sink.mu.Unlock()
+	if ok && sink.now().Sub(cached.at) < listingTTL {
+		return cached.names, nil
+	}
+	names, err := sink.store.List(ctx, tenantPrefix(tenant))
+	if err != nil {
+		return nil, err
+	}
+	sink.mu.Lock()
+	sink.listings[tenant] = listing{names: names, at: sink.now()}
+	sink.mu.Unlock()
+	return names, nil
+}
+
+// listed - change the cached names of the objects of a tenant, if they are listed
+func (sink *ndjsonSink) listed(tenant string, change func([]string) []string) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if cached, ok := sink.listings[tenant]; ok {
+		cached.names = change(slices.Clone(cached.names))
+		sink.listings[tenant] = cached
+	}
+}
+
+// find - get the task by id from the NDJSON data, nil if it is not there
+func find(data []byte, id string) (*pbTask.Task, error) {
+	var found *pbTask.Task
+	err := scan(data, func(task *pbTask.Task) bool {
+		if task.Id == id {
+			found = task
+		}
+		return found == nil
+	})
+	return found, err
+}
+
+// scan - call fn with every task of the NDJSON data until it returns false
+func scan(data []byte, fn func(*pbTask.Task) bool) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		task := &pbTask.Task{}
+		if err := protojson.Unmarshal(scanner.Bytes(), task); err != nil {
+			return fmt.Errorf("unmarshal error: %w", err)
+		}
+		if !fn(task) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// tenantPrefix - the prefix of the object names of a tenant, the objects of the default tenant
+// keep the names they had before the tenants
+func tenantPrefix(tenant string) string {
+	if tenant == "" {
+		return objectPrefix
+	}
+	return tenant + "." + objectPrefix
+}
+
+// objectName - the name of the object of the tasks of a tenant from first to last, archived at now
+func objectName(tenant string, first string, last string, now time.Time) string {
+	return fmt.Sprintf("%s%s_%s_%d%s", tenantPrefix(tenant), first, last, now.UnixNano(), objectSuffix)
+}
+
+// objectRange - get the first and the last id of an object of a tenant from its name
+func objectRange(tenant string, name string) (string, string, bool) {
+	parts := objectParts(tenant, name)
+	if parts == nil {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// objectTenant - get the tenant of an object and when it was archived from its name
+func objectTenant(name string) (string, int64, bool) {
+	tenant := ""
+	if !strings.HasPrefix(name, objectPrefix) {
+		before, _, ok := strings.Cut(name, "."+objectPrefix)
+		if !ok {
+			return "", 0, false
+		}
+		tenant = before
+	}
+	parts := objectParts(tenant, name)
+	if parts == nil {
+		return "", 0, false
+	}
+	nanos, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return tenant, nanos, true
+}
+
+// objectParts - get the first id, the last id and the nanos of an object of a tenant from its name, nil if it is not one
+func objectParts(tenant string, name string) []string {
+	prefix := tenantPrefix(tenant)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, objectSuffix) {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, prefix), objectSuffix), "_")
+	if len(parts) != 3 {
+		return nil
+	}
+	return parts
+}
+
+// NewSink - create a sink which writes NDJSON objects to store and indexes them in index, without an index
+// a new object of another instance is only seen by Get after listingTTL
+func NewSink(store Store, index Index) Sink {
+	return &ndjsonSink{
+		store:    store,
+		index:    index,
+		now:      time.Now,
+		listings: make(map[string]listing),
+	}
+}
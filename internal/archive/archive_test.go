@@ -0,0 +1,225 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// checkStore - the behavior every store shares, a sink on the store finds the latest copy of a task
+// with or without an index
+func checkStore(t *testing.T, store Store, index Index) {
+	var (
+		ctx  = context.Background()
+		sink = NewSink(store, index)
+		now  = time.Now()
+		put  = func(tenant string, tasks ...*pbTask.Task) string {
+			name, err := sink.Put(ctx, tenant, tasks)
+			assert.Nil(t, err)
+			return name
+		}
+	)
+	_, err := store.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	put("", &pbTask.Task{Id: "12", Name: "a", UpdateTime: timestamppb.New(now)},
+		&pbTask.Task{Id: "10", Name: "b", Description: "line\nbreak", UpdateTime: timestamppb.New(now)})
+	put("", &pbTask.Task{Id: "11", Name: "c", UpdateTime: timestamppb.New(now)})
+	put("", &pbTask.Task{Id: "12", Name: "d", UpdateTime: timestamppb.New(now.Add(time.Second))})
+	assert.Equal(t, "", put(""))
+
+	names, err := store.List(ctx, "")
+	assert.Nil(t, err)
+	assert.Len(t, names, 3)
+	sort.Strings(names)
+	first, last, ok := objectRange("", names[0])
+	assert.True(t, ok)
+	assert.Equal(t, []string{"10", "12"}, []string{first, last})
+
+	task, err := sink.Get(ctx, "", "10")
+	assert.Nil(t, err)
+	assert.Equal(t, "line\nbreak", task.Description)
+	task, err = sink.Get(ctx, "", "12")
+	assert.Nil(t, err)
+	assert.Equal(t, "d", task.Name)
+	_, err = sink.Get(ctx, "", "13")
+	assert.ErrorIs(t, err, ErrNotFound)
+	// 11 is in the range of the first object, but it is only in the second
+	task, err = sink.Get(ctx, "", "11")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", task.Name)
+	// a tenant only finds its own tasks
+	_, err = sink.Get(ctx, "acme", "10")
+	assert.ErrorIs(t, err, ErrNotFound)
+	name := put("acme", &pbTask.Task{Id: "10", Name: "e", UpdateTime: timestamppb.New(now)})
+	task, err = sink.Get(ctx, "acme", "10")
+	assert.Nil(t, err)
+	assert.Equal(t, "e", task.Name)
+	task, _ = sink.Get(ctx, "", "10")
+	assert.Equal(t, "b", task.Name)
+	names, _ = store.List(ctx, "acme.")
+	assert.Equal(t, []string{name}, names)
+
+	// a deleted object is no longer read, deleting it again is not an error
+	assert.Nil(t, sink.Delete(ctx, name))
+	assert.Nil(t, sink.Delete(ctx, name))
+	_, err = sink.Get(ctx, "acme", "10")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	checkStore(t, store, nil)
+
+	// a partial object is not listed
+	assert.Nil(t, os.WriteFile(dir+"/.tmp-1", []byte("{"), 0o644))
+	names, _ := store.List(context.Background(), "")
+	assert.Len(t, names, 3)
+
+	_, err = NewFileStore("")
+	assert.NotNil(t, err)
+}
+
+// countingStore - count the listings of a store
+type countingStore struct {
+	Store
+	lists int
+}
+
+func (store *countingStore) List(ctx context.Context, prefix string) ([]string, error) {
+	store.lists++
+	return store.Store.List(ctx, prefix)
+}
+
+func TestListing(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		files, _ = NewFileStore(t.TempDir())
+		store    = &countingStore{Store: files}
+		sink     = NewSink(store, nil).(*ndjsonSink)
+		now      = time.Now()
+	)
+	sink.now = func() time.Time { return now }
+	_, err := sink.Put(ctx, "", []*pbTask.Task{{Id: "10", Name: "a"}, {Id: "12", Name: "b"}})
+	assert.Nil(t, err)
+
+	// the ids outside the range of the objects are not read and the listing is kept
+	for _, id := range []string{"09", "13", "missing"} {
+		_, err = sink.Get(ctx, "", id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 1, store.lists)
+
+	// the objects of the sink are seen before the listing expires
+	name, _ := sink.Put(ctx, "", []*pbTask.Task{{Id: "20", Name: "c"}})
+	task, err := sink.Get(ctx, "", "20")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", task.Name)
+	assert.Nil(t, sink.Delete(ctx, name))
+	_, err = sink.Get(ctx, "", "20")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 1, store.lists)
+
+	// the objects of another instance are seen after the listing expires
+	other := NewSink(files, nil)
+	_, err = other.Put(ctx, "", []*pbTask.Task{{Id: "30", Name: "d"}})
+	assert.Nil(t, err)
+	_, err = sink.Get(ctx, "", "30")
+	assert.ErrorIs(t, err, ErrNotFound)
+	now = now.Add(listingTTL)
+	task, err = sink.Get(ctx, "", "30")
+	assert.Nil(t, err)
+	assert.Equal(t, "d", task.Name)
+	assert.Equal(t, 2, store.lists)
+}
+
+func TestRedisIndex(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		server   = miniredis.RunT(t)
+		client   = redis.NewClient(&redis.Options{Addr: server.Addr()})
+		files, _ = NewFileStore(t.TempDir())
+		store    = &countingStore{Store: files}
+	)
+	checkStore(t, store, NewRedisIndex(client))
+	// Get never lists the objects
+	assert.Equal(t, 2, store.lists)
+	name := server.HGet(IndexHash, "11")
+	assert.Contains(t, name, "tasks_11_11_")
+
+	// the objects written before the index are indexed once, the latest copy wins
+	var (
+		now   = time.Now()
+		plain = NewSink(files, nil)
+		sink  = NewSink(files, NewRedisIndex(client))
+	)
+	server.FlushAll()
+	_, err := plain.Put(ctx, "acme", []*pbTask.Task{{Id: "1", Name: "a", UpdateTime: timestamppb.New(now)}})
+	assert.Nil(t, err)
+	_, err = plain.Put(ctx, "acme", []*pbTask.Task{{Id: "1", Name: "b", UpdateTime: timestamppb.New(now)}})
+	assert.Nil(t, err)
+	_, err = sink.Get(ctx, "acme", "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, sink.Reindex(ctx))
+	task, err := sink.Get(ctx, "acme", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", task.Name)
+	for _, id := range []string{"10", "11", "12"} {
+		_, err = sink.Get(ctx, "", id)
+		assert.Nil(t, err)
+	}
+	assert.True(t, server.Exists(IndexedKey))
+
+	server.Del(repository.TenantPrefix("acme") + IndexHash)
+	assert.Nil(t, sink.Reindex(ctx))
+	_, err = sink.Get(ctx, "acme", "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, NewSink(files, nil).Reindex(ctx))
+}
+
+func TestObjectTenant(t *testing.T) {
+	tenant, nanos, ok := objectTenant(objectName("", "1", "9", time.Unix(0, 42)))
+	assert.True(t, ok)
+	assert.Equal(t, "", tenant)
+	assert.Equal(t, int64(42), nanos)
+	tenant, nanos, ok = objectTenant(objectName("acme", "1", "9", time.Unix(0, 43)))
+	assert.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, int64(43), nanos)
+	for _, name := range []string{"other", "acme.tasks_1_9_x.ndjson", "acme.tasks_1_9.ndjson", ".tmp-1"} {
+		_, _, ok = objectTenant(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestObjectRange(t *testing.T) {
+	first, last, ok := objectRange("", objectName("", "1", "9", time.Unix(0, 42)))
+	assert.True(t, ok)
+	assert.Equal(t, "1", first)
+	assert.Equal(t, "9", last)
+	_, _, ok = objectRange("", "tasks_1_9.ndjson")
+	assert.False(t, ok)
+	_, _, ok = objectRange("", "other")
+	assert.False(t, ok)
+	// the objects of a tenant are only in its own range
+	name := objectName("acme", "1", "9", time.Unix(0, 42))
+	assert.Equal(t, "acme.tasks_1_9_42.ndjson", name)
+	_, _, ok = objectRange("", name)
+	assert.False(t, ok)
+	_, _, ok = objectRange("acme", objectName("", "1", "9", time.Unix(0, 42)))
+	assert.False(t, ok)
+	first, _, ok = objectRange("acme", name)
+	assert.True(t, ok)
+	assert.Equal(t, "1", first)
+}
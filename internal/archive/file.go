@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileStore - the objects are the files of a local directory
+type fileStore struct {
+	dir string
+}
+
+// Put - write the object to a temporary file and rename it, so a partial object is never listed
+func (store *fileStore) Put(ctx context.Context, name string, data []byte) error {
+	tmp, err := os.CreateTemp(store.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create file error: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write file error: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close file error: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(store.dir, name)); err != nil {
+		return fmt.Errorf("rename file error: %w", err)
+	}
+	return nil
+}
+
+// Get - read the object file
+func (store *fileStore) Get(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(store.dir, filepath.Base(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file error: %w", err)
+	}
+	return data, nil
+}
+
+// List - get the names of the object files with the prefix, the temporary files are skipped
+func (store *fileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir error: %w", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") && strings.HasPrefix(entry.Name(), prefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete - remove the object file
+func (store *fileStore) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(store.dir, filepath.Base(name)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove file error: %w", err)
+	}
+	return nil
+}
+
+// NewFileStore - create a store in the directory dir, it is created if it does not exist
+func NewFileStore(dir string) (Store, error) {
+	if dir == "" {
+		return nil, errors.New("archive directory is empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dir error: %w", err)
+	}
+	return &fileStore{dir: dir}, nil
+}
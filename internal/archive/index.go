@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// IndexHash - the hash of the archive object names by task id of a tenant
+	IndexHash string = "archiveIndex"
+	// IndexedKey - set once the objects written before the index are indexed
+	IndexedKey string = "archiveIndexed"
+)
+
+// Index - which archive object has the latest copy of a task
+type Index interface {
+	// Put - index the ids of a tenant to the object name, an indexed id is only replaced if replace is set
+	Put(ctx context.Context, tenant string, name string, ids []string, replace bool) error
+	// Get - get the object name of a task of a tenant, it returns ErrNotFound if the task is not indexed
+	Get(ctx context.Context, tenant string, id string) (string, error)
+	// Built - whether the objects written before the index are indexed
+	Built(ctx context.Context) (bool, error)
+	// MarkBuilt - mark the objects written before the index as indexed
+	MarkBuilt(ctx context.Context) error
+}
+
+// redisIndex - the index is a redis hash of every tenant
+type redisIndex struct {
+	client *redis.Client
+}
+
+// Put - index the ids of a tenant to the object name
+func (index *redisIndex) Put(ctx context.Context, tenant string, name string, ids []string, replace bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	key := repository.TenantPrefix(tenant) + IndexHash
+	_, err := index.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			if replace {
+				pipe.HSet(ctx, key, id, name)
+			} else {
+				pipe.HSetNX(ctx, key, id, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis hset error: %w", err)
+	}
+	return nil
+}
+
+// Get - get the object name of a task of a tenant
+func (index *redisIndex) Get(ctx context.Context, tenant string, id string) (string, error) {
+	name, err := index.client.HGet(ctx, repository.TenantPrefix(tenant)+IndexHash, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis hget error: %w", err)
+	}
+	return name, nil
+}
+
+// Built - whether the objects written before the index are indexed
+func (index *redisIndex) Built(ctx context.Context) (bool, error) {
+	count, err := index.client.Exists(ctx, IndexedKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis exists error: %w", err)
+	}
+	return count > 0, nil
+}
+
+// MarkBuilt - mark the objects written before the index as indexed
+func (index *redisIndex) MarkBuilt(ctx context.Context) error {
+	if err := index.client.Set(ctx, IndexedKey, 1, 0).Err(); err != nil {
+		return fmt.Errorf("redis set error: %w", err)
+	}
+	return nil
+}
+
+// NewRedisIndex - create an index in the redis hashes of the tenants
+func NewRedisIndex(client *redis.Client) Index {
+	return &redisIndex{client: client}
+}
@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Options - the S3 compatible bucket of a store
+type S3Options struct {
+	// Endpoint - the URL of the S3 API, e.g. https://s3.us-east-1.amazonaws.com
+	Endpoint string
+	// Region - the region the requests are signed for
+	Region string
+	// Bucket - the bucket name
+	Bucket string
+	// Prefix - the prefix of the object keys, e.g. tasks/
+	Prefix string
+	// AccessKey - the access key id
+	AccessKey string
+	// SecretKey - the secret access key
+	SecretKey string
+	// PathStyle - address the bucket in the path instead of the host, e.g. for MinIO
+	PathStyle bool
+}
+
+// s3Store - the objects are the keys under a prefix of an S3 compatible bucket
+type s3Store struct {
+	endpoint *url.URL
+	opts     S3Options
+	signer   signer
+	client   *http.Client
+	now      func() time.Time
+}
+
+// listResult - the reply of ListObjectsV2
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Put - PutObject
+func (store *s3Store) Put(ctx context.Context, name string, data []byte) error {
+	resp, err := store.do(ctx, http.MethodPut, store.opts.Prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get - GetObject
+func (store *s3Store) Get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := store.do(ctx, http.MethodGet, store.opts.Prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3 read error: %w", err)
+	}
+	return data, nil
+}
+
+// List - ListObjectsV2 under the prefix of the store and prefix, page by page
+func (store *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var (
+		names = []string{}
+		token = ""
+	)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {store.opts.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := store.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list decode error: %w", err)
+		}
+		for _, content := range result.Contents {
+			names = append(names, strings.TrimPrefix(content.Key, store.opts.Prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Delete - DeleteObject
+func (store *s3Store) Delete(ctx context.Context, name string) error {
+	resp, err := store.do(ctx, http.MethodDelete, store.opts.Prefix+name, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do - send a signed request for the key of the bucket, a missing key is ErrNotFound
+func (store *s3Store) do(ctx context.Context, method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *store.endpoint
+	path := strings.TrimSuffix(u.Path, "/") + "/" + key
+	if store.opts.PathStyle {
+		path = strings.TrimSuffix(u.Path, "/") + "/" + store.opts.Bucket + "/" + key
+	} else {
+		u.Host = store.opts.Bucket + "." + u.Host
+	}
+	// the path and the query on the wire are the signed ones
+	u.Path, u.RawPath = path, canonicalPath(path)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3 request error: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	store.signer.sign(req, hashHex(body), store.now())
+
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s error: %w", method, err)
+	}
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, key, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return resp, nil
+}
+
+// NewS3Store - create a store in an S3 compatible bucket, client is http.DefaultClient if it is nil
+func NewS3Store(opts S3Options, client *http.Client) (Store, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("s3 bucket is empty")
+	}
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint invalid: %q", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &s3Store{
+		endpoint: endpoint,
+		opts:     opts,
+		signer: signer{
+			accessKey: opts.AccessKey,
+			secretKey: opts.SecretKey,
+			region:    opts.Region,
+			service:   "s3",
+		},
+		client: client,
+		now:    time.Now,
+	}, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// APIKey - a static key of a subject
+type APIKey struct {
+	// Subject - who uses the key
+	Subject string
+	// Key - the secret sent in the X-Api-Key header
+	Key string
+	// Tenant - the only tenant the key can use, empty if it can use any
+	Tenant string
+	// Roles - the roles of the subject
+	Roles []string
+}
+
+// apiKeys - the identities indexed by the SHA-256 of their keys, so a lookup takes the same time
+// for every key and the keys are not kept in memory
+type apiKeys map[[sha256.Size]byte]Identity
+
+// Authenticate - get the identity of the X-Api-Key header
+func (keys apiKeys) Authenticate(ctx context.Context, md metadata.MD) (Identity, error) {
+	values := md.Get(APIKeyHeader)
+	if len(values) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	identity, ok := keys[sha256.Sum256([]byte(strings.TrimSpace(values[0])))]
+	if len(values) > 1 || !ok {
+		return Identity{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+	return identity, nil
+}
+
+// NewAPIKeys - create an authenticator of the static API keys, every key needs a subject
+func NewAPIKeys(keys []APIKey) (Authenticator, error) {
+	result := apiKeys{}
+	for i, key := range keys {
+		if key.Subject == "" || key.Key == "" {
+			return nil, fmt.Errorf("api key %d needs a subject and a key", i)
+		}
+		hash := sha256.Sum256([]byte(key.Key))
+		if _, ok := result[hash]; ok {
+			return nil, fmt.Errorf("api key of %s is not unique", key.Subject)
+		}
+		result[hash] = Identity{Subject: key.Subject, Tenant: key.Tenant, Method: MethodAPIKey, Roles: key.Roles}
+	}
+	return result, nil
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Authorization - the metadata key of the bearer tokens, the gateway forwards the Authorization header as it
+	Authorization string = "authorization"
+	// APIKeyHeader - the metadata key of the API keys, forwarded from the X-Api-Key header by the gateway
+	APIKeyHeader string = "x-api-key"
+
+	// MethodAPIKey - an identity authenticated by an API key
+	MethodAPIKey string = "api-key"
+	// MethodJWT - an identity authenticated by a JWT bearer token
+	MethodJWT string = "jwt"
+
+	// ReasonMissing - the ErrorInfo reason of a call without credentials
+	ReasonMissing string = "CREDENTIALS_MISSING"
+	// ReasonInvalid - the ErrorInfo reason of a call with unknown or malformed credentials
+	ReasonInvalid string = "CREDENTIALS_INVALID"
+	// ReasonExpired - the ErrorInfo reason of a call with an expired token
+	ReasonExpired string = "CREDENTIALS_EXPIRED"
+)
+
+var (
+	// ErrNoCredentials - the metadata has no credentials an authenticator checks
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials - the credentials are unknown or malformed
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrExpired - the credentials were valid but expired
+	ErrExpired = errors.New("credentials expired")
+)
+
+// Identity - who makes a call
+type Identity struct {
+	// Subject - the API key subject or the sub claim of the token
+	Subject string
+	// Tenant - the only tenant the identity can use, empty if it can use any
+	Tenant string
+	// Method - how the identity was authenticated, MethodAPIKey or MethodJWT
+	Method string
+	// Roles - the roles of the identity, the policy gives its default roles to an identity without any
+	Roles []string
+}
+
+// Principal - the subject prefixed with how it was authenticated, e.g. api-key:ci or jwt:alice,
+// so an API key and a token with the same subject are different callers
+func (identity Identity) Principal() string {
+	return identity.Method + ":" + identity.Subject
+}
+
+// identityKey - the context key of the identity of a call
+type identityKey struct{}
+
+// WithIdentity - get a context of a call made by the identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityOf - get the identity of the call in ctx, false if it is not authenticated
+func IdentityOf(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Fields - the log fields of the identity in ctx
+func Fields(ctx context.Context) []zap.Field {
+	identity, ok := IdentityOf(ctx)
+	if !ok {
+		return nil
+	}
+	return []zap.Field{zap.String("subject", identity.Subject), zap.String("auth", identity.Method)}
+}
+
+// Authenticator - check the credentials of a call
+type Authenticator interface {
+	// Authenticate - get the identity of the credentials in md.
+	// It returns ErrNoCredentials if md has none of the credentials it checks
+	Authenticate(ctx context.Context, md metadata.MD) (Identity, error)
+}
+
+// chain - the first authenticator which finds its credentials decides
+type chain []Authenticator
+
+func (authenticators chain) Authenticate(ctx context.Context, md metadata.MD) (Identity, error) {
+	for _, authenticator := range authenticators {
+		identity, err := authenticator.Authenticate(ctx, md)
+		if !errors.Is(err, ErrNoCredentials) {
+			return identity, err
+		}
+	}
+	return Identity{}, ErrNoCredentials
+}
+
+// Chain - an authenticator of the calls with the credentials of any of the authenticators
+func Chain(authenticators ...Authenticator) Authenticator {
+	return chain(authenticators)
+}
+
+// Interceptor - authenticate every call, the calls are not authenticated without an authenticator
+type Interceptor struct {
+	authenticator Authenticator
+	logger        *zap.Logger
+}
+
+// Enabled - check if the calls are authenticated
+func (interceptor *Interceptor) Enabled() bool {
+	return interceptor.authenticator != nil
+}
+
+// Authenticate - get a context with the identity of the call in the incoming metadata of ctx,
+// the error is UNAUTHENTICATED with the reason in its ErrorInfo
+func (interceptor *Interceptor) Authenticate(ctx context.Context, method string) (context.Context, error) {
+	if !interceptor.Enabled() {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	identity, err := interceptor.authenticator.Authenticate(ctx, md)
+	if err == nil {
+		interceptor.logger.Debug("Authenticate call", append(Fields(WithIdentity(ctx, identity)), zap.String("method", method))...)
+		return WithIdentity(ctx, identity), nil
+	}
+	meta := map[string]string{"method": method}
+	switch {
+	case errors.Is(err, ErrNoCredentials):
+		return nil, helper.UnauthenticatedErr("credentials are required", ReasonMissing, meta)
+	case errors.Is(err, ErrExpired):
+		return nil, helper.UnauthenticatedErr("credentials expired", ReasonExpired, meta)
+	case errors.Is(err, ErrInvalidCredentials):
+		interceptor.logger.Info("Authenticate invalid credentials", zap.String("method", method), zap.Error(err))
+		return nil, helper.UnauthenticatedErr("credentials invalid", ReasonInvalid, meta)
+	}
+	interceptor.logger.Error("Authenticate error", zap.String("method", method), zap.Error(err))
+	return nil, helper.InternalErr("authentication error")
+}
+
+// UnaryInterceptor - authenticate a unary call
+func (interceptor *Interceptor) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := interceptor.Authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor - authenticate a streaming call
+func (interceptor *Interceptor) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := interceptor.Authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &identityStream{ServerStream: stream, ctx: ctx})
+}
+
+// identityStream - a server stream whose context has the identity
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *identityStream) Context() context.Context {
+	return stream.ctx
+}
+
+// NewInterceptor - create an interceptor which authenticates the calls with authenticator,
+// a nil authenticator lets every call in
+func NewInterceptor(authenticator Authenticator, logger *zap.Logger) *Interceptor {
+	return &Interceptor{
+		authenticator: authenticator,
+		logger:        logger,
+	}
+}
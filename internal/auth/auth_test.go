@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKeys(t *testing.T) {
+	keys, err := NewAPIKeys([]APIKey{{Subject: "ci", Key: "k1", Tenant: "acme", Roles: []string{"admin"}}, {Subject: "ops", Key: "k2"}})
+	assert.Nil(t, err)
+	identity, err := keys.Authenticate(context.Background(), metadata.Pairs(APIKeyHeader, " k1 "))
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{Subject: "ci", Tenant: "acme", Method: MethodAPIKey, Roles: []string{"admin"}}, identity)
+	_, err = keys.Authenticate(context.Background(), metadata.Pairs(APIKeyHeader, "k3"))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = keys.Authenticate(context.Background(), metadata.Pairs(APIKeyHeader, "k1", APIKeyHeader, "k2"))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = keys.Authenticate(context.Background(), metadata.MD{})
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	_, err = NewAPIKeys([]APIKey{{Subject: "ci"}})
+	assert.NotNil(t, err)
+	_, err = NewAPIKeys([]APIKey{{Subject: "ci", Key: "k1"}, {Subject: "ops", Key: "k1"}})
+	assert.NotNil(t, err)
+}
+
+func TestInterceptor(t *testing.T) {
+	var (
+		logger, _ = zap.NewDevelopment()
+		keys, _   = NewAPIKeys([]APIKey{{Subject: "ci", Key: "k1"}})
+		info      = &grpc.UnaryServerInfo{FullMethod: "/task.v1.TaskService/GetTask"}
+		handler   = func(ctx context.Context, req interface{}) (interface{}, error) {
+			identity, _ := IdentityOf(ctx)
+			return identity.Subject, nil
+		}
+		call = func(interceptor *Interceptor, md metadata.MD) (interface{}, error) {
+			return interceptor.UnaryInterceptor(metadata.NewIncomingContext(context.Background(), md), nil, info, handler)
+		}
+	)
+	interceptor := NewInterceptor(Chain(keys), logger)
+	subject, err := call(interceptor, metadata.Pairs(APIKeyHeader, "k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", subject)
+
+	for _, tc := range []struct {
+		md     metadata.MD
+		reason string
+	}{
+		{metadata.MD{}, ReasonMissing},
+		{metadata.Pairs(APIKeyHeader, "k2"), ReasonInvalid},
+	} {
+		_, err = call(interceptor, tc.md)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		details := status.Convert(err).Details()
+		assert.Len(t, details, 1)
+		errInfo, ok := details[0].(*errdetails.ErrorInfo)
+		assert.True(t, ok)
+		assert.Equal(t, tc.reason, errInfo.Reason)
+		assert.Equal(t, info.FullMethod, errInfo.Metadata["method"])
+	}
+
+	// every call is let in without an authenticator
+	subject, err = call(NewInterceptor(nil, logger), metadata.MD{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", subject)
+}
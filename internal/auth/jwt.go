@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// DefaultTenantClaim - the claim of the tenant of a token when it is not configured
+	DefaultTenantClaim string = "tenant"
+	// DefaultRolesClaim - the claim of the roles of a token when it is not configured
+	DefaultRolesClaim string = "roles"
+	// DefaultJWKSRefresh - how often the JWKS is loaded again when it is not configured
+	DefaultJWKSRefresh time.Duration = time.Hour
+	// minJWKSReload - the shortest time between two loads of the JWKS for the tokens of an unknown key,
+	// so the tokens with made up key ids can not flood the issuer
+	minJWKSReload time.Duration = time.Minute
+	// maxJWKSSize - the largest JWKS which is read
+	maxJWKSSize int64 = 1 << 20
+	// jwksTimeout - how long a load of the JWKS can take
+	jwksTimeout time.Duration = 10 * time.Second
+)
+
+// signingMethods - the asymmetric algorithms of the tokens, a JWKS has no shared secrets
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// JWTOptions - how the bearer tokens are validated, the zero values are the defaults
+type JWTOptions struct {
+	// JWKSFile - the path of the JWKS file with the public keys of the issuer
+	JWKSFile string
+	// JWKSURL - the URL of the JWKS of the issuer, e.g. the jwks_uri of an OIDC provider, when there is no file
+	JWKSURL string
+	// Issuer - the iss claim of the tokens, any issuer if it is empty
+	Issuer string
+	// Audience - one of the aud claims of the tokens, any audience if it is empty
+	Audience string
+	// TenantClaim - the claim of the only tenant a token can use
+	TenantClaim string
+	// RolesClaim - the claim of the roles of a token, a list of strings or a string of roles separated by spaces
+	RolesClaim string
+	// Refresh - how often the JWKS is loaded again, the keys of a rotation are loaded at once
+	Refresh time.Duration
+	// Leeway - the clock skew allowed in the exp and nbf claims
+	Leeway time.Duration
+}
+
+func (opts JWTOptions) withDefaults() JWTOptions {
+	if opts.TenantClaim == "" {
+		opts.TenantClaim = DefaultTenantClaim
+	}
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = DefaultRolesClaim
+	}
+	if opts.Refresh <= 0 {
+		opts.Refresh = DefaultJWKSRefresh
+	}
+	return opts
+}
+
+// jwtAuthenticator - validate the bearer tokens with the keys of a JWKS
+type jwtAuthenticator struct {
+	opts   JWTOptions
+	keys   *keySet
+	parser *jwt.Parser
+}
+
+// Authenticate - get the identity of the bearer token in the Authorization header
+func (authenticator *jwtAuthenticator) Authenticate(ctx context.Context, md metadata.MD) (Identity, error) {
+	values := md.Get(Authorization)
+	if len(values) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	scheme, raw, _ := strings.Cut(strings.TrimSpace(values[0]), " ")
+	if !strings.EqualFold(scheme, "bearer") {
+		return Identity{}, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := authenticator.parser.ParseWithClaims(strings.TrimSpace(raw), claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return authenticator.keys.key(ctx, kid)
+	})
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return Identity{}, ErrExpired
+	}
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+	}
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return Identity{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	tenant, ok := claims[authenticator.opts.TenantClaim].(string)
+	if _, exists := claims[authenticator.opts.TenantClaim]; exists && !ok {
+		return Identity{}, fmt.Errorf("%w: claim %s is not a string", ErrInvalidCredentials, authenticator.opts.TenantClaim)
+	}
+	roles, err := claimRoles(claims[authenticator.opts.RolesClaim])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: claim %s %s", ErrInvalidCredentials, authenticator.opts.RolesClaim, err)
+	}
+	return Identity{Subject: subject, Tenant: tenant, Method: MethodJWT, Roles: roles}, nil
+}
+
+// claimRoles - get the roles of a claim, e.g. ["admin"] or the space separated "admin ops" of a scope
+func claimRoles(claim interface{}) ([]string, error) {
+	switch claim := claim.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.Fields(claim), nil
+	case []interface{}:
+		roles := make([]string, 0, len(claim))
+		for _, role := range claim {
+			value, ok := role.(string)
+			if !ok {
+				return nil, errors.New("is not a list of strings")
+			}
+			roles = append(roles, value)
+		}
+		return roles, nil
+	}
+	return nil, errors.New("is not a list of strings")
+}
+
+// keySet - the public keys of a JWKS by their key ids, loaded again every refresh
+// or when a token has an unknown key id
+type keySet struct {
+	mu     sync.Mutex
+	keys   map[string]crypto.PublicKey
+	loaded time.Time
+	// loading - closed when the load in flight is done, nil without one
+	loading chan struct{}
+	refresh time.Duration
+	timeout time.Duration
+	load    func(ctx context.Context) ([]byte, error)
+	now     func() time.Time
+}
+
+// key - get the key of a token, a token without a key id uses the only key of the set.
+// The JWKS is loaded in the background without the lock, only a token of an unknown key waits for it
+func (set *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	set.mu.Lock()
+	_, known := set.keys[kid]
+	known = known || (kid == "" && len(set.keys) == 1)
+	age := set.now().Sub(set.loaded)
+	done := set.loading
+	if age >= set.refresh || (!known && kid != "" && age >= minJWKSReload) {
+		done = set.reload()
+	}
+	set.mu.Unlock()
+	if done != nil && !known {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if kid == "" && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key, nil
+		}
+	}
+	key, ok := set.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// reload - load the JWKS in the background unless it is already loading, set.mu is held.
+// It returns a channel closed when the load is done, the known keys are kept if the issuer is not reachable
+func (set *keySet) reload() chan struct{} {
+	if set.loading != nil {
+		return set.loading
+	}
+	set.loaded = set.now()
+	done := make(chan struct{})
+	set.loading = done
+	go func() {
+		defer close(done)
+		keys, err := set.fetch(context.Background())
+		set.mu.Lock()
+		defer set.mu.Unlock()
+		if err == nil {
+			set.keys = keys
+		}
+		set.loading = nil
+	}()
+	return done
+}
+
+// fetch - load and parse the JWKS within the timeout
+func (set *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, set.timeout)
+	defer cancel()
+	data, err := set.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+// jwk - a public key of a JWKS, RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS - get the RSA, EC and Ed25519 signing keys of a JWKS, the other keys are skipped
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwks unmarshal error: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		public, err := key.public()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %w", key.Kid, err)
+		}
+		if public != nil {
+			keys[key.Kid] = public
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no signing keys")
+	}
+	return keys, nil
+}
+
+// public - get the public key, nil for an unsupported key type
+func (key jwk) public() (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(key.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[key.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		x, err := decodeInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil || key.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// jwksLoader - read the JWKS from the file or get it from the URL
+func jwksLoader(opts JWTOptions, client *http.Client) (func(ctx context.Context) ([]byte, error), error) {
+	if opts.JWKSFile != "" {
+		return func(ctx context.Context) ([]byte, error) {
+			return os.ReadFile(opts.JWKSFile)
+		}, nil
+	}
+	if opts.JWKSURL == "" {
+		return nil, errors.New("jwt needs a jwks file or url")
+	}
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.JWKSURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("jwks request error: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("jwks get error: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwks get status %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	}, nil
+}
+
+// NewJWT - create an authenticator of the bearer tokens signed by the keys of the JWKS,
+// the JWKS is loaded at once so a wrong file or URL fails at the start. A nil client is a client with a timeout
+func NewJWT(ctx context.Context, opts JWTOptions, client *http.Client) (Authenticator, error) {
+	if client == nil {
+		client = &http.Client{Timeout: jwksTimeout}
+	}
+	opts = opts.withDefaults()
+	load, err := jwksLoader(opts, client)
+	if err != nil {
+		return nil, err
+	}
+	keys := &keySet{refresh: opts.Refresh, timeout: jwksTimeout, load: load, now: time.Now}
+	if keys.keys, err = keys.fetch(ctx); err != nil {
+		return nil, err
+	}
+	keys.loaded = keys.now()
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(opts.Leeway),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	return &jwtAuthenticator{
+		opts:   opts,
+		keys:   keys,
+		parser: jwt.NewParser(parserOpts...),
+	}, nil
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+// jwks - the JWKS of the public keys by their key ids
+func jwks(t *testing.T, keys map[string]interface{}) []byte {
+	encode := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+	set := []map[string]string{}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set = append(set, map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+				"n": encode(key.N), "e": encode(big.NewInt(int64(key.E)))})
+		case *ecdsa.PublicKey:
+			set = append(set, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(key.X), "y": encode(key.Y)})
+		}
+	}
+	// an encryption key is skipped
+	set = append(set, map[string]string{"kty": "RSA", "kid": "enc", "use": "enc"})
+	data, err := json.Marshal(map[string]interface{}{"keys": set})
+	assert.Nil(t, err)
+	return data
+}
+
+// bearer - the Authorization metadata of a token signed by the key
+func bearer(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) metadata.MD {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return metadata.Pairs(Authorization, "Bearer "+signed)
+}
+
+func TestJWT(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+		ecKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		file      = filepath.Join(t.TempDir(), "jwks.json")
+		exp       = time.Now().Add(time.Hour).Unix()
+	)
+	assert.Nil(t, os.WriteFile(file, jwks(t, map[string]interface{}{"r1": &rsaKey.PublicKey, "e1": &ecKey.PublicKey}), 0o644))
+	authenticator, err := NewJWT(ctx, JWTOptions{JWKSFile: file, Issuer: "https://issuer", Audience: "tasks"}, nil)
+	assert.Nil(t, err)
+
+	claims := jwt.MapClaims{"sub": "alice", "iss": "https://issuer", "aud": []string{"tasks"}, "exp": exp, "tenant": "acme", "roles": []string{"admin"}}
+	identity, err := authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, claims))
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{Subject: "alice", Tenant: "acme", Method: MethodJWT, Roles: []string{"admin"}}, identity)
+	identity, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodES256, "e1", ecKey,
+		jwt.MapClaims{"sub": "bob", "iss": "https://issuer", "aud": "tasks", "exp": exp, "roles": "member ops"}))
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{Subject: "bob", Method: MethodJWT, Roles: []string{"member", "ops"}}, identity)
+
+	for name, md := range map[string]metadata.MD{
+		"wrong key":      bearer(t, jwt.SigningMethodRS256, "e1", rsaKey, claims),
+		"unknown key":    bearer(t, jwt.SigningMethodRS256, "r2", rsaKey, claims),
+		"wrong issuer":   bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, jwt.MapClaims{"sub": "alice", "iss": "other", "aud": "tasks", "exp": exp}),
+		"wrong audience": bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, jwt.MapClaims{"sub": "alice", "iss": "https://issuer", "aud": "other", "exp": exp}),
+		"no expiry":      bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, jwt.MapClaims{"sub": "alice", "iss": "https://issuer", "aud": "tasks"}),
+		"no subject":     bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, jwt.MapClaims{"iss": "https://issuer", "aud": "tasks", "exp": exp}),
+		"shared secret":  bearer(t, jwt.SigningMethodHS256, "r1", []byte("secret"), claims),
+		"tenant number":  bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, jwt.MapClaims{"sub": "alice", "iss": "https://issuer", "aud": "tasks", "exp": exp, "tenant": 1}),
+		"roles numbers":  bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, jwt.MapClaims{"sub": "alice", "iss": "https://issuer", "aud": "tasks", "exp": exp, "roles": []int{1}}),
+		"malformed":      metadata.Pairs(Authorization, "Bearer abc"),
+	} {
+		_, err = authenticator.Authenticate(ctx, md)
+		assert.ErrorIs(t, err, ErrInvalidCredentials, name)
+	}
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "r1", rsaKey, claims))
+	assert.ErrorIs(t, err, ErrExpired)
+	_, err = authenticator.Authenticate(ctx, metadata.Pairs(Authorization, "Basic YTpi"))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	_, err = NewJWT(ctx, JWTOptions{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}, nil)
+	assert.NotNil(t, err)
+	_, err = NewJWT(ctx, JWTOptions{}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestJWKSRotation(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		old, _  = rsa.GenerateKey(rand.Reader, 2048)
+		next, _ = rsa.GenerateKey(rand.Reader, 2048)
+		rotated atomic.Bool
+		loads   atomic.Int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loads.Add(1)
+		keys := map[string]interface{}{"old": &old.PublicKey}
+		if rotated.Load() {
+			keys["next"] = &next.PublicKey
+		}
+		w.Write(jwks(t, keys))
+	}))
+	defer server.Close()
+	authenticator, err := NewJWT(ctx, JWTOptions{JWKSURL: server.URL}, server.Client())
+	assert.Nil(t, err)
+	keys := authenticator.(*jwtAuthenticator).keys
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	claims := jwt.MapClaims{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "", old, claims))
+	assert.Nil(t, err)
+	// an unknown key is only looked for once a minute
+	rotated.Store(true)
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "next", next, claims))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, int32(1), loads.Load())
+	now = now.Add(minJWKSReload)
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "next", next, claims))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), loads.Load())
+	// the known keys are kept when the issuer is down
+	server.Close()
+	now = now.Add(DefaultJWKSRefresh)
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "old", old, claims))
+	assert.Nil(t, err)
+}
+
+func TestJWKSSlowIssuer(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		key, _ = rsa.GenerateKey(rand.Reader, 2048)
+		hang   atomic.Bool
+	)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write(jwks(t, map[string]interface{}{"k1": &key.PublicKey}))
+	}))
+	defer server.Close()
+	defer close(release)
+	authenticator, err := NewJWT(ctx, JWTOptions{JWKSURL: server.URL}, server.Client())
+	assert.Nil(t, err)
+	keys := authenticator.(*jwtAuthenticator).keys
+	keys.timeout = 100 * time.Millisecond
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	// a refresh does not hold up the tokens of the known keys
+	hang.Store(true)
+	now = now.Add(DefaultJWKSRefresh)
+	claims := jwt.MapClaims{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+	start := time.Now()
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "k1", key, claims))
+	assert.Nil(t, err)
+	assert.Less(t, time.Since(start), keys.timeout)
+
+	// a token of an unknown key waits for the load in flight, which gives up after the timeout
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "k2", other, claims))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authenticator.Authenticate(ctx, bearer(t, jwt.SigningMethodRS256, "k1", key, claims))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,115 @@
+package authz
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+)
+
+const (
+	// Everyone - the principal of every caller
+	Everyone string = "*"
+	// RolePrefix - the prefix of the principal of the callers with a role, e.g. role:ops
+	RolePrefix string = "role:"
+)
+
+// Access - what a caller does with a task
+type Access int
+
+const (
+	// Read - get the task, its subtasks, revisions and events
+	Read Access = iota
+	// Write - change or undelete the task
+	Write
+	// Share - change the readers and the writers of the task
+	Share
+	// Delete - move the task to the trash, only a role with every task can
+	Delete
+)
+
+func (access Access) String() string {
+	switch access {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case Share:
+		return "share"
+	case Delete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Grant - who makes a call and what its roles let it do with the tasks
+type Grant struct {
+	// Subject - the principal of the identity of the call, e.g. jwt:alice
+	Subject string
+	// Roles - the roles of the caller
+	Roles []string
+	// AllTasks - one of the roles can read, write and delete every task whatever its owner, readers and writers
+	AllTasks bool
+}
+
+// matches - check if the principal is the caller
+func (grant Grant) matches(principal string) bool {
+	if principal == Everyone || principal == grant.Subject {
+		return true
+	}
+	role, ok := strings.CutPrefix(principal, RolePrefix)
+	return ok && slices.Contains(grant.Roles, role)
+}
+
+// Allows - check if the caller has the access to the task, a role with every task has every access,
+// the owner has every access but delete, the writers can read and write and the readers can read
+func (grant Grant) Allows(task *pbTask.Task, access Access) bool {
+	if grant.AllTasks {
+		return true
+	}
+	if access == Delete {
+		return false
+	}
+	if task.GetOwner() != "" && task.GetOwner() == grant.Subject {
+		return true
+	}
+	if access == Share {
+		return false
+	}
+	if slices.ContainsFunc(task.GetWriters(), grant.matches) {
+		return true
+	}
+	return access == Read && slices.ContainsFunc(task.GetReaders(), grant.matches)
+}
+
+// grantKey - the context key of the grant of a call
+type grantKey struct{}
+
+// WithGrant - get a context of a call authorized with the grant
+func WithGrant(ctx context.Context, grant Grant) context.Context {
+	return context.WithValue(ctx, grantKey{}, grant)
+}
+
+// GrantOf - get the grant of the call in ctx, false if the call is not authorized
+func GrantOf(ctx context.Context) (Grant, bool) {
+	grant, ok := ctx.Value(grantKey{}).(Grant)
+	return grant, ok
+}
+
+// Allowed - check if the call in ctx has the access to the task, a call which is not authorized has every access
+func Allowed(ctx context.Context, task *pbTask.Task, access Access) bool {
+	grant, ok := GrantOf(ctx)
+	return !ok || grant.Allows(task, access)
+}
+
+// Readable - get the match of the tasks the call in ctx can read, nil if it can read every task
+func Readable(ctx context.Context) func(task *pbTask.Task) bool {
+	grant, ok := GrantOf(ctx)
+	if !ok || grant.AllTasks {
+		return nil
+	}
+	return func(task *pbTask.Task) bool {
+		return grant.Allows(task, Read)
+	}
+}
@@ -0,0 +1,105 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGrant(t *testing.T) {
+	task := &pbTask.Task{Owner: "alice", Readers: []string{"carol", "role:ops"}, Writers: []string{"bob"}}
+	for _, tc := range []struct {
+		grant  Grant
+		read   bool
+		write  bool
+		share  bool
+		delete bool
+	}{
+		{Grant{Subject: "alice"}, true, true, true, false},
+		{Grant{Subject: "bob"}, true, true, false, false},
+		{Grant{Subject: "carol"}, true, false, false, false},
+		{Grant{Subject: "dave", Roles: []string{"ops"}}, true, false, false, false},
+		{Grant{Subject: "erin"}, false, false, false, false},
+		{Grant{Subject: "root", AllTasks: true}, true, true, true, true},
+	} {
+		assert.Equal(t, tc.read, tc.grant.Allows(task, Read), tc.grant.Subject)
+		assert.Equal(t, tc.write, tc.grant.Allows(task, Write), tc.grant.Subject)
+		assert.Equal(t, tc.share, tc.grant.Allows(task, Share), tc.grant.Subject)
+		assert.Equal(t, tc.delete, tc.grant.Allows(task, Delete), tc.grant.Subject)
+	}
+	// a task without an owner is not owned by a subject without a name
+	assert.False(t, Grant{}.Allows(&pbTask.Task{}, Write))
+	assert.True(t, Grant{Subject: "erin"}.Allows(&pbTask.Task{Readers: []string{Everyone}}, Read))
+
+	// a call which is not authorized can read every task
+	assert.True(t, Allowed(context.Background(), task, Share))
+	assert.Nil(t, Readable(context.Background()))
+	readable := Readable(WithGrant(context.Background(), Grant{Subject: "erin"}))
+	assert.False(t, readable(task))
+}
+
+func TestPolicy(t *testing.T) {
+	var (
+		logger, _ = zap.NewDevelopment()
+		handler   = func(ctx context.Context, req interface{}) (interface{}, error) {
+			grant, _ := GrantOf(ctx)
+			return grant, nil
+		}
+		call = func(policy *Policy, method string, identity *auth.Identity) (interface{}, error) {
+			ctx := context.Background()
+			if identity != nil {
+				ctx = auth.WithIdentity(ctx, *identity)
+			}
+			return policy.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		}
+	)
+	policy, err := NewPolicy(map[string]Role{
+		"admin":  {Methods: []string{AllMethods}, AllTasks: true},
+		"member": {Methods: []string{"GetTask", "UpdateTask", "WatchTasks"}},
+	}, []string{"member"}, logger)
+	assert.Nil(t, err)
+	assert.True(t, policy.Enabled())
+
+	grant, err := call(policy, "/task.v1.TaskService/DeleteTask", &auth.Identity{Subject: "root", Method: auth.MethodJWT, Roles: []string{"admin"}})
+	assert.Nil(t, err)
+	assert.Equal(t, Grant{Subject: "jwt:root", Roles: []string{"admin"}, AllTasks: true}, grant)
+	// an identity without roles has the default roles
+	grant, err = call(policy, "/task.v1.TaskService/UpdateTask", &auth.Identity{Subject: "alice", Method: auth.MethodJWT})
+	assert.Nil(t, err)
+	assert.Equal(t, Grant{Subject: "jwt:alice", Roles: []string{"member"}}, grant)
+
+	_, err = call(policy, "/task.v1.TaskService/DeleteTask", &auth.Identity{Subject: "alice", Method: auth.MethodJWT})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	details := status.Convert(err).Details()
+	assert.Len(t, details, 1)
+	errInfo, ok := details[0].(*errdetails.ErrorInfo)
+	assert.True(t, ok)
+	assert.Equal(t, ReasonMethodDenied, errInfo.Reason)
+	_, err = call(policy, "/task.v1.TaskService/GetTask", &auth.Identity{Subject: "bob", Method: auth.MethodJWT, Roles: []string{"unknown"}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// a call without an identity is denied, the calls of the other services are not authorized
+	_, err = call(policy, "/task.v1.TaskService/GetTask", nil)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	grant, err = call(policy, "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Grant{}, grant)
+	_, err = call(policy, "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", &auth.Identity{Subject: "alice", Method: auth.MethodJWT})
+	assert.Nil(t, err)
+
+	_, err = NewPolicy(map[string]Role{"member": {Methods: []string{"GetTasks"}}}, nil, logger)
+	assert.NotNil(t, err)
+	_, err = NewPolicy(map[string]Role{"member": {Methods: []string{"GetTask"}}}, []string{"viewer"}, logger)
+	assert.NotNil(t, err)
+	policy, err = NewPolicy(nil, nil, logger)
+	assert.Nil(t, err)
+	assert.False(t, policy.Enabled())
+}
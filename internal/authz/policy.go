@@ -0,0 +1,141 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+const (
+	// AllMethods - the method of a role which can call every method
+	AllMethods string = "*"
+	// ReasonMethodDenied - the ErrorInfo reason of a call of a method none of the roles of the caller can call
+	ReasonMethodDenied string = "METHOD_DENIED"
+)
+
+// Role - what the callers with the role can do
+type Role struct {
+	// Methods - the TaskService methods the role can call, e.g. GetTask, AllMethods is every method
+	Methods []string
+	// AllTasks - read, write and delete every task of the tenant whatever its owner, readers and writers
+	AllTasks bool
+}
+
+// Policy - check the roles of the callers of the TaskService methods
+type Policy struct {
+	roles    map[string]Role
+	defaults []string
+	logger   *zap.Logger
+}
+
+// Enabled - check if the calls are authorized
+func (policy *Policy) Enabled() bool {
+	return len(policy.roles) > 0
+}
+
+// Authorize - get a context with the grant of the call of the method, the error is PERMISSION_DENIED
+// when none of the roles of the caller can call it and UNAUTHENTICATED when the call has no identity.
+// A call of another service is not authorized, it has every access
+func (policy *Policy) Authorize(ctx context.Context, method string) (context.Context, error) {
+	if !policy.Enabled() {
+		return ctx, nil
+	}
+	name, ok := strings.CutPrefix(method, "/"+pbTask.TaskService_ServiceDesc.ServiceName+"/")
+	if !ok {
+		return ctx, nil
+	}
+	identity, ok := auth.IdentityOf(ctx)
+	if !ok {
+		return nil, helper.UnauthenticatedErr("credentials are required", auth.ReasonMissing,
+			map[string]string{"method": method})
+	}
+
+	grant := Grant{Subject: identity.Principal(), Roles: identity.Roles}
+	if len(grant.Roles) == 0 {
+		grant.Roles = policy.defaults
+	}
+	allowed := false
+	for _, role := range grant.Roles {
+		methods := policy.roles[role].Methods
+		allowed = allowed || slices.Contains(methods, AllMethods) || slices.Contains(methods, name)
+		grant.AllTasks = grant.AllTasks || policy.roles[role].AllTasks
+	}
+	if !allowed {
+		policy.logger.Info("Authorize method denied", zap.String("method", method),
+			zap.String("subject", identity.Subject), zap.Strings("roles", grant.Roles))
+		return nil, helper.PermissionDeniedErr("method not allowed", ReasonMethodDenied,
+			map[string]string{"method": method, "subject": identity.Subject})
+	}
+	return WithGrant(ctx, grant), nil
+}
+
+// UnaryInterceptor - authorize a unary call
+func (policy *Policy) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := policy.Authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor - authorize a streaming call
+func (policy *Policy) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := policy.Authorize(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &grantStream{ServerStream: stream, ctx: ctx})
+}
+
+// grantStream - a server stream whose context has the grant
+type grantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *grantStream) Context() context.Context {
+	return stream.ctx
+}
+
+// serviceMethods - the names of the TaskService methods
+func serviceMethods() []string {
+	desc := pbTask.TaskService_ServiceDesc
+	methods := []string{}
+	for _, method := range desc.Methods {
+		methods = append(methods, method.MethodName)
+	}
+	for _, stream := range desc.Streams {
+		methods = append(methods, stream.StreamName)
+	}
+	return methods
+}
+
+// NewPolicy - create a policy of the roles, the identities without roles have the default roles.
+// The calls are not authorized without roles
+func NewPolicy(roles map[string]Role, defaults []string, logger *zap.Logger) (*Policy, error) {
+	known := serviceMethods()
+	for name, role := range roles {
+		for _, method := range role.Methods {
+			if method != AllMethods && !slices.Contains(known, method) {
+				return nil, fmt.Errorf("role %s has an unknown method %q", name, method)
+			}
+		}
+	}
+	for _, name := range defaults {
+		if _, ok := roles[name]; !ok {
+			return nil, fmt.Errorf("default role %s is not defined", name)
+		}
+	}
+	return &Policy{
+		roles:    roles,
+		defaults: defaults,
+		logger:   logger,
+	}, nil
+}
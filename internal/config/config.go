@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type RedisCfg struct {
 	Host       string `yaml:"host"`
 	Port       int    `yaml:"port"`
@@ -9,6 +11,153 @@ type RedisCfg struct {
 	DB         int    `yaml:"db"`
 }
 
+const (
+	StorageRedis  string = "redis"
+	StorageMemory string = "memory"
+	StorageSQL    string = "sql"
+)
+
+type Storage struct {
+	// redis, memory, sql
+	Driver string `yaml:"driver" default:"redis" help:"the task storage backend"`
+}
+
+type SQLCfg struct {
+	// postgres, sqlite3
+	Driver       string `yaml:"driver" help:"the database/sql driver name"`
+	DSN          string `yaml:"dsn" help:"the data source name"`
+	MaxOpenConns int    `yaml:"max-open-conns" help:"the maximum number of open connections"`
+}
+
+type PageToken struct {
+	TTL time.Duration `yaml:"ttl" default:"24h" help:"how long a page token is valid"`
+	// the first key signs new tokens, keep the old keys here until their tokens expire
+	Keys []SigningKey `yaml:"keys" help:"the page token signing keys"`
+}
+
+type SigningKey struct {
+	ID     string `yaml:"id" help:"the key id"`
+	Secret string `yaml:"secret" help:"the HMAC secret"`
+	// keeps the secret out of the config file, it is used instead of secret
+	SecretEnv string `yaml:"secret-env" help:"the environment variable with the HMAC secret"`
+}
+
+type Workflow struct {
+	// the statuses are the names of the task status, e.g. IN_PROGRESS or STATUS_IN_PROGRESS
+	Initial []string `yaml:"initial" help:"the statuses a task can be created with"`
+	// a status without transitions is final, without both the default workflow is used
+	Transitions map[string][]string `yaml:"transitions" help:"the statuses a task can move to from each status"`
+}
+
+type Trash struct {
+	Retention     time.Duration `yaml:"retention" default:"720h" help:"how long a deleted task can be undeleted"`
+	PurgeInterval time.Duration `yaml:"purge-interval" default:"1h" help:"how often the expired tasks are purged"`
+	PurgeBatch    int64         `yaml:"purge-batch" default:"100" help:"the maximum number of tasks purged at once"`
+}
+
+const (
+	ArchiveFile string = "file"
+	ArchiveS3   string = "s3"
+)
+
+type Archive struct {
+	// file, s3, the tasks are not archived without a driver
+	Driver string        `yaml:"driver" help:"the archive sink"`
+	After  time.Duration `yaml:"after" default:"720h" help:"how long after its last update a task is archived"`
+	// the statuses are the names of the task status, by default the ones which do not block other tasks
+	Statuses []string      `yaml:"statuses" help:"the statuses of the archived tasks"`
+	Interval time.Duration `yaml:"interval" default:"1h" help:"how often the tasks are archived"`
+	Batch    int64         `yaml:"batch" default:"500" help:"the maximum number of tasks in an archive object"`
+	Dir      string        `yaml:"dir" help:"the directory of the file archive"`
+	S3       S3Cfg         `yaml:"s3" help:"the S3 compatible archive"`
+}
+
+type S3Cfg struct {
+	Endpoint  string `yaml:"endpoint" help:"the S3 API URL, e.g. https://s3.us-east-1.amazonaws.com"`
+	Region    string `yaml:"region" default:"us-east-1" help:"the region the requests are signed for"`
+	Bucket    string `yaml:"bucket" help:"the bucket name"`
+	Prefix    string `yaml:"prefix" help:"the prefix of the object keys"`
+	AccessKey string `yaml:"access-key" help:"the access key id"`
+	SecretKey string `yaml:"secret-key" help:"the secret access key"`
+	// MinIO and most local stand-ins need it
+	PathStyle bool `yaml:"path-style" help:"address the bucket in the path instead of the host"`
+}
+
+type Webhook struct {
+	MaxAttempts int32         `yaml:"max-attempts" default:"8" help:"how many times a delivery is tried before it is dead-lettered"`
+	Backoff     time.Duration `yaml:"backoff" default:"10s" help:"the wait before the first retry, it doubles with every retry"`
+	MaxBackoff  time.Duration `yaml:"max-backoff" default:"1h" help:"the longest wait between the retries"`
+	Timeout     time.Duration `yaml:"timeout" default:"10s" help:"the timeout of a delivery request"`
+	Interval    time.Duration `yaml:"interval" default:"1s" help:"how often the due deliveries are sent"`
+}
+
+type Tenancy struct {
+	// a request without a tenant uses the default tenant unless one is required
+	Required bool  `yaml:"required" help:"reject the requests without a tenant"`
+	MaxTasks int64 `yaml:"max-tasks" help:"how many tasks a tenant can store, 0 means no limit"`
+	// the default tenant is ""
+	Quotas map[string]int64 `yaml:"quotas" help:"the tenants with another limit than max-tasks"`
+}
+
+type Auth struct {
+	// the requests are not authenticated without api keys and a jwks
+	APIKeys []APIKey `yaml:"api-keys" help:"the static API keys"`
+	JWT     JWT      `yaml:"jwt" help:"the JWT bearer tokens"`
+}
+
+type APIKey struct {
+	Subject string   `yaml:"subject" help:"who uses the key"`
+	Key     string   `yaml:"key" help:"the secret sent in the X-Api-Key header"`
+	Tenant  string   `yaml:"tenant" help:"the only tenant the key can use"`
+	Roles   []string `yaml:"roles" help:"the roles of the subject"`
+}
+
+type JWT struct {
+	// the file is used when both are set
+	JWKSFile    string        `yaml:"jwks-file" help:"the path of the JWKS of the issuer"`
+	JWKSURL     string        `yaml:"jwks-url" help:"the URL of the JWKS of the issuer"`
+	Issuer      string        `yaml:"issuer" help:"the iss claim of the tokens"`
+	Audience    string        `yaml:"audience" help:"the aud claim of the tokens"`
+	TenantClaim string        `yaml:"tenant-claim" default:"tenant" help:"the claim of the only tenant a token can use"`
+	RolesClaim  string        `yaml:"roles-claim" default:"roles" help:"the claim of the roles of a token"`
+	Refresh     time.Duration `yaml:"refresh" default:"1h" help:"how often the JWKS is loaded again"`
+	Leeway      time.Duration `yaml:"leeway" help:"the clock skew allowed in the token times"`
+}
+
+type Authz struct {
+	// the calls are not authorized without roles, the authorization needs the authentication
+	DefaultRoles []string        `yaml:"default-roles" help:"the roles of the identities without roles"`
+	Roles        map[string]Role `yaml:"roles" help:"the roles by their names"`
+}
+
+type Role struct {
+	// the names of the TaskService methods, e.g. GetTask, * is every method
+	Methods  []string `yaml:"methods" help:"the methods the role can call"`
+	AllTasks bool     `yaml:"all-tasks" help:"read, write and delete every task whatever its owner, readers and writers"`
+}
+
+type RateLimit struct {
+	// the calls are not limited without a rate, the token buckets are kept in redis
+	Default Limit            `yaml:"default" help:"the limit of the methods without their own"`
+	Methods map[string]Limit `yaml:"methods" help:"the limits by method name, e.g. CreateTask"`
+	// a client is api-key:<subject>, jwt:<subject> or ip:<address> for the unauthenticated calls
+	Clients map[string]ClientLimits `yaml:"clients" help:"the clients with other limits"`
+	// the address of a client is the one X-Forwarded-For has before the addresses of the proxies
+	TrustedProxies int `yaml:"trusted-proxies" help:"how many proxies in front of the gateway set X-Forwarded-For"`
+}
+
+type ClientLimits struct {
+	// a zero rate uses the default of every client
+	Default Limit            `yaml:"default" help:"the limit of the methods without their own"`
+	Methods map[string]Limit `yaml:"methods" help:"the limits by method name"`
+}
+
+type Limit struct {
+	Rate  int64         `yaml:"rate" help:"the tokens added every per, a call takes one"`
+	Per   time.Duration `yaml:"per" help:"how often rate tokens are added, 1s if it is empty"`
+	Burst int64         `yaml:"burst" help:"the most tokens of a bucket, rate if it is smaller"`
+}
+
 type Log struct {
 	// Debug(-1), Info(0), Warn(1), Error(2), DPanic(3), Panic(4), Fatal(5)
 	Level            int    `default:"1" yaml:"level" help:"the application log level"`
@@ -22,10 +171,27 @@ type Rest struct {
 	Port int    `yaml:"port" help:"the port to bind for REST server"`
 }
 
+type Grpc struct {
+	Host string `yaml:"host" help:"the host to bind for gRPC server"`
+	Port int    `yaml:"port" help:"the port to bind for gRPC server"`
+}
+
 type Config struct {
-	Name   string   `yaml:"name" help:"the application name"`
-	Rest   Rest     `yaml:"rest" help:"the application rest information"`
-	Redis  RedisCfg `yaml:"redis" help:"the application redis option"`
-	NodeID uint64   `yaml:"node-id"`
-	Log    Log      `yaml:"log" help:"the application log"`
+	Name      string    `yaml:"name" help:"the application name"`
+	Rest      Rest      `yaml:"rest" help:"the application rest information"`
+	Grpc      Grpc      `yaml:"grpc" help:"the application grpc information"`
+	Redis     RedisCfg  `yaml:"redis" help:"the application redis option"`
+	SQL       SQLCfg    `yaml:"sql" help:"the application sql database option"`
+	Storage   Storage   `yaml:"storage" help:"the application task storage"`
+	PageToken PageToken `yaml:"page-token" help:"the application page token signing"`
+	Workflow  Workflow  `yaml:"workflow" help:"the application task status workflow"`
+	Trash     Trash     `yaml:"trash" help:"the application deleted task retention"`
+	Archive   Archive   `yaml:"archive" help:"the application old task archival"`
+	Webhook   Webhook   `yaml:"webhook" help:"the application webhook deliveries"`
+	Tenancy   Tenancy   `yaml:"tenancy" help:"the application tenants"`
+	Auth      Auth      `yaml:"auth" help:"the application authentication"`
+	Authz     Authz     `yaml:"authz" help:"the application authorization"`
+	RateLimit RateLimit `yaml:"rate-limit" help:"the application rate limits"`
+	NodeID    uint64    `yaml:"node-id"`
+	Log       Log       `yaml:"log" help:"the application log"`
 }
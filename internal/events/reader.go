@@ -0,0 +1,118 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrInvalidPosition - the position is not an event id
+	ErrInvalidPosition = errors.New("position invalid")
+	// ErrTrimmed - the events after the position may be trimmed from the stream
+	ErrTrimmed = errors.New("position trimmed")
+)
+
+// Reader - read the task events of a redis stream in order without a consumer group,
+// every reader gets every event, e.g. a watch of a client
+type Reader struct {
+	client *redis.Client
+	stream string
+	batch  int64
+	block  time.Duration
+}
+
+// Resume - the position to read after, the latest event for an empty position.
+// It fails if the position is not an event id or the stream does not keep the events after it
+func (reader *Reader) Resume(ctx context.Context, position string) (string, error) {
+	if position == "" {
+		messages, err := reader.client.XRevRangeN(ctx, reader.stream, "+", "-", 1).Result()
+		if err != nil {
+			return "", fmt.Errorf("redis xrevrange error: %w", err)
+		}
+		if len(messages) == 0 {
+			return "0-0", nil
+		}
+		return messages[0].ID, nil
+	}
+	ms, seq, ok := parseID(position)
+	if !ok {
+		return "", ErrInvalidPosition
+	}
+	messages, err := reader.client.XRangeN(ctx, reader.stream, "-", "+", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("redis xrange error: %w", err)
+	}
+	// the position is an event which was read, so it is kept unless the stream is trimmed past it
+	if len(messages) == 0 {
+		return "", ErrTrimmed
+	}
+	oldestMs, oldestSeq, _ := parseID(messages[0].ID)
+	if ms < oldestMs || (ms == oldestMs && seq < oldestSeq) {
+		return "", ErrTrimmed
+	}
+	return position, nil
+}
+
+// Read - the events after the position, waiting up to block for them.
+// It returns no events when none is published in time
+func (reader *Reader) Read(ctx context.Context, position string) ([]*pbTask.TaskEvent, error) {
+	streams, err := reader.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{reader.stream, position},
+		Count:   reader.batch,
+		Block:   reader.block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis xread error: %w", err)
+	}
+	events := []*pbTask.TaskEvent{}
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			event, err := Decode(message)
+			if err != nil {
+				// an entry which is not an event is skipped, the position still moves past it
+				event = &pbTask.TaskEvent{EventId: message.ID}
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// parseID - split a stream entry id into its time and sequence number
+func parseID(id string) (uint64, uint64, bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+// NewReader - create a reader of the event stream, the zero options are the defaults,
+// Group, Consumer, Start and MinIdle are not used
+func NewReader(client *redis.Client, opts Options) *Reader {
+	opts = opts.withDefaults()
+	return &Reader{
+		client: client,
+		stream: opts.Stream,
+		batch:  opts.Batch,
+		block:  opts.Block,
+	}
+}
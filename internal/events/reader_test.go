@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReader(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		server = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: server.Addr()})
+		reader = NewReader(client, Options{Block: time.Millisecond})
+		repo   = repository.NewRedisRepository(client, zap.NewNop())
+	)
+	defer client.Close()
+	position, err := reader.Resume(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "0-0", position)
+
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "2", Name: "b"}))
+	latest, err := reader.Resume(ctx, "")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "0-0", latest)
+
+	events, err := reader.Read(ctx, position)
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, []string{"1", "2"}, []string{events[0].TaskId, events[1].TaskId})
+	assert.Equal(t, latest, events[1].EventId)
+	first := events[0].EventId
+	events, err = reader.Read(ctx, latest)
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	// a resume token is kept until the stream is trimmed past it
+	position, err = reader.Resume(ctx, first)
+	assert.Nil(t, err)
+	assert.Equal(t, first, position)
+	assert.Nil(t, client.XTrimMaxLen(ctx, repository.EventStream, 1).Err())
+	_, err = reader.Resume(ctx, first)
+	assert.ErrorIs(t, err, ErrTrimmed)
+	_, err = reader.Resume(ctx, latest)
+	assert.Nil(t, err)
+	_, err = reader.Resume(ctx, "latest")
+	assert.ErrorIs(t, err, ErrInvalidPosition)
+}
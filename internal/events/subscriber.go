@@ -0,0 +1,211 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// StartNew - a new group only gets the events published after it is created
+	StartNew string = "$"
+	// StartOldest - a new group gets every event the stream still keeps
+	StartOldest string = "0"
+	// DefaultBatch - the maximum number of events read at once when it is not configured
+	DefaultBatch int64 = 100
+	// DefaultBlock - how long a read waits for new events when it is not configured
+	DefaultBlock time.Duration = 5 * time.Second
+	// DefaultMinIdle - how long an event is pending before it is delivered again when it is not configured
+	DefaultMinIdle time.Duration = time.Minute
+)
+
+// Handler - handle an event, it is acknowledged when the handler returns nil,
+// otherwise it is delivered again after MinIdle. An event can be delivered more than once
+type Handler func(ctx context.Context, event *pbTask.TaskEvent) error
+
+// Options - the consumer group of a subscriber, the zero values are the defaults
+type Options struct {
+	// Stream - the event stream, repository.EventStream by default
+	Stream string
+	// Group - the consumer group, the subscribers of a group share its events
+	Group string
+	// Consumer - the name of the subscriber in the group, unique for every instance
+	Consumer string
+	// Start - where a new group starts, StartNew by default or StartOldest
+	Start string
+	// Batch - the maximum number of events read at once
+	Batch int64
+	// Block - how long a read waits for new events
+	Block time.Duration
+	// MinIdle - how long an event is pending before it is delivered again,
+	// e.g. its handler failed or its subscriber stopped
+	MinIdle time.Duration
+}
+
+func (opts Options) withDefaults() Options {
+	if opts.Stream == "" {
+		opts.Stream = repository.EventStream
+	}
+	if opts.Start == "" {
+		opts.Start = StartNew
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = DefaultBatch
+	}
+	if opts.Block <= 0 {
+		opts.Block = DefaultBlock
+	}
+	if opts.MinIdle <= 0 {
+		opts.MinIdle = DefaultMinIdle
+	}
+	return opts
+}
+
+// Subscriber - consume the task events of a redis stream in a consumer group
+type Subscriber struct {
+	client *redis.Client
+	opts   Options
+	logger *zap.Logger
+	// claim - the cursor of the pending events to claim
+	claim string
+}
+
+// Run - handle the events until ctx is done, the group is created if it does not exist
+func (subscriber *Subscriber) Run(ctx context.Context, handler Handler) error {
+	if err := subscriber.createGroup(ctx); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		if _, err := subscriber.Poll(ctx, handler); err != nil && ctx.Err() == nil {
+			subscriber.logger.Error("Subscriber poll error", zap.String("group", subscriber.opts.Group), zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	return nil
+}
+
+// Poll - handle the events pending longer than MinIdle and then the new events, waiting up to Block for them.
+// It returns the number of acknowledged events
+func (subscriber *Subscriber) Poll(ctx context.Context, handler Handler) (int, error) {
+	opts := subscriber.opts
+	claimed, next, err := subscriber.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   opts.Stream,
+		Group:    opts.Group,
+		Consumer: opts.Consumer,
+		MinIdle:  opts.MinIdle,
+		Start:    subscriber.claim,
+		Count:    opts.Batch,
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("redis xautoclaim error: %w", err)
+	}
+	subscriber.claim = next
+	acked, err := subscriber.handle(ctx, claimed, handler)
+	if err != nil {
+		return acked, err
+	}
+
+	streams, err := subscriber.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    opts.Group,
+		Consumer: opts.Consumer,
+		Streams:  []string{opts.Stream, ">"},
+		Count:    opts.Batch,
+		Block:    opts.Block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return acked, nil
+	}
+	if err != nil {
+		return acked, fmt.Errorf("redis xreadgroup error: %w", err)
+	}
+	for _, stream := range streams {
+		n, err := subscriber.handle(ctx, stream.Messages, handler)
+		acked += n
+		if err != nil {
+			return acked, err
+		}
+	}
+	return acked, nil
+}
+
+// handle - run the handler for the messages and acknowledge the handled ones,
+// a message which is not an event can never be handled, so it is acknowledged too
+func (subscriber *Subscriber) handle(ctx context.Context, messages []redis.XMessage, handler Handler) (int, error) {
+	ids := []string{}
+	for _, message := range messages {
+		event, err := Decode(message)
+		if err != nil {
+			subscriber.logger.Error("Subscriber drop invalid event", zap.String("id", message.ID), zap.Error(err))
+			ids = append(ids, message.ID)
+			continue
+		}
+		if err = handler(ctx, event); err != nil {
+			subscriber.logger.Warn("Subscriber handler error", zap.String("id", message.ID), zap.Error(err))
+			continue
+		}
+		ids = append(ids, message.ID)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := subscriber.client.XAck(ctx, subscriber.opts.Stream, subscriber.opts.Group, ids...).Err(); err != nil {
+		return 0, fmt.Errorf("redis xack error: %w", err)
+	}
+	return len(ids), nil
+}
+
+// createGroup - create the group at Start, the stream is created if it does not exist
+func (subscriber *Subscriber) createGroup(ctx context.Context) error {
+	err := subscriber.client.XGroupCreateMkStream(ctx, subscriber.opts.Stream, subscriber.opts.Group, subscriber.opts.Start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("redis xgroup create error: %w", err)
+	}
+	return nil
+}
+
+// Decode - get the event of a stream entry written by the repository scripts
+func Decode(message redis.XMessage) (*pbTask.TaskEvent, error) {
+	data, ok := message.Values["event"].(string)
+	if !ok {
+		return nil, errors.New("event is missing")
+	}
+	event := &pbTask.TaskEvent{}
+	if err := proto.Unmarshal([]byte(data), event); err != nil {
+		return nil, fmt.Errorf("unmarshal event error: %w", err)
+	}
+	event.EventId = message.ID
+	// the scripts add the status of the stored task next to the event
+	if value, ok := message.Values["previous_status"].(string); ok {
+		status, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("previous status invalid: %q", value)
+		}
+		event.PreviousStatus = pbTask.Status(status)
+	}
+	return event, nil
+}
+
+// NewSubscriber - create a subscriber of a consumer group, the group and the consumer are required
+func NewSubscriber(client *redis.Client, opts Options, logger *zap.Logger) (*Subscriber, error) {
+	if opts.Group == "" || opts.Consumer == "" {
+		return nil, errors.New("subscriber group and consumer are required")
+	}
+	return &Subscriber{
+		client: client,
+		opts:   opts.withDefaults(),
+		logger: logger,
+		claim:  "0-0",
+	}, nil
+}
@@ -0,0 +1,133 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newSubscriber - a subscriber of the events of a redis repository on an in-process redis
+func newSubscriber(t *testing.T, opts Options) (*Subscriber, repository.TaskRepository) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := zap.NewNop()
+	subscriber, err := NewSubscriber(client, opts, logger)
+	assert.Nil(t, err)
+	return subscriber, repository.NewRedisRepository(client, logger)
+}
+
+func TestSubscriber(t *testing.T) {
+	var (
+		ctx              = context.Background()
+		subscriber, repo = newSubscriber(t, Options{Group: "g", Consumer: "c", Block: time.Millisecond})
+		events           = []*pbTask.TaskEvent{}
+		collect          = func(ctx context.Context, event *pbTask.TaskEvent) error {
+			events = append(events, event)
+			return nil
+		}
+	)
+	// the group starts with the new events
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "0", Name: "before"}))
+	assert.Nil(t, subscriber.createGroup(ctx))
+	assert.Nil(t, subscriber.createGroup(ctx))
+
+	alice := repository.WithActor(ctx, "alice")
+	task := &pbTask.Task{Id: "1", Name: "a", Status: pbTask.Status_STATUS_IN_PROGRESS}
+	assert.Nil(t, repo.Create(alice, task))
+	task.Status = pbTask.Status_STATUS_COMPLETE
+	assert.Nil(t, repo.Update(alice, task, "1"))
+	assert.ErrorIs(t, repo.Update(alice, task, "1"), repository.ErrConflict)
+	_, err := repo.BatchDelete(ctx, []*pbTask.Task{{Id: "1"}}, []string{"2"}, true)
+	assert.Nil(t, err)
+
+	acked, err := subscriber.Poll(ctx, collect)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, acked)
+	assert.Len(t, events, 3)
+	types := []pbTask.TaskEvent_Type{}
+	for _, event := range events {
+		types = append(types, event.Type)
+		assert.Equal(t, "1", event.TaskId)
+		assert.NotEmpty(t, event.EventId)
+		assert.NotNil(t, event.Time)
+	}
+	assert.Equal(t, []pbTask.TaskEvent_Type{
+		pbTask.TaskEvent_TYPE_CREATED, pbTask.TaskEvent_TYPE_UPDATED, pbTask.TaskEvent_TYPE_DELETED,
+	}, types)
+	// a completed task
+	assert.Equal(t, pbTask.Status_STATUS_IN_PROGRESS, events[1].PreviousStatus)
+	assert.Equal(t, pbTask.Status_STATUS_COMPLETE, events[1].Task.Status)
+	assert.Equal(t, "alice", events[1].Actor)
+	assert.Equal(t, "", events[2].Actor)
+	assert.Equal(t, "3", events[2].Task.Etag)
+
+	acked, err = subscriber.Poll(ctx, collect)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, acked)
+}
+
+func TestSubscriberRedelivery(t *testing.T) {
+	var (
+		ctx              = context.Background()
+		subscriber, repo = newSubscriber(t, Options{Group: "g", Consumer: "c", Start: StartOldest,
+			Block: time.Millisecond, MinIdle: 10 * time.Millisecond})
+		attempts = 0
+		handler  = func(ctx context.Context, event *pbTask.TaskEvent) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("unavailable")
+			}
+			return nil
+		}
+	)
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a"}))
+	assert.Nil(t, subscriber.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: repository.EventStream, Values: []string{"other", "value"}}).Err())
+	assert.Nil(t, subscriber.createGroup(ctx))
+
+	// the invalid event is dropped, the failed one is pending
+	acked, err := subscriber.Poll(ctx, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, acked)
+	acked, _ = subscriber.Poll(ctx, handler)
+	assert.Equal(t, 0, acked)
+
+	time.Sleep(20 * time.Millisecond)
+	acked, err = subscriber.Poll(ctx, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, acked)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestSubscriberRun(t *testing.T) {
+	var (
+		ctx, cancel      = context.WithCancel(context.Background())
+		subscriber, repo = newSubscriber(t, Options{Group: "g", Consumer: "c", Start: StartOldest, Block: time.Millisecond})
+		done             = make(chan error)
+	)
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a"}))
+	go func() {
+		done <- subscriber.Run(ctx, func(ctx context.Context, event *pbTask.TaskEvent) error {
+			cancel()
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not stop")
+	}
+
+	_, err := NewSubscriber(nil, Options{Group: "g"}, zap.NewNop())
+	assert.NotNil(t, err)
+}
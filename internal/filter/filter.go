@@ -0,0 +1,220 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/utils"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+)
+
+const (
+	// FieldStatus - the status of the task, e.g. status = STATUS_COMPLETE
+	FieldStatus string = "status"
+	// FieldName - the name of the task, e.g. name : "report" or name = "daily*"
+	FieldName string = "name"
+	// FieldCreateTime - the creation time of the task, e.g. create_time > "2024-01-01T00:00:00Z"
+	FieldCreateTime string = "create_time"
+)
+
+// Filter - a parsed AIP-160 filter over the tasks
+type Filter struct {
+	root expr
+}
+
+type expr interface {
+	match(task *pbTask.Task) bool
+}
+
+type and []expr
+
+type or []expr
+
+type not struct {
+	expr expr
+}
+
+type restriction struct {
+	field string
+	op    string
+	value string
+	// status and created are the parsed values of the status and create_time fields
+	status  pbTask.Status
+	created time.Time
+}
+
+// Parse - parse a filter, an empty filter matches every task
+func Parse(in string) (*Filter, error) {
+	tokens, err := lex(in)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.done() {
+		return &Filter{}, nil
+	}
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return &Filter{root: root}, nil
+}
+
+// Match - check if the task matches the filter
+func (f *Filter) Match(task *pbTask.Task) bool {
+	if f == nil || f.root == nil {
+		return true
+	}
+	return f.root.match(task)
+}
+
+// Status - get the status every matched task must have, if the filter requires one
+func (f *Filter) Status() (pbTask.Status, bool) {
+	if f == nil {
+		return 0, false
+	}
+	terms := []expr{f.root}
+	if all, ok := f.root.(and); ok {
+		terms = all
+	}
+	for _, term := range terms {
+		if r, ok := term.(*restriction); ok && r.field == FieldStatus && r.op == "=" {
+			return r.status, true
+		}
+	}
+	return 0, false
+}
+
+func (e and) match(task *pbTask.Task) bool {
+	for _, sub := range e {
+		if !sub.match(task) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e or) match(task *pbTask.Task) bool {
+	for _, sub := range e {
+		if sub.match(task) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e not) match(task *pbTask.Task) bool {
+	return !e.expr.match(task)
+}
+
+func (r *restriction) match(task *pbTask.Task) bool {
+	switch r.field {
+	case FieldStatus:
+		if r.op == "=" {
+			return task.Status == r.status
+		}
+		return task.Status != r.status
+	case FieldName:
+		switch r.op {
+		case ":":
+			return strings.Contains(strings.ToLower(task.Name), strings.ToLower(r.value))
+		case "=":
+			return wildcard(r.value, task.Name)
+		default:
+			return !wildcard(r.value, task.Name)
+		}
+	case FieldCreateTime:
+		// the tasks created before create_time existed only have the time in their ids
+		if task.CreateTime != nil {
+			return compareTime(r.op, task.CreateTime.AsTime(), r.created)
+		}
+		created, err := utils.GetTimeByID(task.Id)
+		if err != nil {
+			return false
+		}
+		return compareTime(r.op, created, r.created)
+	}
+	return false
+}
+
+// newRestriction - check the comparator and the value of a field
+func newRestriction(field string, op string, value string) (*restriction, error) {
+	r := &restriction{field: field, op: op, value: value}
+	switch field {
+	case FieldStatus:
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("operator %s is not supported by %s", op, field)
+		}
+		status, ok := pbTask.Status_value[value]
+		if !ok {
+			num, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status: %s", value)
+			}
+			status = int32(num)
+		}
+		if _, ok = pbTask.Status_name[status]; !ok {
+			return nil, fmt.Errorf("invalid status: %s", value)
+		}
+		r.status = pbTask.Status(status)
+	case FieldName:
+		if op != "=" && op != "!=" && op != ":" {
+			return nil, fmt.Errorf("operator %s is not supported by %s", op, field)
+		}
+	case FieldCreateTime:
+		if op == ":" {
+			return nil, fmt.Errorf("operator %s is not supported by %s", op, field)
+		}
+		created, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time: %s, it must be RFC 3339", value)
+		}
+		r.created = created
+	default:
+		return nil, fmt.Errorf("unknown field: %s", field)
+	}
+	return r, nil
+}
+
+func compareTime(op string, a time.Time, b time.Time) bool {
+	switch op {
+	case "=":
+		return a.Equal(b)
+	case "!=":
+		return !a.Equal(b)
+	case "<":
+		return a.Before(b)
+	case "<=":
+		return !a.After(b)
+	case ">":
+		return a.After(b)
+	case ">=":
+		return !a.Before(b)
+	}
+	return false
+}
+
+// wildcard - match s with a pattern where * matches any text
+func wildcard(pattern string, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,125 @@
+package filter
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// taskAt - a task whose id was generated at the time
+func taskAt(name string, status pbTask.Status, at time.Time) *pbTask.Task {
+	// 2022-01-01 00:00:00 is the base epoch of the ids
+	millis := uint64(at.UnixMilli()-1640966400000) << 22
+	return &pbTask.Task{
+		Id:     new(big.Int).SetUint64(millis).String(),
+		Name:   name,
+		Status: status,
+	}
+}
+
+func TestMatch(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	report := taskAt("Weekly report", pbTask.Status_STATUS_INCOMPLETE, day)
+	review := taskAt("daily review", pbTask.Status_STATUS_COMPLETE, day.Add(48*time.Hour))
+
+	tests := []struct {
+		filter string
+		report bool
+		review bool
+	}{
+		{"", true, true},
+		{"status = STATUS_INCOMPLETE", true, false},
+		{"status != STATUS_INCOMPLETE", false, true},
+		{"status = 1", false, true},
+		{`name : "REPORT"`, true, false},
+		{`name = "daily*"`, false, true},
+		{`name = "*review"`, false, true},
+		{`name != "daily review"`, true, false},
+		{"review", false, true},
+		{`create_time > "2024-01-03T00:00:00Z"`, false, true},
+		{`create_time <= "2024-01-02T00:00:00Z"`, true, false},
+		{`create_time = "2024-01-02T00:00:00Z"`, true, false},
+		{`status = STATUS_COMPLETE OR name : report`, true, true},
+		{`status = STATUS_COMPLETE AND name : report`, false, false},
+		{`status = STATUS_COMPLETE name : review`, false, true},
+		{`NOT status = STATUS_COMPLETE`, true, false},
+		{`-name : review`, true, false},
+		{`(name : weekly OR name : daily) AND status = STATUS_COMPLETE`, false, true},
+	}
+	for _, test := range tests {
+		f, err := Parse(test.filter)
+		if !assert.NoError(t, err, test.filter) {
+			continue
+		}
+		assert.Equal(t, test.report, f.Match(report), test.filter)
+		assert.Equal(t, test.review, f.Match(review), test.filter)
+	}
+
+	// create_time is preferred to the time in the id
+	review.CreateTime = timestamppb.New(day)
+	f, _ := Parse(`create_time = "2024-01-02T00:00:00Z"`)
+	assert.True(t, f.Match(review))
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"status = DONE",
+		"status > 1",
+		"owner = me",
+		`name = "open`,
+		"(status = 1",
+		"status = 1)",
+		"name :",
+		"create_time > yesterday",
+		"AND name : a",
+		"name ! a",
+	} {
+		_, err := Parse(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		filter string
+		status pbTask.Status
+		ok     bool
+	}{
+		{"", 0, false},
+		{"status = STATUS_COMPLETE", pbTask.Status_STATUS_COMPLETE, true},
+		{"name : a AND status = STATUS_COMPLETE", pbTask.Status_STATUS_COMPLETE, true},
+		{"name : a status = STATUS_INCOMPLETE", pbTask.Status_STATUS_INCOMPLETE, true},
+		{"status != STATUS_COMPLETE", 0, false},
+		{"status = STATUS_COMPLETE OR name : a", 0, false},
+	}
+	for _, test := range tests {
+		f, err := Parse(test.filter)
+		assert.NoError(t, err)
+		status, ok := f.Status()
+		assert.Equal(t, test.ok, ok, test.filter)
+		assert.Equal(t, test.status, status, test.filter)
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	desc, err := ParseOrder("")
+	assert.NoError(t, err)
+	assert.False(t, desc)
+
+	desc, err = ParseOrder("create_time desc")
+	assert.NoError(t, err)
+	assert.True(t, desc)
+
+	desc, err = ParseOrder(" id  asc ")
+	assert.NoError(t, err)
+	assert.False(t, desc)
+
+	_, err = ParseOrder("name")
+	assert.Error(t, err)
+	_, err = ParseOrder("id up")
+	assert.Error(t, err)
+}
@@ -0,0 +1,29 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseOrder - parse an AIP-132 order_by, the tasks can be ordered by id or create_time,
+// which is the same order since the id is generated by time.
+// It returns true when the order is descending, e.g. "create_time desc"
+func ParseOrder(in string) (bool, error) {
+	fields := strings.Fields(in)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	if len(fields) > 2 || (fields[0] != "id" && fields[0] != FieldCreateTime) {
+		return false, fmt.Errorf("unsupported order: %s, only id or create_time is supported", in)
+	}
+	if len(fields) == 1 {
+		return false, nil
+	}
+	switch fields[1] {
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	}
+	return false, fmt.Errorf("unsupported direction: %s", fields[1])
+}
@@ -0,0 +1,210 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type kind int
+
+const (
+	tWord kind = iota
+	tString
+	tComparator
+	tLParen
+	tRParen
+	tMinus
+)
+
+type token struct {
+	kind kind
+	text string
+	pos  int
+}
+
+// lex - split a filter into tokens
+func lex(in string) ([]token, error) {
+	var (
+		tokens []token
+		runes  = []rune(in)
+	)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tRParen, text: ")", pos: i})
+			i++
+		case r == '"' || r == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tString, text: sb.String(), pos: i})
+			i = j + 1
+		case strings.ContainsRune("=!<>:", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && r != '=' && r != ':' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected ! at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tComparator, text: op, pos: i})
+			i += len(op)
+		case r == '-' && (len(tokens) == 0 || tokens[len(tokens)-1].kind != tComparator):
+			// a minus in front of a term negates it, e.g. -status = STATUS_COMPLETE
+			tokens = append(tokens, token{kind: tMinus, text: "-", pos: i})
+			i++
+		default:
+			j := i
+			for ; j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()"'=!<>:`, runes[j]); j++ {
+			}
+			tokens = append(tokens, token{kind: tWord, text: string(runes[i:j]), pos: i})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// parser - a recursive descent parser of the AIP-160 grammar:
+//
+//	expression  = sequence { "AND" sequence }
+//	sequence    = factor { factor }
+//	factor      = term { "OR" term }
+//	term        = [ "NOT" | "-" ] simple
+//	simple      = restriction | "(" expression ")"
+//	restriction = comparable [ comparator arg ]
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) keyword(word string) bool {
+	return !p.done() && p.peek().kind == tWord && p.peek().text == word
+}
+
+func (p *parser) expression() (expr, error) {
+	var all and
+	for {
+		seq, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, seq...)
+		if !p.keyword("AND") {
+			break
+		}
+		p.pos++
+	}
+	if len(all) == 1 {
+		return all[0], nil
+	}
+	return all, nil
+}
+
+func (p *parser) sequence() (and, error) {
+	var seq and
+	for {
+		factor, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, factor)
+		if p.done() || p.peek().kind == tRParen || p.keyword("AND") {
+			return seq, nil
+		}
+	}
+}
+
+func (p *parser) factor() (expr, error) {
+	var anyOf or
+	for {
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		anyOf = append(anyOf, term)
+		if !p.keyword("OR") {
+			break
+		}
+		p.pos++
+	}
+	if len(anyOf) == 1 {
+		return anyOf[0], nil
+	}
+	return anyOf, nil
+}
+
+func (p *parser) term() (expr, error) {
+	if p.keyword("NOT") || (!p.done() && p.peek().kind == tMinus) {
+		p.pos++
+		simple, err := p.simple()
+		if err != nil {
+			return nil, err
+		}
+		return not{expr: simple}, nil
+	}
+	return p.simple()
+}
+
+func (p *parser) simple() (expr, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	current := p.peek()
+	switch current.kind {
+	case tLParen:
+		p.pos++
+		inner, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.peek().kind != tRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", current.pos)
+		}
+		p.pos++
+		return inner, nil
+	case tWord, tString:
+		if current.kind == tWord && (current.text == "AND" || current.text == "OR" || current.text == "NOT") {
+			return nil, fmt.Errorf("unexpected %s at position %d", current.text, current.pos)
+		}
+		p.pos++
+		if p.done() || p.peek().kind != tComparator {
+			// a value alone searches the name of the task
+			return newRestriction(FieldName, ":", current.text)
+		}
+		if current.kind == tString {
+			return nil, fmt.Errorf("unexpected string at position %d, expect a field", current.pos)
+		}
+		op := p.peek()
+		p.pos++
+		if p.done() || (p.peek().kind != tWord && p.peek().kind != tString) {
+			return nil, fmt.Errorf("missing value after %s at position %d", op.text, op.pos)
+		}
+		value := p.peek()
+		p.pos++
+		return newRestriction(current.text, op.text, value.text)
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", current.text, current.pos)
+}
@@ -2,10 +2,12 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 func NotFoundErr(msg string, field string, resourceId string) error {
@@ -22,6 +24,20 @@ func NotFoundErr(msg string, field string, resourceId string) error {
 	return st.Err()
 }
 
+func AlreadyExistsErr(msg string, field string, resourceId string) error {
+	st := status.New(codes.AlreadyExists, msg)
+	v := &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf("'%s' already exists", resourceId),
+	}
+
+	badReq := &errdetails.BadRequest{}
+	badReq.FieldViolations = append(badReq.FieldViolations, v)
+
+	st, _ = st.WithDetails(badReq)
+	return st.Err()
+}
+
 func RequiredFieldErr(msg string, field string) error {
 	st := status.New(codes.InvalidArgument, msg)
 	v := &errdetails.BadRequest_FieldViolation{
@@ -64,7 +80,101 @@ func BadRequestErr(msg string, field string, description string) error {
 	return st.Err()
 }
 
+const (
+	// EtagViolation - the precondition failure type of an etag mismatch
+	EtagViolation string = "ETAG"
+	// TransitionViolation - the precondition failure type of a status change the workflow does not allow
+	TransitionViolation string = "STATUS_TRANSITION"
+	// DependencyViolation - the precondition failure type of a dependency cycle or an incomplete blocker
+	DependencyViolation string = "DEPENDENCY"
+	// SubtaskViolation - the precondition failure type of deleting a task with subtasks
+	SubtaskViolation string = "SUBTASKS"
+	// RequestViolation - the precondition failure type of a request id used by a request with another payload
+	RequestViolation string = "REQUEST_ID"
+)
+
+func FailedPreconditionErr(msg string, violationType string, subject string, description string) error {
+	st := status.New(codes.FailedPrecondition, msg)
+	v := &errdetails.PreconditionFailure_Violation{
+		Type:        violationType,
+		Subject:     subject,
+		Description: description,
+	}
+
+	failure := &errdetails.PreconditionFailure{}
+	failure.Violations = append(failure.Violations, v)
+
+	st, _ = st.WithDetails(failure)
+	return st.Err()
+}
+
+func ResourceExhaustedErr(msg string, subject string, description string) error {
+	st := status.New(codes.ResourceExhausted, msg)
+	v := &errdetails.QuotaFailure_Violation{
+		Subject:     subject,
+		Description: description,
+	}
+
+	failure := &errdetails.QuotaFailure{}
+	failure.Violations = append(failure.Violations, v)
+
+	st, _ = st.WithDetails(failure)
+	return st.Err()
+}
+
+func RateLimitErr(msg string, subject string, description string, retryDelay time.Duration) error {
+	st := status.New(codes.ResourceExhausted, msg)
+	v := &errdetails.QuotaFailure_Violation{
+		Subject:     subject,
+		Description: description,
+	}
+
+	failure := &errdetails.QuotaFailure{}
+	failure.Violations = append(failure.Violations, v)
+	retry := &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}
+
+	st, _ = st.WithDetails(failure, retry)
+	return st.Err()
+}
+
+// ErrorDomain - the domain of the ErrorInfo details
+const ErrorDomain string = "task.v1"
+
+func UnauthenticatedErr(msg string, reason string, metadata map[string]string) error {
+	st := status.New(codes.Unauthenticated, msg)
+	info := &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	}
+
+	st, _ = st.WithDetails(info)
+	return st.Err()
+}
+
+func PermissionDeniedErr(msg string, reason string, metadata map[string]string) error {
+	st := status.New(codes.PermissionDenied, msg)
+	info := &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	}
+
+	st, _ = st.WithDetails(info)
+	return st.Err()
+}
+
+func AbortedErr(msg string) error {
+	st := status.New(codes.Aborted, msg)
+	return st.Err()
+}
+
 func InternalErr(msg string) error {
 	st := status.New(codes.Internal, msg)
 	return st.Err()
 }
+
+func UnimplementedErr(msg string) error {
+	st := status.New(codes.Unimplemented, msg)
+	return st.Err()
+}
@@ -1,24 +1,717 @@
 package helper
 
+// searchIndex - the functions of the scripts maintaining the search index with a key prefix:
+// the sorted set <prefix>:term:<term> scores the ids of the tasks with the term by its weight,
+// the sorted set <prefix>:terms has every term for the prefix matches and the set <prefix>:gram:<gram>
+// has the terms with the trigram for the fuzzy matches. The terms are split as search.Tokenize does
+const searchIndex string = `
+	local function searchTerms(task)
+		local terms = {}
+		for field, weight in pairs({name = 2, description = 1}) do
+			local seen = {}
+			local text = task[field]
+			if (type(text) ~= "string") then
+				text = ""
+			end
+			for term in string.gmatch(string.lower(text), "[%w\128-\255]+") do
+				if (#term <= 64 and not seen[term]) then
+					seen[term] = true
+					terms[term] = (terms[term] or 0) + weight
+				end
+			end
+		end
+		return terms
+	end
+	local function searchGrams(term)
+		local padded = "^" .. term .. "$"
+		local grams = {}
+		for i = 1, #padded - 2 do
+			grams[string.sub(padded, i, i + 2)] = true
+		end
+		return grams
+	end
+	local function indexTask(prefix, id, task)
+		for term, weight in pairs(searchTerms(task)) do
+			local key = prefix .. ":term:" .. term
+			if (redis.call("EXISTS", key) == 0) then
+				redis.call("ZADD", prefix .. ":terms", 0, term)
+				for gram in pairs(searchGrams(term)) do
+					redis.call("SADD", prefix .. ":gram:" .. gram, term)
+				end
+			end
+			redis.call("ZADD", key, weight, id)
+		end
+	end
+	local function unindexTask(prefix, id, task)
+		for term in pairs(searchTerms(task)) do
+			local key = prefix .. ":term:" .. term
+			redis.call("ZREM", key, id)
+			if (redis.call("EXISTS", key) == 0) then
+				redis.call("ZREM", prefix .. ":terms", term)
+				for gram in pairs(searchGrams(term)) do
+					redis.call("SREM", prefix .. ":gram:" .. gram, term)
+				end
+			end
+		end
+	end
+	local function reindexTask(prefix, id, old, task)
+		if ((old["name"] or "") == (task["name"] or "") and (old["description"] or "") == (task["description"] or "")) then
+			return
+		end
+		unindexTask(prefix, id, old)
+		indexTask(prefix, id, task)
+	end
+`
+
+// requestCheck - the functions of the scripts keeping the idempotency keys of the creates:
+// the hash <key> has the id of the task created by the request and the hash of its payload until it expires
+const requestCheck string = `
+	local function checkRequest(key, hash)
+		if (key == "") then
+			return nil
+		end
+		local request = redis.call("HMGET", key, "task", "hash")
+		if (not request[1]) then
+			return nil
+		end
+		if (request[2] ~= hash) then
+			return "REQUEST_MISMATCH"
+		end
+		return "REPLAYED " .. request[1]
+	end
+	local function saveRequest(key, id, hash, ttl)
+		if (key ~= "") then
+			redis.call("HSET", key, "task", id, "hash", hash)
+			redis.call("PEXPIRE", key, ttl)
+		end
+	end
+`
+
+// blockerCheck - the function of the scripts completing a task only when the tasks it depends on
+// with the key prefix are resolved, its status is COMPLETE (1), CANCELLED (4) or ARCHIVED (5),
+// a dependency which does not exist or is deleted does not block
+const blockerCheck string = `
+	local function checkBlockers(prefix, old, task)
+		if ((task["status"] or 0) ~= 1 or (old["status"] or 0) == 1) then
+			return nil
+		end
+		for _, id in ipairs(task["depends_on"] or {}) do
+			local val = redis.call("GET", prefix .. id)
+			if (val) then
+				local blocker = cjson.decode(val)
+				local status = blocker["status"] or 0
+				if (not blocker["delete_time"] and status ~= 1 and status ~= 4 and status ~= 5) then
+					return "BLOCKED"
+				end
+			end
+		end
+		return nil
+	end
+`
+
 var (
-	AddTask string = `
+	// AddTask - save the task and add its id ARGV[2] to the sorted set KEYS[2] and the status index KEYS[3],
+	// if the task has a parent, the parent task with the key prefix ARGV[3] must exist and must not be
+	// in the trash ARGV[5], and the id is added to its children index with the prefix ARGV[4].
+	// The revision is added to the stream with the prefix ARGV[6] with the actor ARGV[7]
+	// and the event ARGV[10] to the event stream ARGV[8] trimmed to about ARGV[9] events.
+	// The task is added to the search index with the prefix ARGV[11].
+	// The sorted set can have at most ARGV[12] tasks if it is not 0, the tenant ARGV[14] is added to the set ARGV[13]
+	// if it is not the default one. If the request key ARGV[15] is not "", the task is only saved when it has
+	// no task yet, then its task and the payload hash ARGV[16] are kept for ARGV[17] milliseconds.
+	// It replies REPLAYED <id> with the task of the request, or REQUEST_MISMATCH if it had another payload
+	AddTask string = searchIndex + requestCheck + `
+		local replay = checkRequest(ARGV[15], ARGV[16])
+		if (replay) then
+			return redis.error_reply(replay)
+		end
+		local task = cjson.decode(ARGV[1])
+		local parent = task["parent_id"] or ""
+		if (parent ~= "" and (redis.call("EXISTS", ARGV[3] .. parent) == 0 or redis.call("ZSCORE", ARGV[5], parent))) then
+			return redis.error_reply("PARENT_NOT_FOUND")
+		end
+		if (tonumber(ARGV[12]) > 0 and redis.call("ZCARD", KEYS[2]) >= tonumber(ARGV[12])) then
+			return redis.error_reply("QUOTA_EXCEEDED")
+		end
 		redis.call("SET", KEYS[1], ARGV[1])
-		local op = redis.pcall("ZADD", KEYS[2], ARGV[2], ARGV[2])
+		local op = redis.pcall("ZADD", KEYS[2], 0, ARGV[2])
 		if (op ~= 1) then
 			redis.call("DEL", KEYS[1])
 			error(op)
 		end
+		redis.call("ZADD", KEYS[3], 0, ARGV[2])
+		if (parent ~= "") then
+			redis.call("ZADD", ARGV[4] .. parent, 0, ARGV[2])
+		end
+		indexTask(ARGV[11], ARGV[2], task)
+		if (ARGV[14] ~= "") then
+			redis.call("SADD", ARGV[13], ARGV[14])
+		end
+		saveRequest(ARGV[15], ARGV[2], ARGV[16], ARGV[17])
+		redis.call("XADD", ARGV[6] .. ARGV[2], "*", "action", "ACTION_CREATE", "actor", ARGV[7], "task", ARGV[1])
+		redis.call("XADD", ARGV[8], "MAXLEN", "~", ARGV[9], "*", "event", ARGV[10])
+		return
+	`
+	// UpdateTask - overwrite the task only if its etag is still ARGV[1],
+	// then move its id ARGV[3] to the status index with the prefix ARGV[4].
+	// The revision is added to the stream with the prefix ARGV[5] with the actor ARGV[6]
+	// and the event ARGV[9] to the event stream ARGV[7] trimmed to about ARGV[8] events.
+	// The task is reindexed in the search index with the prefix ARGV[10] if its text changed.
+	// A task is only completed when the tasks it depends on with the key prefix ARGV[11] are resolved
+	UpdateTask string = searchIndex + blockerCheck + `
+		local val = redis.call("GET", KEYS[1])
+		if (not val) then
+			return redis.error_reply("NOT_FOUND")
+		end
+		local old = cjson.decode(val)
+		if ((old["etag"] or "") ~= ARGV[1]) then
+			return redis.error_reply("CONFLICT")
+		end
+		local task = cjson.decode(ARGV[2])
+		local blocked = checkBlockers(ARGV[11], old, task)
+		if (blocked) then
+			return redis.error_reply(blocked)
+		end
+		redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+		local before = old["status"] or 0
+		local after = task["status"] or 0
+		if (before ~= after) then
+			redis.call("ZREM", ARGV[4] .. before, ARGV[3])
+		end
+		redis.call("ZADD", ARGV[4] .. after, 0, ARGV[3])
+		reindexTask(ARGV[10], ARGV[3], old, task)
+		redis.call("XADD", ARGV[5] .. ARGV[3], "*", "action", "ACTION_UPDATE", "actor", ARGV[6], "task", ARGV[2])
+		redis.call("XADD", ARGV[7], "MAXLEN", "~", ARGV[8], "*", "event", ARGV[9], "previous_status", before)
 		return
 	`
 
-	DeleteTask string = `
+	// DeleteTask - move the task KEYS[1] to the trash KEYS[2] only if its etag is still ARGV[1],
+	// ARGV[2] is the deleted task, ARGV[3] is its id and ARGV[6] is its expire time in milliseconds.
+	// Its id is removed from the status index with the prefix ARGV[4] and from the children index
+	// of its parent with the prefix ARGV[5], a task with subtasks which are not deleted is not deleted.
+	// The revision is added to the stream with the prefix ARGV[7] with the actor ARGV[8]
+	// and the event ARGV[11] to the event stream ARGV[9] trimmed to about ARGV[10] events.
+	// The task is removed from the search index with the prefix ARGV[12]
+	DeleteTask string = searchIndex + `
 		local val = redis.call("GET", KEYS[1])
-		redis.call("DEL", KEYS[1])
-		local op = redis.pcall("ZREM", KEYS[2], ARGV[1])
-		if (op ~= 1) then 
-			redis.call("SET", KEYS[1], val)
-			error(op)
+		if (not val) then
+			return redis.error_reply("NOT_FOUND")
+		end
+		local old = cjson.decode(val)
+		if ((old["etag"] or "") ~= ARGV[1]) then
+			return redis.error_reply("CONFLICT")
+		end
+		if (redis.call("EXISTS", ARGV[5] .. ARGV[3]) == 1) then
+			return redis.error_reply("HAS_CHILDREN")
+		end
+		redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+		redis.call("ZREM", ARGV[4] .. (old["status"] or 0), ARGV[3])
+		local parent = old["parent_id"] or ""
+		if (parent ~= "") then
+			redis.call("ZREM", ARGV[5] .. parent, ARGV[3])
+		end
+		redis.call("ZADD", KEYS[2], ARGV[6], ARGV[3])
+		unindexTask(ARGV[12], ARGV[3], old)
+		redis.call("XADD", ARGV[7] .. ARGV[3], "*", "action", "ACTION_DELETE", "actor", ARGV[8], "task", ARGV[2])
+		redis.call("XADD", ARGV[9], "MAXLEN", "~", ARGV[10], "*", "event", ARGV[11], "previous_status", old["status"] or 0)
+		return
+	`
+
+	// UndeleteTask - restore the task KEYS[1] from the trash KEYS[2] only if its etag is still ARGV[1],
+	// ARGV[2] is the restored task and ARGV[3] is its id. Its id is added back to the status index
+	// with the prefix ARGV[4] and to the children index of its parent with the prefix ARGV[5],
+	// the parent with the key prefix ARGV[6] must exist and must not be in the trash.
+	// The revision is added to the stream with the prefix ARGV[7] with the actor ARGV[8]
+	// and the event ARGV[11] to the event stream ARGV[9] trimmed to about ARGV[10] events.
+	// The task is added back to the search index with the prefix ARGV[12]
+	UndeleteTask string = searchIndex + `
+		local val = redis.call("GET", KEYS[1])
+		if (not val) then
+			return redis.error_reply("NOT_FOUND")
+		end
+		local old = cjson.decode(val)
+		if ((old["etag"] or "") ~= ARGV[1]) then
+			return redis.error_reply("CONFLICT")
+		end
+		local task = cjson.decode(ARGV[2])
+		local parent = task["parent_id"] or ""
+		if (parent ~= "" and (redis.call("EXISTS", ARGV[6] .. parent) == 0 or redis.call("ZSCORE", KEYS[2], parent))) then
+			return redis.error_reply("PARENT_NOT_FOUND")
+		end
+		redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+		redis.call("ZREM", KEYS[2], ARGV[3])
+		redis.call("ZADD", ARGV[4] .. (task["status"] or 0), 0, ARGV[3])
+		if (parent ~= "") then
+			redis.call("ZADD", ARGV[5] .. parent, 0, ARGV[3])
+		end
+		indexTask(ARGV[12], ARGV[3], task)
+		redis.call("XADD", ARGV[7] .. ARGV[3], "*", "action", "ACTION_UNDELETE", "actor", ARGV[8], "task", ARGV[2])
+		redis.call("XADD", ARGV[9], "MAXLEN", "~", ARGV[10], "*", "event", ARGV[11], "previous_status", old["status"] or 0)
+		return
+	`
+
+	// PurgeTasks - permanently delete up to ARGV[2] of the tasks in the trash KEYS[1] which expire
+	// before ARGV[1] in milliseconds and remove them from the sorted set KEYS[2], the task keys have
+	// the prefix ARGV[3], the children indexes have the prefix ARGV[4] and the revision streams have
+	// the prefix ARGV[5]. It replies the purged ids
+	PurgeTasks string = `
+		local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", "(" .. ARGV[1], "LIMIT", 0, ARGV[2])
+		for _, id in ipairs(ids) do
+			redis.call("DEL", ARGV[3] .. id)
+			redis.call("DEL", ARGV[4] .. id)
+			redis.call("DEL", ARGV[5] .. id)
+			redis.call("ZREM", KEYS[2], id)
+			redis.call("ZREM", KEYS[1], id)
+		end
+		return ids
+	`
+
+	// AddDependency - overwrite the task KEYS[1] only if its etag is still ARGV[1], ARGV[2] is the task
+	// which got the dependency ARGV[3] and ARGV[5] is its id. The dependency with the key prefix ARGV[4]
+	// must exist, must not be in the trash ARGV[6] and must not depend on the task, directly or not.
+	// The revision is added to the stream with the prefix ARGV[7] with the actor ARGV[8]
+	// and the event ARGV[11] to the event stream ARGV[9] trimmed to about ARGV[10] events
+	AddDependency string = `
+		local val = redis.call("GET", KEYS[1])
+		if (not val) then
+			return redis.error_reply("NOT_FOUND")
+		end
+		local old = cjson.decode(val)
+		if ((old["etag"] or "") ~= ARGV[1]) then
+			return redis.error_reply("CONFLICT")
+		end
+		if (redis.call("EXISTS", ARGV[4] .. ARGV[3]) == 0 or redis.call("ZSCORE", ARGV[6], ARGV[3])) then
+			return redis.error_reply("DEPENDENCY_NOT_FOUND")
+		end
+		local queue = {ARGV[3]}
+		local visited = {[ARGV[3]] = true}
+		local i = 1
+		while (i <= #queue) do
+			if (queue[i] == ARGV[5]) then
+				return redis.error_reply("CYCLE")
+			end
+			local dep = redis.call("GET", ARGV[4] .. queue[i])
+			if (dep) then
+				for _, id in ipairs(cjson.decode(dep)["depends_on"] or {}) do
+					if (not visited[id]) then
+						visited[id] = true
+						table.insert(queue, id)
+					end
+				end
+			end
+			i = i + 1
 		end
+		redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+		redis.call("XADD", ARGV[7] .. ARGV[5], "*", "action", "ACTION_UPDATE", "actor", ARGV[8], "task", ARGV[2])
+		redis.call("XADD", ARGV[9], "MAXLEN", "~", ARGV[10], "*", "event", ARGV[11], "previous_status", old["status"] or 0)
 		return
 	`
+
+	// BatchAddTask - save the tasks KEYS[2i] with the status indexes KEYS[2i+1] and add them to the sorted set KEYS[1],
+	// ARGV[5i+4] is the task, ARGV[5i+5] is its id, ARGV[5i+6] is its event, ARGV[5i+7] is the key of its request
+	// and ARGV[5i+8] is the payload hash of the request. The parent of a task with the key prefix ARGV[2]
+	// must exist before the batch and must not be in the trash ARGV[4],
+	// the id is added to its children index with the prefix ARGV[3].
+	// The revisions are added to the streams with the prefix ARGV[5] with the actor ARGV[6]
+	// and the events to the event stream ARGV[7] trimmed to about ARGV[8] events.
+	// The tasks are added to the search index with the prefix ARGV[5n+9] after the n tasks,
+	// the sorted set can have at most ARGV[5n+10] tasks if it is not 0 and the tenant ARGV[5n+12]
+	// is added to the set ARGV[5n+11] if it is not the default one. The requests are kept for ARGV[5n+13] milliseconds.
+	// It replies OK, ALREADY_EXISTS, PARENT_NOT_FOUND, QUOTA_EXCEEDED, REQUEST_MISMATCH or REPLAYED <id> for each task,
+	// if ARGV[1] is "1" nothing is saved when any of them fails, a replayed request does not fail
+	BatchAddTask string = searchIndex + requestCheck + `
+		local n = (#KEYS - 1) / 2
+		local tail = 5 * n + 9
+		local quota = tonumber(ARGV[tail + 1])
+		local count = redis.call("ZCARD", KEYS[1])
+		local codes = {}
+		local tasks = {}
+		local parents = {}
+		local failed = false
+		for i = 1, n do
+			codes[i] = "OK"
+			tasks[i] = cjson.decode(ARGV[5 * i + 4])
+			parents[i] = tasks[i]["parent_id"] or ""
+			local replay = checkRequest(ARGV[5 * i + 7], ARGV[5 * i + 8])
+			if (replay) then
+				codes[i] = replay
+				failed = failed or replay == "REQUEST_MISMATCH"
+			elseif (redis.call("EXISTS", KEYS[2 * i]) == 1) then
+				codes[i] = "ALREADY_EXISTS"
+				failed = true
+			elseif (parents[i] ~= "" and (redis.call("EXISTS", ARGV[2] .. parents[i]) == 0 or redis.call("ZSCORE", ARGV[4], parents[i]))) then
+				codes[i] = "PARENT_NOT_FOUND"
+				failed = true
+			elseif (quota > 0 and count >= quota) then
+				codes[i] = "QUOTA_EXCEEDED"
+				failed = true
+			else
+				count = count + 1
+			end
+		end
+		if (failed and ARGV[1] == "1") then
+			return codes
+		end
+		for i = 1, n do
+			if (codes[i] == "OK") then
+				local id = ARGV[5 * i + 5]
+				redis.call("SET", KEYS[2 * i], ARGV[5 * i + 4])
+				redis.call("ZADD", KEYS[1], 0, id)
+				redis.call("ZADD", KEYS[2 * i + 1], 0, id)
+				if (parents[i] ~= "") then
+					redis.call("ZADD", ARGV[3] .. parents[i], 0, id)
+				end
+				indexTask(ARGV[tail], id, tasks[i])
+				if (ARGV[tail + 3] ~= "") then
+					redis.call("SADD", ARGV[tail + 2], ARGV[tail + 3])
+				end
+				saveRequest(ARGV[5 * i + 7], id, ARGV[5 * i + 8], ARGV[tail + 4])
+				redis.call("XADD", ARGV[5] .. id, "*", "action", "ACTION_CREATE", "actor", ARGV[6], "task", ARGV[5 * i + 4])
+				redis.call("XADD", ARGV[7], "MAXLEN", "~", ARGV[8], "*", "event", ARGV[5 * i + 6])
+			end
+		end
+		return codes
+	`
+
+	// BatchUpdateTask - overwrite the tasks KEYS[i] only if their etags are still ARGV[4i+3],
+	// ARGV[4i+4] is the task, ARGV[4i+5] is its id and ARGV[4i+6] is its event, the status indexes have the prefix ARGV[2].
+	// The revisions are added to the streams with the prefix ARGV[3] with the actor ARGV[4]
+	// and the events to the event stream ARGV[5] trimmed to about ARGV[6] events.
+	// The tasks whose text changed are reindexed in the search index with the prefix of the last ARGV,
+	// a task is only completed when the tasks it depends on with the key prefix of the ARGV before it are resolved.
+	// It replies OK, NOT_FOUND, CONFLICT or BLOCKED for each task, if ARGV[1] is "1" nothing is saved when any of them fails
+	BatchUpdateTask string = searchIndex + blockerCheck + `
+		local codes = {}
+		local olds = {}
+		local failed = false
+		for i = 1, #KEYS do
+			codes[i] = "OK"
+			local val = redis.call("GET", KEYS[i])
+			if (not val) then
+				codes[i] = "NOT_FOUND"
+				failed = true
+			else
+				olds[i] = cjson.decode(val)
+				if ((olds[i]["etag"] or "") ~= ARGV[4 * i + 3]) then
+					codes[i] = "CONFLICT"
+					failed = true
+				else
+					local blocked = checkBlockers(ARGV[#ARGV - 1], olds[i], cjson.decode(ARGV[4 * i + 4]))
+					if (blocked) then
+						codes[i] = blocked
+						failed = true
+					end
+				end
+			end
+		end
+		if (failed and ARGV[1] == "1") then
+			return codes
+		end
+		for i = 1, #KEYS do
+			if (codes[i] == "OK") then
+				redis.call("SET", KEYS[i], ARGV[4 * i + 4], "KEEPTTL")
+				local task = cjson.decode(ARGV[4 * i + 4])
+				local before = olds[i]["status"] or 0
+				local after = task["status"] or 0
+				if (before ~= after) then
+					redis.call("ZREM", ARGV[2] .. before, ARGV[4 * i + 5])
+				end
+				redis.call("ZADD", ARGV[2] .. after, 0, ARGV[4 * i + 5])
+				reindexTask(ARGV[#ARGV], ARGV[4 * i + 5], olds[i], task)
+				redis.call("XADD", ARGV[3] .. ARGV[4 * i + 5], "*", "action", "ACTION_UPDATE", "actor", ARGV[4], "task", ARGV[4 * i + 4])
+				redis.call("XADD", ARGV[5], "MAXLEN", "~", ARGV[6], "*", "event", ARGV[4 * i + 6], "previous_status", before)
+			end
+		end
+		return codes
+	`
+
+	// BatchDeleteTask - move the tasks KEYS[i+1] to the trash KEYS[1] only if their etags are still ARGV[5i+3],
+	// ARGV[5i+4] is the deleted task, ARGV[5i+5] is its id, ARGV[5i+6] is its expire time in milliseconds
+	// and ARGV[5i+7] is its event.
+	// The status indexes have the prefix ARGV[2] and the children indexes have the prefix ARGV[3],
+	// a task with subtasks is only deleted if they are deleted before it in the same batch.
+	// The revisions are added to the streams with the prefix ARGV[4] with the actor ARGV[5]
+	// and the events to the event stream ARGV[6] trimmed to about ARGV[7] events.
+	// The tasks are removed from the search index with the prefix of the last ARGV.
+	// It replies OK, NOT_FOUND, CONFLICT or HAS_CHILDREN for each task,
+	// if ARGV[1] is "1" nothing is deleted when any of them fails
+	BatchDeleteTask string = searchIndex + `
+		local n = #KEYS - 1
+		local codes = {}
+		local olds = {}
+		local gone = {}
+		local failed = false
+		for i = 1, n do
+			codes[i] = "OK"
+			local id = ARGV[5 * i + 5]
+			local val = redis.call("GET", KEYS[i + 1])
+			if (not val) then
+				codes[i] = "NOT_FOUND"
+				failed = true
+			else
+				olds[i] = cjson.decode(val)
+				if ((olds[i]["etag"] or "") ~= ARGV[5 * i + 3]) then
+					codes[i] = "CONFLICT"
+					failed = true
+				else
+					for _, child in ipairs(redis.call("ZRANGE", ARGV[3] .. id, 0, -1)) do
+						if (not gone[child]) then
+							codes[i] = "HAS_CHILDREN"
+							failed = true
+							break
+						end
+					end
+				end
+			end
+			if (codes[i] == "OK") then
+				gone[id] = true
+			end
+		end
+		if (failed and ARGV[1] == "1") then
+			return codes
+		end
+		for i = 1, n do
+			if (codes[i] == "OK") then
+				local id = ARGV[5 * i + 5]
+				redis.call("SET", KEYS[i + 1], ARGV[5 * i + 4], "KEEPTTL")
+				redis.call("ZREM", ARGV[2] .. (olds[i]["status"] or 0), id)
+				local parent = olds[i]["parent_id"] or ""
+				if (parent ~= "") then
+					redis.call("ZREM", ARGV[3] .. parent, id)
+				end
+				redis.call("ZADD", KEYS[1], ARGV[5 * i + 6], id)
+				unindexTask(ARGV[#ARGV], id, olds[i])
+				redis.call("XADD", ARGV[4] .. id, "*", "action", "ACTION_DELETE", "actor", ARGV[5], "task", ARGV[5 * i + 4])
+				redis.call("XADD", ARGV[6], "MAXLEN", "~", ARGV[7], "*", "event", ARGV[5 * i + 7], "previous_status", olds[i]["status"] or 0)
+			end
+		end
+		return codes
+	`
+
+	// BatchRemoveTask - permanently delete the tasks KEYS[i+1] only if their etags are still ARGV[2i+3],
+	// ARGV[2i+4] is the id of the task and KEYS[1] is the index of all tasks.
+	// The status indexes have the prefix ARGV[2], the children indexes have the prefix ARGV[3]
+	// and the revision streams have the prefix ARGV[4], a task with subtasks is only removed
+	// if they are removed before it in the same batch.
+	// The tasks are removed from the search index with the prefix of the last ARGV.
+	// It replies OK, NOT_FOUND, CONFLICT or HAS_CHILDREN for each task,
+	// if ARGV[1] is "1" nothing is removed when any of them fails
+	BatchRemoveTask string = searchIndex + `
+		local n = #KEYS - 1
+		local codes = {}
+		local olds = {}
+		local gone = {}
+		local failed = false
+		for i = 1, n do
+			codes[i] = "OK"
+			local id = ARGV[2 * i + 4]
+			local val = redis.call("GET", KEYS[i + 1])
+			if (not val) then
+				codes[i] = "NOT_FOUND"
+				failed = true
+			else
+				olds[i] = cjson.decode(val)
+				if ((olds[i]["etag"] or "") ~= ARGV[2 * i + 3]) then
+					codes[i] = "CONFLICT"
+					failed = true
+				else
+					for _, child in ipairs(redis.call("ZRANGE", ARGV[3] .. id, 0, -1)) do
+						if (not gone[child]) then
+							codes[i] = "HAS_CHILDREN"
+							failed = true
+							break
+						end
+					end
+				end
+			end
+			if (codes[i] == "OK") then
+				gone[id] = true
+			end
+		end
+		if (failed and ARGV[1] == "1") then
+			return codes
+		end
+		for i = 1, n do
+			if (codes[i] == "OK") then
+				local id = ARGV[2 * i + 4]
+				redis.call("DEL", KEYS[i + 1])
+				redis.call("DEL", ARGV[4] .. id)
+				unindexTask(ARGV[#ARGV], id, olds[i])
+				redis.call("ZREM", KEYS[1], id)
+				redis.call("ZREM", ARGV[2] .. (olds[i]["status"] or 0), id)
+				local parent = olds[i]["parent_id"] or ""
+				if (parent ~= "") then
+					redis.call("ZREM", ARGV[3] .. parent, id)
+				end
+			end
+		end
+		return codes
+	`
+
+	// ListTasks - get a page of the index KEYS[1] and the tasks in one call,
+	// ARGV[1] and ARGV[2] are the range of ZRANGE BYLEX, it is reversed if ARGV[3] is "1",
+	// ARGV[4] is the limit and ARGV[5] is the prefix of the task keys.
+	// The ids without a task are removed from every index in KEYS.
+	// It replies the scanned ids, the tasks and the orphaned ids
+	ListTasks string = `
+		local args = {"ZRANGE", KEYS[1], ARGV[1], ARGV[2], "BYLEX"}
+		if (ARGV[3] == "1") then
+			table.insert(args, "REV")
+		end
+		if (tonumber(ARGV[4]) > 0) then
+			table.insert(args, "LIMIT")
+			table.insert(args, 0)
+			table.insert(args, ARGV[4])
+		end
+		local ids = redis.call(unpack(args))
+		local tasks = {}
+		local orphans = {}
+		for _, id in ipairs(ids) do
+			local val = redis.call("GET", ARGV[5] .. id)
+			if (val) then
+				table.insert(tasks, val)
+			else
+				table.insert(orphans, id)
+				for i = 1, #KEYS do
+					redis.call("ZREM", KEYS[i], id)
+				end
+			end
+		end
+		return {ids, tasks, orphans}
+	`
+
+	// SearchTasks - rank the tasks by the groups ARGV[4], a JSON array with a list of the term index keys
+	// and their weights, [key, weight, key, weight, ...], for every query token. The score of a task for
+	// a token is its best weighted score in the term indexes of the group, a task must be in every group
+	// and its score is the sum over the groups. ARGV[1] is the prefix of the temporary keys, ARGV[2] is
+	// the offset and ARGV[3] is the size of the page and the task keys have the prefix ARGV[5].
+	// It replies the tasks of the page from the highest score, the ties from the largest id
+	SearchTasks string = `
+		local temps = {}
+		for i, group in ipairs(cjson.decode(ARGV[4])) do
+			local temp = ARGV[1] .. i
+			local args = {"ZUNIONSTORE", temp, #group / 2}
+			for j = 1, #group, 2 do
+				table.insert(args, group[j])
+			end
+			table.insert(args, "WEIGHTS")
+			for j = 2, #group, 2 do
+				table.insert(args, group[j])
+			end
+			table.insert(args, "AGGREGATE")
+			table.insert(args, "MAX")
+			redis.call(unpack(args))
+			table.insert(temps, temp)
+		end
+		local result = ARGV[1] .. "result"
+		local args = {"ZINTERSTORE", result, #temps}
+		for _, temp in ipairs(temps) do
+			table.insert(args, temp)
+		end
+		redis.call(unpack(args))
+		local ids = redis.call("ZREVRANGE", result, ARGV[2], ARGV[2] + ARGV[3] - 1)
+		table.insert(temps, result)
+		redis.call("DEL", unpack(temps))
+		local tasks = {}
+		for _, id in ipairs(ids) do
+			local val = redis.call("GET", ARGV[5] .. id)
+			if (val) then
+				table.insert(tasks, val)
+			end
+		end
+		return tasks
+	`
+
+	// DeleteWebhook - remove the webhook ARGV[1] from the hash KEYS[1] with its delivery log KEYS[2]
+	// and dead letters KEYS[3], its pending deliveries are dropped when they are claimed
+	DeleteWebhook string = `
+		if (redis.call("HDEL", KEYS[1], ARGV[1]) == 0) then
+			return redis.error_reply("NOT_FOUND")
+		end
+		redis.call("DEL", KEYS[2], KEYS[3])
+		return 0
+	`
+
+	// EnqueueDeliveries - add the deliveries ARGV[i+1] with the ids ARGV[i] for every even i
+	// to the pending hash KEYS[2] and to the queue KEYS[1] due at ARGV[1] in milliseconds.
+	// A delivery which is already pending is kept, e.g. an event delivered twice
+	EnqueueDeliveries string = `
+		for i = 2, #ARGV, 2 do
+			if (redis.call("HSETNX", KEYS[2], ARGV[i], ARGV[i + 1]) == 1) then
+				redis.call("ZADD", KEYS[1], ARGV[1], ARGV[i])
+			end
+		end
+		return 0
+	`
+
+	// ClaimDeliveries - get at most ARGV[3] pending deliveries of the hash KEYS[2] due at ARGV[1]
+	// in the queue KEYS[1], they are due again at ARGV[2], so they are not claimed again until
+	// they are finished or the lease expires. A queued id which is not pending is removed
+	ClaimDeliveries string = `
+		local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+		local deliveries = {}
+		for _, id in ipairs(ids) do
+			local val = redis.call("HGET", KEYS[2], id)
+			if (val) then
+				redis.call("ZADD", KEYS[1], ARGV[2], id)
+				table.insert(deliveries, val)
+			else
+				redis.call("ZREM", KEYS[1], id)
+			end
+		end
+		return deliveries
+	`
+
+	// FinishDelivery - record the attempt ARGV[2] of the delivery ARGV[1] in the log stream KEYS[3]
+	// trimmed to about ARGV[3] entries. If ARGV[5] is "retry", the pending delivery in the hash KEYS[2]
+	// is replaced by the attempt and due at ARGV[6] in the queue KEYS[1]. Otherwise it is removed and
+	// if ARGV[5] is "dead", the attempt is added to the dead letter stream KEYS[4] trimmed to about
+	// ARGV[7] entries. A delivery of a webhook ARGV[4] which is not in the hash KEYS[5] is only removed
+	FinishDelivery string = `
+		if (ARGV[5] == "retry" and redis.call("HEXISTS", KEYS[5], ARGV[4]) == 1) then
+			redis.call("HSET", KEYS[2], ARGV[1], ARGV[2])
+			redis.call("ZADD", KEYS[1], ARGV[6], ARGV[1])
+		else
+			redis.call("HDEL", KEYS[2], ARGV[1])
+			redis.call("ZREM", KEYS[1], ARGV[1])
+		end
+		if (redis.call("HEXISTS", KEYS[5], ARGV[4]) == 0) then
+			return 0
+		end
+		redis.call("XADD", KEYS[3], "MAXLEN", "~", ARGV[3], "*", "delivery", ARGV[2])
+		if (ARGV[5] == "dead") then
+			redis.call("XADD", KEYS[4], "MAXLEN", "~", ARGV[7], "*", "delivery", ARGV[2])
+		end
+		return 0
+	`
+
+	// TakeToken - take a token of the bucket KEYS[1] at ARGV[1] in milliseconds, ARGV[2] tokens are added
+	// every ARGV[3] milliseconds up to ARGV[4]. A new bucket is full and a bucket expires when it is full again.
+	// It replies 1 if a token was taken, the whole tokens left, the milliseconds until a token is added
+	// when none was taken and the milliseconds until the bucket is full
+	TakeToken string = `
+		local now = tonumber(ARGV[1])
+		local rate = tonumber(ARGV[2])
+		local per = tonumber(ARGV[3])
+		local burst = tonumber(ARGV[4])
+		local bucket = redis.call("HMGET", KEYS[1], "tokens", "time")
+		local tokens = tonumber(bucket[1]) or burst
+		local last = tonumber(bucket[2]) or now
+		if (now > last) then
+			tokens = math.min(burst, tokens + (now - last) * rate / per)
+			last = now
+		end
+		local taken = 0
+		local retry = 0
+		if (tokens >= 1) then
+			tokens = tokens - 1
+			taken = 1
+		else
+			retry = math.ceil((1 - tokens) * per / rate)
+		end
+		local full = math.ceil((burst - tokens) * per / rate)
+		redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "time", tostring(last))
+		redis.call("PEXPIRE", KEYS[1], math.max(full, 1))
+		return {taken, math.floor(tokens), retry, full}
+	`
 )
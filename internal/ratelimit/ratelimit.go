@@ -0,0 +1,255 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// BucketPrefix - the prefix of the redis keys of the token buckets, <prefix>:<client>:<method>
+	BucketPrefix string = "ratelimit"
+
+	// LimitHeader - the metadata key of the burst of the bucket of a call, X-RateLimit-Limit on the gateway
+	LimitHeader string = "x-ratelimit-limit"
+	// RemainingHeader - the metadata key of the tokens left in the bucket of a call
+	RemainingHeader string = "x-ratelimit-remaining"
+	// ResetHeader - the metadata key of the seconds until the bucket of a call is full again
+	ResetHeader string = "x-ratelimit-reset"
+	// forwardedFor - the metadata key of the client addresses of a call forwarded by the gateway
+	forwardedFor string = "x-forwarded-for"
+)
+
+// Limit - a token bucket, Rate tokens are added every Per up to Burst and every call takes one
+type Limit struct {
+	Rate  int64
+	Per   time.Duration
+	Burst int64
+}
+
+// unlimited - check if the limit lets every call in
+func (limit Limit) unlimited() bool {
+	return limit.Rate <= 0
+}
+
+func (limit Limit) withDefaults() Limit {
+	if limit.Per <= 0 {
+		limit.Per = time.Second
+	}
+	if limit.Burst < limit.Rate {
+		limit.Burst = limit.Rate
+	}
+	return limit
+}
+
+// Limits - the limits of the calls by method
+type Limits struct {
+	// Default - the limit of the methods without their own, a zero rate is no limit
+	Default Limit
+	// Methods - the limits by method name, e.g. CreateTask
+	Methods map[string]Limit
+}
+
+// Options - the limits of the clients, a client is the subject of an identity or else the address of the caller
+type Options struct {
+	Limits
+	// Clients - the clients with other limits, a method without a limit of the client has the limit of Limits
+	Clients map[string]Limits
+	// TrustedProxies - how many proxies in front of the gateway set X-Forwarded-For, e.g. 1 behind nginx
+	TrustedProxies int
+}
+
+// limit - get the limit of the method for the client
+func (opts Options) limit(client string, method string) Limit {
+	if limits, ok := opts.Clients[client]; ok {
+		if limit, ok := limits.Methods[method]; ok {
+			return limit.withDefaults()
+		}
+		if limits.Default != (Limit{}) {
+			return limits.Default.withDefaults()
+		}
+	}
+	if limit, ok := opts.Methods[method]; ok {
+		return limit.withDefaults()
+	}
+	return opts.Default.withDefaults()
+}
+
+// Result - what the bucket of a call had
+type Result struct {
+	// Allowed - a token was taken
+	Allowed bool
+	// Limit - the burst of the bucket
+	Limit int64
+	// Remaining - the tokens left
+	Remaining int64
+	// RetryAfter - when the next token is added if none was taken
+	RetryAfter time.Duration
+	// Reset - when the bucket is full again
+	Reset time.Duration
+}
+
+// Limiter - limit the calls of every client with the token buckets in redis, so the instances share them
+type Limiter struct {
+	client *redis.Client
+	opts   Options
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// Enabled - check if any call is limited
+func (limiter *Limiter) Enabled() bool {
+	if !limiter.opts.Default.unlimited() {
+		return true
+	}
+	for _, limit := range limiter.opts.Methods {
+		if !limit.unlimited() {
+			return true
+		}
+	}
+	for _, limits := range limiter.opts.Clients {
+		if !limits.Default.unlimited() {
+			return true
+		}
+		for _, limit := range limits.Methods {
+			if !limit.unlimited() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Take - take a token of the bucket of the client for the method, the result of a method without a limit is allowed
+func (limiter *Limiter) Take(ctx context.Context, client string, method string) (Result, error) {
+	limit := limiter.opts.limit(client, method)
+	if limit.unlimited() {
+		return Result{Allowed: true}, nil
+	}
+	values, err := limiter.client.Eval(ctx, helper.TakeToken, []string{BucketKey(client, method)},
+		limiter.now().UnixMilli(), limit.Rate, limit.Per.Milliseconds(), limit.Burst).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("redis eval error: %w", err)
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("redis eval reply has %d values", len(values))
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Burst,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// Limit - take a token for the call of the method in ctx and set the rate limit headers of the call,
+// the error is RESOURCE_EXHAUSTED with a QuotaFailure and a RetryInfo when the bucket is empty.
+// A call is let in when redis fails
+func (limiter *Limiter) Limit(ctx context.Context, fullMethod string) error {
+	if !limiter.Enabled() {
+		return nil
+	}
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	client := Client(ctx, limiter.opts.TrustedProxies)
+	result, err := limiter.Take(ctx, client, method)
+	if err != nil {
+		limiter.logger.Error("Limit take token error", zap.String("client", client), zap.String("method", fullMethod), zap.Error(err))
+		return nil
+	}
+	if result.Limit == 0 {
+		return nil
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(
+		LimitHeader, strconv.FormatInt(result.Limit, 10),
+		RemainingHeader, strconv.FormatInt(result.Remaining, 10),
+		ResetHeader, strconv.FormatInt(seconds(result.Reset), 10),
+	))
+	if result.Allowed {
+		return nil
+	}
+	limiter.logger.Info("Limit call denied", zap.String("client", client), zap.String("method", fullMethod))
+	return helper.RateLimitErr("rate limit exceeded", "clients/"+client,
+		fmt.Sprintf("at most %d calls of %s in a burst", result.Limit, method), result.RetryAfter)
+}
+
+// UnaryInterceptor - limit a unary call
+func (limiter *Limiter) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := limiter.Limit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor - limit the start of a streaming call
+func (limiter *Limiter) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := limiter.Limit(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// Client - get the client of the call in ctx: the subject of its identity, e.g. api-key:ci,
+// or else the address of the caller. X-Forwarded-For is only read from a call of the gateway of the
+// instance, which calls from the host of the server and appends the address of its own caller.
+// The client is the address the proxies hops before that one, the addresses before it can be made up
+func Client(ctx context.Context, proxies int) string {
+	if identity, ok := auth.IdentityOf(ctx); ok {
+		return identity.Principal()
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	host := hostOf(p.Addr)
+	values := metadata.ValueFromIncomingContext(ctx, forwardedFor)
+	if len(values) == 0 || p.LocalAddr == nil || host != hostOf(p.LocalAddr) {
+		return "ip:" + host
+	}
+	hops := strings.Split(strings.Join(values, ","), ",")
+	hop := strings.TrimSpace(hops[max(len(hops)-1-proxies, 0)])
+	if hop == "" {
+		return "ip:" + host
+	}
+	return "ip:" + hop
+}
+
+// hostOf - get the host of an address without its port
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// BucketKey - get the redis key of the token bucket of the client for the method
+func BucketKey(client string, method string) string {
+	return fmt.Sprintf("%s:%s:%s", BucketPrefix, client, method)
+}
+
+// seconds - round a duration up to whole seconds
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// NewLimiter - create a limiter of the calls with the buckets in redis, the calls are not limited without limits
+func NewLimiter(client *redis.Client, opts Options, logger *zap.Logger) *Limiter {
+	return &Limiter{
+		client: client,
+		opts:   opts,
+		logger: logger,
+		now:    time.Now,
+	}
+}
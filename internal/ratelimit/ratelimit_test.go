@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// newLimiter - a limiter on an in-process redis whose clock only moves when the test moves it
+func newLimiter(t *testing.T, opts Options) (*Limiter, *time.Time) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	limiter := NewLimiter(client, opts, zap.NewNop())
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestTake(t *testing.T) {
+	ctx := context.Background()
+	limiter, now := newLimiter(t, Options{
+		Limits: Limits{
+			Default: Limit{Rate: 1, Per: time.Second, Burst: 2},
+			Methods: map[string]Limit{"GetTask": {Rate: 10}},
+		},
+		Clients: map[string]Limits{"api-key:ci": {Default: Limit{Rate: 0}, Methods: map[string]Limit{"CreateTask": {Rate: 100}}}},
+	})
+	assert.True(t, limiter.Enabled())
+
+	// a new bucket is full
+	for _, remaining := range []int64{1, 0} {
+		result, err := limiter.Take(ctx, "ip:10.0.0.1", "CreateTask")
+		assert.Nil(t, err)
+		assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: remaining, Reset: time.Duration(2-remaining) * time.Second}, result)
+	}
+	result, err := limiter.Take(ctx, "ip:10.0.0.1", "CreateTask")
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	// the buckets are by client and method
+	result, _ = limiter.Take(ctx, "ip:10.0.0.2", "CreateTask")
+	assert.True(t, result.Allowed)
+	result, _ = limiter.Take(ctx, "ip:10.0.0.1", "GetTask")
+	assert.Equal(t, Result{Allowed: true, Limit: 10, Remaining: 9, Reset: 100 * time.Millisecond}, result)
+
+	// the tokens are added over time
+	*now = now.Add(500 * time.Millisecond)
+	result, _ = limiter.Take(ctx, "ip:10.0.0.1", "CreateTask")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	*now = now.Add(500 * time.Millisecond)
+	result, _ = limiter.Take(ctx, "ip:10.0.0.1", "CreateTask")
+	assert.True(t, result.Allowed)
+
+	// a client with its own limits, the default of a client without one is the default of every client
+	result, _ = limiter.Take(ctx, "api-key:ci", "CreateTask")
+	assert.Equal(t, int64(100), result.Limit)
+	result, _ = limiter.Take(ctx, "api-key:ci", "DeleteTask")
+	assert.Equal(t, int64(2), result.Limit)
+
+	assert.False(t, NewLimiter(nil, Options{}, zap.NewNop()).Enabled())
+}
+
+func TestInterceptor(t *testing.T) {
+	var (
+		limiter, _ = newLimiter(t, Options{Limits: Limits{Default: Limit{Rate: 1, Per: time.Minute}}})
+		info       = &grpc.UnaryServerInfo{FullMethod: "/task.v1.TaskService/GetTask"}
+		handler    = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		}
+		ctx = auth.WithIdentity(context.Background(), auth.Identity{Subject: "ci", Method: auth.MethodAPIKey})
+	)
+	_, err := limiter.UnaryInterceptor(ctx, nil, info, handler)
+	assert.Nil(t, err)
+	_, err = limiter.UnaryInterceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	details := status.Convert(err).Details()
+	assert.Len(t, details, 2)
+	failure, ok := details[0].(*errdetails.QuotaFailure)
+	assert.True(t, ok)
+	assert.Equal(t, "clients/api-key:ci", failure.Violations[0].Subject)
+	retry, ok := details[1].(*errdetails.RetryInfo)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, retry.RetryDelay.AsDuration())
+}
+
+func TestClient(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		local   = &net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 64531}
+		remote  = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}, LocalAddr: local})
+		gateway = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 5000}, LocalAddr: local})
+		forward = func(ctx context.Context, hops string) context.Context {
+			return metadata.NewIncomingContext(ctx, metadata.Pairs(forwardedFor, hops))
+		}
+	)
+	assert.Equal(t, "unknown", Client(ctx, 0))
+	assert.Equal(t, "ip:10.0.0.1", Client(remote, 0))
+	// a caller which is not the gateway can not choose its address
+	assert.Equal(t, "ip:10.0.0.1", Client(forward(remote, "192.0.2.1"), 0))
+
+	// the gateway appends the address of its caller, a made up address before it is skipped
+	assert.Equal(t, "ip:10.0.0.9", Client(gateway, 0))
+	assert.Equal(t, "ip:192.0.2.1", Client(forward(gateway, "192.0.2.1"), 0))
+	assert.Equal(t, "ip:192.0.2.1", Client(forward(gateway, "198.51.100.1, 192.0.2.1"), 0))
+	// behind a proxy the gateway appends the address of the proxy
+	assert.Equal(t, "ip:192.0.2.1", Client(forward(gateway, "198.51.100.1, 192.0.2.1, 10.0.0.2"), 1))
+	assert.Equal(t, "ip:192.0.2.1", Client(forward(gateway, "192.0.2.1"), 1))
+
+	ctx = auth.WithIdentity(forward(gateway, "192.0.2.1"), auth.Identity{Subject: "alice", Method: auth.MethodJWT})
+	assert.Equal(t, "jwt:alice", Client(ctx, 0))
+}
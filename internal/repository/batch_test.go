@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkBatch - the batch behavior every repository shares
+func checkBatch(t *testing.T, repo TaskRepository) {
+	ctx := context.Background()
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a"}))
+
+	// atomic, 1 exists so 2 is not created
+	errs, err := repo.BatchCreate(ctx, []*pbTask.Task{{Id: "2", Name: "b"}, {Id: "1"}}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrAlreadyExists}, errs)
+	tasks, err := repo.BatchGet(ctx, []string{"2", "1"})
+	assert.Nil(t, err)
+	assert.Nil(t, tasks[0])
+	assert.Equal(t, "a", tasks[1].Name)
+
+	errs, err = repo.BatchCreate(ctx, []*pbTask.Task{{Id: "2", Name: "b"}, {Id: "1"}, {Id: "3", Name: "c", Status: 1}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrAlreadyExists, nil}, errs)
+	tasks, _ = repo.List(ctx, ListOptions{})
+	assert.Equal(t, []string{"1", "2", "3"}, taskIDs(tasks))
+	complete := pbTask.Status_STATUS_COMPLETE
+	tasks, _ = repo.List(ctx, ListOptions{Status: &complete})
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+
+	// atomic, 2 has a stale etag so 1 is not updated
+	errs, err = repo.BatchUpdate(ctx, []*pbTask.Task{{Id: "1", Name: "a2"}, {Id: "2", Name: "b2"}}, []string{"1", "0"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrConflict}, errs)
+	task, _ := repo.Get(ctx, "1")
+	assert.Equal(t, "a", task.Name)
+
+	update := []*pbTask.Task{{Id: "1", Name: "a2", Status: 1}, {Id: "2", Name: "b2"}, {Id: "4"}}
+	errs, err = repo.BatchUpdate(ctx, update, []string{"1", "0", ""}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrConflict, ErrNotFound}, errs)
+	task, _ = repo.Get(ctx, "1")
+	assert.Equal(t, "a2", task.Name)
+	assert.Equal(t, "2", task.Etag)
+	tasks, _ = repo.List(ctx, ListOptions{Status: &complete})
+	assert.Equal(t, []string{"1", "3"}, taskIDs(tasks))
+
+	// atomic, 4 does not exist so 1 is not deleted
+	expire := time.Now().Add(time.Hour)
+	errs, err = repo.BatchDelete(ctx, []*pbTask.Task{deleted(repo, "1", expire), deleted(repo, "4", expire)}, []string{"2", ""}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrNotFound}, errs)
+	task, _ = repo.Get(ctx, "1")
+	assert.Nil(t, task.DeleteTime)
+
+	trash := []*pbTask.Task{deleted(repo, "1", expire), deleted(repo, "2", expire), deleted(repo, "3", expire)}
+	errs, err = repo.BatchDelete(ctx, trash, []string{"2", "1", "0"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, nil, ErrConflict}, errs)
+	assert.Equal(t, "3", trash[0].Etag)
+	tasks, _ = repo.List(ctx, ListOptions{})
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+	tasks, _ = repo.List(ctx, ListOptions{Status: &complete})
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+	tasks, _ = repo.List(ctx, ListOptions{ShowDeleted: true})
+	assert.Equal(t, []string{"1", "2", "3"}, taskIDs(tasks))
+}
+
+func TestMemoryBatch(t *testing.T) {
+	checkBatch(t, NewMemoryRepository())
+}
+
+func TestRedisBatch(t *testing.T) {
+	repo, _ := newMiniRedisRepository(t)
+	checkBatch(t, repo)
+}
+
+func TestSQLBatch(t *testing.T) {
+	checkBatch(t, newSQLiteRepository(t))
+}
+
+// checkRemove - the permanent delete every repository shares
+func checkRemove(t *testing.T, repo TaskRepository) {
+	ctx := context.Background()
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a", Status: 1}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "2", Name: "b", Status: 1, ParentId: "1"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "3", Name: "c", Status: 1, ParentId: "1"}))
+
+	// atomic, 1 still has the subtask 3
+	errs, err := repo.BatchRemove(ctx, []string{"2", "1"}, []string{"1", "1"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrHasChildren}, errs)
+	tasks, _ := repo.List(ctx, ListOptions{})
+	assert.Equal(t, []string{"1", "2", "3"}, taskIDs(tasks))
+
+	errs, err = repo.BatchRemove(ctx, []string{"2", "1", "4", "3"}, []string{"1", "1", "1", "0"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrHasChildren, ErrNotFound, ErrConflict}, errs)
+	tasks, _ = repo.List(ctx, ListOptions{Parent: "1"})
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+
+	errs, err = repo.BatchRemove(ctx, []string{"3", "1"}, []string{"1", "1"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, nil}, errs)
+	complete := pbTask.Status_STATUS_COMPLETE
+	tasks, _ = repo.List(ctx, ListOptions{Status: &complete, ShowDeleted: true})
+	assert.Empty(t, tasks)
+	_, err = repo.Get(ctx, "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryRemove(t *testing.T) {
+	checkRemove(t, NewMemoryRepository())
+}
+
+func TestRedisRemove(t *testing.T) {
+	repo, server := newMiniRedisRepository(t)
+	checkRemove(t, repo)
+	// only the event stream is left
+	assert.Equal(t, []string{EventStream}, server.Keys())
+}
+
+func TestSQLRemove(t *testing.T) {
+	checkRemove(t, newSQLiteRepository(t))
+}
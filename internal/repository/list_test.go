@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryListMaxScan(t *testing.T) {
+	var (
+		repo = NewMemoryRepository()
+		ctx  = context.Background()
+	)
+	for i := 1; i <= 300; i++ {
+		assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: fmt.Sprintf("%03d", i)}))
+	}
+	match := func(task *pbTask.Task) bool {
+		return task.Id == "290"
+	}
+
+	// the page is cut after the scan reaching MaxScan, the first scan reads the page size
+	// and the others at least rescanSize
+	tasks, next, err := repo.ListPage(ctx, ListOptions{Size: 2, Match: match, MaxScan: 150})
+	assert.Nil(t, err)
+	assert.Empty(t, tasks)
+	assert.Equal(t, "202", next)
+
+	tasks, next, err = repo.ListPage(ctx, ListOptions{Cursor: next, Size: 2, Match: match, MaxScan: 150})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"290"}, taskIDs(tasks))
+	assert.Equal(t, "", next)
+
+	// a full page ends at its last task even if the scan read more
+	tasks, next, _ = repo.ListPage(ctx, ListOptions{Cursor: "100", Size: 3})
+	assert.Equal(t, []string{"101", "102", "103"}, taskIDs(tasks))
+	assert.Equal(t, "103", next)
+}
@@ -0,0 +1,562 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/search"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type memoryRepository struct {
+	mu sync.RWMutex
+	// spaces - the tasks of the tenants indexed by the tenant id
+	spaces map[string]*memorySpace
+}
+
+// memorySpace - the tasks of a tenant
+type memorySpace struct {
+	// tasks - the tasks indexed by id
+	tasks map[string]*pbTask.Task
+	// ids - the task ids in lexicographic order, like the redis sortSet
+	ids []string
+	// children - the ids of the subtasks which are not deleted indexed by the parent id
+	children map[string]map[string]bool
+	// revisions - the revisions of the tasks indexed by id, the oldest first like a redis stream
+	revisions map[string][]*pbTask.TaskRevision
+	// requests - the requests of the creates indexed by key, kept until they expire
+	requests map[string]memoryRequest
+}
+
+// memoryRequest - the task created by a request and the hash of its payload
+type memoryRequest struct {
+	taskID string
+	hash   string
+	expire time.Time
+}
+
+// Get - get a task by id
+func (repo *memoryRepository) Get(ctx context.Context, id string) (*pbTask.Task, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	space := repo.space(ctx, false)
+	task, ok := space.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(task).(*pbTask.Task), nil
+}
+
+// List - get a list of tasks ordered by id
+func (repo *memoryRepository) List(ctx context.Context, opts ListOptions) ([]*pbTask.Task, error) {
+	tasks, _, err := repo.ListPage(ctx, opts)
+	return tasks, err
+}
+
+// ListPage - get a page of tasks ordered by id and the cursor of the next page
+func (repo *memoryRepository) ListPage(ctx context.Context, opts ListOptions) ([]*pbTask.Task, string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	space := repo.space(ctx, false)
+
+	index := space.ids
+	if opts.Parent != "" && !opts.ShowDeleted {
+		index = make([]string, 0, len(space.children[opts.Parent]))
+		for id := range space.children[opts.Parent] {
+			index = append(index, id)
+		}
+		sort.Strings(index)
+	}
+	return collect(opts, func(cursor string, count int64) ([]*pbTask.Task, int, string, error) {
+		ids := after(index, cursor, opts.Desc, count)
+		tasks := make([]*pbTask.Task, 0, len(ids))
+		for _, id := range ids {
+			tasks = append(tasks, proto.Clone(space.tasks[id]).(*pbTask.Task))
+		}
+		if len(ids) == 0 {
+			return tasks, 0, "", nil
+		}
+		return tasks, len(ids), ids[len(ids)-1], nil
+	})
+}
+
+// after - get up to count of the sorted ids after the cursor in the order of the list, count 0 means no limit
+func after(index []string, cursor string, desc bool, count int64) []string {
+	if !desc {
+		// the same as ZRANGE BYLEX (cursor +
+		start := sort.Search(len(index), func(i int) bool {
+			return index[i] > cursor
+		})
+		ids := index[start:]
+		if count > 0 && int64(len(ids)) > count {
+			ids = ids[:count]
+		}
+		return ids
+	}
+	// the same as ZRANGE BYLEX - (cursor REV
+	end := len(index)
+	if cursor != "" {
+		end = sort.SearchStrings(index, cursor)
+	}
+	ids := []string{}
+	for i := end - 1; i >= 0 && (count == 0 || int64(len(ids)) < count); i-- {
+		ids = append(ids, index[i])
+	}
+	return ids
+}
+
+// Create - save a new task
+func (repo *memoryRepository) Create(ctx context.Context, task *pbTask.Task) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, true)
+	if err := space.checkRequest(ctx, task); err != nil {
+		return err
+	}
+	if err := space.checkCreate(task); err != nil {
+		return err
+	}
+	if max := TenantOf(ctx).MaxTasks; max > 0 && int64(len(space.ids)) >= max {
+		return ErrQuotaExceeded
+	}
+	space.create(task, actorOf(ctx))
+	space.saveRequest(ctx, task)
+	return nil
+}
+
+// Update - overwrite an existing task whose stored etag is etag
+func (repo *memoryRepository) Update(ctx context.Context, task *pbTask.Task, etag string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	if err := space.checkUpdate(task.Id, etag); err != nil {
+		return err
+	}
+	if err := space.checkBlockers(task); err != nil {
+		return err
+	}
+	space.update(task, etag, pbTask.TaskRevision_ACTION_UPDATE, actorOf(ctx))
+	return nil
+}
+
+// Delete - move an existing task to the trash
+func (repo *memoryRepository) Delete(ctx context.Context, task *pbTask.Task, etag string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	if err := space.checkDelete(task.Id, etag, nil); err != nil {
+		return err
+	}
+	space.trash(task, etag, actorOf(ctx))
+	return nil
+}
+
+// Undelete - restore a deleted task from the trash
+func (repo *memoryRepository) Undelete(ctx context.Context, task *pbTask.Task, etag string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	if err := space.checkUpdate(task.Id, etag); err != nil {
+		return err
+	}
+	if parent, ok := space.tasks[task.ParentId]; task.ParentId != "" && (!ok || parent.DeleteTime != nil) {
+		return ErrParentNotFound
+	}
+	space.update(task, etag, pbTask.TaskRevision_ACTION_UNDELETE, actorOf(ctx))
+	space.addChild(task)
+	return nil
+}
+
+// Purge - permanently delete the expired tasks in the trash
+func (repo *memoryRepository) Purge(ctx context.Context, before time.Time, limit int64) ([]string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	expired := []*pbTask.Task{}
+	for _, task := range space.tasks {
+		if task.DeleteTime != nil && task.ExpireTime.AsTime().Before(before) {
+			expired = append(expired, task)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		a, b := expired[i].ExpireTime.AsTime(), expired[j].ExpireTime.AsTime()
+		if a.Equal(b) {
+			return expired[i].Id < expired[j].Id
+		}
+		return a.Before(b)
+	})
+	if limit > 0 && int64(len(expired)) > limit {
+		expired = expired[:limit]
+	}
+	ids := make([]string, len(expired))
+	for i, task := range expired {
+		ids[i] = task.Id
+		space.delete(task.Id)
+	}
+	return ids, nil
+}
+
+// AddDependency - overwrite an existing task which got the dependency dependsOn
+func (repo *memoryRepository) AddDependency(ctx context.Context, task *pbTask.Task, etag string, dependsOn string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	if err := space.checkUpdate(task.Id, etag); err != nil {
+		return err
+	}
+	if dep, ok := space.tasks[dependsOn]; !ok || dep.DeleteTime != nil {
+		return ErrDependencyNotFound
+	}
+	cycle, _ := reaches(dependsOn, task.Id, func(id string) (*pbTask.Task, error) {
+		return space.tasks[id], nil
+	})
+	if cycle {
+		return ErrCycle
+	}
+	space.update(task, etag, pbTask.TaskRevision_ACTION_UPDATE, actorOf(ctx))
+	return nil
+}
+
+// BatchGet - get the tasks by ids
+func (repo *memoryRepository) BatchGet(ctx context.Context, ids []string) ([]*pbTask.Task, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	space := repo.space(ctx, false)
+	tasks := make([]*pbTask.Task, len(ids))
+	for i, id := range ids {
+		if task, ok := space.tasks[id]; ok {
+			tasks[i] = proto.Clone(task).(*pbTask.Task)
+		}
+	}
+	return tasks, nil
+}
+
+// BatchCreate - save new tasks
+func (repo *memoryRepository) BatchCreate(ctx context.Context, tasks []*pbTask.Task, atomic bool) ([]error, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, true)
+	errs := make([]error, len(tasks))
+	seen := map[string]bool{}
+	max, count := TenantOf(ctx).MaxTasks, int64(len(space.ids))
+	for i, task := range tasks {
+		if errs[i] = space.checkRequest(ctx, task); errs[i] != nil {
+			continue
+		}
+		errs[i] = space.checkCreate(task)
+		if seen[task.Id] {
+			errs[i] = ErrAlreadyExists
+		}
+		seen[task.Id] = true
+		if errs[i] == nil {
+			if max > 0 && count >= max {
+				errs[i] = ErrQuotaExceeded
+			} else {
+				count++
+			}
+		}
+	}
+	if atomic && failed(errs) {
+		return errs, nil
+	}
+	for i, task := range tasks {
+		if errs[i] == nil {
+			space.create(task, actorOf(ctx))
+			space.saveRequest(ctx, task)
+		}
+	}
+	return errs, nil
+}
+
+// BatchUpdate - overwrite existing tasks
+func (repo *memoryRepository) BatchUpdate(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	errs := make([]error, len(tasks))
+	for i, task := range tasks {
+		if errs[i] = space.checkUpdate(task.Id, etags[i]); errs[i] == nil {
+			errs[i] = space.checkBlockers(task)
+		}
+	}
+	if atomic && failed(errs) {
+		return errs, nil
+	}
+	for i, task := range tasks {
+		if errs[i] == nil {
+			space.update(task, etags[i], pbTask.TaskRevision_ACTION_UPDATE, actorOf(ctx))
+		}
+	}
+	return errs, nil
+}
+
+// BatchDelete - move existing tasks to the trash
+func (repo *memoryRepository) BatchDelete(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	errs := make([]error, len(tasks))
+	gone := map[string]bool{}
+	for i, task := range tasks {
+		errs[i] = space.checkDelete(task.Id, etags[i], gone)
+		if errs[i] == nil {
+			gone[task.Id] = true
+		}
+	}
+	if atomic && failed(errs) {
+		return errs, nil
+	}
+	for i, task := range tasks {
+		if errs[i] == nil {
+			space.trash(task, etags[i], actorOf(ctx))
+		}
+	}
+	return errs, nil
+}
+
+// BatchRemove - permanently delete existing tasks
+func (repo *memoryRepository) BatchRemove(ctx context.Context, ids []string, etags []string, atomic bool) ([]error, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	space := repo.space(ctx, false)
+	errs := make([]error, len(ids))
+	gone := map[string]bool{}
+	for i, id := range ids {
+		errs[i] = space.checkDelete(id, etags[i], gone)
+		if errs[i] == nil {
+			gone[id] = true
+		}
+	}
+	if atomic && failed(errs) {
+		return errs, nil
+	}
+	for i, id := range ids {
+		if errs[i] == nil {
+			space.delete(id)
+		}
+	}
+	return errs, nil
+}
+
+// ListRevisions - get the revisions of a task before the cursor, the newest first
+func (repo *memoryRepository) ListRevisions(ctx context.Context, id string, cursor string, size int64) ([]*pbTask.TaskRevision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	space := repo.space(ctx, false)
+	revisions := []*pbTask.TaskRevision{}
+	all := space.revisions[id]
+	for i := len(all) - 1; i >= 0 && (size <= 0 || int64(len(revisions)) < size); i-- {
+		if cursor == "" || revisionBefore(all[i].RevisionId, cursor) {
+			revisions = append(revisions, proto.Clone(all[i]).(*pbTask.TaskRevision))
+		}
+	}
+	return revisions, nil
+}
+
+// Search - rank every stored task which is not deleted for the query
+func (repo *memoryRepository) Search(ctx context.Context, query string, offset int64, size int64) ([]*pbTask.Task, error) {
+	tasks, err := repo.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return search.Page(search.Rank(tasks, search.Query(query)), offset, size), nil
+}
+
+// GetRevision - get a revision of a task by its id
+func (repo *memoryRepository) GetRevision(ctx context.Context, id string, revisionID string) (*pbTask.TaskRevision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	space := repo.space(ctx, false)
+	for _, revision := range space.revisions[id] {
+		if revision.RevisionId == revisionID {
+			return proto.Clone(revision).(*pbTask.TaskRevision), nil
+		}
+	}
+	return nil, ErrRevisionNotFound
+}
+
+func (space *memorySpace) checkCreate(task *pbTask.Task) error {
+	if _, ok := space.tasks[task.Id]; ok {
+		return ErrAlreadyExists
+	}
+	if parent, ok := space.tasks[task.ParentId]; task.ParentId != "" && (!ok || parent.DeleteTime != nil) {
+		return ErrParentNotFound
+	}
+	return nil
+}
+
+func (space *memorySpace) checkUpdate(id string, etag string) error {
+	current, ok := space.tasks[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.Etag != etag {
+		return ErrConflict
+	}
+	return nil
+}
+
+// checkBlockers - check if the update completes the task while a task it depends on is not resolved,
+// a dependency which was deleted does not block
+func (space *memorySpace) checkBlockers(task *pbTask.Task) error {
+	if task.Status != pbTask.Status_STATUS_COMPLETE || space.tasks[task.Id].Status == pbTask.Status_STATUS_COMPLETE {
+		return nil
+	}
+	for _, id := range task.DependsOn {
+		if blocker, ok := space.tasks[id]; ok && blocker.DeleteTime == nil && !Resolved(blocker.Status) {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+// checkDelete - check if the task can be deleted after the tasks gone are deleted
+func (space *memorySpace) checkDelete(id string, etag string, gone map[string]bool) error {
+	if err := space.checkUpdate(id, etag); err != nil {
+		return err
+	}
+	for child := range space.children[id] {
+		if !gone[child] {
+			return ErrHasChildren
+		}
+	}
+	return nil
+}
+
+func (space *memorySpace) create(task *pbTask.Task, actor string) {
+	task.Etag = NextEtag("")
+	space.tasks[task.Id] = proto.Clone(task).(*pbTask.Task)
+	space.record(task, pbTask.TaskRevision_ACTION_CREATE, actor)
+	i := sort.SearchStrings(space.ids, task.Id)
+	space.ids = append(space.ids, "")
+	copy(space.ids[i+1:], space.ids[i:])
+	space.ids[i] = task.Id
+	space.addChild(task)
+}
+
+// checkRequest - check if the request of the create of the task was already made
+func (space *memorySpace) checkRequest(ctx context.Context, task *pbTask.Task) error {
+	request, _, ok := requestOf(ctx, task.Id)
+	if !ok {
+		return nil
+	}
+	saved, ok := space.requests[request.Key]
+	if !ok || !time.Now().Before(saved.expire) {
+		return nil
+	}
+	if saved.hash != request.Hash {
+		return ErrRequestMismatch
+	}
+	return &ReplayError{TaskID: saved.taskID}
+}
+
+// saveRequest - keep the request of the created task until it expires, the expired requests are dropped
+func (space *memorySpace) saveRequest(ctx context.Context, task *pbTask.Task) {
+	request, ttl, ok := requestOf(ctx, task.Id)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	for key, saved := range space.requests {
+		if !now.Before(saved.expire) {
+			delete(space.requests, key)
+		}
+	}
+	space.requests[request.Key] = memoryRequest{taskID: task.Id, hash: request.Hash, expire: now.Add(ttl)}
+}
+
+func (space *memorySpace) addChild(task *pbTask.Task) {
+	if task.ParentId != "" {
+		if space.children[task.ParentId] == nil {
+			space.children[task.ParentId] = map[string]bool{}
+		}
+		space.children[task.ParentId][task.Id] = true
+	}
+}
+
+func (space *memorySpace) removeChild(task *pbTask.Task) {
+	if parent := task.ParentId; parent != "" {
+		delete(space.children[parent], task.Id)
+		if len(space.children[parent]) == 0 {
+			delete(space.children, parent)
+		}
+	}
+}
+
+func (space *memorySpace) update(task *pbTask.Task, etag string, action pbTask.TaskRevision_Action, actor string) {
+	task.Etag = NextEtag(etag)
+	space.tasks[task.Id] = proto.Clone(task).(*pbTask.Task)
+	space.record(task, action, actor)
+}
+
+// trash - overwrite the task which is deleted, it is no longer a child of its parent
+func (space *memorySpace) trash(task *pbTask.Task, etag string, actor string) {
+	space.update(task, etag, pbTask.TaskRevision_ACTION_DELETE, actor)
+	space.removeChild(task)
+}
+
+// record - append a revision of the task as written
+func (space *memorySpace) record(task *pbTask.Task, action pbTask.TaskRevision_Action, actor string) {
+	last := ""
+	if revisions := space.revisions[task.Id]; len(revisions) > 0 {
+		last = revisions[len(revisions)-1].RevisionId
+	}
+	revision := newRevision(nextRevisionID(last, time.Now()), action, actor, task)
+	space.revisions[task.Id] = append(space.revisions[task.Id], revision)
+}
+
+func (space *memorySpace) delete(id string) {
+	space.removeChild(space.tasks[id])
+	delete(space.tasks, id)
+	delete(space.children, id)
+	delete(space.revisions, id)
+	i := sort.SearchStrings(space.ids, id)
+	space.ids = append(space.ids[:i], space.ids[i+1:]...)
+}
+
+// Tenants - get the tenants with tasks, the default tenant first
+func (repo *memoryRepository) Tenants(ctx context.Context) ([]string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	tenants := []string{}
+	for id := range repo.spaces {
+		if id != "" {
+			tenants = append(tenants, id)
+		}
+	}
+	sort.Strings(tenants)
+	return append([]string{""}, tenants...), nil
+}
+
+// space - get the tasks of the tenant of ctx, the space of a new tenant is only kept if stored is true,
+// e.g. when it creates a task
+func (repo *memoryRepository) space(ctx context.Context, stored bool) *memorySpace {
+	id := TenantOf(ctx).ID
+	space, ok := repo.spaces[id]
+	if !ok {
+		space = newMemorySpace()
+		if stored {
+			repo.spaces[id] = space
+		}
+	}
+	return space
+}
+
+func newMemorySpace() *memorySpace {
+	return &memorySpace{
+		tasks:     map[string]*pbTask.Task{},
+		ids:       []string{},
+		children:  map[string]map[string]bool{},
+		revisions: map[string][]*pbTask.TaskRevision{},
+		requests:  map[string]memoryRequest{},
+	}
+}
+
+func NewMemoryRepository() TaskRepository {
+	return &memoryRepository{
+		spaces: map[string]*memorySpace{"": newMemorySpace()},
+	}
+}
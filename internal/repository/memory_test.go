@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCreateAndGet(t *testing.T) {
+	repo := NewMemoryRepository()
+	task := &pbTask.Task{Id: "1", Name: "test-name", Status: 1}
+
+	err := repo.Create(context.Background(), task)
+	assert.Nil(t, err)
+
+	// the stored task must not share memory with the caller
+	task.Name = "changed"
+	resp, err := repo.Get(context.Background(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "test-name", resp.Name)
+
+	err = repo.Create(context.Background(), task)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+}
+
+func TestMemoryGetNotFound(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Get(context.Background(), "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	repo := NewMemoryRepository()
+	err := repo.Update(context.Background(), &pbTask.Task{Id: "1"}, "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	repo.Create(context.Background(), &pbTask.Task{Id: "1", Name: "test-name"})
+	err = repo.Update(context.Background(), &pbTask.Task{Id: "1", Name: "update-test-name"}, "1")
+	assert.Nil(t, err)
+	resp, _ := repo.Get(context.Background(), "1")
+	assert.Equal(t, "update-test-name", resp.Name)
+	assert.Equal(t, "2", resp.Etag)
+
+	err = repo.Update(context.Background(), &pbTask.Task{Id: "1", Name: "stale"}, "1")
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestMemoryDelete(t *testing.T) {
+	repo := NewMemoryRepository()
+	err := repo.Delete(context.Background(), deleted(repo, "1", time.Now()), "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, id := range []string{"1", "2", "3"} {
+		repo.Create(context.Background(), &pbTask.Task{Id: id})
+	}
+	err = repo.Delete(context.Background(), deleted(repo, "2", time.Now()), "2")
+	assert.ErrorIs(t, err, ErrConflict)
+	err = repo.Delete(context.Background(), deleted(repo, "2", time.Now()), "1")
+	assert.Nil(t, err)
+
+	tasks, _ := repo.List(context.Background(), ListOptions{})
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "1", tasks[0].Id)
+	assert.Equal(t, "3", tasks[1].Id)
+}
+
+func TestMemoryListLexOrder(t *testing.T) {
+	repo := NewMemoryRepository()
+	// inserted out of order, listed lexicographically like ZRANGE BYLEX
+	for _, id := range []string{"3", "10", "2", "1", "25"} {
+		repo.Create(context.Background(), &pbTask.Task{Id: id})
+	}
+
+	tasks, err := repo.List(context.Background(), ListOptions{Size: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "10"}, taskIDs(tasks))
+
+	tasks, err = repo.List(context.Background(), ListOptions{Cursor: "10", Size: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2", "25"}, taskIDs(tasks))
+
+	// the cursor does not need to exist
+	tasks, err = repo.List(context.Background(), ListOptions{Cursor: "24", Size: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"25", "3"}, taskIDs(tasks))
+
+	tasks, err = repo.List(context.Background(), ListOptions{Cursor: "3", Size: 10})
+	assert.Nil(t, err)
+	assert.Empty(t, tasks)
+}
+
+func TestMemoryConcurrentCreate(t *testing.T) {
+	repo := NewMemoryRepository()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			repo.Create(context.Background(), &pbTask.Task{Id: fmt.Sprintf("%03d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	tasks, _ := repo.List(context.Background(), ListOptions{})
+	assert.Len(t, tasks, 100)
+	for i, task := range tasks {
+		assert.Equal(t, fmt.Sprintf("%03d", i), task.Id)
+	}
+}
+
+func taskIDs(tasks []*pbTask.Task) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.Id
+	}
+	return ids
+}
+
+func TestMemoryListDesc(t *testing.T) {
+	var (
+		repo     = NewMemoryRepository()
+		ctx      = context.Background()
+		complete = pbTask.Status_STATUS_COMPLETE
+	)
+	for i := 1; i <= 5; i++ {
+		assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: fmt.Sprint(i), Status: pbTask.Status(i % 2)}))
+	}
+
+	tasks, err := repo.List(ctx, ListOptions{Size: 2, Desc: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"5", "4"}, taskIDs(tasks))
+
+	tasks, err = repo.List(ctx, ListOptions{Cursor: "4", Status: &complete, Desc: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3", "1"}, taskIDs(tasks))
+}
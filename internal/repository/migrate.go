@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// loadMigrations - load the embedded migrations of a driver ordered by version
+func loadMigrations(driver string) ([]migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported sql driver %q: %w", driver, err)
+	}
+	result := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		// 0001_create_tasks.sql
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %q: %w", entry.Name(), err)
+		}
+		query, err := fs.ReadFile(migrations, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, migration{version: version, name: entry.Name(), query: string(query)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].version < result[j].version
+	})
+	return result, nil
+}
+
+// migrate - apply the migrations which have not been applied yet
+func migrate(ctx context.Context, db *sql.DB, driver string) error {
+	list, err := loadMigrations(driver)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations error: %w", err)
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("get schema version error: %w", err)
+	}
+
+	for _, m := range list {
+		if m.version <= current {
+			continue
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, m.query); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %s error: %w", m.name, err)
+		}
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version) VALUES ($1)`, m.version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %s error: %w", m.name, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+-- the ids are compared as bytes, the same as the redis sortSet
+CREATE TABLE IF NOT EXISTS tasks (
+    id     TEXT COLLATE "C" PRIMARY KEY,
+    status INTEGER NOT NULL,
+    data   TEXT NOT NULL
+);
@@ -0,0 +1,5 @@
+-- the tenant of the tasks and their revisions, '' is the default tenant;
+-- the ids stay unique across the tenants since they are generated
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS tasks_tenant_id ON tasks (tenant, id);
+ALTER TABLE task_revisions ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- the idempotency keys of the creates of the tasks, a key is kept until expire_time in milliseconds
+-- with the task it created and the hash of the payload
+CREATE TABLE IF NOT EXISTS task_requests (
+    tenant      TEXT NOT NULL DEFAULT '',
+    key         TEXT COLLATE "C" NOT NULL,
+    task_id     TEXT COLLATE "C" NOT NULL,
+    hash        TEXT NOT NULL,
+    expire_time BIGINT NOT NULL,
+    PRIMARY KEY (tenant, key)
+);
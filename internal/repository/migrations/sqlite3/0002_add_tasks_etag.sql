@@ -0,0 +1 @@
+ALTER TABLE tasks ADD COLUMN etag TEXT NOT NULL DEFAULT '';
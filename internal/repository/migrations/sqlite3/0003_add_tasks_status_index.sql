@@ -0,0 +1,2 @@
+-- the status index of the filtered task list
+CREATE INDEX IF NOT EXISTS tasks_status_id ON tasks (status, id);
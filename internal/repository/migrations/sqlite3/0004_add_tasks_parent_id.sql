@@ -0,0 +1,3 @@
+-- the children index of the subtasks
+ALTER TABLE tasks ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS tasks_parent_id ON tasks (parent_id, id);
@@ -0,0 +1,3 @@
+-- the expire time in milliseconds of a deleted task, NULL if it is not deleted
+ALTER TABLE tasks ADD COLUMN expire_time INTEGER;
+CREATE INDEX IF NOT EXISTS tasks_expire_time ON tasks (expire_time);
@@ -0,0 +1,11 @@
+-- the revisions of the tasks, every write saves the task as written;
+-- the revision id is ms-seq, the same as the redis stream ids
+CREATE TABLE IF NOT EXISTS task_revisions (
+    task_id TEXT COLLATE BINARY NOT NULL,
+    ms      INTEGER NOT NULL,
+    seq     INTEGER NOT NULL,
+    action  INTEGER NOT NULL,
+    actor   TEXT NOT NULL DEFAULT '',
+    data    TEXT NOT NULL,
+    PRIMARY KEY (task_id, ms, seq)
+);
@@ -0,0 +1,657 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/search"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	TaskID  string = "taskID"
+	SortSet string = "sortSet"
+	// StatusSet - the prefix of the sorted sets indexing the task ids by status
+	StatusSet string = "statusSet"
+	// ChildSet - the prefix of the sorted sets indexing the ids of the subtasks which are not deleted by parent
+	ChildSet string = "childSet"
+	// TrashSet - the sorted set of the deleted task ids scored by their expire time in milliseconds
+	TrashSet string = "trashSet"
+	// RevisionStream - the prefix of the streams of the task revisions, the entry ids are the revision ids
+	RevisionStream string = "revisions"
+	// EventStream - the stream of the task events, see the events package to consume it
+	EventStream string = "taskEvents"
+	// EventStreamMaxLen - about how many of the latest events the event stream keeps
+	EventStreamMaxLen int64 = 100000
+	// TenantSet - the set of the tenants which stored a task, besides the default tenant
+	TenantSet string = "tenants"
+	// SearchIndex - the prefix of the keys of the search index, see helper.SearchTasks
+	SearchIndex string = "search"
+	// RequestHash - the prefix of the hashes of the create requests by idempotency key, they expire
+	RequestHash string = "requests"
+)
+
+type redisRepository struct {
+	client *redis.Client
+	logger *zap.Logger
+}
+
+// TaskKey - get the redis key of a task
+func TaskKey(id string) string {
+	return fmt.Sprintf("%s:%s", TaskID, id)
+}
+
+// StatusKey - get the redis key of the status index
+func StatusKey(status pbTask.Status) string {
+	return fmt.Sprintf("%s:%d", StatusSet, status)
+}
+
+// ChildKey - get the redis key of the children index of a task
+func ChildKey(id string) string {
+	return fmt.Sprintf("%s:%s", ChildSet, id)
+}
+
+// RevisionKey - get the redis key of the revision stream of a task
+func RevisionKey(id string) string {
+	return fmt.Sprintf("%s:%s", RevisionStream, id)
+}
+
+// RequestKey - get the redis key of the create request with the idempotency key
+func RequestKey(key string) string {
+	return fmt.Sprintf("%s:%s", RequestHash, key)
+}
+
+// request - get the script args of the request of the create of the task id in ctx, its key and its hash,
+// both are empty if it has none
+func (ks keyspace) request(ctx context.Context, id string) []interface{} {
+	request, _, ok := requestOf(ctx, id)
+	if !ok {
+		return []interface{}{"", ""}
+	}
+	return []interface{}{ks.key(RequestKey(request.Key)), request.Hash}
+}
+
+// requestTTL - get the milliseconds the request keys of the creates in ctx are kept
+func requestTTL(ctx context.Context) int64 {
+	value, _ := ctx.Value(requestsKey{}).(requests)
+	return value.ttl.Milliseconds()
+}
+
+// TermKey - get the redis key of the ids of the tasks with a search term
+func TermKey(term string) string {
+	return fmt.Sprintf("%s:term:%s", SearchIndex, term)
+}
+
+// GramKey - get the redis key of the search terms with a trigram
+func GramKey(gram string) string {
+	return fmt.Sprintf("%s:gram:%s", SearchIndex, gram)
+}
+
+// Get - get a task by id
+func (repo *redisRepository) Get(ctx context.Context, id string) (*pbTask.Task, error) {
+	ks := keyspaceOf(ctx)
+	data, err := repo.client.Get(ctx, ks.key(TaskKey(id))).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("redis get error: %w", err)
+	}
+	task := &pbTask.Task{}
+	if err = json.Unmarshal(data, task); err != nil {
+		return nil, fmt.Errorf("unmarshal error: %w", err)
+	}
+	return task, nil
+}
+
+// List - get a list of tasks ordered by id
+func (repo *redisRepository) List(ctx context.Context, opts ListOptions) ([]*pbTask.Task, error) {
+	tasks, _, err := repo.ListPage(ctx, opts)
+	return tasks, err
+}
+
+// ListPage - get a page of tasks ordered by id and the cursor of the next page, every page is read in one call
+func (repo *redisRepository) ListPage(ctx context.Context, opts ListOptions) ([]*pbTask.Task, string, error) {
+	ks := keyspaceOf(ctx)
+	// the status and children indexes only have the tasks which are not deleted
+	key := ks.key(SortSet)
+	switch {
+	case opts.ShowDeleted:
+	case opts.Parent != "":
+		key = ks.key(ChildKey(opts.Parent))
+	case opts.Status != nil:
+		key = ks.key(StatusKey(*opts.Status))
+	}
+	// the orphaned ids are removed from every index
+	keys := append(append([]string{key, ks.key(SortSet)}, statusKeys(ks)...), ks.key(TrashSet))
+	return collect(opts, func(cursor string, count int64) ([]*pbTask.Task, int, string, error) {
+		start, stop, rev := "-", "+", "0"
+		if cursor != "" {
+			start = "(" + cursor
+		}
+		if opts.Desc {
+			// ZRANGE key max min BYLEX REV
+			start, stop, rev = "+", "-", "1"
+			if cursor != "" {
+				start = "(" + cursor
+			}
+		}
+		reply, err := repo.client.Eval(ctx, helper.ListTasks, keys,
+			start, stop, rev, count, ks.key(TaskID+":")).Slice()
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("redis eval error: %w", err)
+		}
+		ids, values, orphans := replyStrings(reply, 0), replyStrings(reply, 1), replyStrings(reply, 2)
+		if len(orphans) > 0 {
+			repo.logger.Warn("List removed the ids without a task from the index",
+				zap.String("index", key), zap.Strings("ids", orphans))
+		}
+
+		tasks := []*pbTask.Task{}
+		for _, value := range values {
+			task := &pbTask.Task{}
+			if err = json.Unmarshal([]byte(value), task); err != nil {
+				repo.logger.Error("List unmarshal error", zap.String("value", value), zap.Error(err))
+				continue
+			}
+			tasks = append(tasks, task)
+		}
+		if len(ids) == 0 {
+			return tasks, 0, "", nil
+		}
+		return tasks, len(ids), ids[len(ids)-1], nil
+	})
+}
+
+// Create - save a new task
+func (repo *redisRepository) Create(ctx context.Context, task *pbTask.Task) error {
+	ks := keyspaceOf(ctx)
+	// check id exist
+	// usually the id won't repeat
+	exist := repo.client.Exists(ctx, ks.key(TaskKey(task.Id))).Val()
+	if exist != 0 {
+		return ErrAlreadyExists
+	}
+
+	task.Etag = NextEtag("")
+	data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_CREATED, task)
+	if err != nil {
+		return err
+	}
+	tenant := TenantOf(ctx)
+	args := []interface{}{data, task.Id, ks.key(TaskID + ":"), ks.key(ChildSet + ":"), ks.key(TrashSet), ks.key(RevisionStream + ":"),
+		actorOf(ctx), EventStream, EventStreamMaxLen, event, ks.key(SearchIndex), tenant.MaxTasks, TenantSet, tenant.ID}
+	args = append(append(args, ks.request(ctx, task.Id)...), requestTTL(ctx))
+	err = repo.client.Eval(ctx, helper.AddTask,
+		[]string{ks.key(TaskKey(task.Id)), ks.key(SortSet), ks.key(StatusKey(task.Status))}, args...).Err()
+	return scriptErr(err)
+}
+
+// Update - overwrite an existing task whose stored etag is etag
+func (repo *redisRepository) Update(ctx context.Context, task *pbTask.Task, etag string) error {
+	ks := keyspaceOf(ctx)
+	task.Etag = NextEtag(etag)
+	data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_UPDATED, task)
+	if err != nil {
+		return err
+	}
+	err = repo.client.Eval(ctx, helper.UpdateTask,
+		[]string{ks.key(TaskKey(task.Id))}, etag, data, task.Id, ks.key(StatusSet+":"), ks.key(RevisionStream+":"),
+		actorOf(ctx), EventStream, EventStreamMaxLen, event, ks.key(SearchIndex), ks.key(TaskID+":")).Err()
+	return scriptErr(err)
+}
+
+// Delete - move an existing task to the trash
+func (repo *redisRepository) Delete(ctx context.Context, task *pbTask.Task, etag string) error {
+	ks := keyspaceOf(ctx)
+	task.Etag = NextEtag(etag)
+	data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_DELETED, task)
+	if err != nil {
+		return err
+	}
+	err = repo.client.Eval(ctx, helper.DeleteTask, []string{ks.key(TaskKey(task.Id)), ks.key(TrashSet)},
+		etag, data, task.Id, ks.key(StatusSet+":"), ks.key(ChildSet+":"), expireScore(task), ks.key(RevisionStream+":"),
+		actorOf(ctx), EventStream, EventStreamMaxLen, event, ks.key(SearchIndex)).Err()
+	return scriptErr(err)
+}
+
+// Undelete - restore a deleted task from the trash
+func (repo *redisRepository) Undelete(ctx context.Context, task *pbTask.Task, etag string) error {
+	ks := keyspaceOf(ctx)
+	task.Etag = NextEtag(etag)
+	data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_UNDELETED, task)
+	if err != nil {
+		return err
+	}
+	err = repo.client.Eval(ctx, helper.UndeleteTask, []string{ks.key(TaskKey(task.Id)), ks.key(TrashSet)},
+		etag, data, task.Id, ks.key(StatusSet+":"), ks.key(ChildSet+":"), ks.key(TaskID+":"), ks.key(RevisionStream+":"),
+		actorOf(ctx), EventStream, EventStreamMaxLen, event, ks.key(SearchIndex)).Err()
+	return scriptErr(err)
+}
+
+// Purge - permanently delete the expired tasks in the trash
+func (repo *redisRepository) Purge(ctx context.Context, before time.Time, limit int64) ([]string, error) {
+	ks := keyspaceOf(ctx)
+	if limit <= 0 {
+		limit = -1
+	}
+	ids, err := repo.client.Eval(ctx, helper.PurgeTasks, []string{ks.key(TrashSet), ks.key(SortSet)},
+		before.UnixMilli(), limit, ks.key(TaskID+":"), ks.key(ChildSet+":"), ks.key(RevisionStream+":")).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis eval error: %w", err)
+	}
+	return ids, nil
+}
+
+// AddDependency - overwrite an existing task which got the dependency dependsOn,
+// the dependency graph is checked in the same script
+func (repo *redisRepository) AddDependency(ctx context.Context, task *pbTask.Task, etag string, dependsOn string) error {
+	ks := keyspaceOf(ctx)
+	task.Etag = NextEtag(etag)
+	data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_UPDATED, task)
+	if err != nil {
+		return err
+	}
+	err = repo.client.Eval(ctx, helper.AddDependency,
+		[]string{ks.key(TaskKey(task.Id))}, etag, data, dependsOn, ks.key(TaskID+":"), task.Id, ks.key(TrashSet),
+		ks.key(RevisionStream+":"), actorOf(ctx), EventStream, EventStreamMaxLen, event).Err()
+	return scriptErr(err)
+}
+
+// BatchGet - get the tasks by ids with MGET
+func (repo *redisRepository) BatchGet(ctx context.Context, ids []string) ([]*pbTask.Task, error) {
+	ks := keyspaceOf(ctx)
+	tasks := make([]*pbTask.Task, len(ids))
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = ks.key(TaskKey(id))
+	}
+	values, err := repo.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis mget error: %w", err)
+	}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		task := &pbTask.Task{}
+		if err = json.Unmarshal([]byte(data), task); err != nil {
+			return nil, fmt.Errorf("unmarshal error: %w", err)
+		}
+		tasks[i] = task
+	}
+	return tasks, nil
+}
+
+// BatchCreate - save new tasks in one script
+func (repo *redisRepository) BatchCreate(ctx context.Context, tasks []*pbTask.Task, atomic bool) ([]error, error) {
+	ks := keyspaceOf(ctx)
+	keys := []string{ks.key(SortSet)}
+	args := []interface{}{atomicArg(atomic), ks.key(TaskID + ":"), ks.key(ChildSet + ":"), ks.key(TrashSet),
+		ks.key(RevisionStream + ":"), actorOf(ctx), EventStream, EventStreamMaxLen}
+	for _, task := range tasks {
+		task.Etag = NextEtag("")
+		data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_CREATED, task)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ks.key(TaskKey(task.Id)), ks.key(StatusKey(task.Status)))
+		args = append(args, data, task.Id, event)
+		args = append(args, ks.request(ctx, task.Id)...)
+	}
+	tenant := TenantOf(ctx)
+	args = append(args, ks.key(SearchIndex), tenant.MaxTasks, TenantSet, tenant.ID, requestTTL(ctx))
+	return repo.batch(ctx, helper.BatchAddTask, keys, args)
+}
+
+// BatchUpdate - overwrite existing tasks in one script
+func (repo *redisRepository) BatchUpdate(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	ks := keyspaceOf(ctx)
+	keys := []string{}
+	args := []interface{}{atomicArg(atomic), ks.key(StatusSet + ":"), ks.key(RevisionStream + ":"), actorOf(ctx),
+		EventStream, EventStreamMaxLen}
+	for i, task := range tasks {
+		task.Etag = NextEtag(etags[i])
+		data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_UPDATED, task)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ks.key(TaskKey(task.Id)))
+		args = append(args, etags[i], data, task.Id, event)
+	}
+	args = append(args, ks.key(TaskID+":"), ks.key(SearchIndex))
+	return repo.batch(ctx, helper.BatchUpdateTask, keys, args)
+}
+
+// BatchDelete - move existing tasks to the trash in one script
+func (repo *redisRepository) BatchDelete(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	ks := keyspaceOf(ctx)
+	keys := []string{ks.key(TrashSet)}
+	args := []interface{}{atomicArg(atomic), ks.key(StatusSet + ":"), ks.key(ChildSet + ":"), ks.key(RevisionStream + ":"),
+		actorOf(ctx), EventStream, EventStreamMaxLen}
+	for i, task := range tasks {
+		task.Etag = NextEtag(etags[i])
+		data, event, err := marshalWrite(ctx, pbTask.TaskEvent_TYPE_DELETED, task)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ks.key(TaskKey(task.Id)))
+		args = append(args, etags[i], data, task.Id, expireScore(task), event)
+	}
+	args = append(args, ks.key(SearchIndex))
+	return repo.batch(ctx, helper.BatchDeleteTask, keys, args)
+}
+
+// BatchRemove - permanently delete existing tasks in one script
+func (repo *redisRepository) BatchRemove(ctx context.Context, ids []string, etags []string, atomic bool) ([]error, error) {
+	ks := keyspaceOf(ctx)
+	keys := []string{ks.key(SortSet)}
+	args := []interface{}{atomicArg(atomic), ks.key(StatusSet + ":"), ks.key(ChildSet + ":"), ks.key(RevisionStream + ":")}
+	for i, id := range ids {
+		keys = append(keys, ks.key(TaskKey(id)))
+		args = append(args, etags[i], id)
+	}
+	args = append(args, ks.key(SearchIndex))
+	return repo.batch(ctx, helper.BatchRemoveTask, keys, args)
+}
+
+// ListRevisions - get the revisions of a task before the cursor with XREVRANGE, the newest first
+func (repo *redisRepository) ListRevisions(ctx context.Context, id string, cursor string, size int64) ([]*pbTask.TaskRevision, error) {
+	ks := keyspaceOf(ctx)
+	start := "+"
+	if cursor != "" {
+		start = "(" + cursor
+	}
+	var (
+		messages []redis.XMessage
+		err      error
+	)
+	if size > 0 {
+		messages, err = repo.client.XRevRangeN(ctx, ks.key(RevisionKey(id)), start, "-", size).Result()
+	} else {
+		messages, err = repo.client.XRevRange(ctx, ks.key(RevisionKey(id)), start, "-").Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis xrevrange error: %w", err)
+	}
+	revisions := make([]*pbTask.TaskRevision, 0, len(messages))
+	for _, message := range messages {
+		revision, err := parseRevision(message)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// GetRevision - get a revision of a task with XRANGE
+func (repo *redisRepository) GetRevision(ctx context.Context, id string, revisionID string) (*pbTask.TaskRevision, error) {
+	ks := keyspaceOf(ctx)
+	if _, _, ok := parseRevisionID(revisionID); !ok {
+		return nil, ErrRevisionNotFound
+	}
+	messages, err := repo.client.XRange(ctx, ks.key(RevisionKey(id)), revisionID, revisionID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis xrange error: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, ErrRevisionNotFound
+	}
+	return parseRevision(messages[0])
+}
+
+// Search - rank the tasks in the search index in one script, every query token matches the indexed terms
+// equal to it, the terms starting with it and the terms sharing enough trigrams a few edits away
+func (repo *redisRepository) Search(ctx context.Context, query string, offset int64, size int64) ([]*pbTask.Task, error) {
+	ks := keyspaceOf(ctx)
+	tokens := search.Query(query)
+	if len(tokens) == 0 {
+		return []*pbTask.Task{}, nil
+	}
+	groups := make([][]interface{}, len(tokens))
+	for i, token := range tokens {
+		group, err := repo.expand(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if len(group) == 0 {
+			return []*pbTask.Task{}, nil
+		}
+		groups[i] = group
+	}
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %w", err)
+	}
+	limit := size
+	if limit <= 0 {
+		// the last index of ZREVRANGE is offset+limit-1
+		limit = -offset
+	}
+	values, err := repo.client.Eval(ctx, helper.SearchTasks, nil,
+		ks.key(SearchIndex+":tmp:"), offset, limit, data, ks.key(TaskID+":")).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis eval error: %w", err)
+	}
+	tasks := []*pbTask.Task{}
+	for _, value := range values {
+		task := &pbTask.Task{}
+		if err = json.Unmarshal([]byte(value), task); err != nil {
+			repo.logger.Error("Search unmarshal error", zap.String("value", value), zap.Error(err))
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// expand - get the keys of the term indexes matching a query token with the weights of the matches,
+// [key, weight, key, weight, ...]
+func (repo *redisRepository) expand(ctx context.Context, token string) ([]interface{}, error) {
+	ks := keyspaceOf(ctx)
+	group := []interface{}{}
+	exists, err := repo.client.Exists(ctx, ks.key(TermKey(token))).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis exists error: %w", err)
+	}
+	if exists > 0 {
+		group = append(group, ks.key(TermKey(token)), search.ExactMatch)
+	}
+	terms, err := repo.client.ZRangeByLex(ctx, ks.key(SearchIndex+":terms"), &redis.ZRangeBy{
+		Min:   "(" + token,
+		Max:   "[" + token + "\xff",
+		Count: search.MaxPrefixTerms,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis zrangebylex error: %w", err)
+	}
+	for _, term := range terms {
+		group = append(group, ks.key(TermKey(term)), search.PrefixMatch)
+	}
+	if search.MaxEdits(token) == 0 {
+		return group, nil
+	}
+	grams := search.Grams(token)
+	pipe := repo.client.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(grams))
+	for i, gram := range grams {
+		cmds[i] = pipe.SMembers(ctx, ks.key(GramKey(gram)))
+	}
+	if _, err = pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis smembers error: %w", err)
+	}
+	shared := map[string]int{}
+	for _, cmd := range cmds {
+		for _, term := range cmd.Val() {
+			shared[term]++
+		}
+	}
+	fuzzy := []string{}
+	for term, count := range shared {
+		if count >= search.MinSharedGrams(token) && search.Match(token, term) == search.FuzzyMatch {
+			fuzzy = append(fuzzy, term)
+		}
+	}
+	sort.Strings(fuzzy)
+	for _, term := range fuzzy {
+		group = append(group, ks.key(TermKey(term)), search.FuzzyMatch)
+	}
+	return group, nil
+}
+
+// Tenants - get the tenants in the tenant set, a tenant stays in it after its tasks are removed
+func (repo *redisRepository) Tenants(ctx context.Context) ([]string, error) {
+	tenants, err := repo.client.SMembers(ctx, TenantSet).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis smembers error: %w", err)
+	}
+	sort.Strings(tenants)
+	return append([]string{""}, tenants...), nil
+}
+
+// parseRevision - get the revision of a stream entry written by the scripts
+func parseRevision(message redis.XMessage) (*pbTask.TaskRevision, error) {
+	data, _ := message.Values["task"].(string)
+	task := &pbTask.Task{}
+	if err := json.Unmarshal([]byte(data), task); err != nil {
+		return nil, fmt.Errorf("unmarshal error: %w", err)
+	}
+	action, _ := message.Values["action"].(string)
+	actor, _ := message.Values["actor"].(string)
+	return newRevision(message.ID, pbTask.TaskRevision_Action(pbTask.TaskRevision_Action_value[action]), actor, task), nil
+}
+
+// batch - run a batch script and map the code replied for each task
+func (repo *redisRepository) batch(ctx context.Context, script string, keys []string, args []interface{}) ([]error, error) {
+	codes, err := repo.client.Eval(ctx, script, keys, args...).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis eval error: %w", err)
+	}
+	errs := make([]error, len(codes))
+	for i, code := range codes {
+		switch code {
+		case "OK":
+		case "ALREADY_EXISTS":
+			errs[i] = ErrAlreadyExists
+		default:
+			errs[i] = scriptErr(errors.New(code))
+		}
+	}
+	return errs, nil
+}
+
+// marshalWrite - get the stored JSON of a written task and its event, the previous status of
+// the event is added by the script which knows the stored task
+func marshalWrite(ctx context.Context, eventType pbTask.TaskEvent_Type, task *pbTask.Task) ([]byte, []byte, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal error: %w", err)
+	}
+	event, err := proto.Marshal(&pbTask.TaskEvent{
+		Type:   eventType,
+		TaskId: task.Id,
+		Task:   task,
+		Actor:  actorOf(ctx),
+		Time:   timestamppb.Now(),
+		Tenant: TenantOf(ctx).ID,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal event error: %w", err)
+	}
+	return data, event, nil
+}
+
+// expireScore - the score of a deleted task in the trash
+func expireScore(task *pbTask.Task) int64 {
+	return task.ExpireTime.AsTime().UnixMilli()
+}
+
+func atomicArg(atomic bool) string {
+	if atomic {
+		return "1"
+	}
+	return "0"
+}
+
+// statusKeys - get the keys of every status index of a keyspace
+func statusKeys(ks keyspace) []string {
+	statuses := make([]int, 0, len(pbTask.Status_name))
+	for status := range pbTask.Status_name {
+		statuses = append(statuses, int(status))
+	}
+	sort.Ints(statuses)
+	keys := make([]string, len(statuses))
+	for i, status := range statuses {
+		keys[i] = ks.key(StatusKey(pbTask.Status(status)))
+	}
+	return keys
+}
+
+// replyStrings - get the strings of the i-th array in a script reply
+func replyStrings(reply []interface{}, i int) []string {
+	if i >= len(reply) {
+		return nil
+	}
+	values, _ := reply[i].([]interface{})
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
+
+// scriptErr - map the errors replied by the scripts
+func scriptErr(err error) error {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return nil
+	}
+	// some servers prefix the replies of redis.error_reply with ERR
+	switch strings.TrimPrefix(err.Error(), "ERR ") {
+	case "NOT_FOUND":
+		return ErrNotFound
+	case "CONFLICT":
+		return ErrConflict
+	case "PARENT_NOT_FOUND":
+		return ErrParentNotFound
+	case "HAS_CHILDREN":
+		return ErrHasChildren
+	case "DEPENDENCY_NOT_FOUND":
+		return ErrDependencyNotFound
+	case "CYCLE":
+		return ErrCycle
+	case "QUOTA_EXCEEDED":
+		return ErrQuotaExceeded
+	case "REQUEST_MISMATCH":
+		return ErrRequestMismatch
+	case "BLOCKED":
+		return ErrBlocked
+	}
+	if id, ok := strings.CutPrefix(strings.TrimPrefix(err.Error(), "ERR "), "REPLAYED "); ok {
+		return &ReplayError{TaskID: id}
+	}
+	return fmt.Errorf("redis eval error: %w", err)
+}
+
+func NewRedisRepository(client *redis.Client, logger *zap.Logger) TaskRepository {
+	return &redisRepository{
+		client: client,
+		logger: logger,
+	}
+}
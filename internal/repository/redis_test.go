@@ -0,0 +1,383 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+func newRedisMockRepository() (TaskRepository, redismock.ClientMock) {
+	client, mock := redismock.NewClientMock()
+	logger, _ := zap.NewDevelopment()
+	return NewRedisRepository(client, logger), mock
+}
+
+// matchEvent - match the arguments of a script with an event of the type where the expected arguments are nil,
+// the event is not compared as its time changes on every call
+func matchEvent(eventType pbTask.TaskEvent_Type) redismock.CustomMatch {
+	return func(expected, actual []interface{}) error {
+		at := -1
+		for i, arg := range expected {
+			if arg == nil {
+				at = i
+			}
+		}
+		if len(expected) != len(actual) || at < 0 || !reflect.DeepEqual(expected[:at], actual[:at]) ||
+			!reflect.DeepEqual(expected[at+1:], actual[at+1:]) {
+			return fmt.Errorf("args not match, expectation: '%+v', but gave: '%+v'", expected, actual)
+		}
+		data, _ := actual[at].([]byte)
+		event := &pbTask.TaskEvent{}
+		if err := proto.Unmarshal(data, event); err != nil || event.Type != eventType {
+			return fmt.Errorf("event not match, expectation: %s, but gave: '%+v'", eventType, actual[at])
+		}
+		return nil
+	}
+}
+
+// newMiniRedisRepository - a repository on an in-process redis which runs the lua scripts
+func newMiniRedisRepository(t *testing.T) (TaskRepository, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger, _ := zap.NewDevelopment()
+	return NewRedisRepository(client, logger), server
+}
+
+func TestRedisCreate(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		task        = &pbTask.Task{Id: "1", Name: "test-name", Status: 1}
+		data, _     = json.Marshal(&pbTask.Task{Id: "1", Name: "test-name", Status: 1, Etag: "1"})
+		key         = TaskKey(task.Id)
+	)
+
+	rmock.ExpectExists(key).SetVal(0)
+	rmock.CustomMatch(matchEvent(pbTask.TaskEvent_TYPE_CREATED)).ExpectEval(helper.AddTask,
+		[]string{key, SortSet, StatusKey(task.Status)}, data, task.Id, TaskID+":", ChildSet+":", TrashSet,
+		RevisionStream+":", "", EventStream, EventStreamMaxLen, nil, SearchIndex, int64(0), TenantSet, "", "", "", int64(0)).RedisNil()
+
+	err := repo.Create(context.Background(), task)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", task.Etag)
+	assert.Nil(t, rmock.ExpectationsWereMet())
+}
+
+func TestRedisCreateIdExist(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		task        = &pbTask.Task{Id: "1", Name: "test-name", Status: 1}
+	)
+
+	rmock.ExpectExists(TaskKey(task.Id)).SetVal(1)
+
+	err := repo.Create(context.Background(), task)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+}
+
+func TestRedisGet(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		except      = &pbTask.Task{Id: "1", Name: "test-name", Status: 1}
+		data, _     = json.Marshal(except)
+	)
+	rmock.ExpectGet(TaskKey(except.Id)).SetVal(string(data))
+
+	task, err := repo.Get(context.Background(), except.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, except, task)
+}
+
+func TestRedisGetNotFound(t *testing.T) {
+	repo, rmock := newRedisMockRepository()
+	rmock.ExpectGet(TaskKey("1")).RedisNil()
+
+	_, err := repo.Get(context.Background(), "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRedisDelete(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		expire      = time.UnixMilli(1700000000000)
+		task        = deleted(nil, "1", expire)
+		data, _     = json.Marshal(&pbTask.Task{Id: "1", Etag: "2", DeleteTime: task.DeleteTime, ExpireTime: task.ExpireTime})
+	)
+	rmock.CustomMatch(matchEvent(pbTask.TaskEvent_TYPE_DELETED)).ExpectEval(helper.DeleteTask, []string{TaskKey("1"), TrashSet},
+		"1", data, "1", StatusSet+":", ChildSet+":", expire.UnixMilli(), RevisionStream+":", "",
+		EventStream, EventStreamMaxLen, nil, SearchIndex).RedisNil()
+
+	err := repo.Delete(context.Background(), task, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", task.Etag)
+	assert.Nil(t, rmock.ExpectationsWereMet())
+}
+
+func TestRedisDeleteNotFound(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		expire      = time.UnixMilli(1700000000000)
+		task        = deleted(nil, "1", expire)
+		data, _     = json.Marshal(&pbTask.Task{Id: "1", Etag: "1", DeleteTime: task.DeleteTime, ExpireTime: task.ExpireTime})
+	)
+	rmock.CustomMatch(matchEvent(pbTask.TaskEvent_TYPE_DELETED)).ExpectEval(helper.DeleteTask, []string{TaskKey("1"), TrashSet},
+		"", data, "1", StatusSet+":", ChildSet+":", expire.UnixMilli(), RevisionStream+":", "",
+		EventStream, EventStreamMaxLen, nil, SearchIndex).SetErr(errors.New("NOT_FOUND"))
+
+	err := repo.Delete(context.Background(), task, "")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRedisUpdate(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		task        = &pbTask.Task{Id: "1", Name: "update-test-name", Status: 1}
+		data, _     = json.Marshal(&pbTask.Task{Id: "1", Name: "update-test-name", Status: 1, Etag: "2"})
+	)
+	rmock.CustomMatch(matchEvent(pbTask.TaskEvent_TYPE_UPDATED)).ExpectEval(helper.UpdateTask, []string{TaskKey(task.Id)},
+		"1", data, task.Id, StatusSet+":", RevisionStream+":", "", EventStream, EventStreamMaxLen, nil, SearchIndex, TaskID+":").RedisNil()
+
+	err := repo.Update(context.Background(), task, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", task.Etag)
+	assert.Nil(t, rmock.ExpectationsWereMet())
+}
+
+func TestRedisScriptUpdate(t *testing.T) {
+	var (
+		repo, _ = newMiniRedisRepository(t)
+		ctx     = context.Background()
+		task    = &pbTask.Task{Id: "1", Name: "test-name"}
+	)
+	err := repo.Update(ctx, &pbTask.Task{Id: "1"}, "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, repo.Create(ctx, task))
+
+	task.Name = "update-test-name"
+	assert.Nil(t, repo.Update(ctx, task, "1"))
+	assert.Equal(t, "2", task.Etag)
+
+	// a writer still holding the first version loses
+	stale := &pbTask.Task{Id: "1", Name: "stale"}
+	err = repo.Update(ctx, stale, "1")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	resp, err := repo.Get(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "update-test-name", resp.Name)
+	assert.Equal(t, "2", resp.Etag)
+}
+
+func TestRedisScriptDelete(t *testing.T) {
+	var (
+		repo, server = newMiniRedisRepository(t)
+		ctx          = context.Background()
+	)
+	err := repo.Delete(ctx, deleted(repo, "1", time.Now()), "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1"}))
+
+	err = repo.Delete(ctx, deleted(repo, "1", time.Now()), "2")
+	assert.ErrorIs(t, err, ErrConflict)
+	members, _ := server.ZMembers(TrashSet)
+	assert.Empty(t, members)
+
+	expire := time.Now().Add(time.Hour)
+	assert.Nil(t, repo.Delete(ctx, deleted(repo, "1", expire), "1"))
+	assert.True(t, server.Exists(TaskKey("1")))
+	members, _ = server.ZMembers(StatusKey(pbTask.Status_STATUS_INCOMPLETE))
+	assert.Empty(t, members)
+	score, _ := server.ZScore(TrashSet, "1")
+	assert.Equal(t, float64(expire.UnixMilli()), score)
+}
+
+func TestRedisList(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		keys        = []string{"1", "2", "3"}
+		expects     = make([]*pbTask.Task, 3)
+		values      = make([]interface{}, 3)
+		ids         = make([]interface{}, 3)
+	)
+	for i, val := range keys {
+		task := &pbTask.Task{
+			Id:     val,
+			Name:   fmt.Sprintf("test-%d", i),
+			Status: 1,
+		}
+		data, _ := json.Marshal(task)
+		expects[i] = task
+		values[i] = string(data)
+		ids[i] = val
+	}
+	// the page is read in one round trip
+	rmock.ExpectEval(helper.ListTasks, append(append([]string{SortSet, SortSet}, statusKeys("")...), TrashSet),
+		"-", "+", "0", int64(30), TaskID+":").SetVal([]interface{}{ids, values, []interface{}{}})
+
+	tasks, err := repo.List(context.Background(), ListOptions{Size: 30})
+	assert.Nil(t, err)
+	assert.Equal(t, expects, tasks)
+	assert.Nil(t, rmock.ExpectationsWereMet())
+}
+
+func TestRedisListWithCursor(t *testing.T) {
+	var (
+		repo, rmock = newRedisMockRepository()
+		expects     = make([]*pbTask.Task, 25)
+		values      = make([]interface{}, 25)
+		ids         = make([]interface{}, 25)
+	)
+	for i := range expects {
+		task := &pbTask.Task{
+			Id:     fmt.Sprintf("%d", i+26),
+			Name:   fmt.Sprintf("test-%d", i),
+			Status: 1,
+		}
+		data, _ := json.Marshal(task)
+		expects[i] = task
+		values[i] = string(data)
+		ids[i] = task.Id
+	}
+	rmock.ExpectEval(helper.ListTasks, append(append([]string{SortSet, SortSet}, statusKeys("")...), TrashSet),
+		"(25", "+", "0", int64(25), TaskID+":").SetVal([]interface{}{ids, values, []interface{}{}})
+
+	tasks, err := repo.List(context.Background(), ListOptions{Cursor: "25", Size: 25})
+	assert.Nil(t, err)
+	assert.Equal(t, expects, tasks)
+}
+
+func TestRedisListError(t *testing.T) {
+	repo, rmock := newRedisMockRepository()
+	rmock.ExpectEval(helper.ListTasks, append(append([]string{SortSet, SortSet}, statusKeys("")...), TrashSet),
+		"-", "+", "0", int64(25), TaskID+":").SetErr(errors.New("connection refused"))
+
+	_, err := repo.List(context.Background(), ListOptions{Size: 25})
+	assert.Error(t, err)
+}
+
+func TestRedisListOrphans(t *testing.T) {
+	var (
+		repo, server = newMiniRedisRepository(t)
+		ctx          = context.Background()
+		complete     = pbTask.Status_STATUS_COMPLETE
+	)
+	for i := 1; i <= 4; i++ {
+		assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: fmt.Sprint(i), Status: complete}))
+	}
+	// the records of 2 and 3 are lost, their ids are still indexed
+	server.Del(TaskKey("2"))
+	server.Del(TaskKey("3"))
+
+	tasks, err := repo.List(ctx, ListOptions{Size: 2, Status: &complete})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "4"}, taskIDs(tasks))
+
+	members, _ := server.ZMembers(SortSet)
+	assert.Equal(t, []string{"1", "4"}, members)
+	members, _ = server.ZMembers(StatusKey(complete))
+	assert.Equal(t, []string{"1", "4"}, members)
+}
+
+func TestRedisScriptStatusIndex(t *testing.T) {
+	var (
+		repo, server = newMiniRedisRepository(t)
+		ctx          = context.Background()
+		complete     = pbTask.Status_STATUS_COMPLETE
+	)
+	for i := 1; i <= 4; i++ {
+		task := &pbTask.Task{Id: fmt.Sprint(i), Name: fmt.Sprintf("task-%d", i), Status: pbTask.Status(i % 2)}
+		assert.Nil(t, repo.Create(ctx, task))
+	}
+	members, _ := server.ZMembers(StatusKey(complete))
+	assert.Equal(t, []string{"1", "3"}, members)
+
+	task, _ := repo.Get(ctx, "2")
+	task.Status = complete
+	assert.Nil(t, repo.Update(ctx, task, task.Etag))
+	members, _ = server.ZMembers(StatusKey(complete))
+	assert.Equal(t, []string{"1", "2", "3"}, members)
+	members, _ = server.ZMembers(StatusKey(pbTask.Status_STATUS_INCOMPLETE))
+	assert.Equal(t, []string{"4"}, members)
+
+	task, _ = repo.Get(ctx, "3")
+	trashed := deleted(repo, "3", time.Now().Add(time.Hour))
+	assert.Nil(t, repo.Delete(ctx, trashed, task.Etag))
+	members, _ = server.ZMembers(StatusKey(complete))
+	assert.Equal(t, []string{"1", "2"}, members)
+
+	tasks, err := repo.List(ctx, ListOptions{Status: &complete, Desc: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2", "1"}, taskIDs(tasks))
+
+	tasks, err = repo.List(ctx, ListOptions{Cursor: "2", Status: &complete, Desc: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, taskIDs(tasks))
+}
+
+func TestRedisScriptIndexScores(t *testing.T) {
+	var (
+		repo, server = newMiniRedisRepository(t)
+		ctx          = context.Background()
+		complete     = pbTask.Status_STATUS_COMPLETE
+	)
+	// the ids are ordered as strings, so 20 is before 3 as it is in the memory storage
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "parent"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "3", ParentId: "1", Status: complete}))
+	_, err := repo.BatchCreate(ctx, []*pbTask.Task{{Id: "20", ParentId: "1"}}, true)
+	assert.Nil(t, err)
+	task, _ := repo.Get(ctx, "20")
+	task.Status = complete
+	assert.Nil(t, repo.Update(ctx, task, task.Etag))
+
+	// every member of the indexes read by BYLEX has the same score
+	for _, key := range []string{SortSet, StatusKey(complete), ChildKey("1")} {
+		for _, id := range []string{"3", "20"} {
+			score, err := server.ZScore(key, id)
+			assert.Nil(t, err)
+			assert.Equal(t, float64(0), score, key)
+		}
+	}
+	for _, opts := range []ListOptions{{}, {Status: &complete}, {Parent: "1"}} {
+		tasks, err := repo.List(ctx, opts)
+		assert.Nil(t, err)
+		ids := taskIDs(tasks)
+		assert.Equal(t, []string{"20", "3"}, ids[len(ids)-2:])
+	}
+}
+
+func TestRedisListMatch(t *testing.T) {
+	var (
+		repo, _ = newMiniRedisRepository(t)
+		ctx     = context.Background()
+	)
+	for i := 1; i <= 7; i++ {
+		assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: fmt.Sprint(i)}))
+	}
+	odd := func(task *pbTask.Task) bool {
+		return task.Id[0]%2 == 1
+	}
+
+	// the pages are filled by scanning more ids than the page size
+	tasks, err := repo.List(ctx, ListOptions{Size: 3, Match: odd})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "3", "5"}, taskIDs(tasks))
+
+	tasks, err = repo.List(ctx, ListOptions{Cursor: "5", Size: 3, Match: odd})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"7"}, taskIDs(tasks))
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+)
+
+var (
+	// ErrNotFound - the task does not exist
+	ErrNotFound = errors.New("task not found")
+	// ErrAlreadyExists - the task id is already used
+	ErrAlreadyExists = errors.New("task already exists")
+	// ErrConflict - the etag of the task is not the expected one
+	ErrConflict = errors.New("task etag conflict")
+	// ErrParentNotFound - the parent of a new or undeleted task does not exist or is deleted
+	ErrParentNotFound = errors.New("parent task not found")
+	// ErrHasChildren - the task has subtasks, so it can only be deleted with them
+	ErrHasChildren = errors.New("task has subtasks")
+	// ErrDependencyNotFound - the task to depend on does not exist or is deleted
+	ErrDependencyNotFound = errors.New("dependency task not found")
+	// ErrCycle - the dependency would make a cycle
+	ErrCycle = errors.New("dependency cycle")
+	// ErrRevisionNotFound - the task has no revision with the id
+	ErrRevisionNotFound = errors.New("task revision not found")
+	// ErrQuotaExceeded - the tenant already stores as many tasks as its MaxTasks
+	ErrQuotaExceeded = errors.New("task quota exceeded")
+	// ErrBlocked - the task is completed while a task it depends on is not resolved
+	ErrBlocked = errors.New("task is blocked")
+)
+
+// Resolved - check if a task with the status no longer blocks the tasks depending on it
+func Resolved(status pbTask.Status) bool {
+	switch status {
+	case pbTask.Status_STATUS_COMPLETE, pbTask.Status_STATUS_CANCELLED, pbTask.Status_STATUS_ARCHIVED:
+		return true
+	}
+	return false
+}
+
+type ListOptions struct {
+	// Cursor - only list the tasks whose id is after the cursor
+	Cursor string
+	// Size - the maximum number of tasks
+	Size int64
+	// Status - only list the tasks in the status, served by the status index
+	Status *pbTask.Status
+	// Desc - list the tasks from the newest to the oldest
+	Desc bool
+	// Parent - only list the subtasks of the task, served by the children index
+	Parent string
+	// ShowDeleted - list the deleted tasks too
+	ShowDeleted bool
+	// Match - only list the tasks it accepts, if it is not nil
+	Match func(task *pbTask.Task) bool
+	// MaxScan - stop scanning after about so many tasks even if the page is not full, 0 means no limit
+	MaxScan int64
+}
+
+// rescanSize - how many tasks a scan after the first one of a page reads at least,
+// so a selective match does not read a page in many small scans
+const rescanSize int64 = 100
+
+// accepts - check if the task is listed with the options
+func (opts ListOptions) accepts(task *pbTask.Task) bool {
+	if task.DeleteTime != nil && !opts.ShowDeleted {
+		return false
+	}
+	if opts.Status != nil && task.Status != *opts.Status {
+		return false
+	}
+	if opts.Parent != "" && task.ParentId != opts.Parent {
+		return false
+	}
+	return opts.Match == nil || opts.Match(task)
+}
+
+// scanFunc - read up to count tasks after cursor in the order of the list,
+// count 0 means no limit. It returns the tasks, the number of scanned ids
+// and the last scanned id.
+type scanFunc func(cursor string, count int64) ([]*pbTask.Task, int, string, error)
+
+// collect - scan until opts.Size tasks are matched, no task is left or opts.MaxScan tasks are scanned.
+// It returns the cursor of the next page, the last listed id of a full page or the last scanned id
+// of a page cut by MaxScan, empty when no task is left
+func collect(opts ListOptions, scan scanFunc) ([]*pbTask.Task, string, error) {
+	var (
+		tasks   = []*pbTask.Task{}
+		cursor  = opts.Cursor
+		scanned int64
+	)
+	for {
+		count := int64(0)
+		if opts.Size > 0 {
+			count = opts.Size
+			if scanned > 0 && count < rescanSize {
+				count = rescanSize
+			}
+		}
+		batch, n, last, err := scan(cursor, count)
+		if err != nil {
+			return nil, "", err
+		}
+		scanned += int64(n)
+		for _, task := range batch {
+			if !opts.accepts(task) {
+				continue
+			}
+			tasks = append(tasks, task)
+			if int64(len(tasks)) == opts.Size {
+				return tasks, task.Id, nil
+			}
+		}
+		if count == 0 || int64(n) < count {
+			return tasks, "", nil
+		}
+		if opts.MaxScan > 0 && scanned >= opts.MaxScan {
+			return tasks, last, nil
+		}
+		cursor = last
+	}
+}
+
+// TaskRepository - the storage of the tasks, every method only reads and writes the tasks
+// of the tenant of ctx, see WithTenant
+type TaskRepository interface {
+	// Get - get a task by id
+	Get(ctx context.Context, id string) (*pbTask.Task, error)
+	// List - get a list of tasks ordered by id
+	List(ctx context.Context, opts ListOptions) ([]*pbTask.Task, error)
+	// ListPage - get a page of tasks as List does and the cursor of the next page, empty when no task is left
+	ListPage(ctx context.Context, opts ListOptions) ([]*pbTask.Task, string, error)
+	// Create - save a new task, its etag is set to the first version.
+	// If it has a parent, the parent must exist and must not be deleted.
+	// It returns ErrQuotaExceeded if the tenant already has MaxTasks tasks.
+	// If the create has a request in ctx, see WithRequests, it returns a ReplayError with the task
+	// of a kept request with the same key and payload, or ErrRequestMismatch if it had another payload
+	Create(ctx context.Context, task *pbTask.Task) error
+	// Update - overwrite an existing task whose stored etag is etag,
+	// the etag of task is set to the next version. It returns ErrBlocked if it completes the task
+	// while a task it depends on, which is not deleted, is not resolved
+	Update(ctx context.Context, task *pbTask.Task, etag string) error
+	// Delete - move an existing task whose stored etag is etag to the trash as Update does,
+	// task has its delete and expire time. A task with subtasks which are not deleted is not deleted
+	Delete(ctx context.Context, task *pbTask.Task, etag string) error
+	// Undelete - restore a deleted task whose stored etag is etag from the trash as Update does,
+	// its parent must not be deleted
+	Undelete(ctx context.Context, task *pbTask.Task, etag string) error
+	// Purge - permanently delete up to limit of the deleted tasks which expire before the time,
+	// the earliest first. It returns the ids of the purged tasks
+	Purge(ctx context.Context, before time.Time, limit int64) ([]string, error)
+	// AddDependency - overwrite an existing task which got the dependency dependsOn as Update does,
+	// dependsOn must exist and must not depend on the task, directly or not
+	AddDependency(ctx context.Context, task *pbTask.Task, etag string, dependsOn string) error
+	// BatchGet - get the tasks by ids in the same order, a missing task is nil
+	BatchGet(ctx context.Context, ids []string) ([]*pbTask.Task, error)
+	// BatchCreate - save new tasks, it returns the error of each task as Create does,
+	// the parents must exist before the batch.
+	// If atomic, nothing is saved when any of them fails, a replayed create does not fail
+	BatchCreate(ctx context.Context, tasks []*pbTask.Task, atomic bool) ([]error, error)
+	// BatchUpdate - overwrite existing tasks whose stored etags are etags as Update does,
+	// the ids must be unique. If atomic, nothing is saved when any of them fails
+	BatchUpdate(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error)
+	// BatchDelete - move existing tasks whose stored etags are etags to the trash as Delete does,
+	// the ids must be unique and a task can be deleted after its subtasks in the same batch.
+	// If atomic, nothing is deleted when any of them fails
+	BatchDelete(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error)
+	// BatchRemove - permanently delete existing tasks whose stored etags are etags, e.g. when they are archived.
+	// The ids must be unique and a task with subtasks which are not deleted is only removed after them
+	// in the same batch. If atomic, nothing is removed when any of them fails
+	BatchRemove(ctx context.Context, ids []string, etags []string, atomic bool) ([]error, error)
+	// ListRevisions - get up to size of the revisions of a task before the revision id cursor,
+	// the newest first. Every write records a revision with the task as written and the actor
+	// of WithActor, a revision is removed with its task when it is purged or removed
+	ListRevisions(ctx context.Context, id string, cursor string, size int64) ([]*pbTask.TaskRevision, error)
+	// GetRevision - get a revision of a task by its id
+	GetRevision(ctx context.Context, id string, revisionID string) (*pbTask.TaskRevision, error)
+	// Search - get up to size of the tasks which are not deleted matching every token of the query
+	// from offset, ranked as search.Rank does. Size 0 means no limit
+	Search(ctx context.Context, query string, offset int64, size int64) ([]*pbTask.Task, error)
+	// Tenants - get the ids of the tenants with tasks, the default tenant "" first,
+	// e.g. to purge the trash of each of them
+	Tenants(ctx context.Context) ([]string, error)
+}
+
+// failed - check if any of the batch errors is not nil, a replayed create does not fail a batch
+func failed(errs []error) bool {
+	for _, err := range errs {
+		if err != nil && !replayed(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// reaches - check if the task from depends on the task id, directly or not,
+// get returns nil for a task which does not exist
+func reaches(from string, id string, get func(id string) (*pbTask.Task, error)) (bool, error) {
+	var (
+		queue   = []string{from}
+		visited = map[string]bool{from: true}
+	)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == id {
+			return true, nil
+		}
+		task, err := get(current)
+		if err != nil {
+			return false, err
+		}
+		if task == nil {
+			continue
+		}
+		for _, next := range task.DependsOn {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false, nil
+}
+
+// NextEtag - get the version after etag, an empty etag is the version 0
+func NextEtag(etag string) string {
+	version, _ := strconv.ParseUint(etag, 10, 64)
+	return strconv.FormatUint(version+1, 10)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRequestMismatch - the key of a create was used by a create with another payload
+var ErrRequestMismatch = errors.New("request key used with another payload")
+
+// Request - the idempotency key of the create of a task and the hash of its payload,
+// a create with the key of another create which is still kept is not saved
+type Request struct {
+	// Key - the key of the request, unique in the tenant
+	Key string
+	// Hash - the hash of the payload, a create with the key and another hash is ErrRequestMismatch
+	Hash string
+}
+
+// ReplayError - the key of a create was used by the create of the task TaskID with the same payload,
+// so the task was not saved again
+type ReplayError struct {
+	TaskID string
+}
+
+func (err *ReplayError) Error() string {
+	return fmt.Sprintf("request replayed by task %s", err.TaskID)
+}
+
+// requests - the requests of the creates by task id and how long their keys are kept
+type requests struct {
+	byTask map[string]Request
+	ttl    time.Duration
+}
+
+// requestsKey - the context key of the requests of the creates
+type requestsKey struct{}
+
+// WithRequests - get a context whose creates of the tasks with the ids of byTask are saved
+// once per request key, the keys are kept for ttl
+func WithRequests(ctx context.Context, byTask map[string]Request, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, requestsKey{}, requests{byTask: byTask, ttl: ttl})
+}
+
+// requestOf - get the request of the create of the task id in ctx and how long its key is kept,
+// false if it has none
+func requestOf(ctx context.Context, id string) (Request, time.Duration, bool) {
+	value, _ := ctx.Value(requestsKey{}).(requests)
+	request, ok := value.byTask[id]
+	return request, value.ttl, ok && request.Key != ""
+}
+
+// replayed - check if err is a ReplayError, a replayed create in a batch does not fail the batch
+func replayed(err error) bool {
+	var replay *ReplayError
+	return errors.As(err, &replay)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkRequests - the idempotent creates every repository shares
+func checkRequests(t *testing.T, repo TaskRepository) {
+	var (
+		base = context.Background()
+		acme = WithTenant(base, Tenant{ID: "acme"})
+		with = func(ctx context.Context, id string, key string, hash string) context.Context {
+			return WithRequests(ctx, map[string]Request{id: {Key: key, Hash: hash}}, time.Hour)
+		}
+	)
+	assert.Nil(t, repo.Create(with(base, "1", "k1", "a"), &pbTask.Task{Id: "1", Name: "first"}))
+
+	// the same key and payload replays the first create, another payload is a mismatch
+	err := repo.Create(with(base, "2", "k1", "a"), &pbTask.Task{Id: "2", Name: "first"})
+	assert.Equal(t, &ReplayError{TaskID: "1"}, err)
+	assert.ErrorIs(t, repo.Create(with(base, "2", "k1", "b"), &pbTask.Task{Id: "2", Name: "second"}), ErrRequestMismatch)
+	_, err = repo.Get(base, "2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	// the keys are by tenant
+	assert.Nil(t, repo.Create(with(acme, "3", "k1", "b"), &pbTask.Task{Id: "3", Name: "acme"}))
+	// a create without a request is not checked
+	assert.Nil(t, repo.Create(with(base, "4", "", "a"), &pbTask.Task{Id: "4"}))
+
+	// a replayed create does not fail an atomic batch
+	ctx := WithRequests(base, map[string]Request{"5": {Key: "k1", Hash: "a"}, "6": {Key: "k6", Hash: "a"}}, time.Hour)
+	errs, err := repo.BatchCreate(ctx, []*pbTask.Task{{Id: "5"}, {Id: "6"}}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{&ReplayError{TaskID: "1"}, nil}, errs)
+	tasks, _ := repo.BatchGet(base, []string{"5", "6"})
+	assert.Nil(t, tasks[0])
+	assert.Equal(t, "6", tasks[1].Id)
+	ctx = WithRequests(base, map[string]Request{"7": {Key: "k6", Hash: "b"}, "8": {Key: "k8", Hash: "a"}}, time.Hour)
+	errs, _ = repo.BatchCreate(ctx, []*pbTask.Task{{Id: "7"}, {Id: "8"}}, true)
+	assert.Equal(t, []error{ErrRequestMismatch, nil}, errs)
+	_, err = repo.Get(base, "8")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryRequests(t *testing.T) {
+	checkRequests(t, NewMemoryRepository())
+}
+
+func TestRedisRequests(t *testing.T) {
+	repo, server := newMiniRedisRepository(t)
+	checkRequests(t, repo)
+	assert.True(t, server.Exists(RequestKey("k1")))
+	assert.True(t, server.Exists(TenantPrefix("acme")+RequestKey("k1")))
+
+	// an expired key is used again
+	server.FastForward(time.Hour)
+	ctx := WithRequests(context.Background(), map[string]Request{"9": {Key: "k1", Hash: "b"}}, time.Hour)
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "9"}))
+}
+
+func TestSQLRequests(t *testing.T) {
+	checkRequests(t, newSQLiteRepository(t))
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// actorKey - the context key of the actor recorded in the revisions
+type actorKey struct{}
+
+// WithActor - get a context whose writes are recorded as made by the actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorOf - get the actor of the writes in ctx, empty if it is unknown
+func actorOf(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// parseRevisionID - split a revision id into its milliseconds and sequence number,
+// the ids have the format of the redis stream ids, e.g. 1700000000000-0
+func parseRevisionID(id string) (uint64, uint64, bool) {
+	msPart, seqPart, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+// nextRevisionID - get the revision id after last at now as XADD * does,
+// the sequence number grows within the same millisecond or when the clock goes back
+func nextRevisionID(last string, now time.Time) string {
+	ms := uint64(now.UnixMilli())
+	lastMs, lastSeq, ok := parseRevisionID(last)
+	if ok && lastMs >= ms {
+		return fmt.Sprintf("%d-%d", lastMs, lastSeq+1)
+	}
+	return fmt.Sprintf("%d-0", ms)
+}
+
+// revisionBefore - check if the revision id a is ordered before b
+func revisionBefore(a string, b string) bool {
+	aMs, aSeq, _ := parseRevisionID(a)
+	bMs, bSeq, _ := parseRevisionID(b)
+	return aMs < bMs || (aMs == bMs && aSeq < bSeq)
+}
+
+// newRevision - get a revision of a snapshot of the task, it is created at the time of its id
+func newRevision(id string, action pbTask.TaskRevision_Action, actor string, task *pbTask.Task) *pbTask.TaskRevision {
+	ms, _, _ := parseRevisionID(id)
+	return &pbTask.TaskRevision{
+		RevisionId: id,
+		Action:     action,
+		Actor:      actor,
+		CreateTime: timestamppb.New(time.UnixMilli(int64(ms))),
+		Task:       proto.Clone(task).(*pbTask.Task),
+	}
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkRevisions - the revision history every repository shares
+func checkRevisions(t *testing.T, repo TaskRepository) {
+	var (
+		ctx   = WithActor(context.Background(), "alice")
+		now   = time.Now()
+		task  = &pbTask.Task{Id: "1", Name: "a"}
+		other = &pbTask.Task{Id: "2", Name: "b"}
+	)
+	assert.Nil(t, repo.Create(ctx, task))
+	_, err := repo.BatchCreate(ctx, []*pbTask.Task{other}, true)
+	assert.Nil(t, err)
+	task.Name = "b"
+	assert.Nil(t, repo.Update(context.Background(), task, "1"))
+	assert.ErrorIs(t, repo.Update(ctx, task, "1"), ErrConflict)
+	task.DependsOn = []string{"2"}
+	assert.Nil(t, repo.AddDependency(ctx, task, "2", "2"))
+	assert.Nil(t, repo.Delete(ctx, deleted(repo, "1", now.Add(time.Hour)), "3"))
+	assert.Nil(t, repo.Undelete(ctx, &pbTask.Task{Id: "1", Name: "b", DependsOn: []string{"2"}}, "4"))
+
+	revisions, err := repo.ListRevisions(ctx, "1", "", 0)
+	assert.Nil(t, err)
+	actions := []pbTask.TaskRevision_Action{}
+	for _, revision := range revisions {
+		actions = append(actions, revision.Action)
+	}
+	assert.Equal(t, []pbTask.TaskRevision_Action{
+		pbTask.TaskRevision_ACTION_UNDELETE,
+		pbTask.TaskRevision_ACTION_DELETE,
+		pbTask.TaskRevision_ACTION_UPDATE,
+		pbTask.TaskRevision_ACTION_UPDATE,
+		pbTask.TaskRevision_ACTION_CREATE,
+	}, actions)
+	assert.Equal(t, "alice", revisions[0].Actor)
+	assert.Equal(t, "", revisions[3].Actor)
+	assert.Equal(t, "5", revisions[0].Task.Etag)
+	assert.Equal(t, "a", revisions[4].Task.Name)
+	assert.Equal(t, []string{"2"}, revisions[1].Task.DependsOn)
+	assert.NotNil(t, revisions[1].Task.DeleteTime)
+	for i := 1; i < len(revisions); i++ {
+		assert.True(t, revisionBefore(revisions[i].RevisionId, revisions[i-1].RevisionId))
+	}
+	assert.WithinDuration(t, now, revisions[0].CreateTime.AsTime(), time.Minute)
+
+	// the pages before a cursor
+	page, err := repo.ListRevisions(ctx, "1", revisions[1].RevisionId, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{revisions[2].RevisionId, revisions[3].RevisionId},
+		[]string{page[0].RevisionId, page[1].RevisionId})
+	page, _ = repo.ListRevisions(ctx, "1", revisions[4].RevisionId, 2)
+	assert.Empty(t, page)
+	page, _ = repo.ListRevisions(ctx, "missing", "", 2)
+	assert.Empty(t, page)
+
+	revision, err := repo.GetRevision(ctx, "1", revisions[3].RevisionId)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", revision.Task.Name)
+	assert.Equal(t, pbTask.TaskRevision_ACTION_UPDATE, revision.Action)
+	_, err = repo.GetRevision(ctx, "missing", revisions[3].RevisionId)
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+	_, err = repo.GetRevision(ctx, "1", "invalid")
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+
+	// the batches record a revision for every task which is written
+	other.Name = "c"
+	_, err = repo.BatchUpdate(ctx, []*pbTask.Task{other}, []string{"1"}, true)
+	assert.Nil(t, err)
+	_, err = repo.BatchDelete(ctx, []*pbTask.Task{deleted(repo, "2", now.Add(time.Hour))}, []string{"2"}, false)
+	assert.Nil(t, err)
+	revisions, _ = repo.ListRevisions(ctx, "2", "", 0)
+	assert.Len(t, revisions, 3)
+	assert.Equal(t, pbTask.TaskRevision_ACTION_DELETE, revisions[0].Action)
+	assert.Equal(t, "c", revisions[1].Task.Name)
+
+	// the revisions are removed with their task
+	_, err = repo.BatchRemove(ctx, []string{"1"}, []string{"5"}, true)
+	assert.Nil(t, err)
+	revisions, _ = repo.ListRevisions(ctx, "1", "", 0)
+	assert.Empty(t, revisions)
+	_, err = repo.Purge(ctx, now.Add(2*time.Hour), 0)
+	assert.Nil(t, err)
+	revisions, _ = repo.ListRevisions(ctx, "2", "", 0)
+	assert.Empty(t, revisions)
+}
+
+func TestMemoryRevisions(t *testing.T) {
+	checkRevisions(t, NewMemoryRepository())
+}
+
+func TestRedisRevisions(t *testing.T) {
+	repo, server := newMiniRedisRepository(t)
+	checkRevisions(t, repo)
+	// only the event stream is left
+	assert.Equal(t, []string{EventStream}, server.Keys())
+}
+
+func TestSQLRevisions(t *testing.T) {
+	checkRevisions(t, newSQLiteRepository(t))
+}
+
+func TestNextRevisionID(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	assert.Equal(t, "1700000000000-0", nextRevisionID("", now))
+	assert.Equal(t, "1700000000000-1", nextRevisionID("1700000000000-0", now))
+	assert.Equal(t, "1700000000001-3", nextRevisionID("1700000000001-2", now))
+	assert.Equal(t, "1700000000001-0", nextRevisionID("1700000000000-5", now.Add(time.Millisecond)))
+	assert.True(t, revisionBefore("999-9", "1000-0"))
+	assert.False(t, revisionBefore("1000-0", "1000-0"))
+	_, _, ok := parseRevisionID("1000")
+	assert.False(t, ok)
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkSearch - the search ranking every repository shares
+func checkSearch(t *testing.T, repo TaskRepository) {
+	var (
+		ctx = context.Background()
+		now = time.Now()
+	)
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "Write the report", Description: "quarterly numbers"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "2", Name: "Review report draft"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "3", Name: "Buy groceries", Description: "after the report"}))
+	_, err := repo.BatchCreate(ctx, []*pbTask.Task{{Id: "4", Name: "Reporting tool"}}, true)
+	assert.Nil(t, err)
+
+	search := func(query string, offset int64, size int64) []string {
+		tasks, err := repo.Search(ctx, query, offset, size)
+		assert.Nil(t, err)
+		return taskIDs(tasks)
+	}
+	// the name ranks higher than the description, an exact match higher than a prefix
+	assert.Equal(t, []string{"2", "1", "4", "3"}, search("REPORT", 0, 0))
+	assert.Equal(t, []string{"4"}, search("reporting", 0, 0))
+	assert.Equal(t, []string{"4", "2", "1", "3"}, search("rep", 0, 0))
+	assert.Equal(t, []string{"2", "1", "3"}, search("repart", 0, 0))
+	assert.Equal(t, []string{"2"}, search("report draft", 0, 0))
+	assert.Equal(t, []string{"1"}, search("quartrly", 0, 0))
+	assert.Empty(t, search("report missing", 0, 0))
+	// a short token is not matched with typos
+	assert.Empty(t, search("rap", 0, 0))
+	assert.Equal(t, []string{"1", "4"}, search("report", 1, 2))
+	assert.Empty(t, search("report", 4, 2))
+
+	// the index follows the writes
+	_, err = repo.BatchUpdate(ctx, []*pbTask.Task{{Id: "2", Name: "Review memo"}}, []string{"1"}, true)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Update(ctx, &pbTask.Task{Id: "3", Name: "Buy groceries"}, "1"))
+	assert.Equal(t, []string{"1", "4"}, search("report", 0, 0))
+	assert.Equal(t, []string{"2"}, search("memo", 0, 0))
+	assert.Nil(t, repo.Delete(ctx, deleted(repo, "1", now.Add(time.Hour)), "1"))
+	assert.Equal(t, []string{"4"}, search("report", 0, 0))
+	assert.Nil(t, repo.Undelete(ctx, &pbTask.Task{Id: "1", Name: "Write the report"}, "2"))
+	assert.Equal(t, []string{"1", "4"}, search("report", 0, 0))
+	_, err = repo.BatchDelete(ctx, []*pbTask.Task{deleted(repo, "4", now.Add(time.Hour))}, []string{"1"}, true)
+	assert.Nil(t, err)
+	_, err = repo.BatchRemove(ctx, []string{"1", "2", "3", "4"}, []string{"3", "2", "2", "2"}, true)
+	assert.Nil(t, err)
+	assert.Empty(t, search("report", 0, 0))
+}
+
+func TestMemorySearch(t *testing.T) {
+	checkSearch(t, NewMemoryRepository())
+}
+
+func TestRedisSearch(t *testing.T) {
+	repo, server := newMiniRedisRepository(t)
+	checkSearch(t, repo)
+	// the index is empty when every task is removed
+	for _, key := range server.Keys() {
+		assert.False(t, strings.HasPrefix(key, SearchIndex+":"), key)
+	}
+}
+
+func TestSQLSearch(t *testing.T) {
+	checkSearch(t, newSQLiteRepository(t))
+}
@@ -0,0 +1,795 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/search"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+)
+
+const (
+	// dependencyLock - the postgres advisory lock which serializes the dependency changes,
+	// so two of them can not make a cycle together
+	dependencyLock int64 = 0x7461736b
+)
+
+type sqlRepository struct {
+	db     *sql.DB
+	driver string
+	logger *zap.Logger
+}
+
+// Get - get a task by id
+func (repo *sqlRepository) Get(ctx context.Context, id string) (*pbTask.Task, error) {
+	return get(ctx, repo.db, id)
+}
+
+func get(ctx context.Context, q querier, id string) (*pbTask.Task, error) {
+	var data []byte
+	err := q.QueryRowContext(ctx,
+		`SELECT data FROM tasks WHERE id = $1 AND tenant = $2`, id, TenantOf(ctx).ID).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("sql select error: %w", err)
+	}
+	task := &pbTask.Task{}
+	if err = json.Unmarshal(data, task); err != nil {
+		return nil, fmt.Errorf("unmarshal error: %w", err)
+	}
+	return task, nil
+}
+
+// List - get a list of tasks ordered by id
+func (repo *sqlRepository) List(ctx context.Context, opts ListOptions) ([]*pbTask.Task, error) {
+	tasks, _, err := repo.ListPage(ctx, opts)
+	return tasks, err
+}
+
+// ListPage - get a page of tasks ordered by id and the cursor of the next page
+func (repo *sqlRepository) ListPage(ctx context.Context, opts ListOptions) ([]*pbTask.Task, string, error) {
+	return collect(opts, func(cursor string, count int64) ([]*pbTask.Task, int, string, error) {
+		query, args := listQuery(TenantOf(ctx).ID, opts, cursor, count)
+		rows, err := repo.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("sql select error: %w", err)
+		}
+		defer rows.Close()
+
+		var (
+			tasks   = []*pbTask.Task{}
+			scanned int
+			last    string
+		)
+		for rows.Next() {
+			var (
+				id   string
+				data []byte
+			)
+			if err = rows.Scan(&id, &data); err != nil {
+				return nil, 0, "", fmt.Errorf("sql scan error: %w", err)
+			}
+			scanned++
+			last = id
+			task := &pbTask.Task{}
+			if err = json.Unmarshal(data, task); err != nil {
+				repo.logger.Error("List unmarshal error", zap.String("id", id), zap.Error(err))
+				continue
+			}
+			tasks = append(tasks, task)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, 0, "", fmt.Errorf("sql rows error: %w", err)
+		}
+		return tasks, scanned, last, nil
+	})
+}
+
+// listQuery - keyset pagination on the id of the tasks of a tenant, count 0 means no limit
+func listQuery(tenant string, opts ListOptions, cursor string, count int64) (string, []interface{}) {
+	var (
+		where = []string{"tenant = $1"}
+		args  = []interface{}{tenant}
+	)
+	if !opts.Desc {
+		args = append(args, cursor)
+		where = append(where, fmt.Sprintf("id > $%d", len(args)))
+	} else if cursor != "" {
+		args = append(args, cursor)
+		where = append(where, fmt.Sprintf("id < $%d", len(args)))
+	}
+	if opts.Status != nil {
+		args = append(args, int32(*opts.Status))
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if opts.Parent != "" {
+		args = append(args, opts.Parent)
+		where = append(where, fmt.Sprintf("parent_id = $%d", len(args)))
+	}
+	if !opts.ShowDeleted {
+		where = append(where, "expire_time IS NULL")
+	}
+
+	query := "SELECT id, data FROM tasks WHERE " + strings.Join(where, " AND ")
+	query += " ORDER BY id"
+	if opts.Desc {
+		query += " DESC"
+	}
+	if count > 0 {
+		args = append(args, count)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args
+}
+
+// querier - the statements of both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Create - save a new task in a transaction with its revision, the check of its parent and the quota of its tenant
+func (repo *sqlRepository) Create(ctx context.Context, task *pbTask.Task) error {
+	return repo.transact(ctx, func(tx querier) error {
+		if err := repo.lockTenant(ctx, tx); err != nil {
+			return err
+		}
+		return create(ctx, tx, task)
+	})
+}
+
+// Update - overwrite an existing task whose stored etag is etag in a transaction with its revision
+func (repo *sqlRepository) Update(ctx context.Context, task *pbTask.Task, etag string) error {
+	return repo.transact(ctx, func(tx querier) error {
+		if err := repo.checkBlockers(ctx, tx, task, etag); err != nil {
+			return err
+		}
+		return update(ctx, tx, task, etag, pbTask.TaskRevision_ACTION_UPDATE)
+	})
+}
+
+// Delete - move an existing task to the trash in a transaction with the check of its subtasks
+func (repo *sqlRepository) Delete(ctx context.Context, task *pbTask.Task, etag string) error {
+	return repo.transact(ctx, func(tx querier) error {
+		return trash(ctx, tx, task, etag)
+	})
+}
+
+// Undelete - restore a deleted task in a transaction with the check of its parent
+func (repo *sqlRepository) Undelete(ctx context.Context, task *pbTask.Task, etag string) error {
+	return repo.transact(ctx, func(tx querier) error {
+		if task.ParentId != "" {
+			if err := alive(ctx, tx, task.ParentId, ErrParentNotFound); err != nil {
+				return err
+			}
+		}
+		return update(ctx, tx, task, etag, pbTask.TaskRevision_ACTION_UNDELETE)
+	})
+}
+
+// Purge - permanently delete the expired tasks in the trash
+func (repo *sqlRepository) Purge(ctx context.Context, before time.Time, limit int64) ([]string, error) {
+	tenant := TenantOf(ctx).ID
+	query := `SELECT id FROM tasks WHERE tenant = $1 AND expire_time < $2 ORDER BY expire_time, id`
+	args := []interface{}{tenant, before.UnixMilli()}
+	if limit > 0 {
+		query += ` LIMIT $3`
+		args = append(args, limit)
+	}
+	ids, err := selectIDs(ctx, repo.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	// the expired request keys go with the expired tasks
+	if _, err = repo.db.ExecContext(ctx, `DELETE FROM task_requests WHERE tenant = $1 AND expire_time <= $2`,
+		tenant, time.Now().UnixMilli()); err != nil {
+		return nil, fmt.Errorf("sql delete error: %w", err)
+	}
+	purged := []string{}
+	for _, id := range ids {
+		err = repo.transact(ctx, func(tx querier) error {
+			// the task may be undeleted in between
+			result, err := tx.ExecContext(ctx,
+				`DELETE FROM tasks WHERE id = $1 AND tenant = $2 AND expire_time IS NOT NULL`, id, tenant)
+			if err != nil {
+				return fmt.Errorf("sql delete error: %w", err)
+			}
+			if err = affected(result, ErrNotFound); err != nil {
+				return err
+			}
+			return removeRevisions(ctx, tx, id)
+		})
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged = append(purged, id)
+	}
+	return purged, nil
+}
+
+// AddDependency - overwrite an existing task which got the dependency dependsOn,
+// the dependency graph is checked in the same transaction
+func (repo *sqlRepository) AddDependency(ctx context.Context, task *pbTask.Task, etag string, dependsOn string) error {
+	return repo.transact(ctx, func(tx querier) error {
+		if repo.driver == "postgres" {
+			if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, dependencyLock); err != nil {
+				return fmt.Errorf("sql lock error: %w", err)
+			}
+		}
+		if err := alive(ctx, tx, dependsOn, ErrDependencyNotFound); err != nil {
+			return err
+		}
+		cycle, err := reaches(dependsOn, task.Id, func(id string) (*pbTask.Task, error) {
+			dep, err := get(ctx, tx, id)
+			if errors.Is(err, ErrNotFound) {
+				return nil, nil
+			}
+			return dep, err
+		})
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrCycle
+		}
+		return update(ctx, tx, task, etag, pbTask.TaskRevision_ACTION_UPDATE)
+	})
+}
+
+// BatchGet - get the tasks by ids
+func (repo *sqlRepository) BatchGet(ctx context.Context, ids []string) ([]*pbTask.Task, error) {
+	tasks := make([]*pbTask.Task, len(ids))
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	var (
+		args   = make([]interface{}, len(ids)+1)
+		params = make([]string, len(ids))
+		index  = make(map[string][]int, len(ids))
+	)
+	args[0] = TenantOf(ctx).ID
+	for i, id := range ids {
+		args[i+1] = id
+		params[i] = fmt.Sprintf("$%d", i+2)
+		index[id] = append(index[id], i)
+	}
+	rows, err := repo.db.QueryContext(ctx,
+		`SELECT id, data FROM tasks WHERE tenant = $1 AND id IN (`+strings.Join(params, ", ")+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql select error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+		if err = rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("sql scan error: %w", err)
+		}
+		for _, i := range index[id] {
+			task := &pbTask.Task{}
+			if err = json.Unmarshal(data, task); err != nil {
+				return nil, fmt.Errorf("unmarshal error: %w", err)
+			}
+			tasks[i] = task
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql rows error: %w", err)
+	}
+	return tasks, nil
+}
+
+// BatchCreate - save new tasks in a transaction
+func (repo *sqlRepository) BatchCreate(ctx context.Context, tasks []*pbTask.Task, atomic bool) ([]error, error) {
+	return repo.batch(ctx, len(tasks), atomic, func(tx querier, i int) error {
+		if i == 0 {
+			if err := repo.lockTenant(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return create(ctx, tx, tasks[i])
+	})
+}
+
+// BatchUpdate - overwrite existing tasks in a transaction
+func (repo *sqlRepository) BatchUpdate(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	return repo.batch(ctx, len(tasks), atomic, func(tx querier, i int) error {
+		if err := repo.checkBlockers(ctx, tx, tasks[i], etags[i]); err != nil {
+			return err
+		}
+		return update(ctx, tx, tasks[i], etags[i], pbTask.TaskRevision_ACTION_UPDATE)
+	})
+}
+
+// BatchDelete - move existing tasks to the trash in a transaction
+func (repo *sqlRepository) BatchDelete(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	return repo.batch(ctx, len(tasks), atomic, func(tx querier, i int) error {
+		return trash(ctx, tx, tasks[i], etags[i])
+	})
+}
+
+// BatchRemove - permanently delete existing tasks in a transaction
+func (repo *sqlRepository) BatchRemove(ctx context.Context, ids []string, etags []string, atomic bool) ([]error, error) {
+	return repo.batch(ctx, len(ids), atomic, func(tx querier, i int) error {
+		return remove(ctx, tx, ids[i], etags[i])
+	})
+}
+
+// ListRevisions - get the revisions of a task before the cursor, the newest first
+func (repo *sqlRepository) ListRevisions(ctx context.Context, id string, cursor string, size int64) ([]*pbTask.TaskRevision, error) {
+	query := `SELECT ms, seq, action, actor, data FROM task_revisions WHERE task_id = $1 AND tenant = $2`
+	args := []interface{}{id, TenantOf(ctx).ID}
+	if cursor != "" {
+		ms, seq, _ := parseRevisionID(cursor)
+		query += ` AND (ms < $3 OR (ms = $3 AND seq < $4))`
+		args = append(args, int64(ms), int64(seq))
+	}
+	query += ` ORDER BY ms DESC, seq DESC`
+	if size > 0 {
+		query += fmt.Sprintf(` LIMIT $%d`, len(args)+1)
+		args = append(args, size)
+	}
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql select error: %w", err)
+	}
+	defer rows.Close()
+	revisions := []*pbTask.TaskRevision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql rows error: %w", err)
+	}
+	return revisions, nil
+}
+
+// Search - rank every task row which is not deleted for the query
+func (repo *sqlRepository) Search(ctx context.Context, query string, offset int64, size int64) ([]*pbTask.Task, error) {
+	tasks, err := repo.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return search.Page(search.Rank(tasks, search.Query(query)), offset, size), nil
+}
+
+// Tenants - get the tenants with tasks, the default tenant first
+func (repo *sqlRepository) Tenants(ctx context.Context) ([]string, error) {
+	tenants, err := selectIDs(ctx, repo.db, `SELECT DISTINCT tenant FROM tasks WHERE tenant <> '' ORDER BY tenant`)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{""}, tenants...), nil
+}
+
+// GetRevision - get a revision of a task by its id
+func (repo *sqlRepository) GetRevision(ctx context.Context, id string, revisionID string) (*pbTask.TaskRevision, error) {
+	ms, seq, ok := parseRevisionID(revisionID)
+	if !ok {
+		return nil, ErrRevisionNotFound
+	}
+	revision, err := scanRevision(repo.db.QueryRowContext(ctx,
+		`SELECT ms, seq, action, actor, data FROM task_revisions WHERE task_id = $1 AND tenant = $2 AND ms = $3 AND seq = $4`,
+		id, TenantOf(ctx).ID, int64(ms), int64(seq)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRevisionNotFound
+	}
+	return revision, err
+}
+
+// scanner - a row of both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRevision - scan a row of ms, seq, action, actor and data into a revision
+func scanRevision(row scanner) (*pbTask.TaskRevision, error) {
+	var (
+		ms, seq int64
+		action  int32
+		actor   string
+		data    []byte
+	)
+	if err := row.Scan(&ms, &seq, &action, &actor, &data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("sql scan error: %w", err)
+	}
+	task := &pbTask.Task{}
+	if err := json.Unmarshal(data, task); err != nil {
+		return nil, fmt.Errorf("unmarshal error: %w", err)
+	}
+	return newRevision(fmt.Sprintf("%d-%d", ms, seq), pbTask.TaskRevision_Action(action), actor, task), nil
+}
+
+// lockTenant - serialize the creates of a tenant with a quota in postgres,
+// so two of them can not both take its last free task
+func (repo *sqlRepository) lockTenant(ctx context.Context, tx querier) error {
+	tenant := TenantOf(ctx)
+	if repo.driver != "postgres" || tenant.MaxTasks <= 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "tenant:"+tenant.ID); err != nil {
+		return fmt.Errorf("sql lock error: %w", err)
+	}
+	return nil
+}
+
+// transact - run exec in a transaction which is only committed when exec succeeds
+func (repo *sqlRepository) transact(ctx context.Context, exec func(tx querier) error) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sql begin error: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = exec(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("sql commit error: %w", err)
+	}
+	return nil
+}
+
+// batch - run n statements in a transaction, the statements change nothing instead of failing
+// for the task errors, so the others can still be committed
+func (repo *sqlRepository) batch(ctx context.Context, n int, atomic bool, exec func(tx querier, i int) error) ([]error, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("sql begin error: %w", err)
+	}
+	defer tx.Rollback()
+
+	errs := make([]error, n)
+	for i := range errs {
+		err = exec(tx, i)
+		if err != nil && !itemErr(err) {
+			return nil, err
+		}
+		errs[i] = err
+	}
+	if atomic && failed(errs) {
+		return errs, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("sql commit error: %w", err)
+	}
+	return errs, nil
+}
+
+// checkBlockers - check if the update completes the task while a task it depends on is not resolved,
+// with postgres the blockers are locked until the transaction ends so they are not reopened before the update
+func (repo *sqlRepository) checkBlockers(ctx context.Context, q querier, task *pbTask.Task, etag string) error {
+	if task.Status != pbTask.Status_STATUS_COMPLETE || len(task.DependsOn) == 0 {
+		return nil
+	}
+	var status int32
+	err := q.QueryRowContext(ctx, `SELECT status FROM tasks WHERE id = $1 AND tenant = $2 AND etag = $3`,
+		task.Id, TenantOf(ctx).ID, etag).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && pbTask.Status(status) == pbTask.Status_STATUS_COMPLETE) {
+		// a missing task or a conflict is reported by the update
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sql select error: %w", err)
+	}
+	query := `SELECT status, expire_time FROM tasks WHERE id = $1 AND tenant = $2`
+	if repo.driver == "postgres" {
+		query += ` FOR SHARE`
+	}
+	for _, id := range task.DependsOn {
+		var expire sql.NullInt64
+		err = q.QueryRowContext(ctx, query, id, TenantOf(ctx).ID).Scan(&status, &expire)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("sql select error: %w", err)
+		}
+		if !expire.Valid && !Resolved(pbTask.Status(status)) {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+// itemErr - check if err is the error of a task in a batch rather than of the database
+func itemErr(err error) bool {
+	for _, target := range []error{ErrNotFound, ErrConflict, ErrAlreadyExists, ErrParentNotFound, ErrHasChildren,
+		ErrQuotaExceeded, ErrRequestMismatch, ErrBlocked} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return replayed(err)
+}
+
+func create(ctx context.Context, q querier, task *pbTask.Task) error {
+	tenant := TenantOf(ctx)
+	if err := checkRequest(ctx, q, task); err != nil {
+		return err
+	}
+	if task.ParentId != "" {
+		if err := alive(ctx, q, task.ParentId, ErrParentNotFound); err != nil {
+			return err
+		}
+	}
+	if tenant.MaxTasks > 0 {
+		var count int64
+		err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM tasks WHERE tenant = $1`, tenant.ID).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("sql select error: %w", err)
+		}
+		if count >= tenant.MaxTasks {
+			// the id of an existing task is still reported first
+			if err = check(ctx, q, task.Id, ""); err == nil {
+				return ErrAlreadyExists
+			}
+			return ErrQuotaExceeded
+		}
+	}
+	task.Etag = NextEtag("")
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+	result, err := q.ExecContext(ctx,
+		`INSERT INTO tasks (id, tenant, status, etag, parent_id, data) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (id) DO NOTHING`,
+		task.Id, tenant.ID, int32(task.Status), task.Etag, task.ParentId, data)
+	if err != nil {
+		return fmt.Errorf("sql insert error: %w", err)
+	}
+	if err = affected(result, ErrAlreadyExists); err != nil {
+		return err
+	}
+	if err = saveRequest(ctx, q, task); err != nil {
+		return err
+	}
+	return record(ctx, q, task.Id, data, pbTask.TaskRevision_ACTION_CREATE)
+}
+
+// checkRequest - check if the request of the create of the task in ctx was used by a create which is still kept
+func checkRequest(ctx context.Context, q querier, task *pbTask.Task) error {
+	request, _, ok := requestOf(ctx, task.Id)
+	if !ok {
+		return nil
+	}
+	var id, hash string
+	err := q.QueryRowContext(ctx,
+		`SELECT task_id, hash FROM task_requests WHERE tenant = $1 AND key = $2 AND expire_time > $3`,
+		TenantOf(ctx).ID, request.Key, time.Now().UnixMilli()).Scan(&id, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sql select error: %w", err)
+	}
+	if hash != request.Hash {
+		return ErrRequestMismatch
+	}
+	return &ReplayError{TaskID: id}
+}
+
+// saveRequest - keep the request of the create of the task in ctx with the task, an expired one is replaced
+func saveRequest(ctx context.Context, q querier, task *pbTask.Task) error {
+	request, ttl, ok := requestOf(ctx, task.Id)
+	if !ok {
+		return nil
+	}
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO task_requests (tenant, key, task_id, hash, expire_time) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant, key) DO UPDATE SET task_id = excluded.task_id, hash = excluded.hash, expire_time = excluded.expire_time`,
+		TenantOf(ctx).ID, request.Key, task.Id, request.Hash, time.Now().Add(ttl).UnixMilli())
+	if err != nil {
+		return fmt.Errorf("sql insert error: %w", err)
+	}
+	return nil
+}
+
+// update - overwrite a task and record the action of the revision
+func update(ctx context.Context, q querier, task *pbTask.Task, etag string, action pbTask.TaskRevision_Action) error {
+	task.Etag = NextEtag(etag)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+	result, err := q.ExecContext(ctx,
+		`UPDATE tasks SET status = $1, etag = $2, data = $3, expire_time = $4 WHERE id = $5 AND tenant = $6 AND etag = $7`,
+		int32(task.Status), task.Etag, data, expireTime(task), task.Id, TenantOf(ctx).ID, etag)
+	if err != nil {
+		return fmt.Errorf("sql update error: %w", err)
+	}
+	if err = affected(result, ErrConflict); err != nil {
+		return missing(ctx, q, task.Id, err)
+	}
+	return record(ctx, q, task.Id, data, action)
+}
+
+// record - insert the revision after the last one of a task with the actor of ctx
+func record(ctx context.Context, q querier, id string, data []byte, action pbTask.TaskRevision_Action) error {
+	var (
+		last    string
+		ms, seq int64
+	)
+	err := q.QueryRowContext(ctx,
+		`SELECT ms, seq FROM task_revisions WHERE task_id = $1 AND tenant = $2 ORDER BY ms DESC, seq DESC LIMIT 1`,
+		id, TenantOf(ctx).ID).Scan(&ms, &seq)
+	if err == nil {
+		last = fmt.Sprintf("%d-%d", ms, seq)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("sql select error: %w", err)
+	}
+	next, nextSeq, _ := parseRevisionID(nextRevisionID(last, time.Now()))
+	_, err = q.ExecContext(ctx,
+		`INSERT INTO task_revisions (task_id, tenant, ms, seq, action, actor, data) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		id, TenantOf(ctx).ID, int64(next), int64(nextSeq), int32(action), actorOf(ctx), data)
+	if err != nil {
+		return fmt.Errorf("sql insert error: %w", err)
+	}
+	return nil
+}
+
+// removeRevisions - delete the revisions of a task which is deleted permanently
+func removeRevisions(ctx context.Context, q querier, id string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM task_revisions WHERE task_id = $1 AND tenant = $2`, id, TenantOf(ctx).ID); err != nil {
+		return fmt.Errorf("sql delete error: %w", err)
+	}
+	return nil
+}
+
+// trash - overwrite a deleted task without subtasks which are not deleted
+func trash(ctx context.Context, q querier, task *pbTask.Task, etag string) error {
+	children, err := childIDs(ctx, q, task.Id)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		if err = check(ctx, q, task.Id, etag); err != nil {
+			return err
+		}
+		return ErrHasChildren
+	}
+	return update(ctx, q, task, etag, pbTask.TaskRevision_ACTION_DELETE)
+}
+
+// remove - delete a task without subtasks which are not deleted
+func remove(ctx context.Context, q querier, id string, etag string) error {
+	children, err := childIDs(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		if err = check(ctx, q, id, etag); err != nil {
+			return err
+		}
+		return ErrHasChildren
+	}
+	result, err := q.ExecContext(ctx, `DELETE FROM tasks WHERE id = $1 AND tenant = $2 AND etag = $3`, id, TenantOf(ctx).ID, etag)
+	if err != nil {
+		return fmt.Errorf("sql delete error: %w", err)
+	}
+	if err = affected(result, ErrConflict); err != nil {
+		return missing(ctx, q, id, err)
+	}
+	return removeRevisions(ctx, q, id)
+}
+
+// alive - check if the task exists and is not deleted, otherwise it returns errMissing
+func alive(ctx context.Context, q querier, id string, errMissing error) error {
+	task, err := get(ctx, q, id)
+	if errors.Is(err, ErrNotFound) || (err == nil && task.DeleteTime != nil) {
+		return errMissing
+	}
+	return err
+}
+
+// expireTime - the expire_time column of a task, NULL if it is not deleted
+func expireTime(task *pbTask.Task) sql.NullInt64 {
+	if task.DeleteTime == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: task.ExpireTime.AsTime().UnixMilli(), Valid: true}
+}
+
+// check - check if the task exists and if etag is not empty, it is the stored etag
+func check(ctx context.Context, q querier, id string, etag string) error {
+	var current string
+	err := q.QueryRowContext(ctx, `SELECT etag FROM tasks WHERE id = $1 AND tenant = $2`, id, TenantOf(ctx).ID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("sql select error: %w", err)
+	}
+	if etag != "" && current != etag {
+		return ErrConflict
+	}
+	return nil
+}
+
+// childIDs - get the ids of the subtasks of a task which are not deleted
+func childIDs(ctx context.Context, q querier, id string) ([]string, error) {
+	return selectIDs(ctx, q, `SELECT id FROM tasks WHERE parent_id = $1 AND tenant = $2 AND expire_time IS NULL ORDER BY id`,
+		id, TenantOf(ctx).ID)
+}
+
+// selectIDs - get the ids selected by a query
+func selectIDs(ctx context.Context, q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql select error: %w", err)
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("sql scan error: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql rows error: %w", err)
+	}
+	return ids, nil
+}
+
+func affected(result sql.Result, errNone error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("sql rows affected error: %w", err)
+	}
+	if n == 0 {
+		return errNone
+	}
+	return nil
+}
+
+// missing - tell apart a missing task from err after a conditional statement changed nothing
+func missing(ctx context.Context, q querier, id string, err error) error {
+	if !errors.Is(err, ErrConflict) {
+		return err
+	}
+	var exist int
+	err = q.QueryRowContext(ctx, `SELECT 1 FROM tasks WHERE id = $1 AND tenant = $2`, id, TenantOf(ctx).ID).Scan(&exist)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("sql select error: %w", err)
+	}
+	return ErrConflict
+}
+
+// NewSQLRepository - create a task repository on db and migrate its schema.
+// driver is the database/sql driver name, postgres or sqlite3.
+func NewSQLRepository(ctx context.Context, db *sql.DB, driver string, logger *zap.Logger) (TaskRepository, error) {
+	if err := migrate(ctx, db, driver); err != nil {
+		return nil, err
+	}
+	return &sqlRepository{
+		db:     db,
+		driver: driver,
+		logger: logger,
+	}, nil
+}
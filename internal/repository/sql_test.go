@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newSQLiteRepository(t *testing.T) TaskRepository {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.Nil(t, err)
+	// every connection has its own in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := zap.NewDevelopment()
+	repo, err := NewSQLRepository(context.Background(), db, "sqlite3", logger)
+	assert.Nil(t, err)
+	return repo
+}
+
+func TestSQLMigrateTwice(t *testing.T) {
+	db, _ := sql.Open("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	assert.Nil(t, migrate(context.Background(), db, "sqlite3"))
+	assert.Nil(t, migrate(context.Background(), db, "sqlite3"))
+
+	list, _ := loadMigrations("sqlite3")
+	var version int
+	db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	assert.Equal(t, list[len(list)-1].version, version)
+}
+
+func TestSQLUnsupportedDriver(t *testing.T) {
+	db, _ := sql.Open("sqlite3", ":memory:")
+	defer db.Close()
+
+	err := migrate(context.Background(), db, "mysql")
+	assert.Contains(t, err.Error(), "unsupported sql driver")
+}
+
+func TestSQLCreateAndGet(t *testing.T) {
+	repo := newSQLiteRepository(t)
+	task := &pbTask.Task{Id: "1", Name: "test-name", Status: 1}
+
+	err := repo.Create(context.Background(), task)
+	assert.Nil(t, err)
+
+	resp, err := repo.Get(context.Background(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, task, resp)
+	assert.Equal(t, "1", resp.Etag)
+
+	err = repo.Create(context.Background(), task)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	_, err = repo.Get(context.Background(), "2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSQLUpdate(t *testing.T) {
+	repo := newSQLiteRepository(t)
+	err := repo.Update(context.Background(), &pbTask.Task{Id: "1"}, "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	repo.Create(context.Background(), &pbTask.Task{Id: "1", Name: "test-name"})
+	err = repo.Update(context.Background(), &pbTask.Task{Id: "1", Name: "update-test-name", Status: 1}, "1")
+	assert.Nil(t, err)
+	resp, _ := repo.Get(context.Background(), "1")
+	assert.Equal(t, "update-test-name", resp.Name)
+	assert.Equal(t, pbTask.Status_STATUS_COMPLETE, resp.Status)
+	assert.Equal(t, "2", resp.Etag)
+
+	err = repo.Update(context.Background(), &pbTask.Task{Id: "1", Name: "stale"}, "1")
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestSQLDelete(t *testing.T) {
+	repo := newSQLiteRepository(t)
+	err := repo.Delete(context.Background(), deleted(repo, "1", time.Now()), "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	repo.Create(context.Background(), &pbTask.Task{Id: "1"})
+	err = repo.Delete(context.Background(), deleted(repo, "1", time.Now()), "2")
+	assert.ErrorIs(t, err, ErrConflict)
+	err = repo.Delete(context.Background(), deleted(repo, "1", time.Now()), "1")
+	assert.Nil(t, err)
+	task, err := repo.Get(context.Background(), "1")
+	assert.Nil(t, err)
+	assert.NotNil(t, task.DeleteTime)
+	tasks, _ := repo.List(context.Background(), ListOptions{})
+	assert.Empty(t, tasks)
+}
+
+func TestSQLListKeyset(t *testing.T) {
+	repo := newSQLiteRepository(t)
+	for _, id := range []string{"3", "10", "2", "1", "25"} {
+		repo.Create(context.Background(), &pbTask.Task{Id: id})
+	}
+
+	tasks, err := repo.List(context.Background(), ListOptions{Size: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "10"}, taskIDs(tasks))
+
+	tasks, err = repo.List(context.Background(), ListOptions{Cursor: "10", Size: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2", "25"}, taskIDs(tasks))
+
+	tasks, err = repo.List(context.Background(), ListOptions{Cursor: "25"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+}
+
+func TestSQLListFilter(t *testing.T) {
+	var (
+		repo     = newSQLiteRepository(t)
+		ctx      = context.Background()
+		complete = pbTask.Status_STATUS_COMPLETE
+	)
+	for i := 1; i <= 6; i++ {
+		task := &pbTask.Task{Id: fmt.Sprint(i), Name: fmt.Sprintf("task-%d", i), Status: pbTask.Status(i % 2)}
+		assert.Nil(t, repo.Create(ctx, task))
+	}
+
+	tasks, err := repo.List(ctx, ListOptions{Status: &complete, Desc: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"5", "3", "1"}, taskIDs(tasks))
+
+	tasks, err = repo.List(ctx, ListOptions{Cursor: "5", Size: 1, Status: &complete, Desc: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+
+	tasks, err = repo.List(ctx, ListOptions{Size: 2, Match: func(task *pbTask.Task) bool {
+		return task.Name >= "task-4"
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"4", "5"}, taskIDs(tasks))
+}
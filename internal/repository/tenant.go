@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// tenantPattern - the tenant names, they are safe in the redis keys, the SQL rows and the archive object names
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant - the namespace of the tasks of a team, the zero value is the default tenant
+type Tenant struct {
+	// ID - the name of the tenant, the tasks of the default tenant "" are stored as before the tenants
+	ID string
+	// MaxTasks - how many tasks the tenant can store including the deleted ones, 0 means no limit
+	MaxTasks int64
+}
+
+// tenantKey - the context key of the tenant of the reads and the writes
+type tenantKey struct{}
+
+// WithTenant - get a context whose reads and writes only see the tasks of the tenant
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantOf - get the tenant of the reads and the writes in ctx, the default tenant if it is not set
+func TenantOf(ctx context.Context) Tenant {
+	tenant, _ := ctx.Value(tenantKey{}).(Tenant)
+	return tenant
+}
+
+// ValidTenant - check if a tenant name is 1 to 63 lowercase letters, digits or hyphens, starting with
+// a letter or a digit. The default tenant "" is not a valid name
+func ValidTenant(id string) bool {
+	return tenantPattern.MatchString(id)
+}
+
+// TenantPrefix - get the prefix of the redis keys of a tenant, empty for the default tenant
+func TenantPrefix(id string) string {
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf("tenant:%s:", id)
+}
+
+// keyspace - the prefix of the redis keys of a tenant
+type keyspace string
+
+// keyspaceOf - get the keyspace of the tenant in ctx
+func keyspaceOf(ctx context.Context) keyspace {
+	return keyspace(TenantPrefix(TenantOf(ctx).ID))
+}
+
+// key - get the key in the keyspace
+func (ks keyspace) key(key string) string {
+	return string(ks) + key
+}
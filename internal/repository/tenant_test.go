@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkTenants - the tenant isolation and quota every repository shares
+func checkTenants(t *testing.T, repo TaskRepository) {
+	var (
+		base  = context.Background()
+		acme  = WithTenant(base, Tenant{ID: "acme", MaxTasks: 2})
+		globe = WithTenant(base, Tenant{ID: "globe"})
+		now   = time.Now()
+	)
+	assert.Nil(t, repo.Create(base, &pbTask.Task{Id: "1", Name: "default report"}))
+	assert.Nil(t, repo.Create(acme, &pbTask.Task{Id: "2", Name: "acme report"}))
+	assert.Nil(t, repo.Create(globe, &pbTask.Task{Id: "3", Name: "globe report"}))
+
+	// the tasks of a tenant are not seen by the others
+	_, err := repo.Get(acme, "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.Get(base, "2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	tasks, _ := repo.List(acme, ListOptions{ShowDeleted: true})
+	assert.Equal(t, []string{"2"}, taskIDs(tasks))
+	tasks, _ = repo.List(base, ListOptions{ShowDeleted: true})
+	assert.Equal(t, []string{"1"}, taskIDs(tasks))
+	tasks, _ = repo.BatchGet(globe, []string{"1", "2", "3"})
+	assert.Equal(t, []*pbTask.Task{nil, nil}, tasks[:2])
+	assert.Equal(t, "3", tasks[2].Id)
+	tasks, _ = repo.Search(globe, "report", 0, 0)
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+	_, err = repo.ListRevisions(globe, "3", "", 0)
+	assert.Nil(t, err)
+	revisions, _ := repo.ListRevisions(acme, "3", "", 0)
+	assert.Empty(t, revisions)
+
+	// the writes of a tenant can not reach the tasks of the others
+	assert.ErrorIs(t, repo.Update(acme, &pbTask.Task{Id: "1", Name: "taken"}, "1"), ErrNotFound)
+	assert.ErrorIs(t, repo.Delete(base, deleted(nil, "3", now), "1"), ErrNotFound)
+	assert.ErrorIs(t, repo.Create(acme, &pbTask.Task{Id: "4", ParentId: "1"}), ErrParentNotFound)
+	errs, err := repo.BatchRemove(globe, []string{"1", "2"}, []string{"1", "1"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{ErrNotFound, ErrNotFound}, errs)
+
+	// the quota counts the tasks of the tenant, the deleted ones too
+	assert.Nil(t, repo.Create(acme, &pbTask.Task{Id: "4", Name: "second"}))
+	assert.Nil(t, repo.Delete(acme, deleted(repo, "4", now.Add(-time.Minute)), "1"))
+	assert.ErrorIs(t, repo.Create(acme, &pbTask.Task{Id: "5"}), ErrQuotaExceeded)
+	purged, _ := repo.Purge(acme, now, 0)
+	assert.Equal(t, []string{"4"}, purged)
+	errs, err = repo.BatchCreate(acme, []*pbTask.Task{{Id: "5"}, {Id: "6"}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrQuotaExceeded}, errs)
+	errs, _ = repo.BatchCreate(acme, []*pbTask.Task{{Id: "7"}}, true)
+	assert.Equal(t, []error{ErrQuotaExceeded}, errs)
+	// the other tenants have their own quota
+	assert.Nil(t, repo.Create(WithTenant(base, Tenant{ID: "globe", MaxTasks: 2}), &pbTask.Task{Id: "8"}))
+
+	tenants, err := repo.Tenants(base)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "acme", "globe"}, tenants)
+}
+
+func TestMemoryTenants(t *testing.T) {
+	checkTenants(t, NewMemoryRepository())
+}
+
+func TestRedisTenants(t *testing.T) {
+	repo, server := newMiniRedisRepository(t)
+	checkTenants(t, repo)
+	// the keys of a tenant are prefixed with it
+	assert.True(t, server.Exists(TenantPrefix("acme")+TaskKey("2")))
+	assert.False(t, server.Exists(TaskKey("2")))
+	assert.False(t, server.Exists(TenantPrefix("acme")+TaskKey("6")))
+	members, _ := server.Members(TenantSet)
+	assert.Equal(t, []string{"acme", "globe"}, members)
+}
+
+func TestSQLTenants(t *testing.T) {
+	checkTenants(t, newSQLiteRepository(t))
+}
+
+func TestValidTenant(t *testing.T) {
+	assert.True(t, ValidTenant("acme-2"))
+	for _, id := range []string{"", "-acme", "Acme", "acme:1", strings.Repeat("a", 64)} {
+		assert.False(t, ValidTenant(id), id)
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// deleted - the stored task deleted an hour before it expires, a new task if repo is nil or it does not exist
+func deleted(repo TaskRepository, id string, expire time.Time) *pbTask.Task {
+	task := &pbTask.Task{Id: id}
+	if repo != nil {
+		if stored, err := repo.Get(context.Background(), id); err == nil {
+			task = stored
+		}
+	}
+	task.DeleteTime = timestamppb.New(expire.Add(-time.Hour))
+	task.ExpireTime = timestamppb.New(expire)
+	return task
+}
+
+// checkTrash - the soft delete behavior every repository shares
+func checkTrash(t *testing.T, repo TaskRepository) {
+	var (
+		ctx = context.Background()
+		now = time.Now()
+	)
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "2", Name: "b", ParentId: "1"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "3", Name: "c"}))
+
+	assert.Nil(t, repo.Delete(ctx, deleted(repo, "2", now.Add(time.Hour)), "1"))
+	assert.Nil(t, repo.Delete(ctx, deleted(repo, "1", now.Add(-time.Minute)), "1"))
+	tasks, err := repo.List(ctx, ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+	tasks, _ = repo.List(ctx, ListOptions{ShowDeleted: true, Desc: true})
+	assert.Equal(t, []string{"3", "2", "1"}, taskIDs(tasks))
+	incomplete := pbTask.Status_STATUS_INCOMPLETE
+	tasks, _ = repo.List(ctx, ListOptions{Status: &incomplete})
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+
+	// the parent has to be undeleted first
+	restored := &pbTask.Task{Id: "2", Name: "b", ParentId: "1"}
+	assert.ErrorIs(t, repo.Undelete(ctx, restored, "2"), ErrParentNotFound)
+
+	ids, err := repo.Purge(ctx, now, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+	_, err = repo.Get(ctx, "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, repo.Undelete(ctx, restored, "2"), ErrParentNotFound)
+
+	assert.Nil(t, repo.Delete(ctx, deleted(repo, "3", now.Add(2*time.Hour)), "1"))
+	assert.ErrorIs(t, repo.Undelete(ctx, &pbTask.Task{Id: "3", Name: "c"}, "1"), ErrConflict)
+	restored = &pbTask.Task{Id: "3", Name: "c"}
+	assert.Nil(t, repo.Undelete(ctx, restored, "2"))
+	assert.Equal(t, "3", restored.Etag)
+	tasks, _ = repo.List(ctx, ListOptions{Status: &incomplete})
+	assert.Equal(t, []string{"3"}, taskIDs(tasks))
+
+	// the earliest expired first
+	assert.Nil(t, repo.Delete(ctx, deleted(repo, "3", now.Add(90*time.Minute)), "3"))
+	ids, err = repo.Purge(ctx, now.Add(3*time.Hour), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+	ids, _ = repo.Purge(ctx, now.Add(3*time.Hour), 1)
+	assert.Equal(t, []string{"3"}, ids)
+	ids, _ = repo.Purge(ctx, now.Add(3*time.Hour), 1)
+	assert.Empty(t, ids)
+	tasks, _ = repo.List(ctx, ListOptions{ShowDeleted: true})
+	assert.Empty(t, tasks)
+}
+
+func TestMemoryTrash(t *testing.T) {
+	checkTrash(t, NewMemoryRepository())
+}
+
+func TestRedisTrash(t *testing.T) {
+	repo, server := newMiniRedisRepository(t)
+	checkTrash(t, repo)
+	// only the event stream is left
+	assert.Equal(t, []string{EventStream}, server.Keys())
+}
+
+func TestSQLTrash(t *testing.T) {
+	checkTrash(t, newSQLiteRepository(t))
+}
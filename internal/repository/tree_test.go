@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkTree - the subtask and dependency behavior every repository shares
+func checkTree(t *testing.T, repo TaskRepository) {
+	var (
+		ctx    = context.Background()
+		expire = time.Now().Add(time.Hour)
+	)
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "2", Name: "b", ParentId: "1"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "3", Name: "c", ParentId: "2"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "4", Name: "d"}))
+	assert.ErrorIs(t, repo.Create(ctx, &pbTask.Task{Id: "5", ParentId: "9"}), ErrParentNotFound)
+
+	errs, err := repo.BatchCreate(ctx, []*pbTask.Task{{Id: "5", Name: "e", ParentId: "1"}, {Id: "6", ParentId: "9"}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, ErrParentNotFound}, errs)
+
+	tasks, err := repo.List(ctx, ListOptions{Parent: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2", "5"}, taskIDs(tasks))
+	tasks, _ = repo.List(ctx, ListOptions{Parent: "1", Desc: true, Size: 1})
+	assert.Equal(t, []string{"5"}, taskIDs(tasks))
+
+	// the etag is checked before the subtasks
+	assert.ErrorIs(t, repo.Delete(ctx, deleted(repo, "1", expire), "0"), ErrConflict)
+	assert.ErrorIs(t, repo.Delete(ctx, deleted(repo, "1", expire), "1"), ErrHasChildren)
+
+	// 4 -> 2, then 2 -> 4 would be a cycle
+	task, _ := repo.Get(ctx, "4")
+	task.DependsOn = []string{"2"}
+	assert.Nil(t, repo.AddDependency(ctx, task, "1", "2"))
+	assert.Equal(t, "2", task.Etag)
+	task, _ = repo.Get(ctx, "4")
+	assert.Equal(t, []string{"2"}, task.DependsOn)
+
+	task, _ = repo.Get(ctx, "2")
+	task.DependsOn = []string{"4"}
+	assert.ErrorIs(t, repo.AddDependency(ctx, task, "1", "4"), ErrCycle)
+	task.DependsOn = []string{"3"}
+	assert.Nil(t, repo.AddDependency(ctx, task, "1", "3"))
+	task, _ = repo.Get(ctx, "3")
+	task.DependsOn = []string{"4"}
+	// 3 -> 4 -> 2 -> 3
+	assert.ErrorIs(t, repo.AddDependency(ctx, task, "1", "4"), ErrCycle)
+	task.DependsOn = []string{"9"}
+	assert.ErrorIs(t, repo.AddDependency(ctx, task, "1", "9"), ErrDependencyNotFound)
+	assert.ErrorIs(t, repo.AddDependency(ctx, &pbTask.Task{Id: "9"}, "1", "4"), ErrNotFound)
+	task, _ = repo.Get(ctx, "3")
+	assert.Empty(t, task.DependsOn)
+
+	// atomic, 2 is checked before its subtask is deleted
+	errs, err = repo.BatchDelete(ctx, []*pbTask.Task{deleted(repo, "2", expire), deleted(repo, "3", expire)}, []string{"2", "1"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{ErrHasChildren, nil}, errs)
+	task, _ = repo.Get(ctx, "3")
+	assert.Nil(t, task.DeleteTime)
+
+	errs, err = repo.BatchDelete(ctx, []*pbTask.Task{deleted(repo, "3", expire), deleted(repo, "2", expire)}, []string{"1", "2"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, nil}, errs)
+	tasks, _ = repo.List(ctx, ListOptions{Parent: "1"})
+	assert.Equal(t, []string{"5"}, taskIDs(tasks))
+	tasks, _ = repo.List(ctx, ListOptions{Parent: "1", ShowDeleted: true})
+	assert.Equal(t, []string{"2", "5"}, taskIDs(tasks))
+
+	// a deleted task can not be a parent or a dependency
+	assert.ErrorIs(t, repo.Create(ctx, &pbTask.Task{Id: "7", ParentId: "2"}), ErrParentNotFound)
+	task, _ = repo.Get(ctx, "5")
+	task.DependsOn = []string{"2"}
+	assert.ErrorIs(t, repo.AddDependency(ctx, task, "1", "2"), ErrDependencyNotFound)
+
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "6", Name: "f", ParentId: "5"}))
+	trash := []*pbTask.Task{deleted(repo, "6", expire), deleted(repo, "5", expire), deleted(repo, "1", expire)}
+	errs, err = repo.BatchDelete(ctx, trash, []string{"1", "1", "1"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	for _, id := range []string{"1", "5", "6"} {
+		task, err = repo.Get(ctx, id)
+		assert.Nil(t, err)
+		assert.NotNil(t, task.DeleteTime, id)
+	}
+	tasks, _ = repo.List(ctx, ListOptions{})
+	assert.Equal(t, []string{"4"}, taskIDs(tasks))
+	tasks, _ = repo.List(ctx, ListOptions{Parent: "5"})
+	assert.Empty(t, tasks)
+
+	// a deleted dependency is kept until it is removed
+	task, _ = repo.Get(ctx, "4")
+	assert.Equal(t, []string{"2"}, task.DependsOn)
+}
+
+func TestMemoryTree(t *testing.T) {
+	checkTree(t, NewMemoryRepository())
+}
+
+func TestRedisTree(t *testing.T) {
+	repo, server := newMiniRedisRepository(t)
+	checkTree(t, repo)
+	// the children indexes of the deleted tasks are removed
+	for _, key := range server.Keys() {
+		assert.NotContains(t, key, ChildSet)
+	}
+}
+
+func TestSQLTree(t *testing.T) {
+	checkTree(t, newSQLiteRepository(t))
+}
+
+// checkBlocked - the blockers of a completed task every repository checks in the write
+func checkBlocked(t *testing.T, repo TaskRepository) {
+	ctx := context.Background()
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "blocker", Status: pbTask.Status_STATUS_COMPLETE}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "2", Name: "blocked", DependsOn: []string{"1", "9"}}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "3", Name: "other", DependsOn: []string{"1"}}))
+
+	// the blocker is reopened after the blocked task was read
+	task, _ := repo.Get(ctx, "2")
+	blocker, _ := repo.Get(ctx, "1")
+	blocker.Status = pbTask.Status_STATUS_IN_PROGRESS
+	assert.Nil(t, repo.Update(ctx, blocker, "1"))
+	task.Status = pbTask.Status_STATUS_COMPLETE
+	assert.ErrorIs(t, repo.Update(ctx, task, "1"), ErrBlocked)
+	task, _ = repo.Get(ctx, "2")
+	assert.Equal(t, pbTask.Status_STATUS_INCOMPLETE, task.Status)
+
+	// another change of a blocked task is saved
+	task.Name = "renamed"
+	assert.Nil(t, repo.Update(ctx, task, "1"))
+
+	tasks, _ := repo.BatchGet(ctx, []string{"2", "3"})
+	tasks[0].Status = pbTask.Status_STATUS_COMPLETE
+	tasks[1].Name = "renamed"
+	errs, err := repo.BatchUpdate(ctx, tasks, []string{"2", "1"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{ErrBlocked, nil}, errs)
+	task, _ = repo.Get(ctx, "3")
+	assert.Equal(t, "other", task.Name)
+
+	// a cancelled blocker does not block
+	blocker, _ = repo.Get(ctx, "1")
+	blocker.Status = pbTask.Status_STATUS_CANCELLED
+	assert.Nil(t, repo.Update(ctx, blocker, "2"))
+	task, _ = repo.Get(ctx, "2")
+	task.Status = pbTask.Status_STATUS_COMPLETE
+	assert.Nil(t, repo.Update(ctx, task, "2"))
+}
+
+func TestMemoryBlocked(t *testing.T) {
+	checkBlocked(t, NewMemoryRepository())
+}
+
+func TestRedisBlocked(t *testing.T) {
+	repo, _ := newMiniRedisRepository(t)
+	checkBlocked(t, repo)
+}
+
+func TestSQLBlocked(t *testing.T) {
+	checkBlocked(t, newSQLiteRepository(t))
+}
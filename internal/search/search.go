@@ -0,0 +1,212 @@
+package search
+
+import (
+	"sort"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+)
+
+const (
+	// NameWeight - the weight of a term in the name of a task
+	NameWeight float64 = 2
+	// DescriptionWeight - the weight of a term in the description of a task, a term in both has both weights
+	DescriptionWeight float64 = 1
+	// ExactMatch - how much a term equal to a query token counts
+	ExactMatch float64 = 1
+	// PrefixMatch - how much a term starting with a query token counts
+	PrefixMatch float64 = 0.5
+	// FuzzyMatch - how much a term a few edits away from a query token counts
+	FuzzyMatch float64 = 0.25
+	// MaxTermLength - the longer terms are not indexed
+	MaxTermLength int = 64
+	// MaxTokens - the tokens of a query after it are ignored
+	MaxTokens int = 10
+	// MaxPrefixTerms - the maximum number of terms a query token matches as a prefix
+	MaxPrefixTerms int64 = 100
+)
+
+// Tokenize - split a text into its distinct lowercase terms in order. A term is a run of ASCII letters
+// and digits or bytes of other UTF-8 characters, only ASCII letters are lowercased. The scripts of the
+// redis index split the same way
+func Tokenize(text string) []string {
+	var (
+		tokens = []string{}
+		seen   = map[string]bool{}
+		term   = []byte{}
+	)
+	flush := func() {
+		if len(term) > 0 && !seen[string(term)] {
+			seen[string(term)] = true
+			tokens = append(tokens, string(term))
+		}
+		term = term[:0]
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+			term = append(term, c+'a'-'A')
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c >= 0x80:
+			term = append(term, c)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Query - the tokens of a query, at most MaxTokens
+func Query(query string) []string {
+	tokens := Tokenize(query)
+	if len(tokens) > MaxTokens {
+		tokens = tokens[:MaxTokens]
+	}
+	return tokens
+}
+
+// Terms - the weights of the indexed terms of a task
+func Terms(task *pbTask.Task) map[string]float64 {
+	terms := map[string]float64{}
+	for _, field := range []struct {
+		text   string
+		weight float64
+	}{
+		{task.GetName(), NameWeight},
+		{task.GetDescription(), DescriptionWeight},
+	} {
+		for _, term := range Tokenize(field.text) {
+			if len(term) <= MaxTermLength {
+				terms[term] += field.weight
+			}
+		}
+	}
+	return terms
+}
+
+// Grams - the trigrams of a term padded with ^ and $, a term has as many as its length
+func Grams(term string) []string {
+	padded := "^" + term + "$"
+	grams := []string{}
+	seen := map[string]bool{}
+	for i := 0; i+3 <= len(padded); i++ {
+		gram := padded[i : i+3]
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// MaxEdits - how many edits a term can be away from a query token to match it
+func MaxEdits(token string) int {
+	switch {
+	case len(token) < 4:
+		return 0
+	case len(token) < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// MinSharedGrams - the number of trigrams a term shares with a token at least if it is at most
+// MaxEdits away, an edit changes at most 3 trigrams
+func MinSharedGrams(token string) int {
+	return len(Grams(token)) - 3*MaxEdits(token)
+}
+
+// Distance - the Levenshtein distance of the bytes of two terms
+func Distance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Match - how much a term counts for a query token, 0 if it does not match
+func Match(token string, term string) float64 {
+	switch {
+	case term == token:
+		return ExactMatch
+	case len(term) > len(token) && term[:len(token)] == token:
+		return PrefixMatch
+	case MaxEdits(token) > 0 && Distance(token, term) <= MaxEdits(token):
+		return FuzzyMatch
+	}
+	return 0
+}
+
+// Score - the relevance of a task with the terms for the query tokens, the sum over the tokens of
+// the best weighted match of a term. It is false if a token matches no term
+func Score(tokens []string, terms map[string]float64) (float64, bool) {
+	total := 0.0
+	for _, token := range tokens {
+		best := 0.0
+		for term, weight := range terms {
+			if score := Match(token, term) * weight; score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// Rank - the tasks matching the query tokens from the most relevant, the ties from the largest id
+// as the redis index orders them. It scans every task, so it is for the storages without an index
+func Rank(tasks []*pbTask.Task, tokens []string) []*pbTask.Task {
+	type result struct {
+		task  *pbTask.Task
+		score float64
+	}
+	results := []result{}
+	if len(tokens) == 0 {
+		return []*pbTask.Task{}
+	}
+	for _, task := range tasks {
+		if score, ok := Score(tokens, Terms(task)); ok {
+			results = append(results, result{task: task, score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].task.Id > results[j].task.Id
+	})
+	ranked := make([]*pbTask.Task, len(results))
+	for i, result := range results {
+		ranked[i] = result.task
+	}
+	return ranked
+}
+
+// Page - the tasks of a page of a ranked list
+func Page(tasks []*pbTask.Task, offset int64, size int64) []*pbTask.Task {
+	if offset >= int64(len(tasks)) {
+		return []*pbTask.Task{}
+	}
+	tasks = tasks[offset:]
+	if size > 0 && size < int64(len(tasks)) {
+		tasks = tasks[:size]
+	}
+	return tasks
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"testing"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"fix", "the", "login", "bug", "v2", "it"}, Tokenize("Fix the LOGIN bug (v2), fix it!"))
+	// only ASCII letters are lowercased
+	assert.Equal(t, []string{"café", "Über"}, Tokenize("Café-Über"))
+	assert.Empty(t, Tokenize(" -- "))
+	assert.Len(t, Query("a b c d e f g h i j k l"), MaxTokens)
+}
+
+func TestTerms(t *testing.T) {
+	terms := Terms(&pbTask.Task{Name: "Write report", Description: "the report is due"})
+	assert.Equal(t, map[string]float64{"write": 2, "report": 3, "the": 1, "is": 1, "due": 1}, terms)
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance("report", "report"))
+	assert.Equal(t, 1, Distance("repart", "report"))
+	assert.Equal(t, 2, Distance("reprot", "report"))
+	assert.Equal(t, 3, Distance("", "abc"))
+}
+
+func TestMatch(t *testing.T) {
+	assert.Equal(t, ExactMatch, Match("report", "report"))
+	assert.Equal(t, PrefixMatch, Match("rep", "report"))
+	assert.Equal(t, FuzzyMatch, Match("repart", "report"))
+	assert.Equal(t, FuzzyMatch, Match("quartrly", "quarterly"))
+	// a short token is only matched exactly or as a prefix
+	assert.Equal(t, 0.0, Match("rap", "rep"))
+	assert.Equal(t, 0.0, Match("report", "rep"))
+	// a term within the edits shares enough trigrams to be found in the index
+	for _, pair := range [][2]string{{"repart", "report"}, {"quartrly", "quarterly"}} {
+		token, term := pair[0], pair[1]
+		shared := 0
+		for _, gram := range Grams(token) {
+			for _, other := range Grams(term) {
+				if gram == other {
+					shared++
+				}
+			}
+		}
+		assert.GreaterOrEqual(t, shared, MinSharedGrams(token), token)
+	}
+}
+
+func TestRank(t *testing.T) {
+	tasks := []*pbTask.Task{
+		{Id: "1", Name: "Write report"},
+		{Id: "2", Name: "Groceries", Description: "report"},
+		{Id: "3", Name: "Reports"},
+		{Id: "4", Name: "Write memo"},
+		{Id: "5", Name: "Report"},
+	}
+	ranked := Rank(tasks, Query("report"))
+	ids := []string{}
+	for _, task := range ranked {
+		ids = append(ids, task.Id)
+	}
+	assert.Equal(t, []string{"5", "1", "3", "2"}, ids)
+	assert.Equal(t, "1", Rank(tasks, Query("write report"))[0].Id)
+	assert.Empty(t, Rank(tasks, nil))
+	assert.Equal(t, ranked[1:3], Page(ranked, 1, 2))
+	assert.Equal(t, ranked[3:], Page(ranked, 3, 0))
+	assert.Empty(t, Page(ranked, 4, 2))
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ReasonTaskDenied - the ErrorInfo reason of a call on a task the caller can not read or change
+const ReasonTaskDenied string = "TASK_DENIED"
+
+// checkAccess - check if the call in ctx has the access to the task
+func checkAccess(ctx context.Context, task *pbTask.Task, access authz.Access) error {
+	if authz.Allowed(ctx, task, access) {
+		return nil
+	}
+	return taskDeniedErr(ctx, task.Id, access)
+}
+
+// checkParents - check if the call in ctx can write the parents of the tasks, the error of every task in order.
+// A parent which is not stored is left to the create, which does not find it
+func (service *taskService) checkParents(ctx context.Context, tasks []*pbTask.Task) ([]error, error) {
+	errs := make([]error, len(tasks))
+	if _, ok := authz.GrantOf(ctx); !ok {
+		return errs, nil
+	}
+	var (
+		ids  = []string{}
+		seen = map[string]bool{}
+	)
+	for _, task := range tasks {
+		if task.ParentId != "" && !seen[task.ParentId] {
+			seen[task.ParentId] = true
+			ids = append(ids, task.ParentId)
+		}
+	}
+	if len(ids) == 0 {
+		return errs, nil
+	}
+	parents, err := service.repo.BatchGet(ctx, ids)
+	if err != nil {
+		service.logger.Error("checkParents storage get error", zap.Error(err))
+		return nil, helper.InternalErr("storage get error")
+	}
+	byID := make(map[string]*pbTask.Task, len(parents))
+	for _, parent := range parents {
+		if parent != nil {
+			byID[parent.Id] = parent
+		}
+	}
+	for i, task := range tasks {
+		if parent, ok := byID[task.ParentId]; ok {
+			errs[i] = checkAccess(ctx, parent, authz.Write)
+		}
+	}
+	return errs, nil
+}
+
+// checkDependsOn - check if the call in ctx can read the task a task depends on, a task it can not read
+// is not found as a task which does not exist. A task which is not stored is left to the write
+func (service *taskService) checkDependsOn(ctx context.Context, dependsOn string) error {
+	if _, ok := authz.GrantOf(ctx); !ok {
+		return nil
+	}
+	task, err := service.repo.Get(ctx, dependsOn)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		service.logger.Error("checkDependsOn storage get error", zap.Error(err))
+		return helper.InternalErr("storage get error")
+	}
+	if !authz.Allowed(ctx, task, authz.Read) {
+		return helper.NotFoundErr("dependency not found", "depends_on", dependsOn)
+	}
+	return nil
+}
+
+// applyUpdate - copy the fields of an update to the task as applyFields does,
+// a change of the readers or the writers needs the share access
+func applyUpdate(ctx context.Context, task *pbTask.Task, src *pbTask.Task, fields []protoreflect.FieldDescriptor) error {
+	readers, writers := task.Readers, task.Writers
+	applyFields(task, src, fields)
+	if slices.Equal(readers, task.Readers) && slices.Equal(writers, task.Writers) {
+		return nil
+	}
+	return checkAccess(ctx, task, authz.Share)
+}
+
+// readable - get the match of the tasks accepted by match which the call in ctx can read
+func readable(ctx context.Context, match func(task *pbTask.Task) bool) func(task *pbTask.Task) bool {
+	allowed := authz.Readable(ctx)
+	if allowed == nil {
+		return match
+	}
+	if match == nil {
+		return allowed
+	}
+	return func(task *pbTask.Task) bool {
+		return allowed(task) && match(task)
+	}
+}
+
+func taskDeniedErr(ctx context.Context, id string, access authz.Access) error {
+	grant, _ := authz.GrantOf(ctx)
+	return helper.PermissionDeniedErr("task not allowed", ReasonTaskDenied,
+		map[string]string{"id": id, "access": access.String(), "subject": grant.Subject})
+}
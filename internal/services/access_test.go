@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// as - a context of a call authorized for the subject of a token
+func as(subject string, allTasks bool, roles ...string) context.Context {
+	identity := auth.Identity{Subject: subject, Method: auth.MethodJWT, Roles: roles}
+	caller := auth.WithIdentity(ctx, identity)
+	return authz.WithGrant(caller, authz.Grant{Subject: identity.Principal(), Roles: roles, AllTasks: allTasks})
+}
+
+func TestTaskAccess(t *testing.T) {
+	var (
+		acl   = newTestService()
+		alice = as("alice", false)
+		bob   = as("bob", false)
+		carol = as("carol", false, "ops")
+		erin  = as("erin", false)
+		root  = as("root", true, "admin")
+	)
+	task, err := acl.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "shared", Status: 1,
+		Readers: []string{"role:ops"}, Writers: []string{"jwt:bob"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "jwt:alice", task.Owner)
+	_, err = acl.CreateTask(erin, &pbTask.CreateTaskRequest{Name: "private", Status: 1})
+	assert.Nil(t, err)
+
+	// the readers can read, the writers can change, the others get neither
+	_, err = acl.GetTask(carol, &pbTask.GetTaskRequest{Id: task.Id})
+	assert.Nil(t, err)
+	_, err = acl.GetTask(erin, &pbTask.GetTaskRequest{Id: task.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	errInfo, _ := status.Convert(err).Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, ReasonTaskDenied, errInfo.GetReason())
+	assert.Equal(t, "read", errInfo.GetMetadata()["access"])
+
+	rename := &pbTask.UpdateTaskRequest{Id: task.Id, Task: &pbTask.Task{Name: "renamed"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}}
+	updated, err := acl.UpdateTask(bob, rename)
+	assert.Nil(t, err)
+	assert.Equal(t, "jwt:alice", updated.Owner)
+	_, err = acl.UpdateTask(carol, rename)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = acl.TransitionTask(erin, &pbTask.TransitionTaskRequest{Id: task.Id, Status: pbTask.Status_STATUS_IN_PROGRESS})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// only the owner changes the readers and the writers
+	share := &pbTask.UpdateTaskRequest{Id: task.Id, Task: &pbTask.Task{Writers: []string{"jwt:bob", "jwt:carol"}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"writers"}}}
+	_, err = acl.UpdateTask(bob, share)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	updated, err = acl.UpdateTask(alice, share)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"jwt:bob", "jwt:carol"}, updated.Writers)
+	_, err = acl.UpdateTask(alice, &pbTask.UpdateTaskRequest{Id: task.Id, Task: &pbTask.Task{Owner: "jwt:bob"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"owner"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = acl.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "invalid", Status: 1, Readers: []string{" bob"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// a list only has the tasks the caller can read
+	list, err := acl.GetTaskList(carol, &pbTask.GetTaskListRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, list.Tasks, 1)
+	assert.Equal(t, task.Id, list.Tasks[0].Id)
+	list, err = acl.GetTaskList(root, &pbTask.GetTaskListRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, list.Tasks, 2)
+
+	batch, err := acl.BatchGetTasks(erin, &pbTask.BatchGetTasksRequest{Ids: []string{task.Id}, AllowPartialSuccess: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(codes.PermissionDenied), batch.Statuses[0].Code)
+	deleted, err := acl.BatchDeleteTasks(erin, &pbTask.BatchDeleteTasksRequest{
+		Requests: []*pbTask.DeleteTaskRequest{{Id: task.Id}}, AllowPartialSuccess: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(codes.PermissionDenied), deleted.Statuses[0].Code)
+
+	// an API key with the subject of the owner is another caller
+	key := auth.Identity{Subject: "alice", Method: auth.MethodAPIKey}
+	impostor := authz.WithGrant(auth.WithIdentity(ctx, key), authz.Grant{Subject: key.Principal()})
+	_, err = acl.GetTask(impostor, &pbTask.GetTaskRequest{Id: task.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// a role with every task changes the tasks of the others
+	_, err = acl.DeleteTask(root, &pbTask.DeleteTaskRequest{Id: task.Id})
+	assert.Nil(t, err)
+}
+
+func TestTaskAccessRelations(t *testing.T) {
+	var (
+		acl   = newTestService()
+		alice = as("alice", false)
+		bob   = as("bob", false)
+	)
+	private, err := acl.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "private", Status: 1})
+	assert.Nil(t, err)
+	shared, err := acl.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "shared", Status: 1, Writers: []string{"jwt:bob"}})
+	assert.Nil(t, err)
+
+	// a subtask needs the write access to its parent
+	_, err = acl.CreateTask(bob, &pbTask.CreateTaskRequest{Name: "sub", Status: 1, ParentId: private.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = acl.CreateTask(bob, &pbTask.CreateTaskRequest{Name: "sub", Status: 1, ParentId: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = acl.CreateTask(bob, &pbTask.CreateTaskRequest{Name: "sub", Status: 1, ParentId: shared.Id})
+	assert.Nil(t, err)
+	requests := []*pbTask.CreateTaskRequest{
+		{Name: "sub", Status: 1, ParentId: shared.Id},
+		{Name: "sub", Status: 1, ParentId: private.Id},
+	}
+	_, err = acl.BatchCreateTasks(bob, &pbTask.BatchCreateTasksRequest{Requests: requests})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	batch, err := acl.BatchCreateTasks(bob, &pbTask.BatchCreateTasksRequest{Requests: requests, AllowPartialSuccess: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(codes.OK), batch.Statuses[0].Code)
+	assert.Equal(t, int32(codes.PermissionDenied), batch.Statuses[1].Code)
+	children, _ := acl.ListTaskChildren(alice, &pbTask.ListTaskChildrenRequest{Id: private.Id})
+	assert.Empty(t, children.Tasks)
+
+	// a dependency the caller can not read is not found
+	own, err := acl.CreateTask(bob, &pbTask.CreateTaskRequest{Name: "own", Status: 1})
+	assert.Nil(t, err)
+	_, err = acl.AddTaskDependency(bob, &pbTask.AddTaskDependencyRequest{Id: own.Id, DependsOn: private.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = acl.AddTaskDependency(bob, &pbTask.AddTaskDependencyRequest{Id: own.Id, DependsOn: shared.Id})
+	assert.Nil(t, err)
+
+	// only a role with every task deletes, neither the writers nor the owner
+	locked, err := acl.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "locked", Status: 1, ParentId: shared.Id})
+	assert.Nil(t, err)
+	for _, caller := range []context.Context{bob, alice} {
+		_, err = acl.DeleteTask(caller, &pbTask.DeleteTaskRequest{Id: shared.Id, Force: true})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		errInfo, _ := status.Convert(err).Details()[0].(*errdetails.ErrorInfo)
+		assert.Equal(t, "delete", errInfo.GetMetadata()["access"])
+	}
+	_, err = acl.DeleteTask(alice, &pbTask.DeleteTaskRequest{Id: locked.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	for _, id := range []string{shared.Id, locked.Id} {
+		task, err := acl.GetTask(alice, &pbTask.GetTaskRequest{Id: id})
+		assert.Nil(t, err)
+		assert.Nil(t, task.DeleteTime)
+	}
+	_, err = acl.DeleteTask(as("root", true, "admin"), &pbTask.DeleteTaskRequest{Id: shared.Id, Force: true})
+	assert.Nil(t, err)
+}
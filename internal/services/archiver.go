@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/archive"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultArchiveAfter - how long after its last update a task is archived when it is not configured
+	DefaultArchiveAfter time.Duration = 30 * 24 * time.Hour
+	// DefaultArchiveInterval - how often the tasks are archived when it is not configured
+	DefaultArchiveInterval time.Duration = time.Hour
+	// DefaultArchiveBatch - the maximum number of tasks in an archive object when it is not configured
+	DefaultArchiveBatch int64 = 500
+)
+
+// ArchiveOptions - which tasks are archived and how often, the zero values are the defaults
+type ArchiveOptions struct {
+	// After - how long after its last update a task is archived
+	After time.Duration
+	// Statuses - the statuses of the archived tasks, the statuses which do not block other tasks by default
+	Statuses []pbTask.Status
+	// Interval - how often the tasks are archived
+	Interval time.Duration
+	// Batch - the maximum number of tasks in an archive object
+	Batch int64
+}
+
+func (opts ArchiveOptions) withDefaults() ArchiveOptions {
+	if opts.After <= 0 {
+		opts.After = DefaultArchiveAfter
+	}
+	if len(opts.Statuses) == 0 {
+		for value := range pbTask.Status_name {
+			if repository.Resolved(pbTask.Status(value)) {
+				opts.Statuses = append(opts.Statuses, pbTask.Status(value))
+			}
+		}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultArchiveInterval
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = DefaultArchiveBatch
+	}
+	return opts
+}
+
+// Archiver - copy the old tasks to the archive sink and remove them from the repository
+type Archiver struct {
+	repo     repository.TaskRepository
+	sink     archive.Sink
+	opts     ArchiveOptions
+	statuses map[pbTask.Status]bool
+	logger   *zap.Logger
+}
+
+// Run - index the objects written before the archive index, then archive the old tasks now and
+// then every interval until ctx is done. The indexing is tried again every interval until it succeeds
+func (archiver *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(archiver.opts.Interval)
+	defer ticker.Stop()
+	indexed := false
+	for {
+		if !indexed {
+			if err := archiver.sink.Reindex(ctx); err != nil {
+				archiver.logger.Error("Archive reindex error", zap.Error(err))
+			} else {
+				indexed = true
+			}
+		}
+		archiver.Archive(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Archive - stream the tasks of every tenant which were last updated before now minus After in batches,
+// every batch is written to the sink before it is removed. A task changed in between or
+// with subtasks is kept, the object of the batch is then written again without it so its copy
+// does not come back after the task is deleted.
+// It returns the number of archived tasks
+func (archiver *Archiver) Archive(ctx context.Context, now time.Time) (int, error) {
+	tenants, err := archiver.repo.Tenants(ctx)
+	if err != nil {
+		archiver.logger.Error("Archive storage tenants error", zap.Error(err))
+		return 0, err
+	}
+	total := 0
+	for _, tenant := range tenants {
+		archived, err := archiver.archive(repository.WithTenant(ctx, repository.Tenant{ID: tenant}), tenant, now.Add(-archiver.opts.After))
+		total += archived
+		if err != nil {
+			return total, err
+		}
+	}
+	if total > 0 {
+		archiver.logger.Info("Archive old tasks", zap.Int("archived", total))
+	}
+	return total, nil
+}
+
+// archive - archive the tasks of the tenant which were last updated before the cutoff
+func (archiver *Archiver) archive(ctx context.Context, tenant string, cutoff time.Time) (int, error) {
+	var (
+		cursor = ""
+		total  = 0
+	)
+	for ctx.Err() == nil {
+		tasks, err := archiver.repo.List(ctx, repository.ListOptions{
+			Cursor: cursor,
+			Size:   archiver.opts.Batch,
+			Match: func(task *pbTask.Task) bool {
+				return archiver.statuses[task.Status] && updatedBefore(task, cutoff)
+			},
+		})
+		if err != nil {
+			archiver.logger.Error("Archive storage list error", zap.String("tenant", tenant), zap.Int("archived", total), zap.Error(err))
+			return total, err
+		}
+		if len(tasks) == 0 {
+			break
+		}
+		cursor = tasks[len(tasks)-1].Id
+
+		name, err := archiver.sink.Put(ctx, tenant, tasks)
+		if err != nil {
+			archiver.logger.Error("Archive sink put error", zap.String("tenant", tenant), zap.Int("archived", total), zap.Error(err))
+			return total, err
+		}
+		// the newest first, so the subtasks in the batch are removed before their parents
+		ids := make([]string, len(tasks))
+		etags := make([]string, len(tasks))
+		for i, task := range tasks {
+			j := len(tasks) - 1 - i
+			ids[j], etags[j] = task.Id, task.Etag
+		}
+		errs, err := archiver.repo.BatchRemove(ctx, ids, etags, false)
+		if err != nil {
+			archiver.logger.Error("Archive storage remove error", zap.String("tenant", tenant), zap.Int("archived", total), zap.Error(err))
+			archiver.rewrite(ctx, tenant, name, nil)
+			return total, err
+		}
+		removed := []*pbTask.Task{}
+		for i, err := range errs {
+			if err == nil {
+				removed = append(removed, tasks[len(tasks)-1-i])
+				continue
+			}
+			archiver.logger.Debug("Archive keep task", zap.String("id", ids[i]), zap.Error(err))
+		}
+		total += len(removed)
+		if len(removed) < len(tasks) {
+			if err = archiver.rewrite(ctx, tenant, name, removed); err != nil {
+				return total, err
+			}
+		}
+		if int64(len(tasks)) < archiver.opts.Batch {
+			break
+		}
+	}
+	return total, nil
+}
+
+// rewrite - replace the object of a batch by one with only the removed tasks,
+// the new object is written before the old one is deleted so a removed task is never missing from the sink
+func (archiver *Archiver) rewrite(ctx context.Context, tenant string, name string, removed []*pbTask.Task) error {
+	if _, err := archiver.sink.Put(ctx, tenant, removed); err != nil {
+		archiver.logger.Error("Archive sink put error", zap.String("tenant", tenant), zap.Error(err))
+		return err
+	}
+	if err := archiver.sink.Delete(ctx, name); err != nil {
+		archiver.logger.Error("Archive sink delete error", zap.String("tenant", tenant), zap.String("object", name), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// updatedBefore - check if the task was last updated before the time,
+// a task without the update time uses its create time and one without both is kept
+func updatedBefore(task *pbTask.Task, cutoff time.Time) bool {
+	updated := task.UpdateTime
+	if updated == nil {
+		updated = task.CreateTime
+	}
+	return updated != nil && updated.AsTime().Before(cutoff)
+}
+
+func NewArchiver(repo repository.TaskRepository, sink archive.Sink, opts ArchiveOptions, logger *zap.Logger) *Archiver {
+	opts = opts.withDefaults()
+	statuses := map[pbTask.Status]bool{}
+	for _, status := range opts.Statuses {
+		statuses[status] = true
+	}
+	return &Archiver{
+		repo:     repo,
+		sink:     sink,
+		opts:     opts,
+		statuses: statuses,
+		logger:   logger,
+	}
+}
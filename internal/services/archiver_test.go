@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/archive"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestArchiver(t *testing.T) {
+	var (
+		store    = repository.NewMemoryRepository()
+		now      = time.Now()
+		old      = timestamppb.New(now.Add(-DefaultArchiveAfter - time.Hour))
+		ids      = []string{}
+		files, _ = archive.NewFileStore(t.TempDir())
+		sink     = archive.NewSink(files, nil)
+		archiver = NewArchiver(store, sink, ArchiveOptions{Batch: 2}, logger)
+		list     = newTestService(withRepo(store), withSink(sink))
+	)
+	for _, task := range []*pbTask.Task{
+		{Name: "complete", Status: pbTask.Status_STATUS_COMPLETE, UpdateTime: old},
+		{Name: "subtask", Status: pbTask.Status_STATUS_CANCELLED, UpdateTime: old},
+		{Name: "in progress", Status: pbTask.Status_STATUS_IN_PROGRESS, UpdateTime: old},
+		{Name: "recent", Status: pbTask.Status_STATUS_COMPLETE, UpdateTime: timestamppb.New(now)},
+		{Name: "archived", Status: pbTask.Status_STATUS_ARCHIVED, CreateTime: old},
+	} {
+		g, _ := mockG.Next()
+		task.Id = g.String()
+		if task.Name == "subtask" {
+			task.ParentId = ids[0]
+		}
+		assert.Nil(t, store.Create(ctx, task))
+		ids = append(ids, task.Id)
+	}
+
+	archived, err := archiver.Archive(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, archived)
+	tasks, _ := store.List(ctx, repository.ListOptions{})
+	assert.Equal(t, []string{ids[2], ids[3]}, []string{tasks[0].Id, tasks[1].Id})
+
+	// GetTask falls back to the archive
+	for _, id := range []string{ids[0], ids[1], ids[4]} {
+		task, err := list.GetTask(ctx, &pbTask.GetTaskRequest{Id: id})
+		assert.Nil(t, err)
+		assert.Equal(t, id, task.Id)
+	}
+	task, err := list.GetTask(ctx, &pbTask.GetTaskRequest{Id: ids[1]})
+	assert.Nil(t, err)
+	assert.Equal(t, ids[0], task.ParentId)
+	_, err = list.GetTask(ctx, &pbTask.GetTaskRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	archived, err = archiver.Archive(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, archived)
+}
+
+func TestArchiverKeptTask(t *testing.T) {
+	var (
+		store    = repository.NewMemoryRepository()
+		old      = timestamppb.New(time.Now().Add(-DefaultArchiveAfter - time.Hour))
+		files, _ = archive.NewFileStore(t.TempDir())
+		sink     = archive.NewSink(files, nil)
+		archiver = NewArchiver(store, sink, ArchiveOptions{}, logger)
+		list     = newTestService(withRepo(store), withSink(sink))
+	)
+	assert.Nil(t, store.Create(ctx, &pbTask.Task{Id: "1", Name: "done", Status: pbTask.Status_STATUS_COMPLETE, UpdateTime: old}))
+	assert.Nil(t, store.Create(ctx, &pbTask.Task{Id: "2", Name: "parent", Status: pbTask.Status_STATUS_COMPLETE, UpdateTime: old}))
+	assert.Nil(t, store.Create(ctx, &pbTask.Task{Id: "3", Name: "open", ParentId: "2", UpdateTime: old}))
+
+	archived, err := archiver.Archive(ctx, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, archived)
+	names, _ := files.List(ctx, "")
+	assert.Len(t, names, 1)
+
+	// the parent was kept, so it is not in the sink once it is removed
+	_, err = sink.Get(ctx, "", "2")
+	assert.ErrorIs(t, err, archive.ErrNotFound)
+	_, err = store.BatchRemove(ctx, []string{"3", "2"}, []string{"1", "1"}, true)
+	assert.Nil(t, err)
+	_, err = list.GetTask(ctx, &pbTask.GetTaskRequest{Id: "2"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	task, err := list.GetTask(ctx, &pbTask.GetTaskRequest{Id: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "done", task.Name)
+
+	// nothing removed, nothing is left in the sink
+	assert.Nil(t, store.Create(ctx, &pbTask.Task{Id: "4", Name: "parent", Status: pbTask.Status_STATUS_COMPLETE, UpdateTime: old}))
+	assert.Nil(t, store.Create(ctx, &pbTask.Task{Id: "5", Name: "open", ParentId: "4", UpdateTime: old}))
+	archived, err = archiver.Archive(ctx, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, archived)
+	names, _ = files.List(ctx, "")
+	assert.Len(t, names, 1)
+}
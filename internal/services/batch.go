@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// MaxBatchSize - the maximum number of requests in a batch
+	MaxBatchSize int = 1000
+)
+
+// batchResult - the tasks and the statuses of a batch in the order of its requests
+type batchResult struct {
+	tasks    []*pbTask.Task
+	statuses []*spb.Status
+}
+
+func newBatchResult(n int) *batchResult {
+	result := &batchResult{
+		tasks:    make([]*pbTask.Task, n),
+		statuses: make([]*spb.Status, n),
+	}
+	for i := 0; i < n; i++ {
+		result.tasks[i] = &pbTask.Task{}
+		result.statuses[i] = status.New(codes.OK, "").Proto()
+	}
+	return result
+}
+
+func (result *batchResult) ok(i int, task *pbTask.Task) {
+	result.tasks[i] = task
+}
+
+func (result *batchResult) fail(i int, err error) {
+	result.statuses[i] = status.Convert(err).Proto()
+}
+
+// pendingUpdate - a request of a batch whose task is not written yet
+type pendingUpdate struct {
+	index  int
+	id     string
+	etag   string
+	pinned bool
+	change func(task *pbTask.Task) error
+}
+
+// batchWriteFunc - write the changed tasks whose stored etags are etags
+type batchWriteFunc func(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error)
+
+// BatchCreateTasks - create tasks in one request
+func (service *taskService) BatchCreateTasks(ctx context.Context, req *pbTask.BatchCreateTasksRequest) (*pbTask.BatchCreateTasksResponse, error) {
+	if err := checkBatchSize("requests", len(req.GetRequests())); err != nil {
+		return nil, err
+	}
+	batchID, err := requestID(ctx, req.GetRequestId())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		partial  = req.GetAllowPartialSuccess()
+		result   = newBatchResult(len(req.GetRequests()))
+		tasks    = []*pbTask.Task{}
+		indexes  = []int{}
+		ids      = []string{}
+		requests = &batchRequests{id: batchID, seen: map[string]bool{}, byTask: map[string]repository.Request{}}
+	)
+	for i, r := range req.GetRequests() {
+		var id string
+		task, err := service.newTask(ctx, r)
+		if err == nil {
+			id, err = service.addRequest(ctx, requests, i, r, task)
+		}
+		if err != nil {
+			if !partial {
+				return nil, batchItemErr("requests", i, err)
+			}
+			result.fail(i, err)
+			continue
+		}
+		tasks = append(tasks, task)
+		indexes = append(indexes, i)
+		ids = append(ids, id)
+	}
+	// the creates of the subtasks of the parents the caller can not write are left out
+	errs, err := service.checkParents(ctx, tasks)
+	if err != nil {
+		return nil, err
+	}
+	kept := 0
+	for j, err := range errs {
+		if err != nil {
+			if !partial {
+				return nil, batchItemErr("requests", indexes[j], err)
+			}
+			result.fail(indexes[j], err)
+			delete(requests.byTask, tasks[j].Id)
+			continue
+		}
+		tasks[kept], indexes[kept], ids[kept] = tasks[j], indexes[j], ids[j]
+		kept++
+	}
+	tasks, indexes, ids = tasks[:kept], indexes[:kept], ids[:kept]
+
+	errs, err = service.repo.BatchCreate(repository.WithRequests(withActor(ctx), requests.byTask, RequestTTL), tasks, !partial)
+	if err != nil {
+		service.logger.Error("BatchCreateTasks storage error", zap.Error(err))
+		return nil, helper.InternalErr("storage error")
+	}
+	for j, err := range errs {
+		task := tasks[j]
+		var replay *repository.ReplayError
+		if errors.As(err, &replay) {
+			task, err = service.replayTask(ctx, replay, ids[j])
+		} else if errors.Is(err, repository.ErrRequestMismatch) {
+			err = requestMismatchErr(ids[j])
+		} else if errors.Is(err, repository.ErrParentNotFound) {
+			err = helper.NotFoundErr("parent task not found", "parent_id", task.ParentId)
+		} else if errors.Is(err, repository.ErrQuotaExceeded) {
+			err = quotaErr(ctx)
+		} else if err != nil {
+			service.logger.Error("BatchCreateTasks attempt to create id error", zap.String("id", task.Id))
+			err = helper.InternalErr("please try again later")
+		}
+		if err != nil {
+			if !partial {
+				return nil, batchItemErr("requests", indexes[j], err)
+			}
+			result.fail(indexes[j], err)
+			continue
+		}
+		result.ok(indexes[j], task)
+	}
+	return &pbTask.BatchCreateTasksResponse{
+		Tasks:    result.tasks,
+		Statuses: result.statuses,
+	}, nil
+}
+
+// BatchGetTasks - get tasks by ids in one request
+func (service *taskService) BatchGetTasks(ctx context.Context, req *pbTask.BatchGetTasksRequest) (*pbTask.BatchGetTasksResponse, error) {
+	if err := checkBatchSize("ids", len(req.GetIds())); err != nil {
+		return nil, err
+	}
+	var (
+		partial = req.GetAllowPartialSuccess()
+		result  = newBatchResult(len(req.GetIds()))
+		ids     = []string{}
+		indexes = []int{}
+	)
+	for i, id := range req.GetIds() {
+		if helper.IsEmpty(id) {
+			err := helper.RequiredFieldErr("id is empty", "id")
+			if !partial {
+				return nil, batchItemErr("ids", i, err)
+			}
+			result.fail(i, err)
+			continue
+		}
+		ids = append(ids, id)
+		indexes = append(indexes, i)
+	}
+
+	tasks, err := service.repo.BatchGet(ctx, ids)
+	if err != nil {
+		service.logger.Error("BatchGetTasks storage get error", zap.Error(err))
+		return nil, helper.InternalErr("storage get error")
+	}
+	for j, task := range tasks {
+		if task == nil || !authz.Allowed(ctx, task, authz.Read) {
+			err := helper.NotFoundErr("task not found", "id", ids[j])
+			if task != nil {
+				err = taskDeniedErr(ctx, ids[j], authz.Read)
+			}
+			if !partial {
+				return nil, batchItemErr("ids", indexes[j], err)
+			}
+			result.fail(indexes[j], err)
+			continue
+		}
+		result.ok(indexes[j], task)
+	}
+	return &pbTask.BatchGetTasksResponse{
+		Tasks:    result.tasks,
+		Statuses: result.statuses,
+	}, nil
+}
+
+// BatchUpdateTasks - update tasks in one request
+func (service *taskService) BatchUpdateTasks(ctx context.Context, req *pbTask.BatchUpdateTasksRequest) (*pbTask.BatchUpdateTasksResponse, error) {
+	if err := checkBatchSize("requests", len(req.GetRequests())); err != nil {
+		return nil, err
+	}
+	var (
+		partial = req.GetAllowPartialSuccess()
+		result  = newBatchResult(len(req.GetRequests()))
+		pending = []pendingUpdate{}
+		seen    = map[string]bool{}
+	)
+	for i, r := range req.GetRequests() {
+		fields, err := updateFields(r)
+		if err == nil && seen[r.GetId()] {
+			err = helper.InvalidErr("id is duplicated", "id", r.GetId())
+		}
+		if err != nil {
+			if !partial {
+				return nil, batchItemErr("requests", i, err)
+			}
+			result.fail(i, err)
+			continue
+		}
+		seen[r.GetId()] = true
+
+		etag := normalizeEtag(r.GetEtag())
+		if etag == "" {
+			etag = normalizeEtag(r.Task.GetEtag())
+		}
+		update := r.Task
+		pending = append(pending, newPendingUpdate(i, r.GetId(), etag, func(task *pbTask.Task) error {
+			before := task.Status
+			if err := applyUpdate(ctx, task, update, fields); err != nil {
+				return err
+			}
+			return service.prepare(ctx, task, before, "")
+		}))
+	}
+
+	if err := service.batchWrite(ctx, "BatchUpdateTasks", pending, partial, authz.Write, result, service.repo.BatchUpdate); err != nil {
+		return nil, err
+	}
+	return &pbTask.BatchUpdateTasksResponse{
+		Tasks:    result.tasks,
+		Statuses: result.statuses,
+	}, nil
+}
+
+// BatchDeleteTasks - move tasks to the trash in one request
+func (service *taskService) BatchDeleteTasks(ctx context.Context, req *pbTask.BatchDeleteTasksRequest) (*pbTask.BatchDeleteTasksResponse, error) {
+	if err := checkBatchSize("requests", len(req.GetRequests())); err != nil {
+		return nil, err
+	}
+	var (
+		partial = req.GetAllowPartialSuccess()
+		result  = newBatchResult(len(req.GetRequests()))
+		pending = []pendingUpdate{}
+		seen    = map[string]bool{}
+		deleted = service.markDeleted(time.Now())
+	)
+	for i, r := range req.GetRequests() {
+		var err error
+		if helper.IsEmpty(r.GetId()) {
+			err = helper.RequiredFieldErr("id is empty", "id")
+		} else if seen[r.GetId()] {
+			err = helper.InvalidErr("id is duplicated", "id", r.GetId())
+		} else if r.GetForce() {
+			err = helper.InvalidErr("force is not supported in a batch", "force", r.GetForce())
+		}
+		if err != nil {
+			if !partial {
+				return nil, batchItemErr("requests", i, err)
+			}
+			result.fail(i, err)
+			continue
+		}
+		seen[r.GetId()] = true
+		pending = append(pending, newPendingUpdate(i, r.GetId(), normalizeEtag(r.GetEtag()), deleted))
+	}
+
+	if err := service.batchWrite(ctx, "BatchDeleteTasks", pending, partial, authz.Delete, result, service.repo.BatchDelete); err != nil {
+		return nil, err
+	}
+	return &pbTask.BatchDeleteTasksResponse{
+		Statuses: result.statuses,
+	}, nil
+}
+
+// batchWrite - read the tasks of the pending requests, change and write them,
+// the tasks without a pinned etag are read again when they conflict and the caller needs the access to each of them.
+// The results are set to result, unless the batch is not partial and fails
+func (service *taskService) batchWrite(ctx context.Context, method string, pending []pendingUpdate,
+	partial bool, access authz.Access, result *batchResult, write batchWriteFunc) error {
+	for attempt := 1; len(pending) > 0; attempt++ {
+		ids := make([]string, len(pending))
+		for j, p := range pending {
+			ids[j] = p.id
+		}
+		current, err := service.repo.BatchGet(ctx, ids)
+		if err != nil {
+			service.logger.Error(method+" storage get error", zap.Error(err))
+			return helper.InternalErr("storage get error")
+		}
+
+		var (
+			tasks = []*pbTask.Task{}
+			etags = []string{}
+			ready = []pendingUpdate{}
+		)
+		for j, p := range pending {
+			task := current[j]
+			switch {
+			case task == nil || task.DeleteTime != nil:
+				err = helper.NotFoundErr("task not found", "id", p.id)
+			case !authz.Allowed(ctx, task, access):
+				err = taskDeniedErr(ctx, p.id, access)
+			case p.pinned && p.etag != task.Etag:
+				err = etagMismatchErr(p.id, p.etag)
+			default:
+				etag := task.Etag
+				if err = p.change(task); err != nil {
+					break
+				}
+				tasks = append(tasks, task)
+				etags = append(etags, etag)
+				ready = append(ready, p)
+				continue
+			}
+			if !partial {
+				return batchItemErr("requests", p.index, err)
+			}
+			result.fail(p.index, err)
+		}
+		if len(ready) == 0 {
+			break
+		}
+
+		errs, err := write(withActor(ctx), tasks, etags, !partial)
+		if err != nil {
+			service.logger.Error(method+" storage write error", zap.Error(err))
+			return helper.InternalErr("storage update error")
+		}
+
+		pending = []pendingUpdate{}
+		if !partial {
+			// nothing was written if any of them failed
+			first := -1
+			for j, err := range errs {
+				// prefer an error which can not be retried
+				if err != nil && (first < 0 || (retryable(ready[first], errs[first]) && !retryable(ready[j], err))) {
+					first = j
+				}
+			}
+			if first < 0 {
+				for j, p := range ready {
+					result.ok(p.index, tasks[j])
+				}
+				break
+			}
+			if retryable(ready[first], errs[first]) && attempt < updateAttempts {
+				pending = ready
+				continue
+			}
+			err = service.updateItemErr(ctx, method, ready[first], tasks[first], errs[first])
+			return batchItemErr("requests", ready[first].index, err)
+		}
+		for j, err := range errs {
+			p := ready[j]
+			switch {
+			case err == nil:
+				result.ok(p.index, tasks[j])
+			case retryable(p, err) && attempt < updateAttempts:
+				pending = append(pending, p)
+			default:
+				result.fail(p.index, service.updateItemErr(ctx, method, p, tasks[j], err))
+			}
+		}
+	}
+	return nil
+}
+
+func newPendingUpdate(index int, id string, etag string, change func(task *pbTask.Task) error) pendingUpdate {
+	return pendingUpdate{
+		index:  index,
+		id:     id,
+		etag:   etag,
+		pinned: etag != "" && etag != AnyEtag,
+		change: change,
+	}
+}
+
+// retryable - check if the update conflicts with another writer and can be read again
+func retryable(p pendingUpdate, err error) bool {
+	return errors.Is(err, repository.ErrConflict) && !p.pinned
+}
+
+// updateItemErr - get the status of the error of the write of the task of a pending request,
+// an unknown error is INTERNAL so it is not retried as a conflict
+func (service *taskService) updateItemErr(ctx context.Context, method string, p pendingUpdate, task *pbTask.Task, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return helper.NotFoundErr("task not found", "id", p.id)
+	case errors.Is(err, repository.ErrHasChildren):
+		return hasChildrenErr(p.id)
+	case errors.Is(err, repository.ErrParentNotFound):
+		return helper.NotFoundErr("parent task not found", "parent_id", task.ParentId)
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		return quotaErr(ctx)
+	case errors.Is(err, repository.ErrBlocked):
+		return blockedErr(p.id)
+	case errors.Is(err, repository.ErrConflict) && p.pinned:
+		return etagMismatchErr(p.id, p.etag)
+	case errors.Is(err, repository.ErrConflict):
+		return helper.AbortedErr("task was modified concurrently, please try again")
+	}
+	service.logger.Error(method+" storage write error", zap.String("id", p.id), zap.Error(err))
+	return helper.InternalErr("storage update error")
+}
+
+func checkBatchSize(field string, n int) error {
+	if n == 0 {
+		return helper.RequiredFieldErr(fmt.Sprintf("%s is empty", field), field)
+	}
+	if n > MaxBatchSize {
+		return helper.BadRequestErr("batch too large", field,
+			fmt.Sprintf("at most %d items are allowed in a batch", MaxBatchSize))
+	}
+	return nil
+}
+
+// batchItemErr - the error of a batch failed by one of its items, e.g. requests[1]: name is empty
+func batchItemErr(field string, i int, err error) error {
+	st := status.Convert(err).Proto()
+	st.Message = fmt.Sprintf("%s[%d]: %s", field, i, st.Message)
+	return status.FromProto(st).Err()
+}
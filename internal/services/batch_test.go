@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func statusCodes(resp interface{ GetStatuses() []*spb.Status }) []codes.Code {
+	result := []codes.Code{}
+	for _, st := range resp.GetStatuses() {
+		result = append(result, codes.Code(st.GetCode()))
+	}
+	return result
+}
+
+func TestBatchCreateTasks(t *testing.T) {
+	list := newTestService()
+	resp, err := list.BatchCreateTasks(ctx, &pbTask.BatchCreateTasksRequest{
+		Requests: []*pbTask.CreateTaskRequest{{Name: "a"}, {Name: "b", Status: 1}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, 2)
+	assert.Equal(t, "b", resp.Tasks[1].Name)
+	assert.Equal(t, []codes.Code{codes.OK, codes.OK}, statusCodes(resp))
+
+	got, err := list.GetTask(ctx, &pbTask.GetTaskRequest{Id: resp.Tasks[0].Id})
+	assert.Nil(t, err)
+	assert.Equal(t, resp.Tasks[0], got)
+}
+
+func TestBatchCreateTasksAllOrNothing(t *testing.T) {
+	list := newTestService()
+	resp, err := list.BatchCreateTasks(ctx, &pbTask.BatchCreateTasksRequest{
+		Requests: []*pbTask.CreateTaskRequest{{Name: "a"}, {Name: ""}},
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "requests[1]: name is empty", status.Convert(err).Message())
+
+	tasks, _ := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{})
+	assert.Empty(t, tasks.Tasks)
+}
+
+func TestBatchCreateTasksPartial(t *testing.T) {
+	list := newTestService()
+	resp, err := list.BatchCreateTasks(ctx, &pbTask.BatchCreateTasksRequest{
+		Requests:            []*pbTask.CreateTaskRequest{{Name: "a"}, {Name: ""}, {Name: "c", Status: 9}},
+		AllowPartialSuccess: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.OK, codes.InvalidArgument, codes.InvalidArgument}, statusCodes(resp))
+	assert.Equal(t, "a", resp.Tasks[0].Name)
+	assert.Empty(t, resp.Tasks[1].Id)
+}
+
+func TestBatchCreateTasksSize(t *testing.T) {
+	_, err := service.BatchCreateTasks(ctx, &pbTask.BatchCreateTasksRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.BatchCreateTasks(ctx, &pbTask.BatchCreateTasksRequest{
+		Requests: make([]*pbTask.CreateTaskRequest, MaxBatchSize+1),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestBatchGetTasks(t *testing.T) {
+	a, b := createTask(t, "a"), createTask(t, "b")
+
+	resp, err := service.BatchGetTasks(ctx, &pbTask.BatchGetTasksRequest{Ids: []string{b.Id, a.Id}})
+	assert.Nil(t, err)
+	assert.Equal(t, []*pbTask.Task{b, a}, resp.Tasks)
+
+	_, err = service.BatchGetTasks(ctx, &pbTask.BatchGetTasksRequest{Ids: []string{a.Id, "missing"}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "ids[1]")
+
+	resp, err = service.BatchGetTasks(ctx, &pbTask.BatchGetTasksRequest{
+		Ids: []string{a.Id, "missing", ""}, AllowPartialSuccess: true})
+	assert.Nil(t, err)
+	assert.Equal(t, a, resp.Tasks[0])
+	assert.Equal(t, []codes.Code{codes.OK, codes.NotFound, codes.InvalidArgument}, statusCodes(resp))
+}
+
+func TestBatchUpdateTasks(t *testing.T) {
+	a, b := createTask(t, "a"), createTask(t, "b")
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"name"}}
+
+	resp, err := service.BatchUpdateTasks(ctx, &pbTask.BatchUpdateTasksRequest{
+		Requests: []*pbTask.UpdateTaskRequest{
+			{Id: a.Id, Task: &pbTask.Task{Name: "a2"}, UpdateMask: mask, Etag: a.Etag},
+			{Id: b.Id, Task: &pbTask.Task{Name: "b2"}, UpdateMask: mask},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "a2", resp.Tasks[0].Name)
+	assert.Equal(t, "b2", resp.Tasks[1].Name)
+	assert.Equal(t, repository.NextEtag(a.Etag), resp.Tasks[0].Etag)
+
+	// a has a stale etag now, so b is not updated either
+	_, err = service.BatchUpdateTasks(ctx, &pbTask.BatchUpdateTasksRequest{
+		Requests: []*pbTask.UpdateTaskRequest{
+			{Id: b.Id, Task: &pbTask.Task{Name: "b3"}, UpdateMask: mask},
+			{Id: a.Id, Task: &pbTask.Task{Name: "a3"}, UpdateMask: mask, Etag: a.Etag},
+		},
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "requests[1]")
+	got, _ := service.GetTask(ctx, &pbTask.GetTaskRequest{Id: b.Id})
+	assert.Equal(t, "b2", got.Name)
+
+	resp, err = service.BatchUpdateTasks(ctx, &pbTask.BatchUpdateTasksRequest{
+		Requests: []*pbTask.UpdateTaskRequest{
+			{Id: b.Id, Task: &pbTask.Task{Name: "b3"}, UpdateMask: mask},
+			{Id: a.Id, Task: &pbTask.Task{Name: "a3"}, UpdateMask: mask, Etag: a.Etag},
+			{Id: "missing", Task: &pbTask.Task{Name: "c"}, UpdateMask: mask},
+			{Id: b.Id, Task: &pbTask.Task{Name: "b4"}, UpdateMask: mask},
+		},
+		AllowPartialSuccess: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.OK, codes.FailedPrecondition, codes.NotFound, codes.InvalidArgument}, statusCodes(resp))
+	assert.Equal(t, "b3", resp.Tasks[0].Name)
+}
+
+func TestBatchUpdateTasksConcurrent(t *testing.T) {
+	var (
+		repo   = repository.NewMemoryRepository()
+		racing = newTestService(withRepo(&racingRepository{TaskRepository: repo, races: 1}))
+		task   = &pbTask.Task{Id: "1", Name: "a"}
+		mask   = &fieldmaskpb.FieldMask{Paths: []string{"name"}}
+	)
+	assert.Nil(t, repo.Create(ctx, task))
+
+	resp, err := racing.BatchUpdateTasks(ctx, &pbTask.BatchUpdateTasksRequest{
+		Requests: []*pbTask.UpdateTaskRequest{{Id: "1", Task: &pbTask.Task{Name: "b"}, UpdateMask: mask}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "b", resp.Tasks[0].Name)
+}
+
+// failingRepository - a repository whose batch updates fail every task with err
+type failingRepository struct {
+	repository.TaskRepository
+	err error
+}
+
+func (r *failingRepository) BatchUpdate(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	errs := make([]error, len(tasks))
+	for i := range errs {
+		errs[i] = r.err
+	}
+	return errs, nil
+}
+
+func TestBatchUpdateTasksStorageError(t *testing.T) {
+	var (
+		repo = repository.NewMemoryRepository()
+		mask = &fieldmaskpb.FieldMask{Paths: []string{"name"}}
+	)
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "1", Name: "a"}))
+	for _, tt := range []struct {
+		err  error
+		etag string
+		code codes.Code
+	}{
+		{errors.New("redis eval error: OOM"), "", codes.Internal},
+		{errors.New("redis eval error: OOM"), "1", codes.Internal},
+		{repository.ErrQuotaExceeded, "", codes.ResourceExhausted},
+		{repository.ErrConflict, "1", codes.FailedPrecondition},
+	} {
+		failing := newTestService(withRepo(&failingRepository{TaskRepository: repo, err: tt.err}))
+		resp, err := failing.BatchUpdateTasks(ctx, &pbTask.BatchUpdateTasksRequest{
+			Requests:            []*pbTask.UpdateTaskRequest{{Id: "1", Task: &pbTask.Task{Name: "b"}, UpdateMask: mask, Etag: tt.etag}},
+			AllowPartialSuccess: true,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []codes.Code{tt.code}, statusCodes(resp), tt.err.Error())
+		_, err = failing.BatchUpdateTasks(ctx, &pbTask.BatchUpdateTasksRequest{
+			Requests: []*pbTask.UpdateTaskRequest{{Id: "1", Task: &pbTask.Task{Name: "b"}, UpdateMask: mask, Etag: tt.etag}},
+		})
+		assert.Equal(t, tt.code, status.Code(err), tt.err.Error())
+	}
+}
+
+func TestBatchDeleteTasks(t *testing.T) {
+	a, b, c := createTask(t, "a"), createTask(t, "b"), createTask(t, "c")
+
+	_, err := service.BatchDeleteTasks(ctx, &pbTask.BatchDeleteTasksRequest{
+		Requests: []*pbTask.DeleteTaskRequest{{Id: a.Id}, {Id: b.Id, Etag: "0"}},
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = service.GetTask(ctx, &pbTask.GetTaskRequest{Id: a.Id})
+	assert.Nil(t, err)
+
+	resp, err := service.BatchDeleteTasks(ctx, &pbTask.BatchDeleteTasksRequest{
+		Requests: []*pbTask.DeleteTaskRequest{
+			{Id: a.Id}, {Id: b.Id, Etag: "0"}, {Id: c.Id, Etag: fmt.Sprintf("%q", c.Etag)}, {Id: a.Id}},
+		AllowPartialSuccess: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.OK, codes.FailedPrecondition, codes.OK, codes.InvalidArgument}, statusCodes(resp))
+	deleted, err := service.GetTask(ctx, &pbTask.GetTaskRequest{Id: c.Id})
+	assert.Nil(t, err)
+	assert.NotNil(t, deleted.DeleteTime)
+
+	// a deleted task is not found
+	resp, err = service.BatchDeleteTasks(ctx, &pbTask.BatchDeleteTasksRequest{
+		Requests: []*pbTask.DeleteTaskRequest{{Id: c.Id}}, AllowPartialSuccess: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.NotFound}, statusCodes(resp))
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+)
+
+// MaxDependencies - the maximum number of tasks a task can depend on
+const MaxDependencies int = 100
+
+// errUnchanged - the change leaves the task as it is, so it is not written
+var errUnchanged = errors.New("task unchanged")
+
+// AddTaskDependency - make a task depend on another task, a dependency making a cycle is rejected
+func (service *taskService) AddTaskDependency(ctx context.Context, req *pbTask.AddTaskDependencyRequest) (*pbTask.Task, error) {
+	if err := checkDependency(req.GetId(), req.GetDependsOn()); err != nil {
+		return nil, err
+	}
+	dependsOn := req.GetDependsOn()
+	if err := service.checkDependsOn(ctx, dependsOn); err != nil {
+		return nil, err
+	}
+
+	write := func(ctx context.Context, task *pbTask.Task, etag string) error {
+		err := service.repo.AddDependency(ctx, task, etag, dependsOn)
+		if errors.Is(err, repository.ErrCycle) {
+			return helper.FailedPreconditionErr("dependency cycle", helper.DependencyViolation, task.Id,
+				fmt.Sprintf("'%s' already depends on '%s'", dependsOn, task.Id))
+		}
+		if errors.Is(err, repository.ErrDependencyNotFound) {
+			return helper.NotFoundErr("dependency not found", "depends_on", dependsOn)
+		}
+		return err
+	}
+	return service.updateWith(ctx, req.GetId(), requestEtag(ctx, req.GetEtag()), func(task *pbTask.Task) error {
+		if slices.Contains(task.DependsOn, dependsOn) {
+			return errUnchanged
+		}
+		if len(task.DependsOn) >= MaxDependencies {
+			return helper.BadRequestErr("too many dependencies", "depends_on",
+				fmt.Sprintf("at most %d dependencies are allowed", MaxDependencies))
+		}
+		task.DependsOn = append(task.DependsOn, dependsOn)
+		stampTimes(task, &task.Status)
+		return nil
+	}, write)
+}
+
+// RemoveTaskDependency - remove a dependency of a task
+func (service *taskService) RemoveTaskDependency(ctx context.Context, req *pbTask.RemoveTaskDependencyRequest) (*pbTask.Task, error) {
+	if err := checkDependency(req.GetId(), req.GetDependsOn()); err != nil {
+		return nil, err
+	}
+	dependsOn := req.GetDependsOn()
+
+	return service.update(ctx, req.GetId(), requestEtag(ctx, req.GetEtag()), func(task *pbTask.Task) error {
+		i := slices.Index(task.DependsOn, dependsOn)
+		if i < 0 {
+			return helper.NotFoundErr("dependency not found", "depends_on", dependsOn)
+		}
+		task.DependsOn = slices.Delete(task.DependsOn, i, i+1)
+		stampTimes(task, &task.Status)
+		return nil
+	})
+}
+
+// ListTaskChildren - list the direct subtasks of a task
+func (service *taskService) ListTaskChildren(ctx context.Context, req *pbTask.ListTaskChildrenRequest) (*pbTask.ListTaskChildrenResponse, error) {
+	if helper.IsEmpty(req.GetId()) {
+		return nil, helper.RequiredFieldErr("id is empty", "id")
+	}
+	parent, err := service.repo.Get(ctx, req.GetId())
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, helper.NotFoundErr("task not found", "id", req.GetId())
+		}
+		service.logger.Error("ListTaskChildren storage get error", zap.Error(err))
+		return nil, helper.InternalErr("storage get error")
+	}
+	if err = checkAccess(ctx, parent, authz.Read); err != nil {
+		return nil, err
+	}
+
+	// the parent is part of the page token, so a token can not page another task's subtasks
+	tasks, next, err := service.listPage(ctx, req.PageSize, req.PageToken,
+		"parent_id = "+req.GetId(), "", repository.ListOptions{Parent: req.GetId(), Match: readable(ctx, nil)})
+	if err != nil {
+		return nil, err
+	}
+	return &pbTask.ListTaskChildrenResponse{
+		Tasks:     tasks,
+		NextToken: next,
+	}, nil
+}
+
+// checkBlockers - check if all the tasks a task depends on are resolved before it is complete,
+// a dependency which was deleted does not block
+func (service *taskService) checkBlockers(ctx context.Context, task *pbTask.Task) error {
+	if len(task.DependsOn) == 0 {
+		return nil
+	}
+	blockers, err := service.repo.BatchGet(ctx, task.DependsOn)
+	if err != nil {
+		service.logger.Error("checkBlockers storage get error", zap.Error(err))
+		return helper.InternalErr("storage get error")
+	}
+	pending := []string{}
+	for _, blocker := range blockers {
+		if blocker != nil && blocker.DeleteTime == nil && !repository.Resolved(blocker.Status) {
+			pending = append(pending, fmt.Sprintf("'%s' (%s)", blocker.Id, blocker.Status))
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	return helper.FailedPreconditionErr("task is blocked", helper.DependencyViolation, task.Id,
+		"blocked by "+strings.Join(pending, ", "))
+}
+
+// blockedErr - the error of a task completed while a blocker was reopened after checkBlockers read it
+func blockedErr(id string) error {
+	return helper.FailedPreconditionErr("task is blocked", helper.DependencyViolation, id,
+		"blocked by a task it depends on which is not resolved")
+}
+
+func checkDependency(id string, dependsOn string) error {
+	if helper.IsEmpty(id) {
+		return helper.RequiredFieldErr("id is empty", "id")
+	}
+	if helper.IsEmpty(dependsOn) {
+		return helper.RequiredFieldErr("depends_on is empty", "depends_on")
+	}
+	if id == dependsOn {
+		return helper.InvalidErr("a task can not depend on itself", "depends_on", dependsOn)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// violation - the precondition failure of an error
+func violation(t *testing.T, err error, kind string) *errdetails.PreconditionFailure_Violation {
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	for _, detail := range status.Convert(err).Details() {
+		if failure, ok := detail.(*errdetails.PreconditionFailure); ok {
+			assert.Equal(t, kind, failure.Violations[0].Type)
+			return failure.Violations[0]
+		}
+	}
+	assert.Fail(t, "no precondition failure", err)
+	return &errdetails.PreconditionFailure_Violation{}
+}
+
+func TestAddTaskDependency(t *testing.T) {
+	var (
+		a = createTask(t, "a")
+		b = createTask(t, "b")
+	)
+
+	resp, err := service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: a.Id, DependsOn: b.Id, Etag: a.Etag})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{b.Id}, resp.DependsOn)
+	assert.NotEqual(t, a.Etag, resp.Etag)
+
+	// adding it again changes nothing
+	again, err := service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: a.Id, DependsOn: b.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, resp.Etag, again.Etag)
+
+	// b -> a would close the cycle
+	_, err = service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: b.Id, DependsOn: a.Id})
+	assert.Equal(t, b.Id, violation(t, err, helper.DependencyViolation).Subject)
+	stored, _ := repo.Get(ctx, b.Id)
+	assert.Empty(t, stored.DependsOn)
+
+	_, err = service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: a.Id, DependsOn: a.Id})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: a.Id})
+	assert.Contains(t, err.Error(), "depends_on is empty")
+	_, err = service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: a.Id, DependsOn: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: "missing", DependsOn: a.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: b.Id, DependsOn: a.Id, Etag: "0"})
+	assert.Contains(t, err.Error(), "etag mismatch")
+}
+
+func TestRemoveTaskDependency(t *testing.T) {
+	var (
+		a = createTask(t, "a")
+		b = createTask(t, "b")
+	)
+	_, err := service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: a.Id, DependsOn: b.Id})
+	assert.Nil(t, err)
+
+	resp, err := service.RemoveTaskDependency(ctx, &pbTask.RemoveTaskDependencyRequest{Id: a.Id, DependsOn: b.Id})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.DependsOn)
+
+	_, err = service.RemoveTaskDependency(ctx, &pbTask.RemoveTaskDependencyRequest{Id: a.Id, DependsOn: b.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, err.Error(), "dependency not found")
+}
+
+func TestCompleteBlockedTask(t *testing.T) {
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"status"}}
+	a, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "a", Status: pbTask.Status_STATUS_INCOMPLETE})
+	assert.Nil(t, err)
+	b, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "b", Status: pbTask.Status_STATUS_IN_PROGRESS})
+	assert.Nil(t, err)
+	_, err = service.AddTaskDependency(ctx, &pbTask.AddTaskDependencyRequest{Id: a.Id, DependsOn: b.Id})
+	assert.Nil(t, err)
+
+	_, err = service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: a.Id, Status: pbTask.Status_STATUS_COMPLETE})
+	assert.Equal(t, "blocked by '"+b.Id+"' (STATUS_IN_PROGRESS)", violation(t, err, helper.DependencyViolation).Description)
+	_, err = service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id: a.Id, Task: &pbTask.Task{Status: pbTask.Status_STATUS_COMPLETE}, UpdateMask: mask})
+	violation(t, err, helper.DependencyViolation)
+
+	// a cancelled blocker is resolved
+	_, err = service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: b.Id, Status: pbTask.Status_STATUS_CANCELLED})
+	assert.Nil(t, err)
+	resp, err := service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: a.Id, Status: pbTask.Status_STATUS_COMPLETE})
+	assert.Nil(t, err)
+	assert.Equal(t, pbTask.Status_STATUS_COMPLETE, resp.Status)
+}
+
+func TestListTaskChildren(t *testing.T) {
+	parent := createTask(t, "parent")
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		resp, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "child", ParentId: parent.Id})
+		assert.Nil(t, err)
+		assert.Equal(t, parent.Id, resp.ParentId)
+		ids = append(ids, resp.Id)
+	}
+
+	resp, err := service.ListTaskChildren(ctx, &pbTask.ListTaskChildrenRequest{Id: parent.Id, PageSize: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, ids[:2], []string{resp.Tasks[0].Id, resp.Tasks[1].Id})
+	assert.NotEmpty(t, resp.NextToken)
+
+	next, err := service.ListTaskChildren(ctx, &pbTask.ListTaskChildrenRequest{Id: parent.Id, PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Len(t, next.Tasks, 1)
+	assert.Equal(t, ids[2], next.Tasks[0].Id)
+
+	// the token only pages the subtasks of its parent
+	_, err = service.ListTaskChildren(ctx, &pbTask.ListTaskChildrenRequest{Id: ids[0], PageToken: resp.NextToken})
+	assert.Contains(t, err.Error(), "page token does not match")
+
+	_, err = service.ListTaskChildren(ctx, &pbTask.ListTaskChildrenRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestCreateTaskParentNotFound(t *testing.T) {
+	_, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "child", ParentId: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, err.Error(), "parent task not found")
+}
+
+func TestDeleteTaskWithSubtasks(t *testing.T) {
+	parent := createTask(t, "parent")
+	child, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "child", ParentId: parent.Id})
+	assert.Nil(t, err)
+
+	_, err = service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: parent.Id})
+	assert.Equal(t, parent.Id, violation(t, err, helper.SubtaskViolation).Subject)
+
+	_, err = service.BatchDeleteTasks(ctx, &pbTask.BatchDeleteTasksRequest{
+		Requests: []*pbTask.DeleteTaskRequest{{Id: parent.Id, Force: true}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: parent.Id, Force: true})
+	assert.Nil(t, err)
+	stored, err := repo.Get(ctx, child.Id)
+	assert.Nil(t, err)
+	assert.NotNil(t, stored.DeleteTime)
+}
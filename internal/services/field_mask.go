@@ -0,0 +1,61 @@
+package services
+
+import (
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// immutableFields - the task fields which can not be changed by UpdateTask,
+// the times and the owner are output only and set by the server, the dependencies have their own methods
+var immutableFields = map[protoreflect.Name]bool{
+	"id":            true,
+	"etag":          true,
+	"create_time":   true,
+	"update_time":   true,
+	"complete_time": true,
+	"delete_time":   true,
+	"expire_time":   true,
+	"transitions":   true,
+	"parent_id":     true,
+	"depends_on":    true,
+	"owner":         true,
+}
+
+// updatePaths - validate the update mask paths against the task descriptor,
+// an empty mask means every mutable field (AIP-134 full replacement).
+// It returns the invalid path when there is one.
+func updatePaths(paths []string) ([]protoreflect.FieldDescriptor, string) {
+	fields := (&pbTask.Task{}).ProtoReflect().Descriptor().Fields()
+	result := []protoreflect.FieldDescriptor{}
+	if len(paths) == 0 {
+		for i := 0; i < fields.Len(); i++ {
+			if !immutableFields[fields.Get(i).Name()] {
+				result = append(result, fields.Get(i))
+			}
+		}
+		return result, ""
+	}
+
+	for _, path := range paths {
+		fd := fields.ByName(protoreflect.Name(path))
+		if fd == nil || immutableFields[fd.Name()] {
+			return nil, path
+		}
+		result = append(result, fd)
+	}
+	return result, ""
+}
+
+// applyFields - copy the fields from src to dst, the fields unset in src are cleared
+func applyFields(dst *pbTask.Task, src *pbTask.Task, fields []protoreflect.FieldDescriptor) {
+	from := proto.Clone(src).ProtoReflect()
+	to := dst.ProtoReflect()
+	for _, fd := range fields {
+		if from.Has(fd) {
+			to.Set(fd, from.Get(fd))
+		} else {
+			to.Clear(fd)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	"go.uber.org/zap"
+)
+
+// Purger - permanently delete the tasks which expired in the trash
+type Purger struct {
+	repo   repository.TaskRepository
+	opts   TrashOptions
+	logger *zap.Logger
+}
+
+// Run - purge the expired tasks now and then every purge interval until ctx is done
+func (purger *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(purger.opts.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		purger.Purge(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge - purge the tasks of every tenant which expired before now in batches, it returns the number of purged tasks
+func (purger *Purger) Purge(ctx context.Context, now time.Time) (int, error) {
+	tenants, err := purger.repo.Tenants(ctx)
+	if err != nil {
+		purger.logger.Error("Purge storage tenants error", zap.Error(err))
+		return 0, err
+	}
+	total := 0
+	for _, tenant := range tenants {
+		purged, err := purger.purge(repository.WithTenant(ctx, repository.Tenant{ID: tenant}), now)
+		total += purged
+		if err != nil {
+			purger.logger.Error("Purge storage error", zap.String("tenant", tenant), zap.Int("purged", total), zap.Error(err))
+			return total, err
+		}
+	}
+	if total > 0 {
+		purger.logger.Info("Purge expired tasks", zap.Int("purged", total))
+	}
+	return total, nil
+}
+
+// purge - purge the tasks of the tenant of ctx which expired before now in batches
+func (purger *Purger) purge(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		ids, err := purger.repo.Purge(ctx, now, purger.opts.PurgeBatch)
+		if err != nil {
+			return total, err
+		}
+		total += len(ids)
+		if int64(len(ids)) < purger.opts.PurgeBatch {
+			break
+		}
+	}
+	return total, nil
+}
+
+func NewPurger(repo repository.TaskRepository, opts TrashOptions, logger *zap.Logger) *Purger {
+	return &Purger{
+		repo:   repo,
+		opts:   opts.withDefaults(),
+		logger: logger,
+	}
+}
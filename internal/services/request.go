@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// IdempotencyKey - the metadata key of the request id of a create, forwarded from the Idempotency-Key header
+	IdempotencyKey string = "idempotency-key"
+	// RequestTTL - how long the request ids of the creates are kept
+	RequestTTL time.Duration = 24 * time.Hour
+	// MaxRequestIDLength - the maximum number of characters of a request id
+	MaxRequestIDLength int = 128
+)
+
+// requestID - get the request id of the request, or the Idempotency-Key header when it is empty
+func requestID(ctx context.Context, id string) (string, error) {
+	if id == "" {
+		if values := metadata.ValueFromIncomingContext(ctx, IdempotencyKey); len(values) > 0 {
+			id = strings.TrimSpace(values[0])
+		}
+	}
+	return id, validateRequestID(id)
+}
+
+func validateRequestID(id string) error {
+	if utf8.RuneCountInString(id) > MaxRequestIDLength {
+		return helper.BadRequestErr("request id too long", "request_id",
+			fmt.Sprintf("at most %d characters are allowed", MaxRequestIDLength))
+	}
+	return nil
+}
+
+// newRequest - get the request of the create of req with the request id, the keys are by caller
+// so the callers can not replay the creates of each other
+func (service *taskService) newRequest(ctx context.Context, id string, req *pbTask.CreateTaskRequest) (repository.Request, error) {
+	payload := proto.Clone(req).(*pbTask.CreateTaskRequest)
+	payload.RequestId = ""
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(payload)
+	if err != nil {
+		service.logger.Error("request hash marshal error", zap.Error(err))
+		return repository.Request{}, helper.InternalErr("please try again later")
+	}
+	hash := sha256.Sum256(data)
+	subject := ""
+	if identity, ok := auth.IdentityOf(ctx); ok {
+		subject = identity.Principal()
+	}
+	return repository.Request{Key: url.PathEscape(subject) + "/" + id, Hash: hex.EncodeToString(hash[:])}, nil
+}
+
+// batchRequests - the requests of the creates of a batch
+type batchRequests struct {
+	// id - the request id of the batch
+	id     string
+	seen   map[string]bool
+	byTask map[string]repository.Request
+}
+
+// addRequest - get the request id of the create request i of the batch and keep its request for the task,
+// a request without a request id has the id <batch request id>/<index> if the batch has one
+func (service *taskService) addRequest(ctx context.Context, requests *batchRequests, i int,
+	req *pbTask.CreateTaskRequest, task *pbTask.Task) (string, error) {
+	id := req.GetRequestId()
+	if err := validateRequestID(id); err != nil {
+		return "", err
+	}
+	if id == "" && requests.id != "" {
+		id = fmt.Sprintf("%s/%d", requests.id, i)
+	}
+	if id == "" {
+		return "", nil
+	}
+	if requests.seen[id] {
+		return "", helper.InvalidErr("request id duplicated", "request_id", id)
+	}
+	request, err := service.newRequest(ctx, id, req)
+	if err != nil {
+		return "", err
+	}
+	requests.seen[id] = true
+	requests.byTask[task.Id] = request
+	return id, nil
+}
+
+// replayTask - get the task of the first create of a replayed request
+func (service *taskService) replayTask(ctx context.Context, replay *repository.ReplayError, id string) (*pbTask.Task, error) {
+	task, err := service.repo.Get(ctx, replay.TaskID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, helper.NotFoundErr("task of the request not found", "request_id", id)
+	}
+	if err != nil {
+		service.logger.Error("replay storage error", zap.String("id", replay.TaskID), zap.Error(err))
+		return nil, helper.InternalErr("storage error")
+	}
+	if err = checkAccess(ctx, task, authz.Read); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func requestMismatchErr(id string) error {
+	return helper.FailedPreconditionErr("request id reused", helper.RequestViolation, id,
+		"the request id was used by a create with another payload")
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateTaskRequestID(t *testing.T) {
+	var (
+		list  = newTestService()
+		alice = as("alice", false)
+	)
+	task, err := list.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "a", RequestId: "r1"})
+	assert.Nil(t, err)
+
+	// a retry gets the task of the first create
+	retry, err := list.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "a", RequestId: "r1"})
+	assert.Nil(t, err)
+	assert.Equal(t, task.Id, retry.Id)
+	tasks, _ := list.GetTaskList(alice, &pbTask.GetTaskListRequest{})
+	assert.Len(t, tasks.Tasks, 1)
+
+	// the Idempotency-Key header is the request id of a request without one
+	header := metadata.NewIncomingContext(alice, metadata.Pairs(IdempotencyKey, "r1"))
+	retry, err = list.CreateTask(header, &pbTask.CreateTaskRequest{Name: "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, task.Id, retry.Id)
+
+	// another payload is rejected
+	_, err = list.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "b", RequestId: "r1"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	failure, _ := status.Convert(err).Details()[0].(*errdetails.PreconditionFailure)
+	assert.Equal(t, "REQUEST_ID", failure.GetViolations()[0].GetType())
+
+	// the request ids are by caller
+	other, err := list.CreateTask(as("bob", false), &pbTask.CreateTaskRequest{Name: "b", RequestId: "r1"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, task.Id, other.Id)
+
+	_, err = list.CreateTask(alice, &pbTask.CreateTaskRequest{Name: "a", RequestId: string(make([]byte, MaxRequestIDLength+1))})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestBatchCreateTasksRequestID(t *testing.T) {
+	list := newTestService()
+	req := &pbTask.BatchCreateTasksRequest{
+		Requests:  []*pbTask.CreateTaskRequest{{Name: "a"}, {Name: "b", RequestId: "own"}},
+		RequestId: "batch",
+	}
+	resp, err := list.BatchCreateTasks(ctx, req)
+	assert.Nil(t, err)
+
+	// a retry of the batch gets the same tasks, a new request of the batch is created
+	req.Requests = append(req.Requests, &pbTask.CreateTaskRequest{Name: "c"})
+	retry, err := list.BatchCreateTasks(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.OK, codes.OK, codes.OK}, statusCodes(retry))
+	assert.Equal(t, resp.Tasks[0].Id, retry.Tasks[0].Id)
+	assert.Equal(t, resp.Tasks[1].Id, retry.Tasks[1].Id)
+	tasks, _ := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{})
+	assert.Len(t, tasks.Tasks, 3)
+
+	// a request id is once in a batch, another payload is rejected
+	retry, err = list.BatchCreateTasks(ctx, &pbTask.BatchCreateTasksRequest{
+		Requests: []*pbTask.CreateTaskRequest{{Name: "d", RequestId: "own"}, {Name: "e", RequestId: "new"},
+			{Name: "f", RequestId: "new"}},
+		AllowPartialSuccess: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.FailedPrecondition, codes.OK, codes.InvalidArgument}, statusCodes(retry))
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// untrackedFields - the fields which change with every write, so they are not listed as changes
+var untrackedFields = map[string]bool{
+	"etag":        true,
+	"update_time": true,
+}
+
+// ListTaskRevisions - get a page of the revisions of a task with the fields each of them changed, the newest first
+func (service *taskService) ListTaskRevisions(ctx context.Context, req *pbTask.ListTaskRevisionsRequest) (*pbTask.ListTaskRevisionsResponse, error) {
+	if helper.IsEmpty(req.GetId()) {
+		return nil, helper.RequiredFieldErr("id is empty", "id")
+	}
+	// a token only pages the revisions of the task it was created for
+	query := "revisions\x00" + req.GetId()
+	cursor, size, err := service.pageCursor(req.PageSize, req.PageToken, query, "")
+	if err != nil {
+		return nil, err
+	}
+	if err = service.checkRevisioned(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	// one more revision to diff the oldest of the page with
+	revisions, err := service.repo.ListRevisions(ctx, req.GetId(), cursor, size+1)
+	if err != nil {
+		service.logger.Error("ListTaskRevisions storage list error", zap.Error(err))
+		return nil, helper.InternalErr("storage list error")
+	}
+	var next string
+	if int64(len(revisions)) > size {
+		next = service.nextToken(revisions[size-1].RevisionId, size, query, "")
+	}
+	for i := 0; i < len(revisions) && int64(i) < size; i++ {
+		var previous *pbTask.Task
+		if i+1 < len(revisions) {
+			previous = revisions[i+1].Task
+		}
+		if revisions[i].Changes, err = diffTasks(previous, revisions[i].Task); err != nil {
+			service.logger.Error("ListTaskRevisions diff error", zap.Error(err))
+			return nil, helper.InternalErr("revision diff error")
+		}
+	}
+	if int64(len(revisions)) > size {
+		revisions = revisions[:size]
+	}
+	return &pbTask.ListTaskRevisionsResponse{
+		Revisions: revisions,
+		NextToken: next,
+	}, nil
+}
+
+// GetTaskRevision - get a revision of a task with the fields it changed and the task as of the revision
+func (service *taskService) GetTaskRevision(ctx context.Context, req *pbTask.GetTaskRevisionRequest) (*pbTask.TaskRevision, error) {
+	if helper.IsEmpty(req.GetId()) {
+		return nil, helper.RequiredFieldErr("id is empty", "id")
+	}
+	if helper.IsEmpty(req.GetRevisionId()) {
+		return nil, helper.RequiredFieldErr("revision id is empty", "revision_id")
+	}
+	if err := service.checkRevisioned(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	revision, err := service.repo.GetRevision(ctx, req.GetId(), req.GetRevisionId())
+	if err != nil {
+		if errors.Is(err, repository.ErrRevisionNotFound) {
+			return nil, helper.NotFoundErr("task revision not found", "revision_id", req.GetRevisionId())
+		}
+		service.logger.Error("GetTaskRevision storage get error", zap.Error(err))
+		return nil, helper.InternalErr("storage get error")
+	}
+	previous, err := service.repo.ListRevisions(ctx, req.GetId(), req.GetRevisionId(), 1)
+	if err != nil {
+		service.logger.Error("GetTaskRevision storage list error", zap.Error(err))
+		return nil, helper.InternalErr("storage list error")
+	}
+	var before *pbTask.Task
+	if len(previous) > 0 {
+		before = previous[0].Task
+	}
+	if revision.Changes, err = diffTasks(before, revision.Task); err != nil {
+		service.logger.Error("GetTaskRevision diff error", zap.Error(err))
+		return nil, helper.InternalErr("revision diff error")
+	}
+	return revision, nil
+}
+
+// checkRevisioned - check if the task has revisions the caller can read, a deleted task has them until it is purged
+func (service *taskService) checkRevisioned(ctx context.Context, id string) error {
+	task, err := service.repo.Get(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return helper.NotFoundErr("task not found", "id", id)
+	}
+	if err != nil {
+		service.logger.Error("ListTaskRevisions storage get error", zap.Error(err))
+		return helper.InternalErr("storage get error")
+	}
+	return checkAccess(ctx, task, authz.Read)
+}
+
+// withActor - get a context whose writes are recorded in the revisions as made by the actor of the request
+func withActor(ctx context.Context) context.Context {
+	return repository.WithActor(ctx, actor(ctx))
+}
+
+// diffTasks - get the fields which are different in after from before in the order of the task fields,
+// the values are the JSON values of the fields and before is nil for the first revision
+func diffTasks(before *pbTask.Task, after *pbTask.Task) ([]*pbTask.FieldChange, error) {
+	old, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := []*pbTask.FieldChange{}
+	fields := (&pbTask.Task{}).ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		name := string(fields.Get(i).Name())
+		if untrackedFields[name] || reflect.DeepEqual(old[name], current[name]) {
+			continue
+		}
+		oldValue, err := structpb.NewValue(old[name])
+		if err != nil {
+			return nil, err
+		}
+		newValue, err := structpb.NewValue(current[name])
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &pbTask.FieldChange{
+			Field:    name,
+			OldValue: oldValue,
+			NewValue: newValue,
+		})
+	}
+	return changes, nil
+}
+
+// jsonFields - get the JSON values of the fields which are set, indexed by the field names
+func jsonFields(task *pbTask.Task) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if task == nil {
+		return fields, nil
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// changedFields - the names of the fields a revision changed
+func changedFields(revision *pbTask.TaskRevision) []string {
+	fields := []string{}
+	for _, change := range revision.Changes {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+func TestListTaskRevisions(t *testing.T) {
+	task, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "first"})
+	assert.Nil(t, err)
+	alice := auth.WithIdentity(ctx, auth.Identity{Subject: "alice", Method: auth.MethodJWT})
+	_, err = service.UpdateTask(alice, &pbTask.UpdateTaskRequest{
+		Id: task.Id, Task: &pbTask.Task{Name: "second", Description: "text"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "description"}}})
+	assert.Nil(t, err)
+	_, err = service.TransitionTask(alice, &pbTask.TransitionTaskRequest{Id: task.Id, Status: pbTask.Status_STATUS_IN_PROGRESS})
+	assert.Nil(t, err)
+	_, err = service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: task.Id})
+	assert.Nil(t, err)
+
+	resp, err := service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{Id: task.Id, PageSize: 3})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Revisions, 3)
+	assert.NotEmpty(t, resp.NextToken)
+	deleted, update := resp.Revisions[0], resp.Revisions[2]
+	assert.Equal(t, pbTask.TaskRevision_ACTION_DELETE, deleted.Action)
+	assert.Equal(t, []string{"delete_time", "expire_time"}, changedFields(deleted))
+	assert.Equal(t, "jwt:alice", resp.Revisions[1].Actor)
+	assert.Equal(t, []string{"status", "transitions"}, changedFields(resp.Revisions[1]))
+	assert.Equal(t, pbTask.TaskRevision_ACTION_UPDATE, update.Action)
+	assert.Equal(t, []string{"name", "description"}, changedFields(update))
+	assert.Equal(t, "first", update.Changes[0].OldValue.GetStringValue())
+	assert.Equal(t, "second", update.Changes[0].NewValue.GetStringValue())
+	_, unset := update.Changes[1].OldValue.Kind.(*structpb.Value_NullValue)
+	assert.True(t, unset)
+
+	resp, err = service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{Id: task.Id, PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Revisions, 1)
+	assert.Empty(t, resp.NextToken)
+	created := resp.Revisions[0]
+	assert.Equal(t, pbTask.TaskRevision_ACTION_CREATE, created.Action)
+	assert.Contains(t, changedFields(created), "name")
+	assert.Equal(t, "first", created.Task.Name)
+
+	// a token only pages the task it was created for
+	other := createTask(t, "other")
+	first, _ := service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{Id: task.Id, PageSize: 1})
+	_, err = service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{Id: other.Id, PageToken: first.NextToken})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{})
+	assert.Contains(t, err.Error(), "id is empty")
+	_, err = service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{Id: task.Id, PageSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetTaskRevision(t *testing.T) {
+	task, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "first"})
+	assert.Nil(t, err)
+	_, err = service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id: task.Id, Task: &pbTask.Task{Name: "second"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}})
+	assert.Nil(t, err)
+	list, err := service.ListTaskRevisions(ctx, &pbTask.ListTaskRevisionsRequest{Id: task.Id})
+	assert.Nil(t, err)
+
+	// the task as of the revision
+	revision, err := service.GetTaskRevision(ctx, &pbTask.GetTaskRevisionRequest{Id: task.Id, RevisionId: list.Revisions[1].RevisionId})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", revision.Task.Name)
+	assert.Equal(t, pbTask.TaskRevision_ACTION_CREATE, revision.Action)
+	revision, err = service.GetTaskRevision(ctx, &pbTask.GetTaskRevisionRequest{Id: task.Id, RevisionId: list.Revisions[0].RevisionId})
+	assert.Nil(t, err)
+	assert.Equal(t, "second", revision.Task.Name)
+	assert.Equal(t, list.Revisions[0].Changes, revision.Changes)
+
+	_, err = service.GetTaskRevision(ctx, &pbTask.GetTaskRevisionRequest{Id: task.Id, RevisionId: "1-0"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = service.GetTaskRevision(ctx, &pbTask.GetTaskRevisionRequest{Id: task.Id})
+	assert.Contains(t, err.Error(), "revision id is empty")
+}
+
+func TestDiffTasks(t *testing.T) {
+	changes, err := diffTasks(&pbTask.Task{Name: "a", Etag: "1"}, &pbTask.Task{Name: "a", Etag: "2", Labels: map[string]string{"k": "v"}})
+	assert.Nil(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "labels", changes[0].Field)
+	assert.Equal(t, "v", changes[0].NewValue.GetStructValue().Fields["k"].GetStringValue())
+
+	changes, _ = diffTasks(nil, &pbTask.Task{Id: "1"})
+	assert.Equal(t, "id", changes[0].Field)
+}
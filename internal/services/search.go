@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/search"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+)
+
+// SearchTasks - get a page of the tasks matching the words of the query, the most relevant first.
+// The ranking is scanned until the page has size tasks the caller can read or about MaxScannedTasks
+// tasks are scanned, the cursor of the page token is the offset after the last scanned task
+func (service *taskService) SearchTasks(ctx context.Context, req *pbTask.SearchTasksRequest) (*pbTask.SearchTasksResponse, error) {
+	if helper.IsEmpty(req.GetQuery()) {
+		return nil, helper.RequiredFieldErr("query is empty", "query")
+	}
+	if len(search.Query(req.GetQuery())) == 0 {
+		return nil, helper.InvalidErr("query has no words", "query", req.GetQuery())
+	}
+	// a token only pages the results of the query it was created for
+	query := "search\x00" + req.GetQuery()
+	cursor, size, err := service.pageCursor(req.PageSize, req.PageToken, query, "")
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	if cursor != "" {
+		if offset, err = strconv.ParseInt(cursor, 10, 64); err != nil || offset < 0 {
+			return nil, helper.InvalidErr("page token invalid", "page_token", req.PageToken)
+		}
+	}
+
+	var (
+		allowed = authz.Readable(ctx)
+		tasks   = []*pbTask.Task{}
+		next    string
+		scanned int64
+	)
+	for {
+		// a scan after the first one reads at least a full page, so a caller who can read few
+		// of the tasks does not read the ranking in many small scans
+		count := size
+		if scanned > 0 {
+			count = max(size, MaxPageSize)
+		}
+		// one more task to know if the ranking has more
+		batch, err := service.repo.Search(ctx, req.GetQuery(), offset, count+1)
+		if err != nil {
+			service.logger.Error("SearchTasks storage search error", zap.Error(err))
+			return nil, helper.InternalErr("storage search error")
+		}
+		more := int64(len(batch)) > count
+		batch = batch[:min(int64(len(batch)), count)]
+		scanned += int64(len(batch))
+		for i, task := range batch {
+			offset++
+			if allowed != nil && !allowed(task) {
+				continue
+			}
+			tasks = append(tasks, task)
+			if int64(len(tasks)) == size {
+				more = more || i < len(batch)-1
+				break
+			}
+		}
+		if !more {
+			break
+		}
+		if int64(len(tasks)) == size || scanned >= MaxScannedTasks {
+			next = service.nextToken(strconv.FormatInt(offset, 10), size, query, "")
+			break
+		}
+	}
+	return &pbTask.SearchTasksResponse{
+		Tasks:     tasks,
+		NextToken: next,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"testing"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSearchTasks(t *testing.T) {
+	ids := []string{}
+	for _, req := range []*pbTask.CreateTaskRequest{
+		{Name: "Plan the zanzibar trip"},
+		{Name: "Pack bags", Description: "for zanzibar"},
+		{Name: "Zanzibar visa"},
+	} {
+		task, err := service.CreateTask(ctx, req)
+		assert.Nil(t, err)
+		ids = append(ids, task.Id)
+	}
+
+	resp, err := service.SearchTasks(ctx, &pbTask.SearchTasksRequest{Query: "zanzibar", PageSize: 2})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, 2)
+	assert.Equal(t, []string{ids[2], ids[0]}, []string{resp.Tasks[0].Id, resp.Tasks[1].Id})
+	assert.NotEmpty(t, resp.NextToken)
+	resp, err = service.SearchTasks(ctx, &pbTask.SearchTasksRequest{Query: "zanzibar", PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, 1)
+	assert.Equal(t, ids[1], resp.Tasks[0].Id)
+	assert.Empty(t, resp.NextToken)
+
+	// prefix and typo matches
+	resp, _ = service.SearchTasks(ctx, &pbTask.SearchTasksRequest{Query: "zanz"})
+	assert.Len(t, resp.Tasks, 3)
+	resp, _ = service.SearchTasks(ctx, &pbTask.SearchTasksRequest{Query: "zanzibra visa"})
+	assert.Len(t, resp.Tasks, 1)
+	assert.Equal(t, ids[2], resp.Tasks[0].Id)
+
+	// a token only pages the query it was created for
+	resp, _ = service.SearchTasks(ctx, &pbTask.SearchTasksRequest{Query: "zanzibar", PageSize: 1})
+	_, err = service.SearchTasks(ctx, &pbTask.SearchTasksRequest{Query: "visa", PageToken: resp.NextToken})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	for _, query := range []string{"", " -- "} {
+		_, err = service.SearchTasks(ctx, &pbTask.SearchTasksRequest{Query: query})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestSearchTasksReadable(t *testing.T) {
+	var (
+		acl   = newTestService()
+		alice = as("alice", false)
+		bob   = as("bob", false)
+		ids   = []string{}
+	)
+	for _, req := range []*pbTask.CreateTaskRequest{
+		{Name: "Lisbon flights", Readers: []string{"jwt:bob"}},
+		{Name: "Lisbon hotel"},
+		{Name: "Lisbon museums"},
+		{Name: "Lisbon dinner", Readers: []string{"jwt:bob"}},
+	} {
+		task, err := acl.CreateTask(alice, req)
+		assert.Nil(t, err)
+		ids = append(ids, task.Id)
+	}
+
+	// the pages are full of the readable tasks, the token skips the unreadable ones scanned
+	resp, err := acl.SearchTasks(bob, &pbTask.SearchTasksRequest{Query: "lisbon", PageSize: 1})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, 1)
+	assert.NotEmpty(t, resp.NextToken)
+	seen := []string{resp.Tasks[0].Id}
+	resp, err = acl.SearchTasks(bob, &pbTask.SearchTasksRequest{Query: "lisbon", PageSize: 1, PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, 1)
+	seen = append(seen, resp.Tasks[0].Id)
+	assert.ElementsMatch(t, []string{ids[0], ids[3]}, seen)
+	if resp.NextToken != "" {
+		resp, err = acl.SearchTasks(bob, &pbTask.SearchTasksRequest{Query: "lisbon", PageSize: 1, PageToken: resp.NextToken})
+		assert.Nil(t, err)
+		assert.Empty(t, resp.Tasks)
+		assert.Empty(t, resp.NextToken)
+	}
+
+	resp, err = acl.SearchTasks(alice, &pbTask.SearchTasksRequest{Query: "lisbon", PageSize: 3})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, 3)
+	assert.NotEmpty(t, resp.NextToken)
+}
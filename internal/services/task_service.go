@@ -2,179 +2,395 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/0x726f6f6b6965/task/internal/archive"
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/filter"
 	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
 	"github.com/0x726f6f6b6965/task/internal/utils"
+	"github.com/0x726f6f6b6965/task/internal/webhook"
+	"github.com/0x726f6f6b6965/task/internal/workflow"
 	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
-	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 const (
-	TaskID  string = "taskID"
-	SortSet string = "sortSet"
+	// IfMatch - the metadata key of the If-Match header
+	IfMatch string = "if-match"
+	// GatewayIfMatch - the metadata key of the If-Match header forwarded by the gateway
+	GatewayIfMatch string = "grpcgateway-if-match"
+	// AnyEtag - the etag matching every version
+	AnyEtag string = "*"
+	// updateAttempts - how many times UpdateTask tries to write a task modified concurrently
+	updateAttempts int = 3
+	// DefaultPageSize - the page size of GetTaskList when it is not given
+	DefaultPageSize int64 = 25
+	// MaxPageSize - the larger page sizes are lowered to it
+	MaxPageSize int64 = 100
+	// MaxScannedTasks - about how many tasks a page reads at most, a page with a selective filter
+	// can be shorter than its size and still have a next token
+	MaxScannedTasks int64 = 1000
 )
 
+// writeFunc - write a changed task whose stored etag is etag
+type writeFunc func(ctx context.Context, task *pbTask.Task, etag string) error
+
 type taskService struct {
 	pbTask.UnimplementedTaskServiceServer
-	sequencer   utils.Generator
-	redisClient *redis.Client
-	logger      *zap.Logger
+	sequencer utils.Generator
+	repo      repository.TaskRepository
+	tokens    utils.PageTokenSigner
+	workflow  workflow.Workflow
+	trash     TrashOptions
+	archive   archive.Sink
+	reader    EventReader
+	webhooks  *webhook.Store
+	logger    *zap.Logger
 }
 
 // CreateTask - create a task
 func (service *taskService) CreateTask(ctx context.Context, req *pbTask.CreateTaskRequest) (*pbTask.Task, error) {
-	if helper.IsEmpty(req.GetName()) {
-		return nil, helper.RequiredFieldErr("name is empty", "name")
+	id, err := requestID(ctx, req.GetRequestId())
+	if err != nil {
+		return nil, err
+	}
+	task, err := service.newTask(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	errs, err := service.checkParents(ctx, []*pbTask.Task{task})
+	if err != nil {
+		return nil, err
+	}
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	write := withActor(ctx)
+	if id != "" {
+		request, err := service.newRequest(ctx, id, req)
+		if err != nil {
+			return nil, err
+		}
+		write = repository.WithRequests(write, map[string]repository.Request{task.Id: request}, RequestTTL)
 	}
 
-	if _, ok := pbTask.Status_name[int32(req.Status)]; !ok {
-		return nil, helper.InvalidErr("status invalid", "status", req.Status)
+	err = service.repo.Create(write, task)
+	if err != nil {
+		var replay *repository.ReplayError
+		if errors.As(err, &replay) {
+			return service.replayTask(ctx, replay, id)
+		}
+		if errors.Is(err, repository.ErrRequestMismatch) {
+			return nil, requestMismatchErr(id)
+		}
+		if errors.Is(err, repository.ErrAlreadyExists) {
+			service.logger.Error("CreateTask attempt to create id error", zap.Any("request", req))
+			return nil, helper.InternalErr("please try again later")
+		}
+		if errors.Is(err, repository.ErrParentNotFound) {
+			return nil, helper.NotFoundErr("parent task not found", "parent_id", task.ParentId)
+		}
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			return nil, quotaErr(ctx)
+		}
+		service.logger.Error("CreateTask storage error", zap.Error(err))
+		return nil, helper.InternalErr("storage error")
 	}
+	return task, nil
+}
 
+// newTask - check a create request and get the task with a new id, owned by the identity of the call
+func (service *taskService) newTask(ctx context.Context, req *pbTask.CreateTaskRequest) (*pbTask.Task, error) {
 	var (
 		id string
 	)
 
 	task := &pbTask.Task{
-		Name:   req.GetName(),
-		Status: req.Status,
+		Name:        req.GetName(),
+		Status:      req.Status,
+		Description: req.GetDescription(),
+		Priority:    req.Priority,
+		DueTime:     req.GetDueTime(),
+		Labels:      req.GetLabels(),
+		ParentId:    req.GetParentId(),
+		Readers:     req.GetReaders(),
+		Writers:     req.GetWriters(),
+	}
+	if identity, ok := auth.IdentityOf(ctx); ok {
+		task.Owner = identity.Principal()
+	}
+	if err := validateTask(task); err != nil {
+		return nil, err
+	}
+	if err := service.checkInitial(task); err != nil {
+		return nil, err
 	}
 	seq, _ := service.sequencer.Next()
 	id = seq.String()
 
-	// check id exist
-	// usually the id won't repeat
-	exist := service.redisClient.Exists(ctx, fmt.Sprintf("%s:%s", TaskID, id)).Val()
-
-	if exist != 0 || helper.IsEmpty(id) {
+	if helper.IsEmpty(id) {
 		service.logger.Error("CreateTask attempt to create id error", zap.Any("request", req))
 		return nil, helper.InternalErr("please try again later")
 	}
 
 	task.Id = id
-
-	data, err := json.Marshal(task)
-	if err != nil {
-		service.logger.Error("CreateTask unmarshal error", zap.Error(err))
-		return nil, helper.InternalErr("unmarshal error")
-	}
-	err = service.redisClient.Eval(ctx, helper.AddTask,
-		[]string{fmt.Sprintf("%s:%s", TaskID, id), SortSet}, data, id).Err()
-
-	if err != nil && !errors.Is(err, redis.Nil) {
-		service.logger.Error("CreateTask redis error", zap.Error(err))
-		return nil, helper.InternalErr("redis error")
-	}
+	stampTimes(task, nil)
 	return task, nil
 }
 
-// DeleteTask - delete a task by id
+// DeleteTask - move a task to the trash, it can be undeleted until it expires
 func (service *taskService) DeleteTask(ctx context.Context, req *pbTask.DeleteTaskRequest) (*emptypb.Empty, error) {
 	if helper.IsEmpty(req.GetId()) {
 		return nil, helper.RequiredFieldErr("id is empty", "id")
 	}
-	exist := service.redisClient.Exists(ctx, fmt.Sprintf("%s:%s", TaskID, req.GetId())).Val()
-	if exist == 0 {
-		return nil, helper.NotFoundErr("task not found", "id", req.GetId())
-	}
-
-	err := service.redisClient.Eval(ctx, helper.DeleteTask,
-		[]string{fmt.Sprintf("%s:%s", TaskID, req.GetId()), SortSet}, req.GetId()).Err()
 
-	if err != nil && !errors.Is(err, redis.Nil) {
-		service.logger.Error("DeleteTask fail", zap.String("id", req.GetId()))
-		return nil, helper.InternalErr("please try again later")
+	write := service.trashTask
+	if req.GetForce() {
+		write = service.trashTree
+	}
+	_, err := service.modify(ctx, req.GetId(), requestEtag(ctx, req.GetEtag()), false, authz.Delete,
+		service.markDeleted(time.Now()), write)
+	if err != nil {
+		return nil, err
 	}
 	return &emptypb.Empty{}, nil
 }
 
-// GetTask - get task information
+// GetTask - get task information, a task which is not in the repository is looked for in the archive
 func (service *taskService) GetTask(ctx context.Context, req *pbTask.GetTaskRequest) (*pbTask.Task, error) {
 	if helper.IsEmpty(req.GetId()) {
 		return nil, helper.RequiredFieldErr("id is empty", "id")
 	}
 
-	result, err := service.redisClient.Get(ctx, fmt.Sprintf("%s:%s", TaskID, req.GetId())).Bytes()
+	resp, err := service.repo.Get(ctx, req.GetId())
+	if errors.Is(err, repository.ErrNotFound) && service.archive != nil {
+		resp, err = service.archive.Get(ctx, repository.TenantOf(ctx).ID, req.GetId())
+		if errors.Is(err, archive.ErrNotFound) {
+			err = repository.ErrNotFound
+		}
+	}
 	if err != nil {
-		if errors.Is(redis.Nil, err) {
+		if errors.Is(err, repository.ErrNotFound) {
 			return nil, helper.NotFoundErr("task not found", "id", req.GetId())
 		}
-		service.logger.Error("GetTask redis get error", zap.Error(err))
-		return nil, helper.InternalErr("redis get error")
+		service.logger.Error("GetTask storage get error", zap.Error(err))
+		return nil, helper.InternalErr("storage get error")
 	}
-	resp := &pbTask.Task{}
-	err = json.Unmarshal(result, resp)
-	if err != nil {
-		service.logger.Error("GetTask unmarshal error", zap.Error(err))
-		return nil, helper.InternalErr("unmarshal error")
+	if err = checkAccess(ctx, resp, authz.Read); err != nil {
+		return nil, err
 	}
 	return resp, nil
 }
 
 // GetTaskList - get a list of task information
 func (service *taskService) GetTaskList(ctx context.Context, req *pbTask.GetTaskListRequest) (*pbTask.GetTaskListResponse, error) {
-	var (
-		start string = "-"
-		size  int64  = 25
-		token        = utils.NewPageToken("", 0)
-	)
-
-	if !helper.IsEmpty(req.PageToken) {
-		token, err := utils.GetPageTokenByString(req.PageToken)
-		// if we get the wrong token, ignore it.
-		if err == nil {
-			start = "(" + token.GetID()
-			size = token.GetSize()
-		}
+	match, err := filter.Parse(req.GetFilter())
+	if err != nil {
+		return nil, helper.BadRequestErr("filter invalid", "filter", err.Error())
+	}
+	desc, err := filter.ParseOrder(req.GetOrderBy())
+	if err != nil {
+		return nil, helper.BadRequestErr("order by invalid", "order_by", err.Error())
 	}
 
-	if req.PageSize != 0 {
-		size = int64(req.PageSize)
+	opts := repository.ListOptions{
+		Desc:        desc,
+		ShowDeleted: req.GetShowDeleted(),
+		Match:       readable(ctx, match.Match),
+	}
+	if status, ok := match.Status(); ok {
+		opts.Status = &status
+	}
+	// the deleted tasks are part of the query, so a token of one listing does not page the other
+	query := req.GetFilter()
+	if opts.ShowDeleted {
+		query += "\x00show_deleted"
 	}
-	keys, err := service.redisClient.ZRangeArgs(ctx, redis.ZRangeArgs{
-		Key:    SortSet,
-		ByLex:  true,
-		Start:  start,
-		Stop:   "+",
-		Offset: 0,
-		Count:  size,
-	}).Result()
+	tasks, next, err := service.listPage(ctx, req.PageSize, req.PageToken, query, req.GetOrderBy(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &pbTask.GetTaskListResponse{
+		Tasks:     tasks,
+		NextToken: next,
+	}, nil
+}
 
+// listPage - list a page of the tasks after the page token and get the next page token,
+// a page token only works with the same filter and order
+func (service *taskService) listPage(ctx context.Context, pageSize int32, pageToken string,
+	filterText string, orderBy string, opts repository.ListOptions) ([]*pbTask.Task, string, error) {
+	cursor, size, err := service.pageCursor(pageSize, pageToken, filterText, orderBy)
 	if err != nil {
-		service.logger.Error("GetTaskList redis zrange error", zap.Error(err))
-		return nil, helper.InternalErr("redis zrange error")
+		return nil, "", err
 	}
-	resp := &pbTask.GetTaskListResponse{
-		Tasks: []*pbTask.Task{},
+	opts.Cursor, opts.Size, opts.MaxScan = cursor, size, MaxScannedTasks
+	tasks, last, err := service.repo.ListPage(ctx, opts)
+	if err != nil {
+		service.logger.Error("GetTaskList storage list error", zap.Error(err))
+		return nil, "", helper.InternalErr("storage list error")
+	}
+
+	var next string
+	if last != "" {
+		next = service.nextToken(last, size, filterText, orderBy)
+	}
+	return tasks, next, nil
+}
+
+// pageCursor - check the page size and the page token of a list and get the cursor and the page size,
+// a cursor only makes sense with the filter and order it was created by
+func (service *taskService) pageCursor(pageSize int32, pageToken string,
+	filterText string, orderBy string) (string, int64, error) {
+	var (
+		size   = DefaultPageSize
+		cursor = ""
+	)
+
+	if pageSize < 0 {
+		return "", 0, helper.InvalidErr("page size invalid", "page_size", pageSize)
 	}
-	for _, key := range keys {
-		bytes, _ := service.redisClient.Get(ctx, fmt.Sprintf("%s:%s", TaskID, key)).Bytes()
-		task := &pbTask.Task{}
-		err = json.Unmarshal(bytes, task)
+	if !helper.IsEmpty(pageToken) {
+		token, err := service.tokens.Verify(pageToken)
+		if errors.Is(err, utils.ErrTokenExpired) {
+			return "", 0, helper.InvalidErr("page token expired", "page_token", pageToken)
+		}
 		if err != nil {
-			service.logger.Error("GetTaskList unmarshal error",
-				zap.String("key", fmt.Sprintf("%s:%s", TaskID, key)), zap.Error(err))
-			continue
+			return "", 0, helper.InvalidErr("page token invalid", "page_token", pageToken)
 		}
-		resp.Tasks = append(resp.Tasks, task)
+		if token.GetQuery() != utils.QueryHash(filterText, orderBy) {
+			return "", 0, helper.InvalidErr("page token does not match the filter or order", "page_token", pageToken)
+		}
+		cursor = token.GetID()
+		size = token.GetSize()
 	}
 
-	if len(keys) >= int(size) {
-		token.SetID(keys[len(keys)-1])
-		token.SetSize(size)
-		resp.NextToken = token.GetToken()
+	if pageSize != 0 {
+		size = int64(pageSize)
+	}
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
 	}
+	return cursor, size, nil
+}
 
-	return resp, nil
+// nextToken - sign the page token of the page after the cursor
+func (service *taskService) nextToken(cursor string, size int64, filterText string, orderBy string) string {
+	token := utils.NewPageToken(cursor, size)
+	token.SetQuery(filterText, orderBy)
+	return service.tokens.Sign(token)
 }
 
 // UpdateTask - update a task information by id
 func (service *taskService) UpdateTask(ctx context.Context, req *pbTask.UpdateTaskRequest) (*pbTask.Task, error) {
+	fields, err := updateFields(req)
+	if err != nil {
+		return nil, err
+	}
+
+	etag := requestEtag(ctx, req.GetEtag())
+	if etag == "" {
+		etag = normalizeEtag(req.Task.GetEtag())
+	}
+	return service.update(ctx, req.GetId(), etag, func(task *pbTask.Task) error {
+		before := task.Status
+		if err := applyUpdate(ctx, task, req.Task, fields); err != nil {
+			return err
+		}
+		return service.prepare(ctx, task, before, "")
+	})
+}
+
+// update - read the task, change it and write it back if its etag is still the same
+func (service *taskService) update(ctx context.Context, id string, etag string, change func(task *pbTask.Task) error) (*pbTask.Task, error) {
+	return service.updateWith(ctx, id, etag, change, service.repo.Update)
+}
+
+// updateWith - update a task as update does, the changed task is written by write.
+// If change returns errUnchanged, the task is returned without being written
+// and the status errors of write are returned as they are
+func (service *taskService) updateWith(ctx context.Context, id string, etag string,
+	change func(task *pbTask.Task) error, write writeFunc) (*pbTask.Task, error) {
+	return service.modify(ctx, id, etag, false, authz.Write, change, write)
+}
+
+// modify - the read, change and write loop of updateWith,
+// a deleted task is not found unless withDeleted and the caller needs the access to the task
+func (service *taskService) modify(ctx context.Context, id string, etag string, withDeleted bool, access authz.Access,
+	change func(task *pbTask.Task) error, write writeFunc) (*pbTask.Task, error) {
+	pinned := etag != "" && etag != AnyEtag
+
+	// the write only succeeds when nobody changed the task since it was read,
+	// if the caller did not ask for a version, read it again and retry
+	for attempt := 1; ; attempt++ {
+		task, err := service.repo.Get(ctx, id)
+		if err == nil && task.DeleteTime != nil && !withDeleted {
+			err = repository.ErrNotFound
+		}
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, helper.NotFoundErr("task not found", "id", id)
+			}
+			service.logger.Error("UpdateTask storage get error", zap.Error(err))
+			return nil, helper.InternalErr("storage get error")
+		}
+		if err = checkAccess(ctx, task, access); err != nil {
+			return nil, err
+		}
+		if pinned && etag != task.Etag {
+			return nil, etagMismatchErr(id, etag)
+		}
+		current := task.Etag
+
+		if err = change(task); err != nil {
+			if errors.Is(err, errUnchanged) {
+				return task, nil
+			}
+			return nil, err
+		}
+
+		err = write(withActor(ctx), task, current)
+		if err == nil {
+			return task, nil
+		}
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, helper.NotFoundErr("task not found", "id", id)
+		}
+		if errors.Is(err, repository.ErrBlocked) {
+			return nil, blockedErr(id)
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			if pinned {
+				return nil, etagMismatchErr(id, etag)
+			}
+			if attempt < updateAttempts {
+				continue
+			}
+			return nil, helper.AbortedErr("task was modified concurrently, please try again")
+		}
+		service.logger.Error("UpdateTask storage update error", zap.Error(err))
+		return nil, helper.InternalErr("storage update error")
+	}
+}
+
+// updateFields - check an update request and get the fields to update
+func updateFields(req *pbTask.UpdateTaskRequest) ([]protoreflect.FieldDescriptor, error) {
 	if helper.IsEmpty(req.GetId()) {
 		return nil, helper.RequiredFieldErr("id is empty", "id")
 	}
@@ -184,48 +400,52 @@ func (service *taskService) UpdateTask(ctx context.Context, req *pbTask.UpdateTa
 	if _, ok := pbTask.Status_name[int32(req.Task.Status)]; !ok {
 		return nil, helper.InvalidErr("status invalid", "status", req.Task.Status)
 	}
-	data, err := service.redisClient.Get(ctx, fmt.Sprintf("%s:%s", TaskID, req.GetId())).Bytes()
-	if err != nil {
-		if errors.Is(redis.Nil, err) {
-			return nil, helper.NotFoundErr("task not found", "id", req.GetId())
-		}
-		service.logger.Error("UpdateTask redis get error", zap.Error(err))
-		return nil, helper.InternalErr("redis get error")
-	}
-	task := &pbTask.Task{}
-	err = json.Unmarshal(data, task)
-	if err != nil {
-		service.logger.Error("UpdateTask unmarshal error", zap.Error(err))
-		return nil, helper.InternalErr("unmarshal error")
+	fields, invalid := updatePaths(req.UpdateMask.GetPaths())
+	if invalid != "" {
+		return nil, helper.InvalidErr("update mask invalid", "update_mask", invalid)
 	}
+	return fields, nil
+}
 
-	for _, key := range req.UpdateMask.GetPaths() {
-		switch key {
-		case "task.name":
-			task.Name = req.Task.Name
-		case "task.status":
-			task.Status = req.Task.Status
+// requestEtag - get the etag of the request, or the If-Match header when it is empty
+func requestEtag(ctx context.Context, etag string) string {
+	for _, key := range []string{IfMatch, GatewayIfMatch} {
+		if etag != "" {
+			break
+		}
+		if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+			etag = values[0]
 		}
 	}
+	return normalizeEtag(etag)
+}
 
-	data, err = json.Marshal(task)
-	if err != nil {
-		service.logger.Error("UpdateTask unmarshal error", zap.Error(err))
-		return nil, helper.InternalErr("unmarshal error")
-	}
+// normalizeEtag - remove the weak prefix and the quotes, e.g. If-Match: W/"1"
+func normalizeEtag(etag string) string {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	return strings.Trim(etag, `"`)
+}
 
-	err = service.redisClient.Set(ctx, fmt.Sprintf("%s:%s", TaskID, req.Id), data, -1).Err()
-	if err != nil {
-		service.logger.Error("UpdateTask redis set error", zap.Error(err))
-		return nil, helper.InternalErr("redis set error")
-	}
-	return task, nil
+func hasChildrenErr(id string) error {
+	return helper.FailedPreconditionErr("task has subtasks", helper.SubtaskViolation, id,
+		"delete the subtasks first or set force to delete them with the task")
+}
+
+func etagMismatchErr(id string, etag string) error {
+	return helper.FailedPreconditionErr("etag mismatch", helper.EtagViolation, id,
+		fmt.Sprintf("etag '%s' does not match the current version of the task", etag))
 }
 
-func NewTaskService(generator utils.Generator, redisClient *redis.Client, logger *zap.Logger) pbTask.TaskServiceServer {
+func NewTaskService(generator utils.Generator, repo repository.TaskRepository, tokens utils.PageTokenSigner, flow workflow.Workflow, trash TrashOptions, sink archive.Sink, reader EventReader, webhooks *webhook.Store, logger *zap.Logger) pbTask.TaskServiceServer {
 	return &taskService{
-		redisClient: redisClient,
-		sequencer:   generator,
-		logger:      logger,
+		repo:      repo,
+		sequencer: generator,
+		tokens:    tokens,
+		workflow:  flow,
+		trash:     trash.withDefaults(),
+		archive:   sink,
+		reader:    reader,
+		webhooks:  webhooks,
+		logger:    logger,
 	}
 }
@@ -2,29 +2,35 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math/big"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/archive"
+	"github.com/0x726f6f6b6965/task/internal/repository"
 	"github.com/0x726f6f6b6965/task/internal/utils"
+	"github.com/0x726f6f6b6965/task/internal/webhook"
+	"github.com/0x726f6f6b6965/task/internal/workflow"
 	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
-	"github.com/go-redis/redismock/v9"
-	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var (
-	rClient *redis.Client
-	rmock   redismock.ClientMock
+	repo    repository.TaskRepository
 	service pbTask.TaskServiceServer
 	mockG   utils.Generator
-	num     *big.Int
+	tokens  utils.PageTokenSigner
+	logger  *zap.Logger
 	ctx     context.Context
 )
 
@@ -36,40 +42,46 @@ func TestMain(m *testing.M) {
 }
 
 func setup() {
-	rClient, rmock = redismock.NewClientMock()
-	logger, _ := zap.NewDevelopment()
-	mockG = &mockGenerator{}
-	num = big.NewInt(time.Now().UnixMilli())
-	service = NewTaskService(mockG, rClient, logger)
+	repo = repository.NewMemoryRepository()
+	logger, _ = zap.NewDevelopment()
+	mockG = &mockGenerator{num: big.NewInt(time.Now().UnixMilli())}
+	tokens, _ = utils.NewPageTokenSigner([]utils.SigningKey{{ID: "test", Secret: []byte("secret")}}, time.Hour)
+	service = newTestService(withRepo(repo))
 	ctx = context.Background()
 	fmt.Printf("\033[1;33m%s\033[0m", "> Setup completed\n")
 }
 
 func teardown() {
-	rClient.Close()
 	fmt.Printf("\033[1;33m%s\033[0m", "> Teardown completed")
 	fmt.Printf("\n")
 }
 
+// createTask - create a task directly in the repository
+func createTask(t *testing.T, name string) *pbTask.Task {
+	g, _ := mockG.Next()
+	task := &pbTask.Task{
+		Id:     g.String(),
+		Name:   name,
+		Status: 1,
+	}
+	assert.Nil(t, repo.Create(ctx, task))
+	return task
+}
+
 func TestCreateTask(t *testing.T) {
 	var (
-		req  = &pbTask.CreateTaskRequest{Name: "test-name", Status: 1}
-		g, _ = mockG.Next()
-		task = &pbTask.Task{
-			Id:     g.String(),
-			Name:   req.Name,
-			Status: req.Status,
-		}
-		data, _ = json.Marshal(task)
-		key     = fmt.Sprintf("%s:%s", TaskID, g.String())
+		req = &pbTask.CreateTaskRequest{Name: "test-name", Status: 1}
 	)
 
-	rmock.ExpectExists(key).SetVal(0)
-	rmock.ExpectEval(helper.AddTask, []string{key, SortSet}, data, g.String()).RedisNil()
+	resp, err := service.CreateTask(ctx, req)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, resp.Id)
+	assert.Equal(t, req.Name, resp.Name)
+	assert.Equal(t, req.Status, resp.Status)
 
-	resp, err := service.CreateTask(context.Background(), req)
+	task, err := repo.Get(ctx, resp.Id)
 	assert.Nil(t, err)
-	assert.Equal(t, task, resp)
+	assert.Equal(t, resp, task)
 }
 
 func TestCreateTaskEmptyName(t *testing.T) {
@@ -77,7 +89,7 @@ func TestCreateTaskEmptyName(t *testing.T) {
 		req = &pbTask.CreateTaskRequest{Status: 1}
 	)
 
-	_, err := service.CreateTask(context.Background(), req)
+	_, err := service.CreateTask(ctx, req)
 	assert.Contains(t, err.Error(), "name is empty")
 }
 
@@ -85,223 +97,576 @@ func TestCreateTaskIdExist(t *testing.T) {
 	var (
 		req  = &pbTask.CreateTaskRequest{Name: "test-name", Status: 1}
 		g, _ = mockG.Next()
-		key  = fmt.Sprintf("%s:%s", TaskID, g.String())
+		// a generator which keeps returning the same id
+		fixed = newTestService(withGenerator(&fixedGenerator{num: g}), withRepo(repo))
 	)
 
-	rmock.ExpectExists(key).SetVal(1)
+	_, err := fixed.CreateTask(ctx, req)
+	assert.Nil(t, err)
 
-	_, err := service.CreateTask(context.Background(), req)
+	_, err = fixed.CreateTask(ctx, req)
 	assert.Contains(t, err.Error(), "please try again later")
 }
 
 func TestCreateTaskInvalidStatus(t *testing.T) {
 	var (
-		req = &pbTask.CreateTaskRequest{Name: "test-name", Status: 3}
+		req = &pbTask.CreateTaskRequest{Name: "test-name", Status: 9}
 	)
 
-	_, err := service.CreateTask(context.Background(), req)
+	_, err := service.CreateTask(ctx, req)
 	assert.Contains(t, err.Error(), "status invalid")
 }
 
-func TestGetTask(t *testing.T) {
+func TestCreateTaskDetails(t *testing.T) {
 	var (
-		g, _   = mockG.Next()
-		except = &pbTask.Task{
-			Id:     g.String(),
-			Name:   "test-name",
-			Status: 1}
-		data, _ = json.Marshal(except)
-		key     = fmt.Sprintf("%s:%s", TaskID, g.String())
+		due = timestamppb.New(time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC))
+		req = &pbTask.CreateTaskRequest{
+			Name:        "test-name",
+			Status:      1,
+			Description: "write the report",
+			Priority:    pbTask.Priority_PRIORITY_HIGH,
+			DueTime:     due,
+			Labels:      map[string]string{"team": "core"},
+		}
 	)
-	rmock.ExpectGet(key).SetVal(string(data))
 
-	resp, err := service.GetTask(context.Background(), &pbTask.GetTaskRequest{Id: g.String()})
+	resp, err := service.CreateTask(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, req.Description, resp.Description)
+	assert.Equal(t, req.Priority, resp.Priority)
+	assert.Equal(t, due.AsTime(), resp.DueTime.AsTime())
+	assert.Equal(t, req.Labels, resp.Labels)
+	assert.NotNil(t, resp.CreateTime)
+	assert.Equal(t, resp.CreateTime.AsTime(), resp.UpdateTime.AsTime())
+	assert.Equal(t, resp.CreateTime.AsTime(), resp.CompleteTime.AsTime())
+
+	task, err := repo.Get(ctx, resp.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, resp.Labels, task.Labels)
+	assert.Equal(t, resp.CreateTime.AsTime(), task.CreateTime.AsTime())
+}
+
+func TestCreateTaskInvalidDetails(t *testing.T) {
+	tests := []struct {
+		req     *pbTask.CreateTaskRequest
+		message string
+	}{
+		{&pbTask.CreateTaskRequest{Name: "a", Priority: 9}, "priority invalid"},
+		{&pbTask.CreateTaskRequest{Name: "a", Description: strings.Repeat("a", MaxDescriptionLength+1)}, "description too long"},
+		{&pbTask.CreateTaskRequest{Name: "a", Labels: map[string]string{"Team": "core"}}, "label invalid"},
+		{&pbTask.CreateTaskRequest{Name: "a", Labels: map[string]string{"team": strings.Repeat("a", MaxLabelLength+1)}}, "label invalid"},
+		{&pbTask.CreateTaskRequest{Name: "a", DueTime: &timestamppb.Timestamp{Nanos: -1}}, "due time invalid"},
+	}
+	for _, test := range tests {
+		_, err := service.CreateTask(ctx, test.req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Contains(t, err.Error(), test.message)
+	}
+}
+
+func TestGetTask(t *testing.T) {
+	except := createTask(t, "test-name")
+
+	resp, err := service.GetTask(ctx, &pbTask.GetTaskRequest{Id: except.Id})
 	assert.Nil(t, err)
 	assert.Equal(t, except, resp)
 }
 
 func TestGetTaskEmptyId(t *testing.T) {
-	_, err := service.GetTask(context.Background(), &pbTask.GetTaskRequest{})
+	_, err := service.GetTask(ctx, &pbTask.GetTaskRequest{})
 	assert.Contains(t, err.Error(), "id is empty")
 }
 
 func TestGetTaskNotFound(t *testing.T) {
-	var (
-		g, _ = mockG.Next()
-		key  = fmt.Sprintf("%s:%s", TaskID, g.String())
-	)
-	rmock.ExpectGet(key).RedisNil()
+	g, _ := mockG.Next()
 
-	_, err := service.GetTask(context.Background(), &pbTask.GetTaskRequest{Id: g.String()})
+	_, err := service.GetTask(ctx, &pbTask.GetTaskRequest{Id: g.String()})
 	assert.Contains(t, err.Error(), "task not found")
 }
 
 func TestDeleteTask(t *testing.T) {
-	var (
-		g, _ = mockG.Next()
-		key  = fmt.Sprintf("%s:%s", TaskID, g.String())
-	)
-	rmock.ExpectExists(key).SetVal(1)
-	rmock.ExpectEval(helper.DeleteTask, []string{key, SortSet}, g.String()).RedisNil()
+	task := createTask(t, "test-name")
 
-	_, err := service.DeleteTask(context.Background(), &pbTask.DeleteTaskRequest{Id: g.String()})
+	_, err := service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: task.Id})
+	assert.Nil(t, err)
+
+	stored, err := repo.Get(ctx, task.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRetention, stored.ExpireTime.AsTime().Sub(stored.DeleteTime.AsTime()))
+
+	_, err = service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: task.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestDeleteTaskEtagMismatch(t *testing.T) {
+	task := createTask(t, "test-name")
+
+	_, err := service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: task.Id, Etag: "99"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	md := metadata.Pairs(GatewayIfMatch, `"1"`)
+	_, err = service.DeleteTask(metadata.NewIncomingContext(ctx, md), &pbTask.DeleteTaskRequest{Id: task.Id})
 	assert.Nil(t, err)
 }
 
 func TestDeleteTaskEmptyId(t *testing.T) {
-	_, err := service.DeleteTask(context.Background(), &pbTask.DeleteTaskRequest{})
+	_, err := service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{})
 	assert.Contains(t, err.Error(), "id is empty")
 }
 
 func TestDeleteTaskNotFound(t *testing.T) {
-	var (
-		g, _ = mockG.Next()
-		key  = fmt.Sprintf("%s:%s", TaskID, g.String())
-	)
-	rmock.ExpectExists(key).SetVal(0)
+	g, _ := mockG.Next()
 
-	_, err := service.DeleteTask(context.Background(), &pbTask.DeleteTaskRequest{Id: g.String()})
+	_, err := service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: g.String()})
 	assert.Contains(t, err.Error(), "task not found")
 }
 
 func TestUpdateTask(t *testing.T) {
 	var (
-		g, _ = mockG.Next()
-		task = &pbTask.Task{
-			Id:     g.String(),
-			Name:   "test-name",
-			Status: 1}
-		data, _ = json.Marshal(task)
-		key     = fmt.Sprintf("%s:%s", TaskID, g.String())
-		req     = &pbTask.UpdateTaskRequest{
-			Id:         g.String(),
-			Task:       task,
-			UpdateMask: &fieldmaskpb.FieldMask{},
+		task = createTask(t, "test-name")
+		req  = &pbTask.UpdateTaskRequest{
+			Id: task.Id,
+			Task: &pbTask.Task{
+				Name:   "update-test-name",
+				Status: 0,
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
 		}
 	)
-	req.Task.Name = "update-test-name"
-	req.UpdateMask.Paths = append(req.UpdateMask.Paths, "task.name")
-	updateData, _ := json.Marshal(req.Task)
-	rmock.ExpectGet(key).SetVal(string(data))
-	rmock.ExpectSet(key, updateData, -1).SetVal("OK")
-	resp, err := service.UpdateTask(context.Background(), req)
+
+	resp, err := service.UpdateTask(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "update-test-name", resp.Name)
+	// status is not in the mask
+	assert.Equal(t, task.Status, resp.Status)
+
+	stored, _ := repo.Get(ctx, task.Id)
+	assert.Equal(t, resp, stored)
+}
+
+func TestUpdateTaskEtag(t *testing.T) {
+	var (
+		task = createTask(t, "test-name")
+		req  = &pbTask.UpdateTaskRequest{
+			Id:         task.Id,
+			Task:       &pbTask.Task{Name: "update-test-name"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+			Etag:       "99",
+		}
+	)
+
+	_, err := service.UpdateTask(ctx, req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	req.Etag = task.Etag
+	resp, err := service.UpdateTask(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", resp.Etag)
+
+	// If-Match: W/"1" is stale now
+	req.Etag = ""
+	md := metadata.Pairs(GatewayIfMatch, `W/"1"`)
+	_, err = service.UpdateTask(metadata.NewIncomingContext(ctx, md), req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	md = metadata.Pairs(GatewayIfMatch, AnyEtag)
+	resp, err = service.UpdateTask(metadata.NewIncomingContext(ctx, md), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", resp.Etag)
+}
+
+func TestUpdateTaskEmptyMask(t *testing.T) {
+	var (
+		task = createTask(t, "test-name")
+		req  = &pbTask.UpdateTaskRequest{
+			Id:   task.Id,
+			Task: &pbTask.Task{Id: "ignored", Name: "replace-test-name", Status: 0},
+		}
+	)
+
+	resp, err := service.UpdateTask(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, task.Id, resp.Id)
+	assert.Equal(t, "replace-test-name", resp.Name)
+	// every mutable field is replaced
+	assert.Equal(t, pbTask.Status_STATUS_INCOMPLETE, resp.Status)
+
+	req.Task.Name = ""
+	_, err = service.UpdateTask(ctx, req)
+	assert.Contains(t, err.Error(), "name is empty")
+}
+
+func TestUpdateTaskInvalidMask(t *testing.T) {
+	task := createTask(t, "test-name")
+	for _, path := range []string{"task.name", "unknown", "id", "etag"} {
+		req := &pbTask.UpdateTaskRequest{
+			Id:         task.Id,
+			Task:       &pbTask.Task{Name: "update-test-name"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", path}},
+		}
+		_, err := service.UpdateTask(ctx, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), path)
+		assert.Contains(t, err.Error(), "update mask invalid")
+	}
+
+	stored, _ := repo.Get(ctx, task.Id)
+	assert.Equal(t, task, stored)
+}
+
+func TestUpdateTaskConcurrent(t *testing.T) {
+	var (
+		task = createTask(t, "test-name")
+		// the first write loses the race against another replica
+		racing = newTestService(withRepo(&racingRepository{TaskRepository: repo, races: 1}))
+		req    = &pbTask.UpdateTaskRequest{
+			Id:         task.Id,
+			Task:       &pbTask.Task{Name: "update-test-name"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+		}
+	)
+
+	resp, err := racing.UpdateTask(ctx, req)
 	assert.Nil(t, err)
-	assert.Equal(t, req.Task, resp)
+	assert.Equal(t, "update-test-name", resp.Name)
+
+	// every write loses
+	racing = newTestService(withRepo(&racingRepository{TaskRepository: repo, races: updateAttempts}))
+	_, err = racing.UpdateTask(ctx, req)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	// the caller asked for a version which was replaced in between
+	racing = newTestService(withRepo(&racingRepository{TaskRepository: repo, races: 1}))
+	req.Etag = resp.Etag
+	_, err = racing.UpdateTask(ctx, req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
 }
 
 func TestUpdateTaskEmptyId(t *testing.T) {
-	_, err := service.UpdateTask(context.Background(), &pbTask.UpdateTaskRequest{})
+	_, err := service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{})
 	assert.Contains(t, err.Error(), "id is empty")
 }
 
 func TestUpdateTaskEmptyTask(t *testing.T) {
 	g, _ := mockG.Next()
-	_, err := service.UpdateTask(context.Background(), &pbTask.UpdateTaskRequest{Id: g.String()})
+	_, err := service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{Id: g.String()})
 	assert.Contains(t, err.Error(), "task is empty")
 }
 
 func TestUpdateTaskNotFound(t *testing.T) {
 	var (
 		g, _ = mockG.Next()
-		task = &pbTask.Task{
-			Id:     g.String(),
-			Name:   "test-name",
-			Status: 1}
-		req = &pbTask.UpdateTaskRequest{
+		req  = &pbTask.UpdateTaskRequest{
 			Id:         g.String(),
-			Task:       task,
+			Task:       &pbTask.Task{Name: "test-name", Status: 1},
 			UpdateMask: &fieldmaskpb.FieldMask{},
 		}
-		key = fmt.Sprintf("%s:%s", TaskID, g.String())
 	)
 
-	rmock.ExpectGet(key).RedisNil()
-
-	_, err := service.UpdateTask(context.Background(), req)
+	_, err := service.UpdateTask(ctx, req)
 	assert.Contains(t, err.Error(), "task not found")
 }
 
 func TestUpdateTaskInvalidStatus(t *testing.T) {
 	var (
-		req = &pbTask.UpdateTaskRequest{Id: "test-id", Task: &pbTask.Task{Status: 3}}
+		req = &pbTask.UpdateTaskRequest{Id: "test-id", Task: &pbTask.Task{Status: 9}}
 	)
 
-	_, err := service.UpdateTask(context.Background(), req)
+	_, err := service.UpdateTask(ctx, req)
 	assert.Contains(t, err.Error(), "status invalid")
 }
 
+func TestUpdateTaskDetails(t *testing.T) {
+	created, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "test-name"})
+	assert.Nil(t, err)
+	assert.Nil(t, created.CompleteTime)
+
+	resp, err := service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id:         created.Id,
+		Task:       &pbTask.Task{Status: 1, Priority: pbTask.Priority_PRIORITY_LOW, Labels: map[string]string{"team": "core"}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"status", "priority", "labels"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, pbTask.Priority_PRIORITY_LOW, resp.Priority)
+	assert.Equal(t, map[string]string{"team": "core"}, resp.Labels)
+	assert.Equal(t, created.CreateTime.AsTime(), resp.CreateTime.AsTime())
+	assert.False(t, resp.UpdateTime.AsTime().Before(created.UpdateTime.AsTime()))
+	assert.NotNil(t, resp.CompleteTime)
+
+	// complete_time is kept while the task stays complete and cleared when it is reopened
+	completed := resp.CompleteTime.AsTime()
+	resp, err = service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id:         created.Id,
+		Task:       &pbTask.Task{Description: "details"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"description"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, completed, resp.CompleteTime.AsTime())
+
+	resp, err = service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id:         created.Id,
+		Task:       &pbTask.Task{Status: 0},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"status"}},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.CompleteTime)
+}
+
+func TestUpdateTaskOutputOnly(t *testing.T) {
+	task := createTask(t, "test-name")
+
+	for _, path := range []string{"create_time", "update_time", "complete_time"} {
+		_, err := service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+			Id:         task.Id,
+			Task:       &pbTask.Task{CreateTime: timestamppb.Now()},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{path}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), path)
+	}
+}
+
 func TestGetTaskList(t *testing.T) {
 	var (
-		keys    = []string{"1", "2", "3"}
+		list    = newTestService()
 		expects = make([]*pbTask.Task, 3)
 	)
-	rmock.ExpectZRangeArgs(redis.ZRangeArgs{
-		Key:    SortSet,
-		ByLex:  true,
-		Start:  "-",
-		Stop:   "+",
-		Offset: 0,
-		Count:  30,
-	}).SetVal(keys)
-
-	for i, val := range keys {
-		task := &pbTask.Task{
-			Id:     val,
-			Name:   fmt.Sprintf("test-%d", i),
-			Status: 1,
-		}
-		data, _ := json.Marshal(task)
+	for i := range expects {
+		task, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: fmt.Sprintf("test-%d", i), Status: 1})
+		assert.Nil(t, err)
 		expects[i] = task
-		rmock.ExpectGet(fmt.Sprintf("%s:%s", TaskID, val)).SetVal(string(data))
 	}
 
-	resp, err := service.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageSize: 30})
+	resp, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageSize: 30})
 	assert.Nil(t, err)
-	for i, expect := range expects {
-		assert.Equal(t, expect, resp.Tasks[i])
-	}
+	assert.Equal(t, expects, resp.Tasks)
+	assert.Empty(t, resp.NextToken)
 }
 
 func TestGetTaskListWithToken(t *testing.T) {
 	var (
-		token   = utils.NewPageToken("25", 25)
-		keys    = make([]string, 25)
-		expects = make([]*pbTask.Task, 25)
+		list    = newTestService()
+		expects = make([]*pbTask.Task, 60)
 	)
-	for i := 0; i < len(keys); i++ {
-		keys[i] = fmt.Sprintf("%d", i+26)
+	for i := range expects {
+		task, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: fmt.Sprintf("test-%d", i), Status: 1})
+		assert.Nil(t, err)
+		expects[i] = task
 	}
-	rmock.ExpectZRangeArgs(redis.ZRangeArgs{
-		Key:    SortSet,
-		ByLex:  true,
-		Start:  "(" + token.GetID(),
-		Stop:   "+",
-		Offset: 0,
-		Count:  25,
-	}).SetVal(keys)
-
-	for i, val := range keys {
-		task := &pbTask.Task{
-			Id:     val,
-			Name:   fmt.Sprintf("test-%d", i),
-			Status: 1,
+
+	resp, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, expects[:25], resp.Tasks)
+	assert.NotEmpty(t, resp.NextToken)
+
+	resp, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Equal(t, expects[25:50], resp.Tasks)
+	assert.NotEmpty(t, resp.NextToken)
+
+	resp, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Equal(t, expects[50:], resp.Tasks)
+	assert.Empty(t, resp.NextToken)
+}
+
+func TestGetTaskListFilter(t *testing.T) {
+	var (
+		list     = newTestService()
+		complete = []*pbTask.Task{}
+	)
+	for i := 0; i < 10; i++ {
+		task, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{
+			Name: fmt.Sprintf("report-%d", i), Status: pbTask.Status(i % 2)})
+		assert.Nil(t, err)
+		if task.Status == pbTask.Status_STATUS_COMPLETE {
+			complete = append(complete, task)
 		}
-		data, _ := json.Marshal(task)
-		expects[i] = task
-		rmock.ExpectGet(fmt.Sprintf("%s:%s", TaskID, val)).SetVal(string(data))
 	}
 
-	resp, err := service.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageToken: token.GetToken()})
+	resp, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{
+		Filter: "status = STATUS_COMPLETE", PageSize: 3})
 	assert.Nil(t, err)
-	for i, expect := range expects {
-		assert.Equal(t, expect, resp.Tasks[i])
+	assert.Equal(t, complete[:3], resp.Tasks)
+	assert.NotEmpty(t, resp.NextToken)
+
+	resp, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{
+		Filter: "status = STATUS_COMPLETE", PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Equal(t, complete[3:], resp.Tasks)
+	assert.Empty(t, resp.NextToken)
+
+	resp, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{Filter: `name : "REPORT-3"`})
+	assert.Nil(t, err)
+	assert.Equal(t, complete[1:2], resp.Tasks)
+}
+
+func TestGetTaskListOrder(t *testing.T) {
+	var (
+		list    = newTestService()
+		expects = make([]*pbTask.Task, 5)
+	)
+	for i := range expects {
+		task, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: fmt.Sprintf("test-%d", i)})
+		assert.Nil(t, err)
+		expects[len(expects)-1-i] = task
+	}
+
+	resp, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{OrderBy: "create_time desc", PageSize: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, expects[:3], resp.Tasks)
+
+	resp, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{OrderBy: "create_time desc", PageToken: resp.NextToken})
+	assert.Nil(t, err)
+	assert.Equal(t, expects[3:], resp.Tasks)
+}
+
+func TestGetTaskListTokenMismatch(t *testing.T) {
+	list := newTestService()
+	for i := 0; i < 3; i++ {
+		_, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: fmt.Sprintf("test-%d", i)})
+		assert.Nil(t, err)
+	}
+
+	resp, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{Filter: "name : test", PageSize: 1})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, resp.NextToken)
+
+	for _, req := range []*pbTask.GetTaskListRequest{
+		{PageToken: resp.NextToken},
+		{PageToken: resp.NextToken, Filter: "name : other"},
+		{PageToken: resp.NextToken, Filter: "name : test", OrderBy: "create_time desc"},
+	} {
+		_, err = list.GetTaskList(ctx, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
 	}
+}
+
+func TestGetTaskListInvalidFilter(t *testing.T) {
+	_, err := service.GetTaskList(ctx, &pbTask.GetTaskListRequest{Filter: "owner = me"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.GetTaskList(ctx, &pbTask.GetTaskListRequest{OrderBy: "name"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetTaskListInvalidToken(t *testing.T) {
+	list := newTestService()
+	for i := 0; i < 3; i++ {
+		_, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: fmt.Sprintf("test-%d", i)})
+		assert.Nil(t, err)
+	}
+	other, _ := utils.NewPageTokenSigner([]utils.SigningKey{{ID: "test", Secret: []byte("other")}}, time.Hour)
+	// the tokens expire in the same second they are signed
+	expired, _ := utils.NewPageTokenSigner([]utils.SigningKey{{ID: "test", Secret: []byte("secret")}}, time.Nanosecond)
+
+	for _, token := range []string{
+		"not-a-token",
+		// the unsigned token a client could craft
+		utils.NewPageToken("0", 1000000).GetToken(),
+		other.Sign(utils.NewPageToken("0", 1)),
+	} {
+		_, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageToken: token})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Contains(t, status.Convert(err).Message(), "page token invalid")
+	}
+
+	_, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageToken: expired.Sign(utils.NewPageToken("0", 1))})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "page token expired")
+}
+
+func TestGetTaskListPageSize(t *testing.T) {
+	list := newTestService()
+	for i := 0; i < int(MaxPageSize)+1; i++ {
+		_, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: fmt.Sprintf("test-%d", i)})
+		assert.Nil(t, err)
+	}
+
+	resp, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageSize: 1000000})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, int(MaxPageSize))
 	assert.NotEmpty(t, resp.NextToken)
+
+	_, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
 // mock
-type mockGenerator struct{}
+type mockGenerator struct {
+	mu  sync.Mutex
+	num *big.Int
+}
 
 func (m *mockGenerator) Next() (*big.Int, error) {
-	return num, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.num = new(big.Int).Add(m.num, big.NewInt(1))
+	return m.num, nil
+}
+
+// racingRepository - a repository whose first updates conflict with another writer
+type racingRepository struct {
+	repository.TaskRepository
+	races int
+}
+
+func (r *racingRepository) Update(ctx context.Context, task *pbTask.Task, etag string) error {
+	if r.races > 0 {
+		r.races--
+		return repository.ErrConflict
+	}
+	return r.TaskRepository.Update(ctx, task, etag)
+}
+
+func (r *racingRepository) BatchUpdate(ctx context.Context, tasks []*pbTask.Task, etags []string, atomic bool) ([]error, error) {
+	if r.races > 0 {
+		r.races--
+		errs := make([]error, len(tasks))
+		for i := range errs {
+			errs[i] = repository.ErrConflict
+		}
+		return errs, nil
+	}
+	return r.TaskRepository.BatchUpdate(ctx, tasks, etags, atomic)
+}
+
+// serviceOption - change a dependency of a service of a test
+type serviceOption func(service *taskService)
+
+// newTestService - a service of a test on a new in-memory repository with the default workflow
+// and without the optional dependencies, the options change them
+func newTestService(opts ...serviceOption) pbTask.TaskServiceServer {
+	service := NewTaskService(mockG, repository.NewMemoryRepository(), tokens, workflow.Default(),
+		TrashOptions{}, nil, nil, nil, logger).(*taskService)
+	for _, opt := range opts {
+		opt(service)
+	}
+	return service
+}
+
+func withRepo(repo repository.TaskRepository) serviceOption {
+	return func(service *taskService) { service.repo = repo }
+}
+
+func withGenerator(generator utils.Generator) serviceOption {
+	return func(service *taskService) { service.sequencer = generator }
+}
+
+func withSink(sink archive.Sink) serviceOption {
+	return func(service *taskService) { service.archive = sink }
+}
+
+func withReader(reader EventReader) serviceOption {
+	return func(service *taskService) { service.reader = reader }
+}
+
+func withWebhooks(store *webhook.Store) serviceOption {
+	return func(service *taskService) { service.webhooks = store }
+}
+
+type fixedGenerator struct {
+	num *big.Int
+}
+
+func (m *fixedGenerator) Next() (*big.Int, error) {
+	return m.num, nil
 }
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Tenant - the metadata key of the tenant of the request, forwarded from the X-Tenant header
+	// or the tenants/{tenant} path of the gateway
+	Tenant string = "x-tenant"
+	// ReasonTenantDenied - the ErrorInfo reason of a request for another tenant than the one of its identity
+	ReasonTenantDenied string = "TENANT_DENIED"
+)
+
+// TenantOptions - how the tenants of the requests are resolved and how many tasks they can store
+type TenantOptions struct {
+	// Required - reject the requests without a tenant instead of serving the default tenant
+	Required bool
+	// MaxTasks - how many tasks a tenant can store, 0 means no limit
+	MaxTasks int64
+	// Quotas - the tenants with another limit than MaxTasks, the default tenant is ""
+	Quotas map[string]int64
+}
+
+// Tenancy - resolve the tenant of every request, so the repository only sees the tasks of the tenant
+type Tenancy struct {
+	opts TenantOptions
+}
+
+// Resolve - get a context with the tenant of the request and its quota, the tenant of the identity
+// of an authenticated request is used when the request has none
+func (tenancy *Tenancy) Resolve(ctx context.Context) (context.Context, error) {
+	values := metadata.ValueFromIncomingContext(ctx, Tenant)
+	id := ""
+	for i, value := range values {
+		value = strings.TrimSpace(value)
+		if i > 0 && value != id {
+			return nil, helper.InvalidErr("tenant conflict", Tenant, value)
+		}
+		id = value
+	}
+	// an identity of a tenant can only use its tenant
+	if identity, ok := auth.IdentityOf(ctx); ok && identity.Tenant != "" {
+		if id != "" && id != identity.Tenant {
+			return nil, helper.PermissionDeniedErr("tenant not allowed", ReasonTenantDenied,
+				map[string]string{"tenant": id, "subject": identity.Subject})
+		}
+		id = identity.Tenant
+	}
+	if id == "" && tenancy.opts.Required {
+		return nil, helper.RequiredFieldErr("tenant is empty", Tenant)
+	}
+	if id != "" && !repository.ValidTenant(id) {
+		return nil, helper.InvalidErr("tenant invalid", Tenant, id)
+	}
+	max := tenancy.opts.MaxTasks
+	if quota, ok := tenancy.opts.Quotas[id]; ok {
+		max = quota
+	}
+	return repository.WithTenant(ctx, repository.Tenant{ID: id, MaxTasks: max}), nil
+}
+
+// UnaryInterceptor - resolve the tenant of a unary call
+func (tenancy *Tenancy) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := tenancy.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor - resolve the tenant of a streaming call
+func (tenancy *Tenancy) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := tenancy.Resolve(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &tenantStream{ServerStream: stream, ctx: ctx})
+}
+
+// tenantStream - a server stream whose context has the tenant
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *tenantStream) Context() context.Context {
+	return stream.ctx
+}
+
+// quotaErr - the error of a create over the task quota of the tenant of ctx
+func quotaErr(ctx context.Context) error {
+	tenant := repository.TenantOf(ctx)
+	return helper.ResourceExhaustedErr("task quota exceeded", "tenants/"+tenant.ID,
+		fmt.Sprintf("the tenant can store at most %d tasks", tenant.MaxTasks))
+}
+
+func NewTenancy(opts TenantOptions) *Tenancy {
+	return &Tenancy{opts: opts}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTenancyResolve(t *testing.T) {
+	tenancy := NewTenancy(TenantOptions{MaxTasks: 10, Quotas: map[string]int64{"acme": 2}})
+	resolved, err := tenancy.Resolve(metadata.NewIncomingContext(ctx, metadata.Pairs(Tenant, " acme ")))
+	assert.Nil(t, err)
+	assert.Equal(t, repository.Tenant{ID: "acme", MaxTasks: 2}, repository.TenantOf(resolved))
+	resolved, err = tenancy.Resolve(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, repository.Tenant{MaxTasks: 10}, repository.TenantOf(resolved))
+
+	for _, md := range []metadata.MD{
+		metadata.Pairs(Tenant, "Acme"),
+		metadata.Pairs(Tenant, "acme", Tenant, "globe"),
+	} {
+		_, err = tenancy.Resolve(metadata.NewIncomingContext(ctx, md))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	_, err = NewTenancy(TenantOptions{Required: true}).Resolve(ctx)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// an identity of a tenant can only use its tenant
+	bob := auth.WithIdentity(ctx, auth.Identity{Subject: "bob", Tenant: "acme", Method: auth.MethodAPIKey})
+	resolved, err = tenancy.Resolve(bob)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", repository.TenantOf(resolved).ID)
+	assert.Equal(t, "api-key:bob", actor(resolved))
+	_, err = tenancy.Resolve(metadata.NewIncomingContext(bob, metadata.Pairs(Tenant, "globe")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	errInfo, _ := status.Convert(err).Details()[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, ReasonTenantDenied, errInfo.GetReason())
+}
+
+func TestTenantIsolation(t *testing.T) {
+	var (
+		tenancy = NewTenancy(TenantOptions{Quotas: map[string]int64{"acme": 1}})
+		acme    = metadata.NewIncomingContext(ctx, metadata.Pairs(Tenant, "acme"))
+		call    = func(ctx context.Context, handler grpc.UnaryHandler) (interface{}, error) {
+			return tenancy.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		}
+	)
+	resp, err := call(acme, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "acme task"})
+	})
+	assert.Nil(t, err)
+	task := resp.(*pbTask.Task)
+
+	// the task is only seen in its tenant
+	_, err = service.GetTask(ctx, &pbTask.GetTaskRequest{Id: task.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: task.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	resp, err = call(acme, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return service.GetTaskList(ctx, &pbTask.GetTaskListRequest{})
+	})
+	assert.Nil(t, err)
+	assert.Len(t, resp.(*pbTask.GetTaskListResponse).Tasks, 1)
+	assert.Equal(t, task.Id, resp.(*pbTask.GetTaskListResponse).Tasks[0].Id)
+
+	// the tenant can not store more tasks than its quota
+	_, err = call(acme, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "over quota"})
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	failure, ok := status.Convert(err).Details()[0].(*errdetails.QuotaFailure)
+	assert.True(t, ok)
+	assert.Equal(t, "tenants/acme", failure.Violations[0].Subject)
+	resp, err = call(acme, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return service.BatchCreateTasks(ctx, &pbTask.BatchCreateTasksRequest{
+			Requests:            []*pbTask.CreateTaskRequest{{Name: "over quota"}},
+			AllowPartialSuccess: true,
+		})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.ResourceExhausted}, statusCodes(resp.(*pbTask.BatchCreateTasksResponse)))
+}
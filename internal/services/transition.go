@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Actor - the metadata key of who the caller says makes the request, forwarded from the X-Actor header by
+	// the gateway, it is only the claimed_actor of the transitions
+	Actor string = "x-actor"
+	// MaxReasonLength - the maximum number of characters of a transition reason
+	MaxReasonLength int = 1024
+	// MaxTransitions - how many of the latest status changes a task keeps
+	MaxTransitions int = 100
+)
+
+// TransitionTask - move a task to another status and record who did it and why
+func (service *taskService) TransitionTask(ctx context.Context, req *pbTask.TransitionTaskRequest) (*pbTask.Task, error) {
+	if helper.IsEmpty(req.GetId()) {
+		return nil, helper.RequiredFieldErr("id is empty", "id")
+	}
+	if _, ok := pbTask.Status_name[int32(req.Status)]; !ok {
+		return nil, helper.InvalidErr("status invalid", "status", req.Status)
+	}
+	if utf8.RuneCountInString(req.GetReason()) > MaxReasonLength {
+		return nil, helper.BadRequestErr("reason too long", "reason",
+			fmt.Sprintf("at most %d characters are allowed", MaxReasonLength))
+	}
+
+	return service.update(ctx, req.GetId(), requestEtag(ctx, req.GetEtag()), func(task *pbTask.Task) error {
+		before := task.Status
+		if before == req.Status {
+			return helper.FailedPreconditionErr("status transition not allowed", helper.TransitionViolation, task.Id,
+				fmt.Sprintf("task is already %s", before))
+		}
+		task.Status = req.Status
+		return service.prepare(ctx, task, before, req.GetReason())
+	})
+}
+
+// prepare - check an updated task which had the status before and set its output only fields
+func (service *taskService) prepare(ctx context.Context, task *pbTask.Task, before pbTask.Status, reason string) error {
+	if err := validateTask(task); err != nil {
+		return err
+	}
+	if !service.workflow.CanTransition(before, task.Status) {
+		return transitionErr(task.Id, before, task.Status, service.workflow.Next(before))
+	}
+	if task.Status == pbTask.Status_STATUS_COMPLETE && before != task.Status {
+		if err := service.checkBlockers(ctx, task); err != nil {
+			return err
+		}
+	}
+	stampTimes(task, &before)
+	if task.Status != before {
+		task.Transitions = append(task.Transitions, &pbTask.StatusTransition{
+			FromStatus:   before,
+			ToStatus:     task.Status,
+			Actor:        actor(ctx),
+			ClaimedActor: claimedActor(ctx),
+			Reason:       reason,
+			Time:         task.UpdateTime,
+		})
+		if n := len(task.Transitions); n > MaxTransitions {
+			task.Transitions = task.Transitions[n-MaxTransitions:]
+		}
+	}
+	return nil
+}
+
+// checkInitial - check if a task can be created with its status
+func (service *taskService) checkInitial(task *pbTask.Task) error {
+	if service.workflow.CanCreate(task.Status) {
+		return nil
+	}
+	return helper.FailedPreconditionErr("status not allowed", helper.TransitionViolation, "status",
+		fmt.Sprintf("a task can not be created as %s, allowed: %s", task.Status, statusNames(service.workflow.Initial())))
+}
+
+// actor - who makes the request, the principal of an authenticated call, empty if it is not authenticated
+func actor(ctx context.Context) string {
+	if identity, ok := auth.IdentityOf(ctx); ok {
+		return identity.Principal()
+	}
+	return ""
+}
+
+// claimedActor - who the caller says makes the request from the x-actor metadata, it is not verified
+func claimedActor(ctx context.Context) string {
+	if values := metadata.ValueFromIncomingContext(ctx, Actor); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+func transitionErr(id string, from pbTask.Status, to pbTask.Status, next []pbTask.Status) error {
+	description := fmt.Sprintf("%s is final and can not move to %s", from, to)
+	if len(next) > 0 {
+		description = fmt.Sprintf("%s can not move to %s, allowed: %s", from, to, statusNames(next))
+	}
+	return helper.FailedPreconditionErr("status transition not allowed", helper.TransitionViolation, id, description)
+}
+
+func statusNames(statuses []pbTask.Status) string {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = status.String()
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/auth"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// transitionViolation - the precondition failure of a status transition error
+func transitionViolation(t *testing.T, err error) *errdetails.PreconditionFailure_Violation {
+	return violation(t, err, helper.TransitionViolation)
+}
+
+func TestTransitionTask(t *testing.T) {
+	var (
+		task     = createTask(t, "test-name")
+		actorCtx = metadata.NewIncomingContext(auth.WithIdentity(ctx, auth.Identity{Subject: "alice", Method: auth.MethodJWT}),
+			metadata.Pairs(Actor, "someone"))
+	)
+
+	resp, err := service.TransitionTask(actorCtx, &pbTask.TransitionTaskRequest{
+		Id:     task.Id,
+		Status: pbTask.Status_STATUS_ARCHIVED,
+		Reason: "done last week",
+		Etag:   task.Etag,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, pbTask.Status_STATUS_ARCHIVED, resp.Status)
+	assert.Len(t, resp.Transitions, 1)
+	transition := resp.Transitions[0]
+	assert.Equal(t, pbTask.Status_STATUS_COMPLETE, transition.FromStatus)
+	assert.Equal(t, pbTask.Status_STATUS_ARCHIVED, transition.ToStatus)
+	// the actor is the authenticated principal, the x-actor metadata is only claimed
+	assert.Equal(t, "jwt:alice", transition.Actor)
+	assert.Equal(t, "someone", transition.ClaimedActor)
+	assert.Equal(t, "done last week", transition.Reason)
+	assert.Equal(t, resp.UpdateTime.AsTime(), transition.Time.AsTime())
+
+	stored, _ := repo.Get(ctx, task.Id)
+	assert.Equal(t, resp.Transitions[0].Reason, stored.Transitions[0].Reason)
+
+	// an archived task is final
+	_, err = service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: task.Id, Status: pbTask.Status_STATUS_INCOMPLETE})
+	violation := transitionViolation(t, err)
+	assert.Equal(t, task.Id, violation.Subject)
+	assert.Contains(t, violation.Description, "STATUS_ARCHIVED is final")
+
+	_, err = service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: task.Id, Status: pbTask.Status_STATUS_ARCHIVED})
+	assert.Contains(t, transitionViolation(t, err).Description, "already STATUS_ARCHIVED")
+}
+
+func TestTransitionTaskInvalid(t *testing.T) {
+	task := createTask(t, "test-name")
+
+	_, err := service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Status: 1})
+	assert.Contains(t, err.Error(), "id is empty")
+
+	_, err = service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: task.Id, Status: 9})
+	assert.Contains(t, err.Error(), "status invalid")
+
+	_, err = service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: "missing", Status: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = service.TransitionTask(ctx, &pbTask.TransitionTaskRequest{Id: task.Id, Status: 0, Etag: "0"})
+	assert.Contains(t, err.Error(), "etag mismatch")
+}
+
+func TestUpdateTaskTransition(t *testing.T) {
+	var (
+		task = createTask(t, "test-name")
+		mask = &fieldmaskpb.FieldMask{Paths: []string{"status"}}
+	)
+
+	// a complete task has to be reopened before it is blocked
+	_, err := service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id: task.Id, Task: &pbTask.Task{Status: pbTask.Status_STATUS_BLOCKED}, UpdateMask: mask})
+	violation := transitionViolation(t, err)
+	assert.Equal(t, "STATUS_COMPLETE can not move to STATUS_BLOCKED, allowed: STATUS_INCOMPLETE, STATUS_ARCHIVED",
+		violation.Description)
+
+	resp, err := service.UpdateTask(metadata.NewIncomingContext(ctx, metadata.Pairs(Actor, "alice")), &pbTask.UpdateTaskRequest{
+		Id: task.Id, Task: &pbTask.Task{Status: pbTask.Status_STATUS_INCOMPLETE}, UpdateMask: mask})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Transitions, 1)
+	assert.Empty(t, resp.Transitions[0].Actor)
+	assert.Equal(t, "alice", resp.Transitions[0].ClaimedActor)
+
+	// the transitions are output only
+	_, err = service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id: task.Id, Task: &pbTask.Task{}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"transitions"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateTaskInitialStatus(t *testing.T) {
+	_, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "test-name", Status: pbTask.Status_STATUS_ARCHIVED})
+	violation := transitionViolation(t, err)
+	assert.Equal(t, "status", violation.Subject)
+
+	resp, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "test-name", Status: pbTask.Status_STATUS_IN_PROGRESS})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Transitions)
+}
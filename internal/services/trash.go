@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// DefaultRetention - how long a deleted task can be undeleted when it is not configured
+	DefaultRetention time.Duration = 30 * 24 * time.Hour
+	// DefaultPurgeInterval - how often the expired tasks are purged when it is not configured
+	DefaultPurgeInterval time.Duration = time.Hour
+	// DefaultPurgeBatch - the maximum number of tasks purged at once when it is not configured
+	DefaultPurgeBatch int64 = 100
+)
+
+// TrashOptions - how long the deleted tasks are kept and how they are purged,
+// the zero values are the defaults
+type TrashOptions struct {
+	// Retention - how long a deleted task can be undeleted
+	Retention time.Duration
+	// PurgeInterval - how often the expired tasks are purged
+	PurgeInterval time.Duration
+	// PurgeBatch - the maximum number of tasks purged at once
+	PurgeBatch int64
+}
+
+func (opts TrashOptions) withDefaults() TrashOptions {
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+	if opts.PurgeInterval <= 0 {
+		opts.PurgeInterval = DefaultPurgeInterval
+	}
+	if opts.PurgeBatch <= 0 {
+		opts.PurgeBatch = DefaultPurgeBatch
+	}
+	return opts
+}
+
+// UndeleteTask - restore a deleted task from the trash before it expires
+func (service *taskService) UndeleteTask(ctx context.Context, req *pbTask.UndeleteTaskRequest) (*pbTask.Task, error) {
+	if helper.IsEmpty(req.GetId()) {
+		return nil, helper.RequiredFieldErr("id is empty", "id")
+	}
+
+	write := func(ctx context.Context, task *pbTask.Task, etag string) error {
+		err := service.repo.Undelete(ctx, task, etag)
+		if errors.Is(err, repository.ErrParentNotFound) {
+			return helper.FailedPreconditionErr("parent task is deleted", helper.SubtaskViolation, task.Id,
+				"undelete the parent task first")
+		}
+		return err
+	}
+	return service.modify(ctx, req.GetId(), requestEtag(ctx, req.GetEtag()), true, authz.Write, func(task *pbTask.Task) error {
+		if task.DeleteTime == nil {
+			return helper.AlreadyExistsErr("task is not deleted", "id", task.Id)
+		}
+		task.DeleteTime = nil
+		task.ExpireTime = nil
+		return nil
+	}, write)
+}
+
+// markDeleted - get the change which moves a task to the trash at now
+func (service *taskService) markDeleted(now time.Time) func(task *pbTask.Task) error {
+	return func(task *pbTask.Task) error {
+		task.DeleteTime = timestamppb.New(now)
+		task.ExpireTime = timestamppb.New(now.Add(service.trash.Retention))
+		return nil
+	}
+}
+
+// trashTask - write a task which is marked deleted, a task with subtasks is not deleted
+func (service *taskService) trashTask(ctx context.Context, task *pbTask.Task, etag string) error {
+	err := service.repo.Delete(ctx, task, etag)
+	if errors.Is(err, repository.ErrHasChildren) {
+		return hasChildrenErr(task.Id)
+	}
+	return err
+}
+
+// trashTree - write a task which is marked deleted with all of its subtasks which are not deleted,
+// they expire with the task and are deleted in one atomic batch. Nothing is deleted if the caller
+// can not delete one of the subtasks
+func (service *taskService) trashTree(ctx context.Context, task *pbTask.Task, etag string) error {
+	var (
+		tasks = []*pbTask.Task{}
+		etags = []string{}
+		queue = []string{task.Id}
+	)
+	for len(queue) > 0 {
+		children, err := service.repo.List(ctx, repository.ListOptions{Parent: queue[0]})
+		if err != nil {
+			return err
+		}
+		queue = queue[1:]
+		for _, child := range children {
+			if err = checkAccess(ctx, child, authz.Delete); err != nil {
+				return err
+			}
+			etags = append(etags, child.Etag)
+			child.DeleteTime, child.ExpireTime = task.DeleteTime, task.ExpireTime
+			tasks = append(tasks, child)
+			queue = append(queue, child.Id)
+		}
+	}
+	// a task is deleted after its subtasks, so the deepest ones go first
+	slices.Reverse(tasks)
+	slices.Reverse(etags)
+	tasks = append(tasks, task)
+	etags = append(etags, etag)
+
+	errs, err := service.repo.BatchDelete(ctx, tasks, etags, true)
+	if err != nil {
+		return err
+	}
+	last := len(errs) - 1
+	for _, err := range errs[:last] {
+		if err != nil {
+			return helper.AbortedErr("subtasks were modified concurrently, please try again")
+		}
+	}
+	if errors.Is(errs[last], repository.ErrHasChildren) {
+		return helper.AbortedErr("subtasks were modified concurrently, please try again")
+	}
+	return errs[last]
+}
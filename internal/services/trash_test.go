@@ -0,0 +1,136 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestUndeleteTask(t *testing.T) {
+	task := createTask(t, "test-name")
+	_, err := service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: task.Id})
+	assert.Nil(t, err)
+
+	// a deleted task can be read, but not changed
+	deleted, err := service.GetTask(ctx, &pbTask.GetTaskRequest{Id: task.Id})
+	assert.Nil(t, err)
+	assert.NotNil(t, deleted.DeleteTime)
+	_, err = service.UpdateTask(ctx, &pbTask.UpdateTaskRequest{
+		Id: task.Id, Task: &pbTask.Task{Name: "new"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{Id: task.Id, Etag: task.Etag})
+	assert.Contains(t, err.Error(), "etag mismatch")
+
+	resp, err := service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{Id: task.Id, Etag: deleted.Etag})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.DeleteTime)
+	assert.Nil(t, resp.ExpireTime)
+	assert.NotEqual(t, deleted.Etag, resp.Etag)
+
+	_, err = service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{Id: task.Id})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{})
+	assert.Contains(t, err.Error(), "id is empty")
+}
+
+func TestUndeleteTaskDeletedParent(t *testing.T) {
+	parent := createTask(t, "parent")
+	child, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "child", ParentId: parent.Id})
+	assert.Nil(t, err)
+	grandchild, err := service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "grandchild", ParentId: child.Id})
+	assert.Nil(t, err)
+
+	_, err = service.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: parent.Id, Force: true})
+	assert.Nil(t, err)
+	stored, err := repo.BatchGet(ctx, []string{parent.Id, child.Id, grandchild.Id})
+	assert.Nil(t, err)
+	for _, task := range stored {
+		assert.Equal(t, stored[0].ExpireTime.AsTime(), task.ExpireTime.AsTime())
+	}
+
+	// a deleted task can not get subtasks
+	_, err = service.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "child", ParentId: parent.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{Id: child.Id})
+	assert.Equal(t, child.Id, violation(t, err, helper.SubtaskViolation).Subject)
+
+	_, err = service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{Id: parent.Id})
+	assert.Nil(t, err)
+	_, err = service.UndeleteTask(ctx, &pbTask.UndeleteTaskRequest{Id: child.Id})
+	assert.Nil(t, err)
+
+	resp, err := service.ListTaskChildren(ctx, &pbTask.ListTaskChildrenRequest{Id: parent.Id})
+	assert.Nil(t, err)
+	assert.Len(t, resp.Tasks, 1)
+	assert.Equal(t, child.Id, resp.Tasks[0].Id)
+}
+
+func TestGetTaskListShowDeleted(t *testing.T) {
+	list := newTestService()
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		resp, err := list.CreateTask(ctx, &pbTask.CreateTaskRequest{Name: "task", Status: 1})
+		assert.Nil(t, err)
+		ids = append(ids, resp.Id)
+	}
+	_, err := list.DeleteTask(ctx, &pbTask.DeleteTaskRequest{Id: ids[0]})
+	assert.Nil(t, err)
+
+	resp, err := list.GetTaskList(ctx, &pbTask.GetTaskListRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, ids[1:], []string{resp.Tasks[0].Id, resp.Tasks[1].Id})
+
+	resp, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{ShowDeleted: true, PageSize: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, ids[:2], []string{resp.Tasks[0].Id, resp.Tasks[1].Id})
+	assert.NotNil(t, resp.Tasks[0].DeleteTime)
+
+	// the token of the trash listing does not page the tasks which are not deleted
+	_, err = list.GetTaskList(ctx, &pbTask.GetTaskListRequest{PageToken: resp.NextToken})
+	assert.Contains(t, err.Error(), "page token does not match")
+}
+
+func TestPurger(t *testing.T) {
+	var (
+		store  = repository.NewMemoryRepository()
+		purger = NewPurger(store, TrashOptions{PurgeBatch: 2}, logger)
+		now    = time.Now()
+	)
+	for i, expire := range []time.Duration{0, -3 * time.Hour, -2 * time.Hour, -time.Hour, time.Hour} {
+		g, _ := mockG.Next()
+		task := &pbTask.Task{Id: g.String(), Name: "task"}
+		assert.Nil(t, store.Create(ctx, task))
+		if i == 0 {
+			continue
+		}
+		task.DeleteTime = timestamppb.New(now.Add(expire - DefaultRetention))
+		task.ExpireTime = timestamppb.New(now.Add(expire))
+		assert.Nil(t, store.Delete(ctx, task, task.Etag))
+	}
+
+	// the expired tasks are purged in batches
+	purged, err := purger.Purge(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, purged)
+	left, err := store.List(ctx, repository.ListOptions{ShowDeleted: true})
+	assert.Nil(t, err)
+	assert.Len(t, left, 2)
+	assert.Nil(t, left[0].DeleteTime)
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), left[1].ExpireTime.AsTime().UnixMilli())
+
+	purged, err = purger.Purge(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// MaxDescriptionLength - the maximum number of characters of a description
+	MaxDescriptionLength int = 4096
+	// MaxLabels - the maximum number of labels of a task
+	MaxLabels int = 64
+	// MaxLabelLength - the maximum number of characters of a label key or value
+	MaxLabelLength int = 63
+	// MaxPrincipals - the maximum number of readers or writers of a task
+	MaxPrincipals int = 100
+	// MaxPrincipalLength - the maximum number of characters of a reader or writer
+	MaxPrincipalLength int = 256
+)
+
+var labelKey = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// validateTask - check the fields of a task which is going to be saved
+func validateTask(task *pbTask.Task) error {
+	if helper.IsEmpty(task.GetName()) {
+		return helper.RequiredFieldErr("name is empty", "name")
+	}
+	if _, ok := pbTask.Status_name[int32(task.Status)]; !ok {
+		return helper.InvalidErr("status invalid", "status", task.Status)
+	}
+	if utf8.RuneCountInString(task.GetDescription()) > MaxDescriptionLength {
+		return helper.BadRequestErr("description too long", "description",
+			fmt.Sprintf("at most %d characters are allowed", MaxDescriptionLength))
+	}
+	if _, ok := pbTask.Priority_name[int32(task.Priority)]; !ok {
+		return helper.InvalidErr("priority invalid", "priority", task.Priority)
+	}
+	if task.DueTime != nil {
+		if err := task.DueTime.CheckValid(); err != nil {
+			return helper.BadRequestErr("due time invalid", "due_time", err.Error())
+		}
+	}
+	if len(task.GetLabels()) > MaxLabels {
+		return helper.BadRequestErr("too many labels", "labels",
+			fmt.Sprintf("at most %d labels are allowed", MaxLabels))
+	}
+	for key, value := range task.GetLabels() {
+		if !labelKey.MatchString(key) || utf8.RuneCountInString(key) > MaxLabelLength {
+			return helper.BadRequestErr("label invalid", "labels", fmt.Sprintf(
+				"key '%s' must be 1 to %d lowercase letters, digits, - or _", key, MaxLabelLength))
+		}
+		if utf8.RuneCountInString(value) > MaxLabelLength {
+			return helper.BadRequestErr("label invalid", "labels", fmt.Sprintf(
+				"value of '%s' has more than %d characters", key, MaxLabelLength))
+		}
+	}
+	if err := validatePrincipals("readers", task.GetReaders()); err != nil {
+		return err
+	}
+	return validatePrincipals("writers", task.GetWriters())
+}
+
+// validatePrincipals - check the readers or the writers of a task
+func validatePrincipals(field string, principals []string) error {
+	if len(principals) > MaxPrincipals {
+		return helper.BadRequestErr("too many "+field, field,
+			fmt.Sprintf("at most %d %s are allowed", MaxPrincipals, field))
+	}
+	for _, principal := range principals {
+		if helper.IsEmpty(principal) || strings.TrimSpace(principal) != principal ||
+			utf8.RuneCountInString(principal) > MaxPrincipalLength {
+			return helper.BadRequestErr("principal invalid", field, fmt.Sprintf(
+				"'%s' must be 1 to %d characters without surrounding spaces", principal, MaxPrincipalLength))
+		}
+	}
+	return nil
+}
+
+// stampTimes - set the output only times of a task which had the status before,
+// a new task has no status before
+func stampTimes(task *pbTask.Task, before *pbTask.Status) {
+	now := timestamppb.Now()
+	if before == nil {
+		task.CreateTime = now
+	}
+	task.UpdateTime = now
+	switch {
+	case task.Status != pbTask.Status_STATUS_COMPLETE:
+		task.CompleteTime = nil
+	case before == nil || *before != pbTask.Status_STATUS_COMPLETE:
+		task.CompleteTime = now
+	}
+}
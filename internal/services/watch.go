@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/events"
+	"github.com/0x726f6f6b6965/task/internal/filter"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+)
+
+// EventReader - read the task events in order, e.g. events.Reader
+type EventReader interface {
+	// Resume - the position to read after, the latest event for an empty position
+	Resume(ctx context.Context, position string) (string, error)
+	// Read - the events after the position, no events when none is published in a while
+	Read(ctx context.Context, position string) ([]*pbTask.TaskEvent, error)
+}
+
+// WatchTasks - stream the task events of the tenant matching the filter of the tasks the caller can read
+// until the client disconnects. When a task the watch sent stops being readable, e.g. the caller is
+// removed from its readers, the watch sends a TYPE_DELETED event with only its id.
+// The resume token of a response is the id of its event, a progress response moves it past
+// the skipped events and keeps an idle connection alive
+func (service *taskService) WatchTasks(req *pbTask.WatchTasksRequest, stream pbTask.TaskService_WatchTasksServer) error {
+	if service.reader == nil {
+		return helper.UnimplementedErr("watch needs the redis storage")
+	}
+	match, err := filter.Parse(req.GetFilter())
+	if err != nil {
+		return helper.BadRequestErr("filter invalid", "filter", err.Error())
+	}
+
+	ctx := stream.Context()
+	tenant := repository.TenantOf(ctx).ID
+	accept := readable(ctx, match.Match)
+	allowed := authz.Readable(ctx)
+	// seen - the tasks the watch sent which were readable then, only kept for an authorized call
+	seen := map[string]bool{}
+	position, err := service.reader.Resume(ctx, req.GetResumeToken())
+	if err != nil {
+		if errors.Is(err, events.ErrInvalidPosition) {
+			return helper.InvalidErr("resume token invalid", "resume_token", req.GetResumeToken())
+		}
+		if errors.Is(err, events.ErrTrimmed) {
+			return helper.InvalidErr("resume token expired", "resume_token", req.GetResumeToken())
+		}
+		service.logger.Error("WatchTasks events resume error", zap.Error(err))
+		return helper.InternalErr("events read error")
+	}
+
+	for {
+		changes, err := service.reader.Read(ctx, position)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			service.logger.Error("WatchTasks events read error", zap.Error(err))
+			return helper.InternalErr("events read error")
+		}
+		sent := false
+		for _, event := range changes {
+			position = event.EventId
+			if event.Tenant != tenant || event.Task == nil {
+				continue
+			}
+			if !accept(event.Task) {
+				if !seen[event.TaskId] || allowed(event.Task) {
+					continue
+				}
+				delete(seen, event.TaskId)
+				event = revoked(event)
+			} else if allowed != nil {
+				seen[event.TaskId] = true
+			}
+			if err = stream.Send(&pbTask.WatchTasksResponse{Event: event, ResumeToken: position}); err != nil {
+				return err
+			}
+			sent = true
+		}
+		if !sent {
+			if err = stream.Send(&pbTask.WatchTasksResponse{ResumeToken: position}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// revoked - the event of a task which is no longer readable, a delete with only the id of the task
+func revoked(event *pbTask.TaskEvent) *pbTask.TaskEvent {
+	return &pbTask.TaskEvent{
+		EventId: event.EventId,
+		Type:    pbTask.TaskEvent_TYPE_DELETED,
+		TaskId:  event.TaskId,
+		Time:    event.Time,
+		Tenant:  event.Tenant,
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/events"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeReader - read the batches of events in turn, the watch is cancelled after the last one
+type fakeReader struct {
+	latest  string
+	batches [][]*pbTask.TaskEvent
+	reads   []string
+	cancel  context.CancelFunc
+}
+
+func (reader *fakeReader) Resume(ctx context.Context, position string) (string, error) {
+	switch position {
+	case "":
+		return reader.latest, nil
+	case "expired":
+		return "", events.ErrTrimmed
+	case "invalid":
+		return "", events.ErrInvalidPosition
+	}
+	return position, nil
+}
+
+func (reader *fakeReader) Read(ctx context.Context, position string) ([]*pbTask.TaskEvent, error) {
+	reader.reads = append(reader.reads, position)
+	if len(reader.batches) == 0 {
+		reader.cancel()
+		return nil, ctx.Err()
+	}
+	batch := reader.batches[0]
+	reader.batches = reader.batches[1:]
+	return batch, nil
+}
+
+// watchStream - collect the responses of a watch
+type watchStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses []*pbTask.WatchTasksResponse
+}
+
+func (stream *watchStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *watchStream) Send(resp *pbTask.WatchTasksResponse) error {
+	stream.responses = append(stream.responses, resp)
+	return nil
+}
+
+// watch - run a watch over the batches until they are read
+func watch(t *testing.T, req *pbTask.WatchTasksRequest, batches ...[]*pbTask.TaskEvent) (*watchStream, *fakeReader, error) {
+	return watchAs(t, context.Background(), req, batches...)
+}
+
+// watchAs - run a watch of the caller of parent over the batches until they are read
+func watchAs(t *testing.T, parent context.Context, req *pbTask.WatchTasksRequest, batches ...[]*pbTask.TaskEvent) (*watchStream, *fakeReader, error) {
+	ctx, cancel := context.WithCancel(parent)
+	t.Cleanup(cancel)
+	reader := &fakeReader{latest: "1-0", batches: batches, cancel: cancel}
+	stream := &watchStream{ctx: ctx}
+	watcher := newTestService(withReader(reader))
+	return stream, reader, watcher.WatchTasks(req, stream)
+}
+
+func TestWatchTasks(t *testing.T) {
+	event := func(id string, name string, status pbTask.Status) *pbTask.TaskEvent {
+		return &pbTask.TaskEvent{EventId: id, TaskId: name, Type: pbTask.TaskEvent_TYPE_UPDATED,
+			Task: &pbTask.Task{Id: name, Name: name, Status: status}}
+	}
+	stream, reader, err := watch(t, &pbTask.WatchTasksRequest{Filter: "status = STATUS_COMPLETE"},
+		[]*pbTask.TaskEvent{
+			event("2-0", "a", pbTask.Status_STATUS_COMPLETE),
+			event("3-0", "b", pbTask.Status_STATUS_INCOMPLETE),
+		},
+		// no events or only skipped ones move the resume token on a progress response
+		nil,
+		[]*pbTask.TaskEvent{event("4-0", "c", pbTask.Status_STATUS_IN_PROGRESS), {EventId: "5-0"}},
+		[]*pbTask.TaskEvent{event("6-0", "d", pbTask.Status_STATUS_COMPLETE)},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1-0", "3-0", "3-0", "5-0", "6-0"}, reader.reads)
+	resumeTokens := []string{}
+	names := []string{}
+	for _, resp := range stream.responses {
+		resumeTokens = append(resumeTokens, resp.ResumeToken)
+		names = append(names, resp.GetEvent().GetTaskId())
+	}
+	assert.Equal(t, []string{"2-0", "3-0", "5-0", "6-0"}, resumeTokens)
+	assert.Equal(t, []string{"a", "", "", "d"}, names)
+
+	// resume after a token
+	_, reader, err = watch(t, &pbTask.WatchTasksRequest{ResumeToken: "6-0"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"6-0"}, reader.reads)
+}
+
+func TestWatchTasksRevoked(t *testing.T) {
+	event := func(id string, task string, readers ...string) *pbTask.TaskEvent {
+		return &pbTask.TaskEvent{EventId: id, TaskId: task, Type: pbTask.TaskEvent_TYPE_UPDATED,
+			Task: &pbTask.Task{Id: task, Name: "secret", Owner: "jwt:alice", Readers: readers}}
+	}
+	stream, _, err := watchAs(t, as("bob", false), &pbTask.WatchTasksRequest{},
+		[]*pbTask.TaskEvent{
+			event("2-0", "a", "jwt:bob"),
+			// bob could never read b, so its changes are not sent at all
+			event("3-0", "b"),
+			event("4-0", "a"),
+			// a is only revoked once
+			event("5-0", "a"),
+			event("6-0", "b"),
+		},
+	)
+	assert.Nil(t, err)
+	assert.Len(t, stream.responses, 2)
+	assert.Equal(t, "secret", stream.responses[0].Event.Task.GetName())
+	revoked := stream.responses[1].Event
+	assert.Equal(t, pbTask.TaskEvent_TYPE_DELETED, revoked.Type)
+	assert.Equal(t, "a", revoked.TaskId)
+	assert.Nil(t, revoked.Task)
+	assert.Equal(t, "4-0", stream.responses[1].ResumeToken)
+}
+
+func TestWatchTasksInvalid(t *testing.T) {
+	for _, req := range []*pbTask.WatchTasksRequest{
+		{Filter: "status ="},
+		{ResumeToken: "invalid"},
+		{ResumeToken: "expired"},
+	} {
+		_, _, err := watch(t, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	// only the redis storage publishes the events
+	err := service.WatchTasks(&pbTask.WatchTasksRequest{}, &watchStream{ctx: ctx})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	"github.com/0x726f6f6b6965/task/internal/webhook"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CreateWebhook - subscribe a URL to the task events of the tenant which the caller can read,
+// the secret is only returned here
+func (service *taskService) CreateWebhook(ctx context.Context, req *pbTask.CreateWebhookRequest) (*pbTask.Webhook, error) {
+	if service.webhooks == nil {
+		return nil, helper.UnimplementedErr("webhooks need the redis storage")
+	}
+	if helper.IsEmpty(req.GetUrl()) {
+		return nil, helper.RequiredFieldErr("url is empty", "url")
+	}
+	target, err := url.Parse(req.GetUrl())
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, helper.InvalidErr("url invalid", "url", req.GetUrl())
+	}
+	types := []pbTask.TaskEvent_Type{}
+	seen := map[pbTask.TaskEvent_Type]bool{}
+	for _, eventType := range req.GetEventTypes() {
+		if _, ok := pbTask.TaskEvent_Type_name[int32(eventType)]; !ok || eventType == pbTask.TaskEvent_TYPE_UNSPECIFIED {
+			return nil, helper.InvalidErr("event type invalid", "event_types", eventType)
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			types = append(types, eventType)
+		}
+	}
+	secret := req.GetSecret()
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			service.logger.Error("CreateWebhook secret error", zap.Error(err))
+			return nil, helper.InternalErr("please try again later")
+		}
+		secret = hex.EncodeToString(key)
+	}
+	seq, _ := service.sequencer.Next()
+	id := seq.String()
+	if helper.IsEmpty(id) {
+		service.logger.Error("CreateWebhook attempt to create id error", zap.Any("request", req))
+		return nil, helper.InternalErr("please try again later")
+	}
+
+	hook := &pbTask.Webhook{
+		Id:         id,
+		Url:        req.GetUrl(),
+		EventTypes: types,
+		Secret:     secret,
+		CreateTime: timestamppb.Now(),
+		Tenant:     repository.TenantOf(ctx).ID,
+	}
+	if grant, ok := authz.GrantOf(ctx); ok {
+		// the deliveries are limited to the tasks the caller can read
+		hook.Grant = &pbTask.WebhookGrant{Subject: grant.Subject, Roles: grant.Roles, AllTasks: grant.AllTasks}
+	}
+	if err = service.webhooks.Create(ctx, hook); err != nil {
+		service.logger.Error("CreateWebhook storage error", zap.Error(err))
+		return nil, helper.InternalErr("storage error")
+	}
+	return hook, nil
+}
+
+// ListWebhooks - get every webhook of the tenant without its secret
+func (service *taskService) ListWebhooks(ctx context.Context, req *pbTask.ListWebhooksRequest) (*pbTask.ListWebhooksResponse, error) {
+	if service.webhooks == nil {
+		return nil, helper.UnimplementedErr("webhooks need the redis storage")
+	}
+	hooks, err := service.webhooks.List(ctx)
+	if err != nil {
+		service.logger.Error("ListWebhooks storage list error", zap.Error(err))
+		return nil, helper.InternalErr("storage list error")
+	}
+	tenant := repository.TenantOf(ctx).ID
+	owned := []*pbTask.Webhook{}
+	for _, hook := range hooks {
+		if hook.Tenant == tenant {
+			hook.Secret = ""
+			owned = append(owned, hook)
+		}
+	}
+	return &pbTask.ListWebhooksResponse{Webhooks: owned}, nil
+}
+
+// DeleteWebhook - unsubscribe a webhook with its delivery log and dead letters
+func (service *taskService) DeleteWebhook(ctx context.Context, req *pbTask.DeleteWebhookRequest) (*emptypb.Empty, error) {
+	if service.webhooks == nil {
+		return nil, helper.UnimplementedErr("webhooks need the redis storage")
+	}
+	if helper.IsEmpty(req.GetId()) {
+		return nil, helper.RequiredFieldErr("id is empty", "id")
+	}
+	if err := service.checkWebhook(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	if err := service.webhooks.Delete(ctx, req.GetId()); err != nil {
+		if errors.Is(err, webhook.ErrNotFound) {
+			return nil, helper.NotFoundErr("webhook not found", "id", req.GetId())
+		}
+		service.logger.Error("DeleteWebhook storage error", zap.Error(err))
+		return nil, helper.InternalErr("storage error")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ListWebhookDeliveries - get a page of the delivery attempts or the dead letters of a webhook, the newest first
+func (service *taskService) ListWebhookDeliveries(ctx context.Context, req *pbTask.ListWebhookDeliveriesRequest) (*pbTask.ListWebhookDeliveriesResponse, error) {
+	if service.webhooks == nil {
+		return nil, helper.UnimplementedErr("webhooks need the redis storage")
+	}
+	if helper.IsEmpty(req.GetId()) {
+		return nil, helper.RequiredFieldErr("id is empty", "id")
+	}
+	// a token only pages the list it was created for
+	query := "deliveries\x00" + req.GetId()
+	if req.GetDeadLetters() {
+		query += "\x00dead_letters"
+	}
+	cursor, size, err := service.pageCursor(req.PageSize, req.PageToken, query, "")
+	if err != nil {
+		return nil, err
+	}
+	if err = service.checkWebhook(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	deliveries, last, err := service.webhooks.Deliveries(ctx, req.GetId(), req.GetDeadLetters(), cursor, size)
+	if err != nil {
+		service.logger.Error("ListWebhookDeliveries storage list error", zap.Error(err))
+		return nil, helper.InternalErr("storage list error")
+	}
+	var next string
+	if int64(len(deliveries)) >= size {
+		next = service.nextToken(last, size, query, "")
+	}
+	return &pbTask.ListWebhookDeliveriesResponse{
+		Deliveries: deliveries,
+		NextToken:  next,
+	}, nil
+}
+
+// checkWebhook - check if the webhook exists in the tenant, the webhooks of the other tenants are not found
+func (service *taskService) checkWebhook(ctx context.Context, id string) error {
+	hook, err := service.webhooks.Get(ctx, id)
+	if errors.Is(err, webhook.ErrNotFound) || (err == nil && hook.Tenant != repository.TenantOf(ctx).ID) {
+		return helper.NotFoundErr("webhook not found", "id", id)
+	}
+	if err != nil {
+		service.logger.Error("Webhook storage get error", zap.Error(err))
+		return helper.InternalErr("storage get error")
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	"github.com/0x726f6f6b6965/task/internal/webhook"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWebhooks(t *testing.T) {
+	var (
+		server = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: server.Addr()})
+		hooks  = newTestService(withWebhooks(webhook.NewStore(client)))
+	)
+	defer client.Close()
+	hook, err := hooks.CreateWebhook(ctx, &pbTask.CreateWebhookRequest{
+		Url: "https://example.com/hook",
+		EventTypes: []pbTask.TaskEvent_Type{
+			pbTask.TaskEvent_TYPE_CREATED, pbTask.TaskEvent_TYPE_DELETED, pbTask.TaskEvent_TYPE_CREATED,
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, hook.Id)
+	assert.Len(t, hook.Secret, 64)
+	assert.Equal(t, []pbTask.TaskEvent_Type{pbTask.TaskEvent_TYPE_CREATED, pbTask.TaskEvent_TYPE_DELETED}, hook.EventTypes)
+	other, err := hooks.CreateWebhook(ctx, &pbTask.CreateWebhookRequest{Url: "http://localhost:8000", Secret: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", other.Secret)
+	assert.Nil(t, other.Grant)
+
+	// the webhook of an authorized call only gets the events of the tasks its creator can read
+	ops, err := hooks.CreateWebhook(as("carol", false, "ops"), &pbTask.CreateWebhookRequest{Url: "https://example.com/ops"})
+	assert.Nil(t, err)
+	assert.Equal(t, "jwt:carol", ops.Grant.Subject)
+	assert.Equal(t, []string{"ops"}, ops.Grant.Roles)
+	_, err = hooks.DeleteWebhook(ctx, &pbTask.DeleteWebhookRequest{Id: ops.Id})
+	assert.Nil(t, err)
+
+	list, err := hooks.ListWebhooks(ctx, &pbTask.ListWebhooksRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, list.Webhooks, 2)
+	assert.Equal(t, hook.Id, list.Webhooks[0].Id)
+	assert.Empty(t, list.Webhooks[0].Secret)
+
+	// the webhooks of a tenant are not seen by the others
+	acme := repository.WithTenant(ctx, repository.Tenant{ID: "acme"})
+	list, _ = hooks.ListWebhooks(acme, &pbTask.ListWebhooksRequest{})
+	assert.Empty(t, list.Webhooks)
+	_, err = hooks.DeleteWebhook(acme, &pbTask.DeleteWebhookRequest{Id: hook.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = hooks.ListWebhookDeliveries(acme, &pbTask.ListWebhookDeliveriesRequest{Id: hook.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err := hooks.ListWebhookDeliveries(ctx, &pbTask.ListWebhookDeliveriesRequest{Id: hook.Id, DeadLetters: true})
+	assert.Nil(t, err)
+	assert.Empty(t, resp.Deliveries)
+	assert.Empty(t, resp.NextToken)
+
+	_, err = hooks.DeleteWebhook(ctx, &pbTask.DeleteWebhookRequest{Id: hook.Id})
+	assert.Nil(t, err)
+	_, err = hooks.DeleteWebhook(ctx, &pbTask.DeleteWebhookRequest{Id: hook.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = hooks.ListWebhookDeliveries(ctx, &pbTask.ListWebhookDeliveriesRequest{Id: hook.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	for _, req := range []*pbTask.CreateWebhookRequest{
+		{},
+		{Url: "example.com/hook"},
+		{Url: "ftp://example.com/hook"},
+		{Url: "https://example.com", EventTypes: []pbTask.TaskEvent_Type{pbTask.TaskEvent_TYPE_UNSPECIFIED}},
+		{Url: "https://example.com", EventTypes: []pbTask.TaskEvent_Type{9}},
+	} {
+		_, err = hooks.CreateWebhook(ctx, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	// only the redis storage publishes the events
+	_, err = service.CreateWebhook(ctx, &pbTask.CreateWebhookRequest{Url: "https://example.com"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
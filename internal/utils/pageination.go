@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 )
 
 type PageToken interface {
@@ -13,10 +17,14 @@ type PageToken interface {
 	GetID() string
 	// GetSize - get page size
 	GetSize() int64
+	// GetQuery - get the hash of the filter and order the token belongs to
+	GetQuery() string
 	// SetID - set ID
 	SetID(id string)
 	// SetSize - set page size
 	SetSize(size int64)
+	// SetQuery - set the hash of the filter and order the token belongs to
+	SetQuery(filter string, orderBy string)
 }
 
 type token struct {
@@ -24,6 +32,8 @@ type token struct {
 	Id string `json:"id"`
 	// Size
 	Size int64 `json:"size"`
+	// Query - the hash of the filter and order
+	Query string `json:"query,omitempty"`
 }
 
 // GetID - get ID
@@ -36,6 +46,11 @@ func (t *token) GetSize() int64 {
 	return t.Size
 }
 
+// GetQuery - get the hash of the filter and order the token belongs to
+func (t *token) GetQuery() string {
+	return t.Query
+}
+
 // GetToken - encodes an token struct as a page token string.
 func (t *token) GetToken() string {
 	b, _ := json.Marshal(t)
@@ -53,6 +68,21 @@ func (t *token) SetSize(size int64) {
 	t.Size = size
 }
 
+// SetQuery - set the hash of the filter and order the token belongs to
+func (t *token) SetQuery(filter string, orderBy string) {
+	t.Query = QueryHash(filter, orderBy)
+}
+
+// QueryHash - get the hash of the filter and order of a list,
+// an empty filter and order have an empty hash
+func QueryHash(filter string, orderBy string) string {
+	if filter == "" && orderBy == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(filter + "\x00" + orderBy))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
 func NewPageToken(id string, size int64) PageToken {
 	return &token{Id: id, Size: size}
 }
@@ -69,3 +99,117 @@ func GetPageTokenByString(in string) (PageToken, error) {
 	}
 	return t, nil
 }
+
+const (
+	// tokenVersion - the version of the signed page token format
+	tokenVersion byte = 1
+	// DefaultTokenTTL - how long a page token is valid when it is not configured
+	DefaultTokenTTL = 24 * time.Hour
+)
+
+var (
+	// ErrTokenInvalid - the page token is malformed or its signature does not match
+	ErrTokenInvalid = errors.New("page token invalid")
+	// ErrTokenExpired - the page token is older than its ttl
+	ErrTokenExpired = errors.New("page token expired")
+)
+
+// SigningKey - a key signing the page tokens
+type SigningKey struct {
+	// ID - the key id written into the token to find the key when it is verified
+	ID string
+	// Secret - the HMAC secret
+	Secret []byte
+}
+
+type PageTokenSigner interface {
+	// Sign - encode a page token with a signature and an expiry
+	Sign(token PageToken) string
+	// Verify - decode a signed page token, it fails when the token is changed, unknown or expired
+	Verify(in string) (PageToken, error)
+}
+
+type signer struct {
+	keys map[string][]byte
+	// current - the key signing new tokens
+	current SigningKey
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// signedToken - the payload of a signed page token
+type signedToken struct {
+	token
+	// Expire - the unix time when the token expires
+	Expire int64 `json:"exp"`
+}
+
+// Sign - the token is version | len(key id) | key id | payload | HMAC-SHA256 in base64
+func (s *signer) Sign(t PageToken) string {
+	payload, _ := json.Marshal(signedToken{
+		token:  token{Id: t.GetID(), Size: t.GetSize(), Query: t.GetQuery()},
+		Expire: s.now().Add(s.ttl).Unix(),
+	})
+	b := make([]byte, 0, 2+len(s.current.ID)+len(payload)+sha256.Size)
+	b = append(b, tokenVersion, byte(len(s.current.ID)))
+	b = append(b, s.current.ID...)
+	b = append(b, payload...)
+	b = append(b, sign(s.current.Secret, b)...)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Verify - decode a signed page token
+func (s *signer) Verify(in string) (PageToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(in)
+	if err != nil || len(b) < 2+sha256.Size || b[0] != tokenVersion {
+		return nil, ErrTokenInvalid
+	}
+	body, mac := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	idLen := int(b[1])
+	if 2+idLen > len(body) {
+		return nil, ErrTokenInvalid
+	}
+	secret, ok := s.keys[string(body[2:2+idLen])]
+	if !ok || !hmac.Equal(mac, sign(secret, body)) {
+		return nil, ErrTokenInvalid
+	}
+	t := new(signedToken)
+	if err = json.Unmarshal(body[2+idLen:], t); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if s.now().Unix() >= t.Expire {
+		return nil, ErrTokenExpired
+	}
+	return &t.token, nil
+}
+
+func sign(secret []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// NewPageTokenSigner - the first key signs new tokens, the others are still verified
+// so the keys can be rotated without breaking the tokens in use.
+// A ttl of 0 is DefaultTokenTTL.
+func NewPageTokenSigner(keys []SigningKey, ttl time.Duration) (PageTokenSigner, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no page token signing key")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	s := &signer{
+		keys:    map[string][]byte{},
+		current: keys[0],
+		ttl:     ttl,
+		now:     time.Now,
+	}
+	for _, key := range keys {
+		if len(key.ID) > 255 || len(key.Secret) == 0 {
+			return nil, fmt.Errorf("invalid page token signing key: %q", key.ID)
+		}
+		s.keys[key.ID] = key.Secret
+	}
+	return s, nil
+}
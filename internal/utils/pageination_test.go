@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -25,3 +28,71 @@ func TestSetToken(t *testing.T) {
 	assert.NotEqual(t, "test-id", token.GetID())
 	assert.NotEqual(t, 225, token.GetSize())
 }
+
+func TestTokenQuery(t *testing.T) {
+	token := NewPageToken("test-id", 225)
+	assert.Equal(t, "", token.GetQuery())
+
+	token.SetQuery("status = STATUS_COMPLETE", "create_time desc")
+	newToken, err := GetPageTokenByString(token.GetToken())
+	assert.Nil(t, err)
+	assert.Equal(t, QueryHash("status = STATUS_COMPLETE", "create_time desc"), newToken.GetQuery())
+	assert.NotEqual(t, QueryHash("status = STATUS_COMPLETE", ""), newToken.GetQuery())
+}
+
+func TestSignToken(t *testing.T) {
+	keys := []SigningKey{{ID: "new", Secret: []byte("new-secret")}, {ID: "old", Secret: []byte("old-secret")}}
+	s, err := NewPageTokenSigner(keys, time.Hour)
+	assert.Nil(t, err)
+
+	token := NewPageToken("test-id", 25)
+	token.SetQuery("name : a", "")
+	newToken, err := s.Verify(s.Sign(token))
+	assert.Nil(t, err)
+	assert.Equal(t, token.GetID(), newToken.GetID())
+	assert.Equal(t, token.GetSize(), newToken.GetSize())
+	assert.Equal(t, token.GetQuery(), newToken.GetQuery())
+
+	// the unsigned tokens are rejected
+	_, err = s.Verify(token.GetToken())
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	_, err = s.Verify("")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestSignTokenTampered(t *testing.T) {
+	s, _ := NewPageTokenSigner([]SigningKey{{ID: "k", Secret: []byte("secret")}}, time.Hour)
+	b, _ := base64.RawURLEncoding.DecodeString(s.Sign(NewPageToken("test-id", 25)))
+	b[len(b)-sha256.Size-2] ^= 1
+	_, err := s.Verify(base64.RawURLEncoding.EncodeToString(b))
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestSignTokenRotation(t *testing.T) {
+	old, _ := NewPageTokenSigner([]SigningKey{{ID: "old", Secret: []byte("old-secret")}}, time.Hour)
+	rotated, _ := NewPageTokenSigner([]SigningKey{
+		{ID: "new", Secret: []byte("new-secret")}, {ID: "old", Secret: []byte("old-secret")}}, time.Hour)
+	removed, _ := NewPageTokenSigner([]SigningKey{{ID: "new", Secret: []byte("new-secret")}}, time.Hour)
+
+	signed := old.Sign(NewPageToken("test-id", 25))
+	_, err := rotated.Verify(signed)
+	assert.Nil(t, err)
+	_, err = removed.Verify(signed)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestSignTokenExpired(t *testing.T) {
+	s, _ := NewPageTokenSigner([]SigningKey{{ID: "k", Secret: []byte("secret")}}, time.Minute)
+	signed := s.Sign(NewPageToken("test-id", 25))
+
+	s.(*signer).now = func() time.Time { return time.Now().Add(time.Hour) }
+	_, err := s.Verify(signed)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestNewPageTokenSignerInvalid(t *testing.T) {
+	_, err := NewPageTokenSigner(nil, 0)
+	assert.Error(t, err)
+	_, err = NewPageTokenSigner([]SigningKey{{ID: "k"}}, 0)
+	assert.Error(t, err)
+}
@@ -87,3 +87,13 @@ func (g *generator) Next() (*big.Int, error) {
 	num.SetUint64(result)
 	return num, nil
 }
+
+// GetTimeByID - get the time when the sequence was generated
+func GetTimeByID(id string) (time.Time, error) {
+	num, ok := new(big.Int).SetString(id, 10)
+	if !ok || num.Sign() < 0 || num.BitLen() > 64 {
+		return time.Time{}, fmt.Errorf("invalid id: %s", id)
+	}
+	millis := num.Uint64()>>shiftEpoch + baseEpoch
+	return time.UnixMilli(int64(millis)), nil
+}
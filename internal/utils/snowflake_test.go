@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestNextMonotonic(t *testing.T) {
@@ -69,3 +70,22 @@ func BenchmarkCall(b *testing.B) {
 		show[v] = true
 	}
 }
+
+func TestGetTimeByID(t *testing.T) {
+	gen, _ := NewGenerator(10)
+	before := time.Now().Truncate(time.Millisecond)
+	seq, _ := gen.Next()
+	after := time.Now()
+
+	created, err := GetTimeByID(seq.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Before(before) || created.After(after) {
+		t.Fatal("bad time:", created, before, after)
+	}
+
+	if _, err = GetTimeByID("abc"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
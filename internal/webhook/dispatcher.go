@@ -0,0 +1,319 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/authz"
+	"github.com/0x726f6f6b6965/task/internal/events"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// SignatureHeader - the header of the signature of a delivery, t=<unix seconds>,v1=<hex HMAC-SHA256>
+	SignatureHeader string = "X-Webhook-Signature"
+	// DeliveryHeader - the header of the delivery id, the same for every attempt
+	DeliveryHeader string = "X-Webhook-Delivery"
+	// EventHeader - the header of the event type, e.g. TYPE_CREATED
+	EventHeader string = "X-Webhook-Event"
+	// Group - the consumer group of the dispatchers on the event stream
+	Group string = "webhooks"
+	// DefaultMaxAttempts - how many times a delivery is tried when it is not configured
+	DefaultMaxAttempts int32 = 8
+	// DefaultBackoff - the wait before the first retry when it is not configured
+	DefaultBackoff time.Duration = 10 * time.Second
+	// DefaultMaxBackoff - the longest wait between the retries when it is not configured
+	DefaultMaxBackoff time.Duration = time.Hour
+	// DefaultTimeout - the timeout of a delivery request when it is not configured
+	DefaultTimeout time.Duration = 10 * time.Second
+	// DefaultInterval - how often the due deliveries are sent when it is not configured
+	DefaultInterval time.Duration = time.Second
+	// DefaultBatch - the maximum number of deliveries sent at once when it is not configured
+	DefaultBatch int64 = 50
+)
+
+// Options - the retries of a dispatcher, the zero values are the defaults
+type Options struct {
+	// Consumer - the name of the dispatcher in the consumer group, unique for every instance
+	Consumer string
+	// Start - where the group starts when it is created, events.StartNew by default
+	Start string
+	// MaxAttempts - how many times a delivery is tried before it is moved to the dead letters
+	MaxAttempts int32
+	// Backoff - the wait before the first retry, it doubles with every retry
+	Backoff time.Duration
+	// MaxBackoff - the longest wait between the retries
+	MaxBackoff time.Duration
+	// Timeout - the timeout of a delivery request
+	Timeout time.Duration
+	// Interval - how often the due deliveries are sent
+	Interval time.Duration
+	// Batch - the maximum number of deliveries sent at once
+	Batch int64
+	// Block - how long a read of the event stream waits for new events
+	Block time.Duration
+}
+
+func (opts Options) withDefaults() Options {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = DefaultBatch
+	}
+	return opts
+}
+
+// Dispatcher - queue a delivery for every webhook subscribed to a task event and post the due deliveries.
+// The dispatchers of the instances share the events and the queue, a delivery is sent at least once
+type Dispatcher struct {
+	store      *Store
+	subscriber *events.Subscriber
+	client     *http.Client
+	opts       Options
+	logger     *zap.Logger
+	now        func() time.Time
+}
+
+// Run - consume the events and send the due deliveries every interval until ctx is done
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := dispatcher.subscriber.Run(ctx, dispatcher.Enqueue); err != nil {
+			dispatcher.logger.Error("Dispatcher subscribe error", zap.Error(err))
+		}
+	}()
+	ticker := time.NewTicker(dispatcher.opts.Interval)
+	defer ticker.Stop()
+	for {
+		dispatcher.Deliver(ctx)
+		select {
+		case <-ctx.Done():
+			<-done
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Enqueue - queue a delivery of the event for every webhook of its tenant subscribed to its type
+// whose creator can read the task
+func (dispatcher *Dispatcher) Enqueue(ctx context.Context, event *pbTask.TaskEvent) error {
+	hooks, err := dispatcher.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	deliveries := []*pbTask.WebhookDelivery{}
+	for _, hook := range hooks {
+		if hook.Tenant != event.Tenant || !subscribed(hook, event.Type) || !readable(hook, event) {
+			continue
+		}
+		deliveries = append(deliveries, &pbTask.WebhookDelivery{
+			DeliveryId: deliveryID(hook.Id, event.EventId),
+			WebhookId:  hook.Id,
+			Event:      event,
+		})
+	}
+	return dispatcher.store.enqueue(ctx, deliveries, dispatcher.now())
+}
+
+// Deliver - send the due deliveries at once, a failed one is due again after the backoff of its attempt
+// or moved to the dead letters after the last attempt. It returns the number of succeeded deliveries
+func (dispatcher *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	// a claimed delivery is due again if its dispatcher stops before it is finished
+	lease := 2 * dispatcher.opts.Timeout
+	deliveries, err := dispatcher.store.claim(ctx, dispatcher.now(), lease, dispatcher.opts.Batch)
+	if err != nil {
+		dispatcher.logger.Error("Dispatcher claim error", zap.Error(err))
+		return 0, err
+	}
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded = 0
+	)
+	for _, delivery := range deliveries {
+		delivery := delivery
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if dispatcher.deliver(ctx, delivery) {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return succeeded, nil
+}
+
+// deliver - post a delivery and record the attempt, it returns true if the receiver accepted it
+func (dispatcher *Dispatcher) deliver(ctx context.Context, delivery *pbTask.WebhookDelivery) bool {
+	hook, err := dispatcher.store.Get(ctx, delivery.WebhookId)
+	if errors.Is(err, ErrNotFound) {
+		// the webhook is deleted, the delivery is dropped
+		delivery.State = pbTask.WebhookDelivery_STATE_DEAD
+		if err = dispatcher.store.finish(ctx, delivery, time.Time{}); err != nil {
+			dispatcher.logger.Error("Dispatcher finish error", zap.String("id", delivery.DeliveryId), zap.Error(err))
+		}
+		return false
+	}
+	if err != nil {
+		dispatcher.logger.Error("Dispatcher get webhook error", zap.String("id", delivery.WebhookId), zap.Error(err))
+		return false
+	}
+
+	now := dispatcher.now()
+	delivery.Attempt++
+	delivery.Time = timestamppb.New(now)
+	delivery.StatusCode, err = dispatcher.post(ctx, hook, delivery, now)
+	delivery.Error = ""
+	retry := time.Time{}
+	switch {
+	case err == nil:
+		delivery.State = pbTask.WebhookDelivery_STATE_SUCCEEDED
+	case delivery.Attempt >= dispatcher.opts.MaxAttempts:
+		delivery.State = pbTask.WebhookDelivery_STATE_DEAD
+		delivery.Error = err.Error()
+	default:
+		delivery.State = pbTask.WebhookDelivery_STATE_FAILED
+		delivery.Error = err.Error()
+		retry = now.Add(dispatcher.backoff(delivery.Attempt))
+	}
+	if err != nil {
+		dispatcher.logger.Warn("Dispatcher delivery error", zap.String("id", delivery.DeliveryId),
+			zap.Int32("attempt", delivery.Attempt), zap.Error(err))
+	}
+	if err = dispatcher.store.finish(ctx, delivery, retry); err != nil {
+		dispatcher.logger.Error("Dispatcher finish error", zap.String("id", delivery.DeliveryId), zap.Error(err))
+	}
+	return delivery.State == pbTask.WebhookDelivery_STATE_SUCCEEDED
+}
+
+// post - post the event of a delivery signed with the secret of the webhook, a reply which is not 2xx fails.
+// It returns the status of the reply
+func (dispatcher *Dispatcher) post(ctx context.Context, hook *pbTask.Webhook, delivery *pbTask.WebhookDelivery, now time.Time) (int32, error) {
+	body, err := protojson.MarshalOptions{EmitUnpopulated: true, UseEnumNumbers: true}.Marshal(delivery.Event)
+	if err != nil {
+		return 0, fmt.Errorf("marshal event error: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, dispatcher.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("request error: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.DeliveryId)
+	req.Header.Set(EventHeader, delivery.Event.GetType().String())
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, now.Unix(), body))
+
+	resp, err := dispatcher.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post error: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return int32(resp.StatusCode), fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return int32(resp.StatusCode), nil
+}
+
+// backoff - the wait after an attempt, it doubles from Backoff up to MaxBackoff
+func (dispatcher *Dispatcher) backoff(attempt int32) time.Duration {
+	wait := dispatcher.opts.Backoff
+	for i := int32(1); i < attempt && wait < dispatcher.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > dispatcher.opts.MaxBackoff {
+		wait = dispatcher.opts.MaxBackoff
+	}
+	return wait
+}
+
+// subscribed - check if a webhook gets the events of the type
+func subscribed(hook *pbTask.Webhook, eventType pbTask.TaskEvent_Type) bool {
+	if len(hook.EventTypes) == 0 {
+		return true
+	}
+	for _, subscribedType := range hook.EventTypes {
+		if subscribedType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// readable - check if the creator of a webhook can read the task of the event,
+// a webhook without a grant was created by a call which was not authorized
+func readable(hook *pbTask.Webhook, event *pbTask.TaskEvent) bool {
+	grant := hook.GetGrant()
+	if grant == nil {
+		return true
+	}
+	return authz.Grant{Subject: grant.Subject, Roles: grant.Roles, AllTasks: grant.AllTasks}.Allows(event.GetTask(), authz.Read)
+}
+
+// Sign - the signature header of a body sent at the unix time, the HMAC-SHA256 of "<timestamp>.<body>".
+// A receiver computes it again with the secret and checks the timestamp is recent
+func Sign(secret string, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewDispatcher - create a dispatcher of the webhooks in the store, client is http.DefaultClient if it is nil
+func NewDispatcher(store *Store, client *http.Client, opts Options, logger *zap.Logger) (*Dispatcher, error) {
+	opts = opts.withDefaults()
+	subscriber, err := events.NewSubscriber(store.client, events.Options{
+		Group:    Group,
+		Consumer: opts.Consumer,
+		Start:    opts.Start,
+		Block:    opts.Block,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Dispatcher{
+		store:      store,
+		subscriber: subscriber,
+		client:     client,
+		opts:       opts,
+		logger:     logger,
+		now:        time.Now,
+	}, nil
+}
@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/events"
+	"github.com/0x726f6f6b6965/task/internal/repository"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// receiver - a webhook receiver checking the signatures, the paths starting with /fail reply 500
+type receiver struct {
+	mu     sync.Mutex
+	secret string
+	paths  []string
+	ids    []string
+}
+
+func (recv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	ts, _, _ := strings.Cut(strings.TrimPrefix(r.Header.Get(SignatureHeader), "t="), ",")
+	unix, _ := strconv.ParseInt(ts, 10, 64)
+	if r.Header.Get(SignatureHeader) != Sign(recv.secret, unix, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	recv.paths = append(recv.paths, r.URL.Path)
+	recv.ids = append(recv.ids, r.Header.Get(DeliveryHeader))
+	if strings.HasPrefix(r.URL.Path, "/fail") {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newDispatcher - a dispatcher on an in-process redis posting to a receiver
+func newDispatcher(t *testing.T, opts Options) (*Dispatcher, *receiver, *httptest.Server) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	recv := &receiver{secret: "secret"}
+	target := httptest.NewServer(recv)
+	t.Cleanup(target.Close)
+	opts.Consumer = "c"
+	dispatcher, err := NewDispatcher(NewStore(client), target.Client(), opts, zap.NewNop())
+	assert.Nil(t, err)
+	return dispatcher, recv, target
+}
+
+func TestDispatcher(t *testing.T) {
+	var (
+		ctx                      = context.Background()
+		dispatcher, recv, target = newDispatcher(t, Options{MaxAttempts: 2, Backoff: time.Minute})
+		store                    = dispatcher.store
+		now                      = time.Now()
+	)
+	dispatcher.now = func() time.Time { return now }
+	for _, hook := range []*pbTask.Webhook{
+		{Id: "1", Url: target.URL + "/all"},
+		{Id: "2", Url: target.URL + "/deleted", EventTypes: []pbTask.TaskEvent_Type{pbTask.TaskEvent_TYPE_DELETED}},
+		{Id: "3", Url: target.URL + "/fail"},
+	} {
+		hook.Secret = "secret"
+		assert.Nil(t, store.Create(ctx, hook))
+	}
+	created := &pbTask.TaskEvent{EventId: "1-0", Type: pbTask.TaskEvent_TYPE_CREATED, TaskId: "10"}
+	assert.Nil(t, dispatcher.Enqueue(ctx, created))
+	// a redelivered event is queued once
+	assert.Nil(t, dispatcher.Enqueue(ctx, created))
+
+	succeeded, err := dispatcher.Deliver(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, succeeded)
+	assert.ElementsMatch(t, []string{"/all", "/fail"}, recv.paths)
+	assert.ElementsMatch(t, []string{"1/1-0", "3/1-0"}, recv.ids)
+
+	// the failed delivery is due after the backoff
+	succeeded, _ = dispatcher.Deliver(ctx)
+	assert.Equal(t, 0, succeeded)
+	assert.Len(t, recv.paths, 2)
+	now = now.Add(time.Minute)
+	succeeded, _ = dispatcher.Deliver(ctx)
+	assert.Equal(t, 0, succeeded)
+	assert.Len(t, recv.paths, 3)
+
+	deliveries, _, err := store.Deliveries(ctx, "1", false, "", 10)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, pbTask.WebhookDelivery_STATE_SUCCEEDED, deliveries[0].State)
+	assert.Equal(t, int32(http.StatusNoContent), deliveries[0].StatusCode)
+	assert.Equal(t, "10", deliveries[0].Event.TaskId)
+
+	// the last attempt is dead-lettered
+	deliveries, cursor, _ := store.Deliveries(ctx, "3", false, "", 1)
+	assert.Equal(t, pbTask.WebhookDelivery_STATE_DEAD, deliveries[0].State)
+	assert.Equal(t, int32(2), deliveries[0].Attempt)
+	deliveries, _, _ = store.Deliveries(ctx, "3", false, cursor, 10)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, pbTask.WebhookDelivery_STATE_FAILED, deliveries[0].State)
+	assert.Equal(t, int32(http.StatusInternalServerError), deliveries[0].StatusCode)
+	assert.NotEmpty(t, deliveries[0].Error)
+	deliveries, _, _ = store.Deliveries(ctx, "3", true, "", 10)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, "3/1-0", deliveries[0].DeliveryId)
+
+	// the pending deliveries of a deleted webhook are dropped
+	assert.Nil(t, dispatcher.Enqueue(ctx, &pbTask.TaskEvent{EventId: "2-0", Type: pbTask.TaskEvent_TYPE_DELETED, TaskId: "10"}))
+	assert.Nil(t, store.Delete(ctx, "2"))
+	assert.ErrorIs(t, store.Delete(ctx, "2"), ErrNotFound)
+	succeeded, _ = dispatcher.Deliver(ctx)
+	assert.Equal(t, 1, succeeded)
+	assert.ElementsMatch(t, []string{"/all", "/fail"}, recv.paths[3:])
+	// only the retry of the failing webhook is pending
+	assert.Equal(t, []string{"3/2-0"}, store.client.HKeys(ctx, DeliveryHash).Val())
+	assert.Equal(t, []string{"3/2-0"}, store.client.ZRange(ctx, DeliveryQueue, 0, -1).Val())
+	assert.Equal(t, int64(0), store.client.Exists(ctx, LogKey("2")).Val())
+
+	hooks, err := store.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, hooks, 2)
+	assert.Equal(t, []string{"1", "3"}, []string{hooks[0].Id, hooks[1].Id})
+	_, err = store.Get(ctx, "2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDispatcherGrant(t *testing.T) {
+	var (
+		ctx                      = context.Background()
+		dispatcher, recv, target = newDispatcher(t, Options{})
+		store                    = dispatcher.store
+	)
+	for _, hook := range []*pbTask.Webhook{
+		{Id: "1", Url: target.URL + "/alice", Grant: &pbTask.WebhookGrant{Subject: "alice"}},
+		{Id: "2", Url: target.URL + "/ops", Grant: &pbTask.WebhookGrant{Subject: "carol", Roles: []string{"ops"}}},
+		{Id: "3", Url: target.URL + "/admin", Grant: &pbTask.WebhookGrant{Subject: "root", AllTasks: true}},
+		{Id: "4", Url: target.URL + "/open"},
+	} {
+		hook.Secret = "secret"
+		assert.Nil(t, store.Create(ctx, hook))
+	}
+	// only the webhooks whose creators can read the task get its events
+	assert.Nil(t, dispatcher.Enqueue(ctx, &pbTask.TaskEvent{EventId: "1-0", Type: pbTask.TaskEvent_TYPE_CREATED, TaskId: "10",
+		Task: &pbTask.Task{Id: "10", Owner: "alice"}}))
+	assert.Nil(t, dispatcher.Enqueue(ctx, &pbTask.TaskEvent{EventId: "2-0", Type: pbTask.TaskEvent_TYPE_CREATED, TaskId: "11",
+		Task: &pbTask.Task{Id: "11", Owner: "bob", Readers: []string{"role:ops"}}}))
+	_, err := dispatcher.Deliver(ctx)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1/1-0", "3/1-0", "4/1-0", "2/2-0", "3/2-0", "4/2-0"}, recv.ids)
+}
+
+func TestDispatcherRun(t *testing.T) {
+	var (
+		ctx, cancel              = context.WithCancel(context.Background())
+		dispatcher, recv, target = newDispatcher(t, Options{Start: events.StartOldest,
+			Interval: 10 * time.Millisecond, Block: 10 * time.Millisecond})
+		repo = repository.NewRedisRepository(dispatcher.store.client, zap.NewNop())
+		done = make(chan struct{})
+	)
+	defer cancel()
+	assert.Nil(t, dispatcher.store.Create(ctx, &pbTask.Webhook{Id: "1", Url: target.URL + "/all", Secret: "secret"}))
+	assert.Nil(t, repo.Create(ctx, &pbTask.Task{Id: "10", Name: "a"}))
+	go func() {
+		defer close(done)
+		dispatcher.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		recv.mu.Lock()
+		n := len(recv.paths)
+		recv.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	assert.Equal(t, []string{"/all"}, recv.paths)
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{opts: Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+	waits := []time.Duration{}
+	for attempt := int32(1); attempt <= 4; attempt++ {
+		waits = append(waits, dispatcher.backoff(attempt))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}, waits)
+}
@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0x726f6f6b6965/task/internal/helper"
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// WebhookHash - the hash of the webhooks by id
+	WebhookHash string = "webhooks"
+	// DeliveryQueue - the sorted set of the pending delivery ids scored by when they are due in milliseconds
+	DeliveryQueue string = "webhookQueue"
+	// DeliveryHash - the hash of the pending deliveries by id
+	DeliveryHash string = "webhookDeliveries"
+	// LogStream - the prefix of the streams of the delivery attempts by webhook
+	LogStream string = "webhookLog"
+	// DeadStream - the prefix of the streams of the dead letters by webhook
+	DeadStream string = "webhookDead"
+	// LogMaxLen - about how many of the latest attempts the log of a webhook keeps
+	LogMaxLen int64 = 1000
+	// DeadMaxLen - about how many of the latest dead letters a webhook keeps
+	DeadMaxLen int64 = 10000
+)
+
+// ErrNotFound - the webhook does not exist
+var ErrNotFound = errors.New("webhook not found")
+
+// Store - the webhooks and their deliveries in redis
+type Store struct {
+	client *redis.Client
+}
+
+// LogKey - get the redis key of the delivery log of a webhook
+func LogKey(id string) string {
+	return fmt.Sprintf("%s:%s", LogStream, id)
+}
+
+// DeadKey - get the redis key of the dead letters of a webhook
+func DeadKey(id string) string {
+	return fmt.Sprintf("%s:%s", DeadStream, id)
+}
+
+// Create - save a webhook
+func (store *Store) Create(ctx context.Context, hook *pbTask.Webhook) error {
+	data, err := proto.Marshal(hook)
+	if err != nil {
+		return fmt.Errorf("marshal webhook error: %w", err)
+	}
+	if err = store.client.HSet(ctx, WebhookHash, hook.Id, data).Err(); err != nil {
+		return fmt.Errorf("redis hset error: %w", err)
+	}
+	return nil
+}
+
+// Get - get a webhook by id
+func (store *Store) Get(ctx context.Context, id string) (*pbTask.Webhook, error) {
+	data, err := store.client.HGet(ctx, WebhookHash, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis hget error: %w", err)
+	}
+	return unmarshalWebhook(data)
+}
+
+// List - get every webhook ordered by id
+func (store *Store) List(ctx context.Context) ([]*pbTask.Webhook, error) {
+	values, err := store.client.HGetAll(ctx, WebhookHash).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis hgetall error: %w", err)
+	}
+	hooks := make([]*pbTask.Webhook, 0, len(values))
+	for _, data := range values {
+		hook, err := unmarshalWebhook(data)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	// the ids are numbers of the generator
+	sort.Slice(hooks, func(i, j int) bool {
+		if len(hooks[i].Id) != len(hooks[j].Id) {
+			return len(hooks[i].Id) < len(hooks[j].Id)
+		}
+		return hooks[i].Id < hooks[j].Id
+	})
+	return hooks, nil
+}
+
+// Delete - remove a webhook with its delivery log and dead letters
+func (store *Store) Delete(ctx context.Context, id string) error {
+	err := store.client.Eval(ctx, helper.DeleteWebhook, []string{WebhookHash, LogKey(id), DeadKey(id)}, id).Err()
+	if err == nil || errors.Is(err, redis.Nil) {
+		return nil
+	}
+	// some servers prefix the replies of redis.error_reply with ERR
+	if strings.TrimPrefix(err.Error(), "ERR ") == "NOT_FOUND" {
+		return ErrNotFound
+	}
+	return fmt.Errorf("redis eval error: %w", err)
+}
+
+// Deliveries - get at most size attempts of a webhook or its dead letters before the cursor, the newest first.
+// It returns the cursor of the last one
+func (store *Store) Deliveries(ctx context.Context, id string, dead bool, cursor string, size int64) ([]*pbTask.WebhookDelivery, string, error) {
+	key := LogKey(id)
+	if dead {
+		key = DeadKey(id)
+	}
+	start := "+"
+	if cursor != "" {
+		start = "(" + cursor
+	}
+	messages, err := store.client.XRevRangeN(ctx, key, start, "-", size).Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("redis xrevrange error: %w", err)
+	}
+	deliveries := make([]*pbTask.WebhookDelivery, 0, len(messages))
+	for _, message := range messages {
+		data, _ := message.Values["delivery"].(string)
+		delivery, err := unmarshalDelivery(data)
+		if err != nil {
+			return nil, "", err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if len(messages) == 0 {
+		return deliveries, "", nil
+	}
+	return deliveries, messages[len(messages)-1].ID, nil
+}
+
+// enqueue - add the deliveries due now, the pending ones are kept
+func (store *Store) enqueue(ctx context.Context, deliveries []*pbTask.WebhookDelivery, now time.Time) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	args := []interface{}{now.UnixMilli()}
+	for _, delivery := range deliveries {
+		data, err := proto.Marshal(delivery)
+		if err != nil {
+			return fmt.Errorf("marshal delivery error: %w", err)
+		}
+		args = append(args, delivery.DeliveryId, data)
+	}
+	if err := store.client.Eval(ctx, helper.EnqueueDeliveries, []string{DeliveryQueue, DeliveryHash}, args...).Err(); err != nil &&
+		!errors.Is(err, redis.Nil) {
+		return fmt.Errorf("redis eval error: %w", err)
+	}
+	return nil
+}
+
+// claim - get at most n deliveries due now, they are not claimed again until now plus the lease
+func (store *Store) claim(ctx context.Context, now time.Time, lease time.Duration, n int64) ([]*pbTask.WebhookDelivery, error) {
+	values, err := store.client.Eval(ctx, helper.ClaimDeliveries, []string{DeliveryQueue, DeliveryHash},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), n).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis eval error: %w", err)
+	}
+	deliveries := make([]*pbTask.WebhookDelivery, 0, len(values))
+	for _, data := range values {
+		delivery, err := unmarshalDelivery(data)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// finish - log the attempt of a delivery by its state, a failed delivery is due again at retry
+func (store *Store) finish(ctx context.Context, delivery *pbTask.WebhookDelivery, retry time.Time) error {
+	data, err := proto.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("marshal delivery error: %w", err)
+	}
+	outcome := "done"
+	switch delivery.State {
+	case pbTask.WebhookDelivery_STATE_FAILED:
+		outcome = "retry"
+	case pbTask.WebhookDelivery_STATE_DEAD:
+		outcome = "dead"
+	}
+	err = store.client.Eval(ctx, helper.FinishDelivery,
+		[]string{DeliveryQueue, DeliveryHash, LogKey(delivery.WebhookId), DeadKey(delivery.WebhookId), WebhookHash},
+		delivery.DeliveryId, data, LogMaxLen, delivery.WebhookId, outcome, retry.UnixMilli(), DeadMaxLen).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("redis eval error: %w", err)
+	}
+	return nil
+}
+
+func unmarshalWebhook(data string) (*pbTask.Webhook, error) {
+	hook := &pbTask.Webhook{}
+	if err := proto.Unmarshal([]byte(data), hook); err != nil {
+		return nil, fmt.Errorf("unmarshal webhook error: %w", err)
+	}
+	return hook, nil
+}
+
+func unmarshalDelivery(data string) (*pbTask.WebhookDelivery, error) {
+	delivery := &pbTask.WebhookDelivery{}
+	if err := proto.Unmarshal([]byte(data), delivery); err != nil {
+		return nil, fmt.Errorf("unmarshal delivery error: %w", err)
+	}
+	return delivery, nil
+}
+
+// deliveryID - the id of the delivery of an event to a webhook, the same for a redelivered event
+func deliveryID(hookID string, eventID string) string {
+	return hookID + "/" + eventID
+}
+
+// NewStore - create a store of the webhooks in redis
+func NewStore(client *redis.Client) *Store {
+	return &Store{client: client}
+}
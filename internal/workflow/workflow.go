@@ -0,0 +1,123 @@
+package workflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+)
+
+// Workflow - the statuses a task can be created with and the moves between the statuses
+type Workflow interface {
+	// CanCreate - check if a task can be created with the status
+	CanCreate(status pbTask.Status) bool
+	// Initial - get the statuses a task can be created with
+	Initial() []pbTask.Status
+	// CanTransition - check if a task can move from a status to another, staying is always allowed
+	CanTransition(from pbTask.Status, to pbTask.Status) bool
+	// Next - get the statuses a task can move to from the status
+	Next(from pbTask.Status) []pbTask.Status
+}
+
+type workflow struct {
+	initial     map[pbTask.Status]bool
+	transitions map[pbTask.Status]map[pbTask.Status]bool
+}
+
+var (
+	// DefaultInitial - the statuses a task can be created with by default
+	DefaultInitial = []string{"INCOMPLETE", "IN_PROGRESS", "BLOCKED", "COMPLETE"}
+	// DefaultTransitions - the moves between the statuses by default,
+	// a finished task can be reopened or archived and an archived task is final
+	DefaultTransitions = map[string][]string{
+		"INCOMPLETE":  {"IN_PROGRESS", "BLOCKED", "COMPLETE", "CANCELLED"},
+		"IN_PROGRESS": {"INCOMPLETE", "BLOCKED", "COMPLETE", "CANCELLED"},
+		"BLOCKED":     {"INCOMPLETE", "IN_PROGRESS", "CANCELLED"},
+		"COMPLETE":    {"INCOMPLETE", "ARCHIVED"},
+		"CANCELLED":   {"INCOMPLETE", "ARCHIVED"},
+	}
+)
+
+// New - create a workflow, the statuses are the names of pbTask.Status with or without the STATUS_ prefix,
+// a status which is not in the transitions is final. Without both the default workflow is used.
+func New(initial []string, transitions map[string][]string) (Workflow, error) {
+	if len(initial) == 0 && len(transitions) == 0 {
+		initial, transitions = DefaultInitial, DefaultTransitions
+	}
+	if len(initial) == 0 {
+		return nil, fmt.Errorf("workflow has no initial status")
+	}
+	w := &workflow{
+		initial:     map[pbTask.Status]bool{},
+		transitions: map[pbTask.Status]map[pbTask.Status]bool{},
+	}
+	for _, name := range initial {
+		status, err := ParseStatus(name)
+		if err != nil {
+			return nil, err
+		}
+		w.initial[status] = true
+	}
+	for fromName, toNames := range transitions {
+		from, err := ParseStatus(fromName)
+		if err != nil {
+			return nil, err
+		}
+		if w.transitions[from] == nil {
+			w.transitions[from] = map[pbTask.Status]bool{}
+		}
+		for _, toName := range toNames {
+			to, err := ParseStatus(toName)
+			if err != nil {
+				return nil, err
+			}
+			w.transitions[from][to] = true
+		}
+	}
+	return w, nil
+}
+
+// Default - the default workflow
+func Default() Workflow {
+	w, _ := New(DefaultInitial, DefaultTransitions)
+	return w
+}
+
+// ParseStatus - get the status by its name, e.g. STATUS_IN_PROGRESS or IN_PROGRESS
+func ParseStatus(name string) (pbTask.Status, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "STATUS_") {
+		name = "STATUS_" + name
+	}
+	status, ok := pbTask.Status_value[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown status: %s", name)
+	}
+	return pbTask.Status(status), nil
+}
+
+func (w *workflow) CanCreate(status pbTask.Status) bool {
+	return w.initial[status]
+}
+
+func (w *workflow) Initial() []pbTask.Status {
+	return sorted(w.initial)
+}
+
+func (w *workflow) CanTransition(from pbTask.Status, to pbTask.Status) bool {
+	return from == to || w.transitions[from][to]
+}
+
+func (w *workflow) Next(from pbTask.Status) []pbTask.Status {
+	return sorted(w.transitions[from])
+}
+
+func sorted(set map[pbTask.Status]bool) []pbTask.Status {
+	result := make([]pbTask.Status, 0, len(set))
+	for status := range set {
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
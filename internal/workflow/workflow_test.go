@@ -0,0 +1,55 @@
+package workflow
+
+import (
+	"testing"
+
+	pbTask "github.com/0x726f6f6b6965/task/protos/task/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	w := Default()
+	assert.True(t, w.CanCreate(pbTask.Status_STATUS_INCOMPLETE))
+	assert.True(t, w.CanCreate(pbTask.Status_STATUS_COMPLETE))
+	assert.False(t, w.CanCreate(pbTask.Status_STATUS_ARCHIVED))
+	assert.Equal(t, []pbTask.Status{pbTask.Status_STATUS_INCOMPLETE, pbTask.Status_STATUS_COMPLETE,
+		pbTask.Status_STATUS_IN_PROGRESS, pbTask.Status_STATUS_BLOCKED}, w.Initial())
+
+	assert.True(t, w.CanTransition(pbTask.Status_STATUS_INCOMPLETE, pbTask.Status_STATUS_IN_PROGRESS))
+	assert.True(t, w.CanTransition(pbTask.Status_STATUS_COMPLETE, pbTask.Status_STATUS_INCOMPLETE))
+	assert.False(t, w.CanTransition(pbTask.Status_STATUS_BLOCKED, pbTask.Status_STATUS_COMPLETE))
+	assert.False(t, w.CanTransition(pbTask.Status_STATUS_ARCHIVED, pbTask.Status_STATUS_INCOMPLETE))
+	// staying is always allowed
+	assert.True(t, w.CanTransition(pbTask.Status_STATUS_ARCHIVED, pbTask.Status_STATUS_ARCHIVED))
+
+	assert.Equal(t, []pbTask.Status{pbTask.Status_STATUS_INCOMPLETE, pbTask.Status_STATUS_ARCHIVED},
+		w.Next(pbTask.Status_STATUS_COMPLETE))
+	assert.Empty(t, w.Next(pbTask.Status_STATUS_ARCHIVED))
+}
+
+func TestNew(t *testing.T) {
+	w, err := New([]string{"incomplete"}, map[string][]string{
+		"STATUS_INCOMPLETE": {"COMPLETE"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, w.CanCreate(pbTask.Status_STATUS_INCOMPLETE))
+	assert.False(t, w.CanCreate(pbTask.Status_STATUS_COMPLETE))
+	assert.True(t, w.CanTransition(pbTask.Status_STATUS_INCOMPLETE, pbTask.Status_STATUS_COMPLETE))
+	// a status without transitions is final
+	assert.False(t, w.CanTransition(pbTask.Status_STATUS_COMPLETE, pbTask.Status_STATUS_INCOMPLETE))
+
+	w, err = New(nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, w.CanTransition(pbTask.Status_STATUS_INCOMPLETE, pbTask.Status_STATUS_IN_PROGRESS))
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New([]string{"DONE"}, nil)
+	assert.Error(t, err)
+
+	_, err = New(nil, map[string][]string{"INCOMPLETE": {"COMPLETE"}})
+	assert.Error(t, err)
+
+	_, err = New([]string{"INCOMPLETE"}, map[string][]string{"INCOMPLETE": {"DONE"}})
+	assert.Error(t, err)
+}